@@ -4,10 +4,10 @@ import (
 	"context"
 
 	"github.com/labstack/echo/v4"
-	"github.com/stardustagi/TopLib/libs/databases"
 	"github.com/stardustagi/TopLib/libs/logs"
 	"github.com/stardustagi/TopLib/libs/server"
 	"github.com/stardustagi/TopLib/utils"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
 	"github.com/stardustagi/TopModelsLogs/models"
 	echoSwagger "github.com/swaggo/echo-swagger"
 	"go.uber.org/zap"
@@ -58,12 +58,13 @@ func (h *Application) AddGroup(group string, middleware ...echo.MiddlewareFunc)
 	h.b.AddGroup(group, middleware...)
 }
 
+// AddPostHandler 注册处理函数，调用前按标签校验权限（见 ScopeOf），分组需配置 LogUserAccess
 func (h *Application) AddPostHandler(group string, handler server.IHandler) {
-	h.b.AddPostHandler(group, handler)
+	h.b.AddPostHandler(group, scoped(handler))
 }
 
 func (h *Application) AddGetHandler(group string, handler server.IHandler) {
-	h.b.AddGetHandler(group, handler)
+	h.b.AddGetHandler(group, scoped(handler))
 }
 
 func (h *Application) AddNativeHandler(method, path string, handler echo.HandlerFunc) {
@@ -78,15 +79,16 @@ func (h *Application) syncDatabaseSchema() {
 		&models.StatusReport{},
 	}
 
-	dao := databases.GetDao()
-	session := dao.NewSession()
-	defer session.Close()
-
+	// 使用存储层的连接，sqlite 模式下没有 databases 连接
+	engine := storage.GetEngine()
 	for _, model := range modelList {
-		err := session.Native().Sync2(model)
+		err := engine.Sync2(model)
 		if err != nil {
 			h.logger.Error("Sync database schema failed", zap.Error(err), zap.Any("model", model))
 		}
 	}
+	if err := storage.WidenColumns(); err != nil {
+		h.logger.Error("Widen log columns failed", zap.Error(err))
+	}
 	h.logger.Info("Database schema synced successfully")
 }
@@ -0,0 +1,145 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopLib/libs/logs"
+	"github.com/stardustagi/TopModelsLogs/backend/metrics"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"go.uber.org/zap"
+)
+
+// 访问审计：开启 [storage.audit] 后，除写入日志外的每次接口调用（列表、详情、检索、统计与管理操作，含因权限不足被拒绝的调用）
+// 都在 audit_event 表中追加一条记录，包含调用方、接口、请求参数、结果条数、错误码与客户端 IP。
+// 写入审计记录失败不影响接口返回，以 audit_write_errors 指标输出
+var (
+	auditEvents      = metrics.Counter("audit_events")
+	auditWriteErrors = metrics.Counter("audit_write_errors")
+)
+
+// errcodeHeadBytes 从响应开头解析错误码时保留的字节数
+const errcodeHeadBytes = 64
+
+type auditKey struct{}
+
+// auditRecord 处理函数填写的审计结果
+type auditRecord struct {
+	count int64
+}
+
+// AuditResult 记录本次请求返回或删除的记录数，未开启审计时忽略
+func AuditResult(c echo.Context, count int64) {
+	if record, ok := c.Request().Context().Value(auditKey{}).(*auditRecord); ok {
+		record.count = count
+	}
+}
+
+// audited 是否审计该权限的接口，写入日志的调用量大且不涉及读取，不审计
+func audited(scope string) bool {
+	return !strings.HasPrefix(scope, ActionIngest+":")
+}
+
+// audit 执行 serve 并追加审计记录
+func (h scopedHandler) audit(c echo.Context, p *Principal, audits *storage.AuditStore, serve echo.HandlerFunc) error {
+	start := time.Now()
+	req := c.Request()
+	filters := auditFilters(c, storage.GetConfig().Audit.MaxFiltersBytes)
+	record := &auditRecord{}
+	c.SetRequest(req.WithContext(context.WithValue(req.Context(), auditKey{}, record)))
+	head := &headWriter{ResponseWriter: c.Response().Writer}
+	c.Response().Writer = head
+
+	err := serve(c)
+
+	event := &models.AuditEvent{
+		UserId:      p.UserId,
+		KeyId:       p.KeyId,
+		Action:      h.GetName(),
+		Scope:       h.scope,
+		Filters:     filters,
+		ResultCount: record.count,
+		ErrCode:     errcodeOf(head.head),
+		HttpStatus:  c.Response().Status,
+		ClientIp:    clientIP(c),
+		UserAgent:   truncateUTF8(req.UserAgent(), 255),
+		DurationMs:  time.Since(start).Milliseconds(),
+		CreatedAt:   start.Unix(),
+	}
+	if err != nil && !c.Response().Committed {
+		event.HttpStatus = http.StatusInternalServerError
+		if he, ok := err.(*echo.HTTPError); ok {
+			event.HttpStatus = he.Code
+		}
+	}
+	// 请求取消后仍然记录
+	if appendErr := audits.Append(context.WithoutCancel(req.Context()), event); appendErr != nil {
+		auditWriteErrors.Add(1)
+		logs.Error("写入审计记录失败", zap.String("action", event.Action), zap.Int64("userId", event.UserId), zap.Error(appendErr))
+	} else {
+		auditEvents.Add(1)
+	}
+	return err
+}
+
+// auditFilters 读取请求参数并恢复请求体，JSON 压缩为一行，超过 limit 时截断
+func auditFilters(c echo.Context, limit int) string {
+	req := c.Request()
+	if req.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return ""
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	var compact bytes.Buffer
+	if json.Compact(&compact, body) == nil {
+		body = compact.Bytes()
+	}
+	return truncateUTF8(string(body), limit)
+}
+
+// truncateUTF8 截断到 limit 字节以内，不拆开多字节字符
+func truncateUTF8(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return strings.ToValidUTF8(s[:limit], "")
+}
+
+// errcodeOf 从响应开头解析 errcode，响应不是以 errcode 开头的 JSON 对象时返回 0
+func errcodeOf(head []byte) int {
+	decoder := json.NewDecoder(bytes.NewReader(head))
+	if tok, err := decoder.Token(); err != nil || tok != json.Delim('{') {
+		return 0
+	}
+	if tok, err := decoder.Token(); err != nil || tok != "errcode" {
+		return 0
+	}
+	var code int
+	if err := decoder.Decode(&code); err != nil {
+		return 0
+	}
+	return code
+}
+
+// headWriter 保留响应开头的若干字节
+type headWriter struct {
+	http.ResponseWriter
+	head []byte
+}
+
+func (w *headWriter) Write(b []byte) (int, error) {
+	if n := errcodeHeadBytes - len(w.head); n > 0 {
+		w.head = append(w.head, b[:min(n, len(b))]...)
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,269 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopLib/libs/server"
+	"github.com/stardustagi/TopLib/utils"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/constants"
+)
+
+// 接口权限：处理函数的标签中，动作标签（ingest / read / stats / admin）与日志类型标签（api / training / call）
+// 组成所需的权限，如 ingest:call、read:api、stats:call；stats 为统计、取值分布与时间分布等聚合接口，read 权限包含 stats。
+// admin 标签与管理操作标签（retention / spool / tenants / keys / rbac / audit / quota / chain / metrics）组成 admin:retention 等权限，
+// 没有管理操作标签或没有动作标签的处理函数需要 admin 权限。
+// 授予的权限支持通配：* 为全部权限，admin 为全部管理操作，read:* 为读取全部日志类型。
+// 查询审计记录的 admin:audit 只授予审计员，admin 与 admin:* 不包含该权限。
+// self 标签的处理函数（如查询自己的用量）对全部已认证的调用方开放，由处理函数限定为调用方自己的数据
+const (
+	ActionIngest = "ingest"
+	ActionRead   = "read"
+	ActionStats  = "stats"
+	ActionAdmin  = "admin"
+
+	ScopeAll   = "*"
+	ScopeAdmin = ActionAdmin
+	ScopeAudit = ScopeAdmin + ":audit"
+	ScopeQuota = ScopeAdmin + ":quota"
+	ScopeSelf  = "self"
+)
+
+var (
+	scopeActions   = []string{ActionIngest, ActionRead, ActionStats, ActionAdmin}
+	scopeResources = []string{"api", "training", "call"}
+	adminResources = []string{"retention", "spool", "tenants", "keys", "rbac", "audit", "quota", "chain", "metrics"}
+)
+
+// AuthConfig [auth] 日志接口认证配置
+type AuthConfig struct {
+	Enabled    bool     `json:"enabled"`     // 关闭时所有请求拥有全部权限，只用于单机调试
+	UserScopes []string `json:"user_scopes"` // JWT 用户的权限，默认 read:*
+	AdminUsers []int64  `json:"admin_users"` // 拥有全部权限的用户
+
+	// TrustedProxies 可信反向代理的网段，只有来自这些地址的 X-Forwarded-For 才被采信；
+	// 为空时以 TCP 连接的对端地址为客户端 IP
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	KeyCacheTTL  string `json:"key_cache_ttl"`  // 服务密钥在 Redis 中的缓存时间，默认 5m
+	RoleCacheTTL string `json:"role_cache_ttl"` // 用户角色权限在 Redis 中的缓存时间，默认 5m
+
+	NodeSigning NodeSigningConfig `json:"node_signing"`
+	RateLimit   RateLimitConfig   `json:"rate_limit"`
+}
+
+var authConfig = &AuthConfig{Enabled: true, UserScopes: []string{"read:*"}, KeyCacheTTL: "5m", RoleCacheTTL: "5m",
+	NodeSigning: NodeSigningConfig{MaxSkew: "5m"}}
+
+// InitAuth 解析 [auth] 配置，未配置时开启认证并使用默认权限
+func InitAuth(configBytes []byte) error {
+	if len(configBytes) == 0 {
+		return nil
+	}
+	config, err := utils.Bytes2Struct[*AuthConfig](configBytes)
+	if err != nil {
+		return err
+	}
+	if len(config.UserScopes) == 0 {
+		config.UserScopes = []string{"read:*"}
+	}
+	if config.KeyCacheTTL == "" {
+		config.KeyCacheTTL = "5m"
+	}
+	if config.RoleCacheTTL == "" {
+		config.RoleCacheTTL = "5m"
+	}
+	if err = initNodeSigning(&config.NodeSigning); err != nil {
+		return err
+	}
+	if err = initRateLimit(&config.RateLimit); err != nil {
+		return err
+	}
+	if clientIPExtractor, err = trustedProxyExtractor(config.TrustedProxies); err != nil {
+		return err
+	}
+	authConfig = config
+	return nil
+}
+
+// clientIPExtractor 取客户端 IP，用于服务密钥的 IP 白名单与审计记录
+var clientIPExtractor = echo.ExtractIPDirect()
+
+// trustedProxyExtractor 只采信可信代理转发的 X-Forwarded-For，关闭 echo 默认对内网与回环地址的信任
+func trustedProxyExtractor(proxies []string) (echo.IPExtractor, error) {
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range proxies {
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth.trusted_proxies entry %q: %w", proxy, err)
+		}
+		options = append(options, echo.TrustIPRange(network))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+// clientIP 请求的客户端 IP，不直接使用 c.RealIP()，避免伪造的 X-Forwarded-For 绕过白名单
+func clientIP(c echo.Context) string {
+	return clientIPExtractor(c.Request())
+}
+
+// Principal 通过认证的调用方，服务密钥调用时 UserId 为密钥所属用户
+type Principal struct {
+	UserId int64
+	KeyId  string // 服务密钥标识，JWT 用户为空
+	Scopes []string
+	Grants []RoleGrant // 用户各角色的授权，用于确定返回结果中隐藏的列
+}
+
+// MasksFor 调用需要 scope 权限的接口时隐藏的列：授予该权限的各角色都隐藏的列，没有角色授权时不隐藏
+func (p *Principal) MasksFor(scope string) []string {
+	var masks []string
+	granted := false
+	for _, g := range p.Grants {
+		if !(&Principal{Scopes: g.Scopes}).Allowed(scope) {
+			continue
+		}
+		if !granted {
+			masks, granted = slices.Clone(g.Masks), true
+			continue
+		}
+		masks = slices.DeleteFunc(masks, func(field string) bool { return !slices.Contains(g.Masks, field) })
+	}
+	return masks
+}
+
+// Allowed 是否拥有 scope 权限
+func (p *Principal) Allowed(scope string) bool {
+	if scope == ScopeSelf {
+		return true
+	}
+	for _, granted := range p.Scopes {
+		if grants(granted, scope) {
+			return true
+		}
+	}
+	// 读取权限包含同一日志类型的统计权限
+	if resource, ok := strings.CutPrefix(scope, ActionStats+":"); ok {
+		return p.Allowed(ActionRead + ":" + resource)
+	}
+	return false
+}
+
+func grants(granted, scope string) bool {
+	if granted == ScopeAll || granted == scope {
+		return true
+	}
+	if scope == ScopeAudit {
+		return false
+	}
+	if action, ok := strings.CutSuffix(granted, ":*"); ok && strings.HasPrefix(scope, action+":") {
+		return true
+	}
+	return granted == ScopeAdmin && strings.HasPrefix(scope, ScopeAdmin+":")
+}
+
+// Admin 是否拥有 admin 权限
+func (p *Principal) Admin() bool {
+	return p.Allowed(ScopeAdmin)
+}
+
+type principalKey struct{}
+
+// WithPrincipal 在 ctx 中记录调用方
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom 获取 ctx 中的调用方，未经认证时返回 nil
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// ScopeOf 按处理函数的标签确定所需权限
+func ScopeOf(tags []string) string {
+	if slices.Contains(tags, ScopeSelf) {
+		return ScopeSelf
+	}
+	action, resource, operation := "", "", ""
+	for _, tag := range tags {
+		if action == "" && slices.Contains(scopeActions, tag) {
+			action = tag
+		}
+		if resource == "" && slices.Contains(scopeResources, tag) {
+			resource = tag
+		}
+		if operation == "" && slices.Contains(adminResources, tag) {
+			operation = tag
+		}
+	}
+	if action == ActionAdmin && operation != "" {
+		return ScopeAdmin + ":" + operation
+	}
+	if action == "" || action == ActionAdmin || resource == "" {
+		return ScopeAdmin
+	}
+	return action + ":" + resource
+}
+
+// scopedHandler 执行处理函数前校验调用方是否拥有标签对应的权限
+type scopedHandler struct {
+	server.IHandler
+	scope string
+}
+
+func scoped(h server.IHandler) server.IHandler {
+	return scopedHandler{IHandler: h, scope: ScopeOf(h.GetTags())}
+}
+
+func (h scopedHandler) GetFunc() func(echo.Context) error {
+	next := h.IHandler.GetFunc()
+	return func(c echo.Context) error {
+		p := PrincipalFrom(c.Request().Context())
+		if p == nil {
+			return c.JSON(401, map[string]interface{}{
+				"errcode": 2,
+				"errmsg":  "缺少认证信息",
+			})
+		}
+		if audits := storage.GetAuditStore(); audits != nil && audited(h.scope) {
+			return h.audit(c, p, audits, func(c echo.Context) error { return h.serve(c, p, next) })
+		}
+		return h.serve(c, p, next)
+	}
+}
+
+// serve 校验权限与限流后执行处理函数
+func (h scopedHandler) serve(c echo.Context, p *Principal, next echo.HandlerFunc) error {
+	if !p.Allowed(h.scope) {
+		return c.JSON(403, map[string]interface{}{
+			"errcode": constants.ErrPermissionDenied.Code(),
+			"errmsg":  constants.ErrPermissionDenied.Msg() + ": " + h.scope,
+		})
+	}
+	// 读取与统计按调用方的用户隔离，未绑定用户的非管理员调用方没有可读的日志
+	if readScope(h.scope) && p.UserId == 0 && !p.Admin() {
+		return c.JSON(403, map[string]interface{}{
+			"errcode": constants.ErrPermissionDenied.Code(),
+			"errmsg":  constants.ErrPermissionDenied.Msg() + ": 调用方未绑定用户",
+		})
+	}
+	if limited := limitScope(c.Request().Context(), p, h.scope); limited != nil {
+		return RejectLimited(c, limited)
+	}
+	c.SetRequest(c.Request().WithContext(storage.WithMasks(c.Request().Context(), p.MasksFor(h.scope))))
+	return next(c)
+}
+
+// readScope 是否为读取或统计日志的权限
+func readScope(scope string) bool {
+	return strings.HasPrefix(scope, ActionRead+":") || strings.HasPrefix(scope, ActionStats+":")
+}
@@ -0,0 +1,208 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stardustagi/TopLib/libs/logs"
+	"github.com/stardustagi/TopLib/libs/redis"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/constants"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"go.uber.org/zap"
+)
+
+// HeaderApiKey 服务密钥请求头，带此请求头时不再校验 JWT
+const HeaderApiKey = "X-Api-Key"
+
+const (
+	apiKeyPrefix   = "tml"
+	apiKeyCacheKey = "apikey:%s"
+	// apiKeyMissing 缓存不存在的密钥标识，避免伪造的密钥反复查库
+	apiKeyMissing    = "null"
+	apiKeyMissingTTL = "1m"
+)
+
+// 服务密钥只允许上报、读取与统计，不能拥有 admin 权限
+var keyActions = []string{ActionIngest, ActionRead, ActionStats}
+
+var (
+	errKeyInvalid   = errors.New("密钥无效")
+	errKeyRevoked   = errors.New("密钥已吊销")
+	errKeyExpired   = errors.New("密钥已过期")
+	errKeyIpBlocked = errors.New("来源IP不在密钥允许范围内")
+	// errKeyUnavailable 查库失败，调用方可重试
+	errKeyUnavailable = errors.New("密钥校验暂不可用")
+)
+
+var (
+	authCache     redis.RedisCli
+	authCacheOnce sync.Once
+)
+
+// authRedis 密钥与角色权限缓存，首次使用时创建，Redis 在注册路由前初始化
+func authRedis() redis.RedisCli {
+	authCacheOnce.Do(func() {
+		authCache = redis.NewRedisView(redis.GetRedisDb(), constants.ApplicationPrefix, logs.GetLogger("AuthRedis"))
+	})
+	return authCache
+}
+
+// NewApiKey 生成密钥标识与明文密钥，明文只在创建与轮换时返回一次
+func NewApiKey(keyId string) (id, plaintext, hash string, err error) {
+	if keyId == "" {
+		raw := make([]byte, 8)
+		if _, err = rand.Read(raw); err != nil {
+			return "", "", "", err
+		}
+		keyId = hex.EncodeToString(raw)
+	}
+	secret := make([]byte, 32)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+	return keyId, fmt.Sprintf("%s_%s_%s", apiKeyPrefix, keyId, encoded), hashKeySecret(encoded), nil
+}
+
+// hashKeySecret secret 为 32 字节随机数，SHA-256 即可防止库表泄露后还原密钥
+func hashKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseApiKey 拆分明文密钥为密钥标识与 secret
+func parseApiKey(plaintext string) (keyId, secret string, ok bool) {
+	parts := strings.SplitN(plaintext, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// ValidateKeyScopes 校验授予密钥的权限：ingest、read 或 stats 加日志类型，日志类型可为 *
+func ValidateKeyScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("scopes is required")
+	}
+	for _, scope := range scopes {
+		action, resource, _ := strings.Cut(scope, ":")
+		if !slices.Contains(keyActions, action) || (resource != "*" && !slices.Contains(scopeResources, resource)) {
+			return fmt.Errorf("invalid key scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// ValidateKeyIps 校验允许的来源，每项为 IP 或 CIDR
+func ValidateKeyIps(ips []string) error {
+	for _, ip := range ips {
+		if net.ParseIP(ip) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(ip); err != nil {
+			return fmt.Errorf("invalid ip or cidr %q", ip)
+		}
+	}
+	return nil
+}
+
+// ForgetApiKey 轮换、吊销后删除缓存，使变更立即生效
+func ForgetApiKey(ctx context.Context, keyId string) {
+	if _, err := authRedis().Del(ctx, fmt.Sprintf(apiKeyCacheKey, keyId)); err != nil {
+		logs.GetLogger("ApiKey").Warn("删除密钥缓存失败", zap.String("keyId", keyId), zap.Error(err))
+	}
+}
+
+// keyPrincipal 校验明文密钥与来源IP，返回密钥的调用方
+func keyPrincipal(ctx context.Context, plaintext, clientIp string) (*Principal, error) {
+	keyId, secret, ok := parseApiKey(plaintext)
+	if !ok {
+		return nil, errKeyInvalid
+	}
+	key, err := lookupApiKey(ctx, keyId)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	hash := []byte(hashKeySecret(secret))
+	if subtle.ConstantTimeCompare(hash, []byte(key.SecretHash)) != 1 &&
+		(key.PrevExpiresAt <= now || subtle.ConstantTimeCompare(hash, []byte(key.PrevSecretHash)) != 1) {
+		return nil, errKeyInvalid
+	}
+	if key.RevokedAt > 0 {
+		return nil, errKeyRevoked
+	}
+	if key.ExpiresAt > 0 && key.ExpiresAt <= now {
+		return nil, errKeyExpired
+	}
+	if !ipAllowed(key.IpList(), clientIp) {
+		return nil, errKeyIpBlocked
+	}
+	return &Principal{UserId: key.UserId, KeyId: key.KeyId, Scopes: key.ScopeList()}, nil
+}
+
+// lookupApiKey 先查 Redis 缓存，未命中时查库并回写，Redis 不可用时直接查库
+func lookupApiKey(ctx context.Context, keyId string) (*models.ApiKey, error) {
+	cacheKey := fmt.Sprintf(apiKeyCacheKey, keyId)
+	if raw, err := authRedis().Get(ctx, cacheKey); err == nil && len(raw) > 0 {
+		if string(raw) == apiKeyMissing {
+			return nil, errKeyInvalid
+		}
+		key := &models.ApiKey{}
+		if err = json.Unmarshal(raw, key); err == nil {
+			return key, nil
+		}
+	}
+	keys := storage.GetKeyStore()
+	if keys == nil {
+		return nil, errKeyInvalid
+	}
+	key, err := keys.Get(ctx, keyId)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		_ = authRedis().Set(ctx, cacheKey, []byte(apiKeyMissing), apiKeyMissingTTL)
+		return nil, errKeyInvalid
+	}
+	if err != nil {
+		logs.GetLogger("ApiKey").Error("查询服务密钥失败", zap.String("keyId", keyId), zap.Error(err))
+		return nil, errKeyUnavailable
+	}
+	if raw, err := json.Marshal(key); err == nil {
+		_ = authRedis().Set(ctx, cacheKey, raw, authConfig.KeyCacheTTL)
+	}
+	return key, nil
+}
+
+func ipAllowed(allowed []string, clientIp string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	ip := net.ParseIP(clientIp)
+	if ip == nil {
+		return false
+	}
+	for _, item := range allowed {
+		if _, network, err := net.ParseCIDR(item); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if allowedIp := net.ParseIP(item); allowedIp != nil && allowedIp.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
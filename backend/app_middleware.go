@@ -2,6 +2,8 @@ package backend
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"strconv"
 
@@ -9,57 +11,137 @@ import (
 	"github.com/stardustagi/TopLib/libs/jwt"
 	"github.com/stardustagi/TopLib/libs/logs"
 	"github.com/stardustagi/TopLib/libs/redis"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
 	"github.com/stardustagi/TopModelsLogs/constants"
 	"go.uber.org/zap"
 )
 
-// LogUserAccess 日志服务用户访问中间件
+// LogUserAccess 日志服务用户访问中间件，校验服务密钥（X-Api-Key）或 jwt 与 id 请求头并记录调用方，
+// 缺少认证信息时拒绝访问
 func LogUserAccess() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			jwtstr := c.Request().Header.Get("jwt")
-			UserId := c.Request().Header.Get("id")
-			secret := fmt.Sprintf("%s-%s-%s", constants.AppName, constants.AppVersion, UserId)
-			if jwtstr != "" {
-				jwtobj, ok := jwt.JWTDecrypt(jwtstr, secret)
-				if !ok || jwtobj == nil || jwtobj["token"] == nil || jwtobj["id"] == nil {
-					return c.JSON(401, map[string]interface{}{
-						"errcode": 2,
-						"errmsg":  "jwt解析错误",
-					})
-				}
-
-				id, ok := jwtobj["id"].(string)
-				if !ok {
-					return c.JSON(401, map[string]interface{}{
-						"errcode": 2,
-						"errmsg":  "用户信息获取失败",
-					})
-				}
-				intId, err := strconv.ParseInt(id, 10, 64)
+			if !authConfig.Enabled {
+				return next(withPrincipal(c, &Principal{Scopes: []string{ScopeAll}}))
+			}
+			if key := c.Request().Header.Get(HeaderApiKey); key != "" {
+				p, err := keyPrincipal(c.Request().Context(), key, clientIP(c))
 				if err != nil {
-					return c.JSON(401, map[string]interface{}{
-						"errcode": 2,
-						"errmsg":  "用户信息获取失败",
-					})
-				}
-				tokenKey := fmt.Sprintf("%s:%s:user:%s", constants.AppName, constants.AppVersion, constants.LogUserTokenKey(intId))
-				logs.Info("redis key is:", zap.String("tokenKey", tokenKey))
-				redisCmd := redis.GetRedisDb()
-				oldToken, err1 := redisCmd.Get(context.Background(), tokenKey).Result()
-				if err1 != nil {
-					return c.JSON(401, map[string]interface{}{
+					logs.Warn("服务密钥认证失败", zap.String("ip", clientIP(c)), zap.Error(err))
+					status := 401
+					if errors.Is(err, errKeyUnavailable) {
+						status = 503
+					}
+					return c.JSON(status, map[string]interface{}{
 						"errcode": 2,
-						"errmsg":  "获取token失败",
+						"errmsg":  err.Error(),
 					})
 				}
-				if jwtobj["token"] != oldToken {
-					return c.JSON(401, map[string]interface{}{
-						"errcode": 2,
-						"errmsg":  "token不匹配",
-					})
+				return next(withPrincipal(c, p))
+			}
+			jwtstr := c.Request().Header.Get("jwt")
+			UserId := c.Request().Header.Get("id")
+			secret := fmt.Sprintf("%s-%s-%s", constants.AppName, constants.AppVersion, UserId)
+			if jwtstr == "" {
+				return c.JSON(401, map[string]interface{}{
+					"errcode": 2,
+					"errmsg":  "缺少认证信息",
+				})
+			}
+			jwtobj, ok := jwt.JWTDecrypt(jwtstr, secret)
+			if !ok || jwtobj == nil || jwtobj["token"] == nil || jwtobj["id"] == nil {
+				return c.JSON(401, map[string]interface{}{
+					"errcode": 2,
+					"errmsg":  "jwt解析错误",
+				})
+			}
+
+			id, ok := jwtobj["id"].(string)
+			if !ok {
+				return c.JSON(401, map[string]interface{}{
+					"errcode": 2,
+					"errmsg":  "用户信息获取失败",
+				})
+			}
+			intId, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				return c.JSON(401, map[string]interface{}{
+					"errcode": 2,
+					"errmsg":  "用户信息获取失败",
+				})
+			}
+			tokenKey := fmt.Sprintf("%s:%s:user:%s", constants.AppName, constants.AppVersion, constants.LogUserTokenKey(intId))
+			logs.Info("redis key is:", zap.String("tokenKey", tokenKey))
+			redisCmd := redis.GetRedisDb()
+			oldToken, err1 := redisCmd.Get(context.Background(), tokenKey).Result()
+			if err1 != nil {
+				return c.JSON(401, map[string]interface{}{
+					"errcode": 2,
+					"errmsg":  "获取token失败",
+				})
+			}
+			if jwtobj["token"] != oldToken {
+				return c.JSON(401, map[string]interface{}{
+					"errcode": 2,
+					"errmsg":  "token不匹配",
+				})
+			}
+			p, err := userPrincipal(c.Request().Context(), intId)
+			if err != nil {
+				return c.JSON(503, map[string]interface{}{
+					"errcode": 2,
+					"errmsg":  err.Error(),
+				})
+			}
+			c.Request().Header.Set("id", id)
+			c = withPrincipal(c, p)
+			return next(c)
+		}
+	}
+}
+
+// withPrincipal 在请求 ctx 中记录调用方，需要隐藏的列在校验接口权限时按接口确定
+func withPrincipal(c echo.Context, p *Principal) echo.Context {
+	req := c.Request()
+	c.SetRequest(req.WithContext(WithPrincipal(req.Context(), p)))
+	return c
+}
+
+// HeaderAdminToken 与 [storage.guard] 的 admin_token 相同时本次请求按管理员上限查询
+const HeaderAdminToken = "X-Admin-Token"
+
+// QueryGuard 选择查询护栏的上限，拥有 admin 权限的调用方或请求头带管理员令牌时按管理员上限查询
+func QueryGuard() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if p := PrincipalFrom(c.Request().Context()); p != nil && p.Admin() {
+				req := c.Request()
+				c.SetRequest(req.WithContext(storage.WithAdminLimits(req.Context())))
+				return next(c)
+			}
+			token := c.Request().Header.Get(HeaderAdminToken)
+			if token != "" && storage.GetConfig() != nil {
+				expected := storage.GetConfig().Guard.AdminToken
+				if expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+					req := c.Request()
+					c.SetRequest(req.WithContext(storage.WithAdminLimits(req.Context())))
 				}
-				c.Request().Header.Set("id", id)
+			}
+			return next(c)
+		}
+	}
+}
+
+// HeaderReadPrimary 请求头为 true 时本次请求的查询读主库，用于写后立即读
+const HeaderReadPrimary = "X-Read-Primary"
+
+// ReadPreference 按请求头选择查询使用主库还是从库
+func ReadPreference() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if primary, _ := strconv.ParseBool(c.Request().Header.Get(HeaderReadPrimary)); primary {
+				req := c.Request()
+				c.SetRequest(req.WithContext(storage.WithPrimary(req.Context())))
 			}
 			return next(c)
 		}
@@ -0,0 +1,180 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopLib/libs/logs"
+	"github.com/stardustagi/TopModelsLogs/constants"
+	"go.uber.org/zap"
+)
+
+// 节点签名：LLM 代理节点上报日志时用各自的共享密钥对请求签名，
+// 签名内容为 "<method>\n<path>\n<timestamp>\n<nonce>\n<body 的 SHA-256 十六进制>" 的 HMAC-SHA256 十六进制。
+// 时间戳与服务端相差超过 max_skew 或 nonce 在有效期内重复使用的请求被拒绝，nonce 记录在 Redis 中
+const (
+	HeaderNodeId        = "X-Node-Id"
+	HeaderNodeTimestamp = "X-Node-Timestamp"
+	HeaderNodeNonce     = "X-Node-Nonce"
+	HeaderNodeSignature = "X-Node-Signature"
+
+	nodeNonceKey = "node:nonce:%s:%s"
+	maxNonceLen  = 64
+)
+
+// NodeSigningConfig [auth.node_signing] 节点签名配置
+type NodeSigningConfig struct {
+	Enabled  bool         `json:"enabled"`
+	Required bool         `json:"required"` // 模型调用日志必须由节点签名上报，关闭时未签名的请求照常写入
+	MaxSkew  string       `json:"max_skew"` // 允许的时间戳偏差，默认 5m，nonce 保留两倍时长
+	Nodes    []NodeSecret `json:"nodes"`
+}
+
+// NodeSecret 节点的共享密钥
+type NodeSecret struct {
+	Id     string `json:"id"`
+	Secret string `json:"secret"`
+	Addr   string `json:"addr"` // 节点地址，配置后覆盖上报的 node_addr
+}
+
+var (
+	errNodeUnknown   = errors.New("未知的节点")
+	errNodeSignature = errors.New("节点签名无效")
+	errNodeExpired   = errors.New("签名时间戳超出允许范围")
+	errNodeReplayed  = errors.New("重复的签名请求")
+	// errNodeUnavailable 无法记录 nonce，拒绝请求以免被重放，调用方可重试
+	errNodeUnavailable = errors.New("节点签名校验暂不可用")
+)
+
+// initNodeSigning 校验节点签名配置并填充默认值
+func initNodeSigning(config *NodeSigningConfig) error {
+	if config.MaxSkew == "" {
+		config.MaxSkew = "5m"
+	}
+	if _, err := time.ParseDuration(config.MaxSkew); err != nil {
+		return fmt.Errorf("invalid node_signing.max_skew: %w", err)
+	}
+	seen := make(map[string]bool, len(config.Nodes))
+	for _, node := range config.Nodes {
+		if node.Id == "" || node.Secret == "" {
+			return errors.New("node_signing.nodes requires id and secret")
+		}
+		if seen[node.Id] {
+			return fmt.Errorf("duplicate node_signing node %q", node.Id)
+		}
+		seen[node.Id] = true
+	}
+	return nil
+}
+
+// NodeSigningRequired 是否要求模型调用日志由节点签名上报
+func NodeSigningRequired() bool {
+	return authConfig.NodeSigning.Enabled && authConfig.NodeSigning.Required
+}
+
+// VerifiedNode 通过签名校验的节点
+type VerifiedNode struct {
+	Id   string
+	Addr string
+}
+
+type nodeKey struct{}
+
+// NodeFrom 获取 ctx 中通过签名校验的节点，未签名时返回 nil
+func NodeFrom(ctx context.Context) *VerifiedNode {
+	node, _ := ctx.Value(nodeKey{}).(*VerifiedNode)
+	return node
+}
+
+// NodeSignature 校验带 X-Node-Id 请求头的请求签名并记录节点，未带签名的请求交由处理函数决定是否接受
+func NodeSignature() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			nodeId := c.Request().Header.Get(HeaderNodeId)
+			if !authConfig.NodeSigning.Enabled || nodeId == "" {
+				return next(c)
+			}
+			node, err := verifyNode(c, nodeId)
+			if err != nil {
+				logs.Warn("节点签名校验失败", zap.String("nodeId", nodeId), zap.String("ip", clientIP(c)), zap.Error(err))
+				status := 401
+				if errors.Is(err, errNodeUnavailable) {
+					status = 503
+				}
+				return c.JSON(status, map[string]interface{}{
+					"errcode": constants.ErrAuthFailed.Code(),
+					"errmsg":  err.Error(),
+				})
+			}
+			req := c.Request()
+			c.SetRequest(req.WithContext(context.WithValue(req.Context(), nodeKey{}, node)))
+			return next(c)
+		}
+	}
+}
+
+func verifyNode(c echo.Context, nodeId string) (*VerifiedNode, error) {
+	config := authConfig.NodeSigning
+	var node *NodeSecret
+	for i := range config.Nodes {
+		if config.Nodes[i].Id == nodeId {
+			node = &config.Nodes[i]
+			break
+		}
+	}
+	if node == nil {
+		return nil, errNodeUnknown
+	}
+
+	header := c.Request().Header
+	timestamp, nonce := header.Get(HeaderNodeTimestamp), header.Get(HeaderNodeNonce)
+	signature, err := hex.DecodeString(header.Get(HeaderNodeSignature))
+	if err != nil || len(signature) == 0 || nonce == "" || len(nonce) > maxNonceLen {
+		return nil, errNodeSignature
+	}
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return nil, errNodeSignature
+	}
+	c.Request().Body = io.NopCloser(bytes.NewReader(body))
+	expected := SignNodeRequest(node.Secret, c.Request().Method, c.Request().URL.Path, timestamp, nonce, body)
+	if !hmac.Equal(signature, expected) {
+		return nil, errNodeSignature
+	}
+
+	// 签名通过后再校验时间戳与 nonce，避免未签名的请求占用 nonce
+	skew, _ := time.ParseDuration(config.MaxSkew)
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errNodeExpired
+	}
+	if diff := time.Since(time.Unix(signedAt, 0)); diff > skew || diff < -skew {
+		return nil, errNodeExpired
+	}
+	fresh, err := authRedis().SetNX(c.Request().Context(), fmt.Sprintf(nodeNonceKey, nodeId, nonce), []byte(timestamp), (2 * skew).String())
+	if err != nil {
+		logs.Error("记录节点签名 nonce 失败", zap.String("nodeId", nodeId), zap.Error(err))
+		return nil, errNodeUnavailable
+	}
+	if !fresh {
+		return nil, errNodeReplayed
+	}
+	return &VerifiedNode{Id: node.Id, Addr: node.Addr}, nil
+}
+
+// SignNodeRequest 计算节点请求签名，节点侧按相同方式生成 X-Node-Signature
+func SignNodeRequest(secret, method, path, timestamp, nonce string, body []byte) []byte {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + path + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(sum[:])))
+	return mac.Sum(nil)
+}
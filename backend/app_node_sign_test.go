@@ -0,0 +1,153 @@
+package backend
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopLib/libs/logs"
+	"github.com/stardustagi/TopLib/libs/redis"
+	"github.com/stardustagi/TopModelsLogs/constants"
+)
+
+const testNodePath = "/log/createModelsCallLog"
+
+// withNodeSigning 开启节点签名并以 miniredis 记录 nonce，测试结束后恢复配置
+func withNodeSigning(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	if _, err := redis.Init([]byte(`{"addrs":["` + mr.Addr() + `"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	// authRedis 只创建一次，指向本次的 miniredis
+	authCache = redis.NewRedisView(redis.GetRedisDb(), constants.ApplicationPrefix, logs.GetLogger("AuthRedis"))
+	authCacheOnce.Do(func() {})
+	saved := authConfig
+	authConfig = &AuthConfig{NodeSigning: NodeSigningConfig{
+		Enabled: true,
+		MaxSkew: "5m",
+		Nodes:   []NodeSecret{{Id: "node-1", Secret: "s3cret", Addr: "10.0.0.1:8080"}},
+	}}
+	t.Cleanup(func() { authConfig = saved })
+	return mr
+}
+
+// nodeRequest 以 secret 签名的上报请求，signedBody 为签名时的请求体
+func nodeRequest(secret, body, signedBody string, signedAt time.Time, nonce string) *http.Request {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, testNodePath, strings.NewReader(body))
+	req.Header.Set(HeaderNodeId, "node-1")
+	req.Header.Set(HeaderNodeTimestamp, timestamp)
+	req.Header.Set(HeaderNodeNonce, nonce)
+	req.Header.Set(HeaderNodeSignature, hex.EncodeToString(
+		SignNodeRequest(secret, http.MethodPost, testNodePath, timestamp, nonce, []byte(signedBody))))
+	return req
+}
+
+// serveNode 经过签名中间件处理请求，返回状态码、错误码与处理函数看到的节点和请求体
+func serveNode(t *testing.T, req *http.Request) (status, errcode int, node *VerifiedNode, body string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	err := NodeSignature()(func(c echo.Context) error {
+		node = NodeFrom(c.Request().Context())
+		raw, err := io.ReadAll(c.Request().Body)
+		body = string(raw)
+		return err
+	})(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		var resp struct {
+			Errcode int `json:"errcode"`
+		}
+		if err = json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		errcode = resp.Errcode
+	}
+	return rec.Code, errcode, node, body
+}
+
+func TestNodeSignatureValid(t *testing.T) {
+	withNodeSigning(t)
+	body := `{"trace_id":"t1"}`
+	status, _, node, seen := serveNode(t, nodeRequest("s3cret", body, body, time.Now(), "n-valid"))
+	if status != http.StatusOK || node == nil {
+		t.Fatalf("status %d, node %v", status, node)
+	}
+	if node.Id != "node-1" || node.Addr != "10.0.0.1:8080" {
+		t.Errorf("node %+v", node)
+	}
+	if seen != body {
+		t.Errorf("handler read body %q, want %q", seen, body)
+	}
+
+	// 未带节点请求头的请求交由处理函数决定
+	status, _, node, _ = serveNode(t, httptest.NewRequest(http.MethodPost, testNodePath, strings.NewReader(body)))
+	if status != http.StatusOK || node != nil {
+		t.Errorf("unsigned: status %d, node %v", status, node)
+	}
+}
+
+func TestNodeSignatureRejected(t *testing.T) {
+	withNodeSigning(t)
+	body := `{"trace_id":"t1"}`
+	cases := []struct {
+		name   string
+		nodeId string
+		req    *http.Request
+		want   error
+	}{
+		{"tampered body", "node-1", nodeRequest("s3cret", `{"trace_id":"t2"}`, body, time.Now(), "n-tampered"), errNodeSignature},
+		{"wrong secret", "node-1", nodeRequest("other", body, body, time.Now(), "n-secret"), errNodeSignature},
+		{"expired timestamp", "node-1", nodeRequest("s3cret", body, body, time.Now().Add(-10*time.Minute), "n-old"), errNodeExpired},
+		{"future timestamp", "node-1", nodeRequest("s3cret", body, body, time.Now().Add(10*time.Minute), "n-future"), errNodeExpired},
+		{"unknown node", "node-9", nodeRequest("s3cret", body, body, time.Now(), "n-unknown"), errNodeUnknown},
+	}
+	for _, c := range cases {
+		ctx := echo.New().NewContext(c.req, httptest.NewRecorder())
+		if _, err := verifyNode(ctx, c.nodeId); !errors.Is(err, c.want) {
+			t.Errorf("%s: %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	status, errcode, node, _ := serveNode(t, nodeRequest("s3cret", "{}", body, time.Now(), "n-mw"))
+	if status != http.StatusUnauthorized || errcode != constants.ErrAuthFailed.Code() || node != nil {
+		t.Errorf("middleware: status %d, errcode %d, want 401 and %d", status, errcode, constants.ErrAuthFailed.Code())
+	}
+}
+
+func TestNodeSignatureReplay(t *testing.T) {
+	mr := withNodeSigning(t)
+	body := `{"trace_id":"t1"}`
+	signedAt := time.Now()
+	if status, _, _, _ := serveNode(t, nodeRequest("s3cret", body, body, signedAt, "n-once")); status != http.StatusOK {
+		t.Fatalf("first: status %d", status)
+	}
+	req := nodeRequest("s3cret", body, body, signedAt, "n-once")
+	if _, err := verifyNode(echo.New().NewContext(req, httptest.NewRecorder()), "node-1"); !errors.Is(err, errNodeReplayed) {
+		t.Errorf("replay: %v, want %v", err, errNodeReplayed)
+	}
+	// 同一时间戳换 nonce 可以通过
+	if status, _, _, _ := serveNode(t, nodeRequest("s3cret", body, body, signedAt, "n-twice")); status != http.StatusOK {
+		t.Errorf("new nonce: status %d", status)
+	}
+
+	// Redis 不可用时拒绝请求，避免被重放
+	mr.Close()
+	status, errcode, _, _ := serveNode(t, nodeRequest("s3cret", body, body, time.Now(), "n-down"))
+	if status != http.StatusServiceUnavailable || errcode != constants.ErrAuthFailed.Code() {
+		t.Errorf("redis down: status %d, errcode %d", status, errcode)
+	}
+}
@@ -0,0 +1,387 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	goredis "github.com/redis/go-redis/v9"
+	topError "github.com/stardustagi/TopLib/libs/errors"
+	"github.com/stardustagi/TopLib/libs/logs"
+	"github.com/stardustagi/TopLib/libs/redis"
+	"github.com/stardustagi/TopModelsLogs/backend/metrics"
+	"github.com/stardustagi/TopModelsLogs/constants"
+	"go.uber.org/zap"
+)
+
+// 限流与写入配额：按接口权限的动作（ingest / read / stats / admin）分组，每个调用方（服务密钥，或未使用密钥的用户）
+// 在每组有一个 Redis 令牌桶；模型调用日志另按 caller_key 限流。写入日志按归属用户（租户）统计每日条数与字节数，
+// 未指定归属用户（user_id 为 0）的写入按写入的服务密钥统计，字节数为写入的请求体、响应体与日志内容的长度。
+// 先计入再写库，写库失败时退还。超出时返回 429 与 Retry-After，Redis 不可用时不限流
+const (
+	rateBucketKey  = "ratelimit:%s:%s"
+	quotaCountKey  = "quota:{%s:%s}:%s" // 同一租户的条数与字节数在同一哈希槽
+	quotaDayLayout = "20060102"
+
+	rateGroupCallerKey = "caller_key"
+)
+
+// RateLimitConfig [auth.rate_limit] 限流与写入配额配置
+type RateLimitConfig struct {
+	Enabled   bool                    `json:"enabled"`
+	Groups    map[string]BucketConfig `json:"groups"`     // 按动作分组的令牌桶，未配置的分组不限流
+	CallerKey BucketConfig            `json:"caller_key"` // 模型调用日志按 caller_key 的令牌桶，rate 为 0 时不限流
+	Quota     QuotaConfig             `json:"quota"`
+}
+
+// BucketConfig 令牌桶，rate 为每秒补充的令牌数，burst 为桶容量，默认为 rate 向上取整
+type BucketConfig struct {
+	Rate  float64 `json:"rate"`
+	Burst int64   `json:"burst"`
+}
+
+// QuotaConfig 每个租户每天的写入上限，0 表示不限
+type QuotaConfig struct {
+	DailyRows  int64         `json:"daily_rows"`
+	DailyBytes int64         `json:"daily_bytes"`
+	Tenants    []TenantQuota `json:"tenants"` // 单独设置上限的租户
+}
+
+// TenantQuota 租户的每日写入上限，key_id 非空时为该服务密钥以 user_id 0 写入的上限
+type TenantQuota struct {
+	UserId     int64  `json:"user_id"`
+	KeyId      string `json:"key_id"`
+	DailyRows  int64  `json:"daily_rows"`
+	DailyBytes int64  `json:"daily_bytes"`
+}
+
+// LimitError 超出限流或配额，RetryAfter 后可重试
+type LimitError struct {
+	Err        *topError.StackError
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return e.Err.Msg() + ": " + e.Reason
+}
+
+var rateLimitErrors = metrics.Counter("rate_limit_errors")
+
+// bucketScript 令牌桶：按经过的时间补充令牌后取一个，返回 {是否允许, 需要等待的毫秒数}
+var bucketScript = goredis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+local allowed, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) * 1000 / rate)
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+return {allowed, wait}
+`)
+
+// quotaScript 条数与字节数都不超过上限时计入，返回是否计入
+var quotaScript = goredis.NewScript(`
+local rows = tonumber(redis.call('GET', KEYS[1]) or '0')
+local bytes = tonumber(redis.call('GET', KEYS[2]) or '0')
+local rowLimit, byteLimit = tonumber(ARGV[1]), tonumber(ARGV[2])
+if (rowLimit > 0 and rows + tonumber(ARGV[3]) > rowLimit) or (byteLimit > 0 and bytes + tonumber(ARGV[4]) > byteLimit) then
+	return 0
+end
+redis.call('INCRBY', KEYS[1], ARGV[3])
+redis.call('EXPIRE', KEYS[1], ARGV[5])
+redis.call('INCRBY', KEYS[2], ARGV[4])
+redis.call('EXPIRE', KEYS[2], ARGV[5])
+return 1
+`)
+
+// refundScript 退还一次计入的用量，计数不存在时不处理
+var refundScript = goredis.NewScript(`
+for i, key in ipairs(KEYS) do
+	if redis.call('EXISTS', key) == 1 then
+		redis.call('DECRBY', key, ARGV[i])
+	end
+end
+return 1
+`)
+
+// initRateLimit 校验限流配置并填充默认值
+func initRateLimit(config *RateLimitConfig) error {
+	for group, bucket := range config.Groups {
+		if !slices.Contains(scopeActions, group) {
+			return fmt.Errorf("unknown rate limit group %q", group)
+		}
+		if err := initBucket(&bucket); err != nil {
+			return fmt.Errorf("rate limit group %q: %w", group, err)
+		}
+		config.Groups[group] = bucket
+	}
+	if err := initBucket(&config.CallerKey); err != nil {
+		return fmt.Errorf("rate limit caller_key: %w", err)
+	}
+	return nil
+}
+
+func initBucket(bucket *BucketConfig) error {
+	if bucket.Rate < 0 || bucket.Burst < 0 {
+		return fmt.Errorf("rate and burst must not be negative")
+	}
+	if bucket.Rate > 0 && bucket.Burst == 0 {
+		bucket.Burst = int64(math.Ceil(bucket.Rate))
+	}
+	return nil
+}
+
+// RateLimitEnabled 是否开启限流与写入配额
+func RateLimitEnabled() bool {
+	return authConfig.RateLimit.Enabled
+}
+
+// rateKey Lua 脚本不经过 RedisView，自行加上应用前缀
+func rateKey(format string, args ...interface{}) string {
+	return constants.ApplicationPrefix + redis.RedisKeySep + fmt.Sprintf(format, args...)
+}
+
+// rateSubject 调用方的限流标识：服务密钥按密钥，其他按用户
+func rateSubject(p *Principal) string {
+	if p.KeyId != "" {
+		return "key:" + p.KeyId
+	}
+	return "user:" + strconv.FormatInt(p.UserId, 10)
+}
+
+// rateGroup 权限所属的限流分组，即权限的动作
+func rateGroup(scope string) string {
+	action, _, _ := strings.Cut(scope, ":")
+	return action
+}
+
+// limitScope 按调用方与接口的分组取令牌
+func limitScope(ctx context.Context, p *Principal, scope string) *LimitError {
+	if !authConfig.RateLimit.Enabled {
+		return nil
+	}
+	group := rateGroup(scope)
+	return takeToken(ctx, group, rateSubject(p), authConfig.RateLimit.Groups[group])
+}
+
+// LimitCallerKey 模型调用日志按 caller_key 取令牌，未配置时不限流
+func LimitCallerKey(ctx context.Context, callerKey string) *LimitError {
+	if !authConfig.RateLimit.Enabled || callerKey == "" {
+		return nil
+	}
+	return takeToken(ctx, rateGroupCallerKey, callerKey, authConfig.RateLimit.CallerKey)
+}
+
+func takeToken(ctx context.Context, group, subject string, bucket BucketConfig) *LimitError {
+	if bucket.Rate <= 0 {
+		return nil
+	}
+	key := rateKey(rateBucketKey, group, subject)
+	result, err := bucketScript.Run(ctx, redis.GetRedisDb(), []string{key},
+		bucket.Rate, bucket.Burst, time.Now().UnixMilli()).Int64Slice()
+	if err != nil || len(result) != 2 {
+		rateLimitErrors.Add(1)
+		logs.Warn("限流检查失败，本次不限流", zap.String("key", key), zap.Error(err))
+		return nil
+	}
+	if result[0] == 1 {
+		return nil
+	}
+	metrics.Counter("rate_limited_" + group).Add(1)
+	return &LimitError{
+		Err:        constants.ErrRateLimited,
+		Reason:     fmt.Sprintf("%s %s 超过每秒 %g 次", group, subject, bucket.Rate),
+		RetryAfter: time.Duration(result[1]) * time.Millisecond,
+	}
+}
+
+// quotaSubject 写入配额的统计对象：有归属用户时按用户，否则按写入的服务密钥
+func quotaSubject(userId int64, keyId string) string {
+	if userId == 0 && keyId != "" {
+		return "key:" + keyId
+	}
+	return "user:" + strconv.FormatInt(userId, 10)
+}
+
+// tenantQuota 租户的每日写入上限
+func tenantQuota(userId int64, keyId string) (rows, bytes int64) {
+	quota := authConfig.RateLimit.Quota
+	for _, tenant := range quota.Tenants {
+		if userId == 0 && keyId != "" {
+			if tenant.KeyId == keyId {
+				return tenant.DailyRows, tenant.DailyBytes
+			}
+		} else if tenant.KeyId == "" && tenant.UserId == userId {
+			return tenant.DailyRows, tenant.DailyBytes
+		}
+	}
+	return quota.DailyRows, quota.DailyBytes
+}
+
+// IngestCharge 一次计入的写入用量，写库失败时通过 Refund 退还
+type IngestCharge struct {
+	keys  []string
+	rows  int64
+	bytes int64
+}
+
+// ChargeIngest 将一次写入计入租户当天的用量，超出配额时不计入并返回错误；
+// 未开启或 Redis 不可用时返回的 charge 为 nil
+func ChargeIngest(ctx context.Context, userId, rows, bytes int64) (*IngestCharge, *LimitError) {
+	if !authConfig.RateLimit.Enabled {
+		return nil, nil
+	}
+	keyId := ""
+	if p := PrincipalFrom(ctx); p != nil {
+		keyId = p.KeyId
+	}
+	subject := quotaSubject(userId, keyId)
+	now := time.Now()
+	day := now.Format(quotaDayLayout)
+	rowLimit, byteLimit := tenantQuota(userId, keyId)
+	keys := []string{rateKey(quotaCountKey, day, subject, "rows"), rateKey(quotaCountKey, day, subject, "bytes")}
+	// 保留两天，跨天后仍可查询前一天的用量
+	ok, err := quotaScript.Run(ctx, redis.GetRedisDb(), keys,
+		rowLimit, byteLimit, rows, bytes, int64((48 * time.Hour).Seconds())).Int64()
+	if err != nil {
+		rateLimitErrors.Add(1)
+		logs.Warn("写入配额检查失败，本次不限制", zap.String("subject", subject), zap.Error(err))
+		return nil, nil
+	}
+	if ok == 1 {
+		return &IngestCharge{keys: keys, rows: rows, bytes: bytes}, nil
+	}
+	metrics.Counter("quota_exceeded").Add(1)
+	year, month, date := now.Date()
+	tomorrow := time.Date(year, month, date+1, 0, 0, 0, 0, now.Location())
+	return nil, &LimitError{
+		Err:        constants.ErrQuotaExceeded,
+		Reason:     fmt.Sprintf("%s 今日写入已达上限（%d 条 / %d 字节）", subject, rowLimit, byteLimit),
+		RetryAfter: tomorrow.Sub(now),
+	}
+}
+
+// Refund 退还本次计入的用量，charge 为 nil 时不处理
+func (c *IngestCharge) Refund(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	// 请求已取消时仍需退还
+	if err := refundScript.Run(context.WithoutCancel(ctx), redis.GetRedisDb(), c.keys, c.rows, c.bytes).Err(); err != nil {
+		rateLimitErrors.Add(1)
+		logs.Warn("退还写入配额失败", zap.Strings("keys", c.keys), zap.Error(err))
+	}
+}
+
+// RejectLimited 返回 429 与 Retry-After（秒，向上取整）
+func RejectLimited(c echo.Context, err *LimitError) error {
+	c.Response().Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(err.RetryAfter.Seconds())), 10))
+	return c.JSON(429, map[string]interface{}{
+		"errcode": err.Err.Code(),
+		"errmsg":  err.Error(),
+	})
+}
+
+// IngestUsage 租户某天的写入用量
+type IngestUsage struct {
+	Day        string `json:"day"`
+	UserId     int64  `json:"user_id"`
+	KeyId      string `json:"key_id"` // user_id 为 0 时按该服务密钥统计
+	Rows       int64  `json:"rows"`
+	Bytes      int64  `json:"bytes"`
+	DailyRows  int64  `json:"daily_rows"`  // 上限，0 表示不限
+	DailyBytes int64  `json:"daily_bytes"` // 上限，0 表示不限
+}
+
+// BucketUsage 令牌桶的当前状态
+type BucketUsage struct {
+	Group   string  `json:"group"`
+	Subject string  `json:"subject"`
+	Tokens  float64 `json:"tokens"` // 当前可用的令牌数
+	Rate    float64 `json:"rate"`
+	Burst   int64   `json:"burst"`
+}
+
+// GetIngestUsage 查询租户某天的写入用量，userId 为 0 时查询服务密钥 keyId 的用量，day 为空时为今天
+func GetIngestUsage(ctx context.Context, userId int64, keyId, day string) (*IngestUsage, error) {
+	if day == "" {
+		day = time.Now().Format(quotaDayLayout)
+	}
+	if userId != 0 {
+		keyId = ""
+	}
+	subject := quotaSubject(userId, keyId)
+	usage := &IngestUsage{Day: day, UserId: userId, KeyId: keyId}
+	usage.DailyRows, usage.DailyBytes = tenantQuota(userId, keyId)
+	values, err := redis.GetRedisDb().MGet(ctx,
+		rateKey(quotaCountKey, day, subject, "rows"), rateKey(quotaCountKey, day, subject, "bytes")).Result()
+	if err != nil {
+		return nil, err
+	}
+	usage.Rows, usage.Bytes = counterValue(values[0]), counterValue(values[1])
+	return usage, nil
+}
+
+func counterValue(v interface{}) int64 {
+	s, _ := v.(string)
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+// GetBucketUsage 查询调用方在各分组令牌桶的状态，subject 为 key:<密钥标识>、user:<用户ID> 或 caller_key
+func GetBucketUsage(ctx context.Context, subjects map[string]string) ([]BucketUsage, error) {
+	usages := make([]BucketUsage, 0)
+	now := time.Now().UnixMilli()
+	for group, subject := range subjects {
+		bucket := authConfig.RateLimit.Groups[group]
+		if group == rateGroupCallerKey {
+			bucket = authConfig.RateLimit.CallerKey
+		}
+		if bucket.Rate <= 0 || subject == "" {
+			continue
+		}
+		state, err := redis.GetRedisDb().HMGet(ctx, rateKey(rateBucketKey, group, subject), "tokens", "ts").Result()
+		if err != nil {
+			return nil, err
+		}
+		tokens := float64(bucket.Burst)
+		if raw, ok := state[0].(string); ok {
+			tokens, _ = strconv.ParseFloat(raw, 64)
+			if raw, ok = state[1].(string); ok {
+				ts, _ := strconv.ParseFloat(raw, 64)
+				tokens = math.Min(float64(bucket.Burst), tokens+math.Max(0, float64(now)-ts)*bucket.Rate/1000)
+			}
+		}
+		usages = append(usages, BucketUsage{Group: group, Subject: subject, Tokens: tokens, Rate: bucket.Rate, Burst: bucket.Burst})
+	}
+	slices.SortFunc(usages, func(a, b BucketUsage) int { return strings.Compare(a.Group, b.Group) })
+	return usages, nil
+}
+
+// RateSubjects 调用方在各分组的限流标识，callerKey 非空时包含 caller_key 分组
+func RateSubjects(userId int64, keyId, callerKey string) map[string]string {
+	subject := rateSubject(&Principal{UserId: userId, KeyId: keyId})
+	subjects := make(map[string]string, len(scopeActions)+1)
+	for _, action := range scopeActions {
+		subjects[action] = subject
+	}
+	if callerKey != "" {
+		subjects[rateGroupCallerKey] = callerKey
+	}
+	return subjects
+}
@@ -0,0 +1,144 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stardustagi/TopLib/libs/logs"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"go.uber.org/zap"
+)
+
+// 角色权限：绑定了角色的 JWT 用户拥有各角色权限的并集；调用接口时只看授予该接口权限的角色，
+// 隐藏这些角色都隐藏的列，其它角色不隐藏某列不会解除隐藏；
+// 未绑定角色的用户使用 [auth] user_scopes，admin_users 拥有全部权限且不隐藏任何列。
+// 用户的权限缓存在 Redis 中，键包含角色代数，角色或绑定变更后更新代数使缓存全部失效
+const (
+	roleGenKey   = "rbac:gen"
+	roleCacheKey = "rbac:user:v2:%s:%d"
+	roleGenNone  = "0"
+)
+
+// errRoleUnavailable 查询角色失败，调用方可重试；不退回默认权限，避免绕过字段脱敏
+var errRoleUnavailable = errors.New("角色权限暂不可用")
+
+// userAccess 用户的权限与各角色的授权
+type userAccess struct {
+	Scopes []string    `json:"scopes"`
+	Grants []RoleGrant `json:"grants"`
+}
+
+// RoleGrant 单个角色授予的权限与隐藏的列
+type RoleGrant struct {
+	Scopes []string `json:"scopes"`
+	Masks  []string `json:"masks"`
+}
+
+// userPrincipal JWT 用户的权限
+func userPrincipal(ctx context.Context, userId int64) (*Principal, error) {
+	if slices.Contains(authConfig.AdminUsers, userId) {
+		return &Principal{UserId: userId, Scopes: []string{ScopeAll}}, nil
+	}
+	access, err := lookupUserAccess(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{UserId: userId, Scopes: access.Scopes, Grants: access.Grants}, nil
+}
+
+// lookupUserAccess 先查 Redis 缓存，未命中时按用户的角色计算并回写，Redis 不可用时直接查库
+func lookupUserAccess(ctx context.Context, userId int64) (*userAccess, error) {
+	roles := storage.GetRoleStore()
+	if roles == nil {
+		return &userAccess{Scopes: authConfig.UserScopes}, nil
+	}
+	gen := roleGenNone
+	if raw, err := authRedis().Get(ctx, roleGenKey); err == nil && len(raw) > 0 {
+		gen = string(raw)
+	}
+	cacheKey := fmt.Sprintf(roleCacheKey, gen, userId)
+	if raw, err := authRedis().Get(ctx, cacheKey); err == nil && len(raw) > 0 {
+		access := &userAccess{}
+		if err = json.Unmarshal(raw, access); err == nil {
+			return access, nil
+		}
+	}
+
+	bound, err := roles.UserRoles(ctx, userId)
+	if err != nil {
+		logs.GetLogger("Rbac").Error("查询用户角色失败", zap.Int64("userId", userId), zap.Error(err))
+		return nil, errRoleUnavailable
+	}
+	access := &userAccess{Scopes: authConfig.UserScopes}
+	if len(bound) > 0 {
+		access.Scopes = nil
+		for i := range bound {
+			for _, scope := range bound[i].ScopeList() {
+				if !slices.Contains(access.Scopes, scope) {
+					access.Scopes = append(access.Scopes, scope)
+				}
+			}
+			access.Grants = append(access.Grants, RoleGrant{Scopes: bound[i].ScopeList(), Masks: bound[i].MaskList()})
+		}
+	}
+	if raw, err := json.Marshal(access); err == nil {
+		_ = authRedis().Set(ctx, cacheKey, raw, authConfig.RoleCacheTTL)
+	}
+	return access, nil
+}
+
+// ForgetRoles 角色或绑定变更后更新角色代数，使所有用户的权限缓存失效
+func ForgetRoles(ctx context.Context) {
+	gen := []byte(strconv.FormatInt(time.Now().UnixNano(), 36))
+	if err := authRedis().Set(ctx, roleGenKey, gen, ""); err != nil {
+		logs.GetLogger("Rbac").Warn("更新角色代数失败", zap.Error(err))
+	}
+}
+
+// errAuditGrant 只有审计员能管理可查询审计记录的角色
+var errAuditGrant = errors.New("roles granting * or admin:audit can only be managed by callers holding admin:audit")
+
+// CheckRoleGrant 审计员与管理员职责分离：创建、修改、删除、绑定或解除包含 * 或 admin:audit 的角色时，
+// 调用方自身必须拥有 admin:audit，避免只有 admin 或 admin:rbac 的调用方给自己授予审计权限
+func CheckRoleGrant(ctx context.Context, scopes ...[]string) error {
+	for _, list := range scopes {
+		if !slices.Contains(list, ScopeAll) && !slices.Contains(list, ScopeAudit) {
+			continue
+		}
+		if p := PrincipalFrom(ctx); p == nil || !p.Allowed(ScopeAudit) {
+			return errAuditGrant
+		}
+	}
+	return nil
+}
+
+// ValidateRoleScopes 校验授予角色的权限：*、admin、admin:<管理操作> 或 ingest、read、stats 加日志类型，
+// 管理操作与日志类型可为 *
+func ValidateRoleScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("scopes is required")
+	}
+	for _, scope := range scopes {
+		if scope == ScopeAll || scope == ScopeAdmin {
+			continue
+		}
+		action, resource, _ := strings.Cut(scope, ":")
+		valid := false
+		switch action {
+		case ActionAdmin:
+			valid = resource == "*" || slices.Contains(adminResources, resource)
+		case ActionIngest, ActionRead, ActionStats:
+			valid = resource == "*" || slices.Contains(scopeResources, resource)
+		}
+		if !valid {
+			return fmt.Errorf("invalid role scope %q", scope)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+)
+
+// registry 服务指标，通过管理接口 /log/getMetrics（需要 admin:metrics）输出
+var registry = expvar.NewMap("top_models_logs")
+
+// Gauge 获取或注册一个瞬时值指标
+func Gauge(name string) *expvar.Int {
+	return intVar(name)
+}
+
+// Counter 获取或注册一个累计计数指标
+func Counter(name string) *expvar.Int {
+	return intVar(name)
+}
+
+func intVar(name string) *expvar.Int {
+	if v, ok := registry.Get(name).(*expvar.Int); ok {
+		return v
+	}
+	v := new(expvar.Int)
+	registry.Set(name, v)
+	return v
+}
+
+// Snapshot 以 JSON 输出全部指标
+func Snapshot() json.RawMessage {
+	return json.RawMessage(registry.String())
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopLib/protocol"
+	"github.com/stardustagi/TopModelsLogs/backend"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/constants"
+	"github.com/stardustagi/TopModelsLogs/protocol/requests"
+	"github.com/stardustagi/TopModelsLogs/protocol/responses"
+	"go.uber.org/zap"
+)
+
+// auditRetentionLoop 按 [storage.audit] 的保留天数定期清理过期审计记录，服务停止时退出
+func (s *LogService) auditRetentionLoop(audits *storage.AuditStore, days int) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		before := time.Now().AddDate(0, 0, -days)
+		if n, err := audits.PurgeBefore(s.ctx, before); err != nil {
+			s.logger.Error("清理过期审计记录失败", zap.Error(err))
+		} else if n > 0 {
+			s.logger.Info("清理过期审计记录", zap.Time("before", before), zap.Int64("events", n))
+		}
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetAuditEventList 查询审计记录
+// @Summary 查询审计记录
+// @Description 查询日志数据的访问记录：调用方、接口、请求参数、结果条数与客户端 IP，需要 admin:audit 权限
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.GetAuditEventListReq true "查询审计记录请求"
+// @Success 200 {object} responses.GetAuditEventListResp
+// @Router /log/getAuditEventList [post]
+func (s *LogService) GetAuditEventList(ctx echo.Context,
+	req requests.GetAuditEventListReq, resp responses.GetAuditEventListResp) error {
+	audits := storage.GetAuditStore()
+	if audits == nil {
+		return protocol.Response(ctx, constants.ErrNotEnabled, nil)
+	}
+	if req.Limit <= 0 {
+		req.Limit = 50
+	}
+	filter := storage.AuditFilter{
+		UserId:    req.UserId,
+		KeyId:     req.KeyId,
+		Action:    req.Action,
+		StartTime: req.StartTime,
+		EndTime:   req.EndTime,
+	}
+	events, total, err := audits.List(ctx.Request().Context(), filter, req.Skip, req.Limit)
+	if err != nil {
+		s.logger.Error("查询审计记录失败", zap.Error(err))
+		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+	}
+	resp.Events = events
+	resp.Total = total
+	backend.AuditResult(ctx, int64(len(events)))
+	return protocol.Response(ctx, nil, resp)
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/stardustagi/TopModelsLogs/backend/metrics"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"go.uber.org/zap"
+)
+
+// 查询结果缓存：列表、统计与时间分布的结果按请求内容的哈希缓存在 Redis 中。
+// 时间范围在今天之前的查询只涉及不再变化的历史日分片，缓存 history_ttl；包含今天的查询缓存 recent_ttl。
+// 写入今天之前的日志（如缓冲回放、补录）或清理日志时更新对应日志类型的代数，历史查询的缓存随之失效
+const (
+	queryCacheGenKey  = "query:gen:%s"
+	queryCacheKey     = "query:%s:%s:%s:%s"
+	logKindApi        = "api"
+	logKindTraining   = "training"
+	logKindCall       = "call"
+	queryCacheGenNone = "0"
+)
+
+var logKinds = []string{logKindApi, logKindTraining, logKindCall}
+
+// cachedQuery 按 req 读取缓存的查询结果，未命中时执行 query 并回写
+// endTime 为请求的结束时间（秒），0 表示截止到当前；bypass 为 true 时直接查询且不回写
+func cachedQuery[T any](s *LogService, ctx context.Context, kind, op string, req interface{},
+	endTime int64, bypass bool, query func(ctx context.Context) (T, error)) (T, error) {
+	config := queryCacheConfig()
+	if config == nil || !config.Enabled {
+		return query(ctx)
+	}
+	if bypass {
+		metrics.Counter("query_cache_bypass").Add(1)
+		return query(ctx)
+	}
+
+	var result T
+	key, err := s.queryCacheKey(ctx, kind, op, req)
+	if err != nil {
+		return query(ctx)
+	}
+	if raw, err := s.rds.Get(ctx, key); err == nil && len(raw) > 0 {
+		if err = json.Unmarshal(raw, &result); err == nil {
+			metrics.Counter("query_cache_hits").Add(1)
+			return result, nil
+		}
+	}
+	metrics.Counter("query_cache_misses").Add(1)
+
+	if result, err = query(ctx); err != nil {
+		return result, err
+	}
+	ttl := config.RecentTTL
+	if endTime > 0 && endTime < truncateLocalDay(time.Now()).Unix() {
+		ttl = config.HistoryTTL
+	}
+	raw, err := json.Marshal(result)
+	if err == nil {
+		err = s.rds.Set(ctx, key, raw, ttl)
+	}
+	if err != nil {
+		s.logger.Warn("缓存查询结果失败", zap.String("key", key), zap.Error(err))
+	}
+	return result, nil
+}
+
+// queryCacheKey 缓存键：日志类型、操作、历史数据代数与请求内容、脱敏列的哈希
+func (s *LogService) queryCacheKey(ctx context.Context, kind, op string, req interface{}) (string, error) {
+	raw, err := json.Marshal([]interface{}{req, storage.Masks(ctx)})
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(raw)
+	return fmt.Sprintf(queryCacheKey, kind, op, s.queryCacheGen(ctx, kind), hex.EncodeToString(sum[:8])), nil
+}
+
+// queryCacheGen 日志类型当前的历史数据代数，Redis 不可用时为 queryCacheGenNone
+func (s *LogService) queryCacheGen(ctx context.Context, kind string) string {
+	raw, err := s.rds.Get(ctx, fmt.Sprintf(queryCacheGenKey, kind))
+	if err != nil || len(raw) == 0 {
+		return queryCacheGenNone
+	}
+	return string(raw)
+}
+
+// historyChanged 写入 createdAt（秒）时间的日志后调用，早于今天时使该日志类型历史查询的缓存失效
+func (s *LogService) historyChanged(ctx context.Context, kind string, createdAt int64) {
+	if createdAt <= 0 || createdAt >= truncateLocalDay(time.Now()).Unix() {
+		return
+	}
+	s.invalidateQueryCache(ctx, kind)
+}
+
+// invalidateQueryCache 更新日志类型的代数（不过期），之前缓存的查询结果不再命中并随 TTL 过期
+func (s *LogService) invalidateQueryCache(ctx context.Context, kinds ...string) {
+	gen := []byte(strconv.FormatInt(time.Now().UnixNano(), 36))
+	for _, kind := range kinds {
+		if err := s.rds.Set(ctx, fmt.Sprintf(queryCacheGenKey, kind), gen, ""); err != nil {
+			s.logger.Warn("更新查询缓存代数失败", zap.String("kind", kind), zap.Error(err))
+		}
+	}
+}
+
+func queryCacheConfig() *storage.QueryCacheConfig {
+	if config := storage.GetConfig(); config != nil {
+		return &config.QueryCache
+	}
+	return nil
+}
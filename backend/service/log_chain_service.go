@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopLib/protocol"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/constants"
+	"github.com/stardustagi/TopModelsLogs/protocol/requests"
+	"github.com/stardustagi/TopModelsLogs/protocol/responses"
+	"go.uber.org/zap"
+)
+
+// VerifyHashChain 校验哈希链
+// @Summary 校验哈希链
+// @Description 重新计算链上序号范围内每行的哈希并校验签名检查点，列出被修改、插入或删除的行，需要 admin:chain 权限
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.VerifyHashChainReq true "校验哈希链请求"
+// @Success 200 {object} responses.VerifyHashChainResp
+// @Router /log/verifyHashChain [post]
+func (s *LogService) VerifyHashChain(ctx echo.Context,
+	req requests.VerifyHashChainReq, resp responses.VerifyHashChainResp) error {
+	chain := storage.GetHashChain()
+	if chain == nil {
+		return protocol.Response(ctx, constants.ErrNotEnabled, nil)
+	}
+	table, err := chain.ChainTable(req.LogType, req.Day)
+	if errors.Is(err, storage.ErrUnknownChain) {
+		return protocol.Response(ctx, constants.ErrInvalidParams.AppendErrors(err), nil)
+	}
+	if err != nil {
+		s.logger.Error("列出日分片失败", zap.Error(err))
+		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+	}
+	report, err := chain.Verify(ctx.Request().Context(), table, req.FromSeq, req.ToSeq)
+	if err != nil {
+		s.logger.Error("校验哈希链失败", zap.String("chain", table), zap.Error(err))
+		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+	}
+	if !report.Valid {
+		s.logger.Warn("哈希链校验不通过", zap.String("chain", table), zap.Int("issues", len(report.Issues)))
+	}
+	resp.PublicKey = chain.PublicKey()
+	resp.PublicKeys = chain.PublicKeys()
+	resp.Report = report
+	return protocol.Response(ctx, nil, resp)
+}
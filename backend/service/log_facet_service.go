@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopLib/protocol"
+	"github.com/stardustagi/TopModelsLogs/backend/metrics"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"github.com/stardustagi/TopModelsLogs/protocol/requests"
+	"github.com/stardustagi/TopModelsLogs/protocol/responses"
+	"go.uber.org/zap"
+)
+
+// 取值分布按自然日拆分统计，与模型调用日志的日分表一一对应，每天的结果单独缓存在 Redis 中：
+// 已结束的日期数据不再变化，缓存较长时间；包含当前时刻的日期只缓存很短时间
+const (
+	facetDefaultDays  = 7
+	maxFacetDays      = 31 // 未配置查询护栏时的最大跨度
+	facetDefaultLimit = 20
+	maxFacetLimit     = 200
+	facetClosedTTL    = "24h"
+	facetOpenTTL      = "1m"
+)
+
+// facetQuery 统计 [start, end] 秒级时间范围内各字段的取值分布
+type facetQuery func(ctx context.Context, start, end int64, fields []string) (map[string]*storage.Facet, error)
+
+// GetApiLogFacets 获取API日志取值分布
+// @Summary 获取API日志取值分布
+// @Description 统计时间范围内接口路径、请求方法、状态码的取值及出现次数，可同时统计多个字段
+// @Tags Log
+// @Accept json
+// @Produce json
+// @Param request body requests.GetApiLogFacetsReq true "获取API日志取值分布请求"
+// @Success 200 {object} responses.GetLogFacetsResp
+// @Router /log/getApiLogFacets [post]
+func (s *LogService) GetApiLogFacets(ctx echo.Context,
+	req requests.GetApiLogFacetsReq, resp responses.GetLogFacetsResp) error {
+	req.UserId = tenantUserId(ctx, req.UserId)
+	s.logger.Info("获取API日志取值分布", zap.Strings("fields", req.Fields))
+
+	filter, err := apiLogFilter(req.UserId, req.ApiPath, 0, 0, req.Filter)
+	if err != nil {
+		return s.queryFailed(ctx, "解析API日志过滤条件失败", err)
+	}
+	if req.Explain {
+		// 试运行不经过按天缓存，解释整个时间范围的统计查询
+		start, end, err := facetRange(req.StartTime, req.EndTime)
+		if err != nil {
+			return s.queryFailed(ctx, "解析取值分布时间范围失败", err)
+		}
+		filter.StartTime, filter.EndTime = start.Unix(), end.Unix()
+		return s.explain(ctx, func(c context.Context) error {
+			_, err := s.store.ApiLogFacets(c, filter, req.Fields)
+			return err
+		})
+	}
+	scope := req
+	scope.Fields, scope.StartTime, scope.EndTime, scope.Limit = nil, 0, 0, 0
+	resp, err = s.facets(ctx.Request().Context(), models.ApiLog{}, logKindApi, scope,
+		req.StartTime, req.EndTime, req.Fields, req.Limit,
+		func(ctx context.Context, start, end int64, fields []string) (map[string]*storage.Facet, error) {
+			filter.StartTime, filter.EndTime = start, end
+			return s.store.ApiLogFacets(ctx, filter, fields)
+		})
+	if err != nil {
+		return s.queryFailed(ctx, "统计API日志取值分布失败", err)
+	}
+	return protocol.Response(ctx, nil, resp)
+}
+
+// GetModelTrainingLogFacets 获取模型训练日志取值分布
+// @Summary 获取模型训练日志取值分布
+// @Description 统计时间范围内训练状态、日志级别的取值及出现次数
+// @Tags Log
+// @Accept json
+// @Produce json
+// @Param request body requests.GetModelTrainingLogFacetsReq true "获取模型训练日志取值分布请求"
+// @Success 200 {object} responses.GetLogFacetsResp
+// @Router /log/getModelTrainingLogFacets [post]
+func (s *LogService) GetModelTrainingLogFacets(ctx echo.Context,
+	req requests.GetModelTrainingLogFacetsReq, resp responses.GetLogFacetsResp) error {
+	req.UserId = tenantUserId(ctx, req.UserId)
+	s.logger.Info("获取模型训练日志取值分布", zap.Strings("fields", req.Fields))
+
+	filter, err := trainingLogFilter(req.UserId, req.ModelId, "", "", 0, 0, req.Filter)
+	if err != nil {
+		return s.queryFailed(ctx, "解析模型训练日志过滤条件失败", err)
+	}
+	if req.Explain {
+		// 试运行不经过按天缓存，解释整个时间范围的统计查询
+		start, end, err := facetRange(req.StartTime, req.EndTime)
+		if err != nil {
+			return s.queryFailed(ctx, "解析取值分布时间范围失败", err)
+		}
+		filter.StartTime, filter.EndTime = start.Unix(), end.Unix()
+		return s.explain(ctx, func(c context.Context) error {
+			_, err := s.store.ModelTrainingLogFacets(c, filter, req.Fields)
+			return err
+		})
+	}
+	scope := req
+	scope.Fields, scope.StartTime, scope.EndTime, scope.Limit = nil, 0, 0, 0
+	resp, err = s.facets(ctx.Request().Context(), models.ModelTrainingLog{}, logKindTraining, scope,
+		req.StartTime, req.EndTime, req.Fields, req.Limit,
+		func(ctx context.Context, start, end int64, fields []string) (map[string]*storage.Facet, error) {
+			filter.StartTime, filter.EndTime = start, end
+			return s.store.ModelTrainingLogFacets(ctx, filter, fields)
+		})
+	if err != nil {
+		return s.queryFailed(ctx, "统计模型训练日志取值分布失败", err)
+	}
+	return protocol.Response(ctx, nil, resp)
+}
+
+// GetModelsCallLogFacets 获取模型调用日志取值分布
+// @Summary 获取模型调用日志取值分布
+// @Description 统计时间范围内模型、供应商、步骤、上报类型、节点地址、状态码的取值及出现次数，按日分片缓存
+// @Tags Log
+// @Accept json
+// @Produce json
+// @Param request body requests.GetModelsCallLogFacetsReq true "获取模型调用日志取值分布请求"
+// @Success 200 {object} responses.GetLogFacetsResp
+// @Router /log/getModelsCallLogFacets [post]
+func (s *LogService) GetModelsCallLogFacets(ctx echo.Context,
+	req requests.GetModelsCallLogFacetsReq, resp responses.GetLogFacetsResp) error {
+	req.UserId = tenantUserId(ctx, req.UserId)
+	s.logger.Info("获取模型调用日志取值分布", zap.Strings("fields", req.Fields))
+
+	filter, err := callLogFilter(req.UserId, req.Model, req.CallerKey, req.Step, req.ActualProviderId, 0, 0, req.Filter)
+	if err != nil {
+		return s.queryFailed(ctx, "解析模型调用日志过滤条件失败", err)
+	}
+	if req.Explain {
+		// 试运行不经过按天缓存，解释整个时间范围的统计查询
+		start, end, err := facetRange(req.StartTime, req.EndTime)
+		if err != nil {
+			return s.queryFailed(ctx, "解析取值分布时间范围失败", err)
+		}
+		filter.StartTime, filter.EndTime = start, end
+		return s.explain(ctx, func(c context.Context) error {
+			_, err := s.store.StatusReportFacets(c, filter, req.Fields)
+			return err
+		})
+	}
+	scope := req
+	scope.Fields, scope.StartTime, scope.EndTime, scope.Limit = nil, 0, 0, 0
+	resp, err = s.facets(ctx.Request().Context(), models.StatusReport{}, logKindCall, scope,
+		req.StartTime, req.EndTime, req.Fields, req.Limit,
+		func(ctx context.Context, start, end int64, fields []string) (map[string]*storage.Facet, error) {
+			filter.StartTime, filter.EndTime = time.Unix(start, 0), time.Unix(end, 0)
+			return s.store.StatusReportFacets(ctx, filter, fields)
+		})
+	if err != nil {
+		return s.queryFailed(ctx, "统计模型调用日志取值分布失败", err)
+	}
+	return protocol.Response(ctx, nil, resp)
+}
+
+// facets 按天拆分时间范围，逐天读取缓存或查询存储，合并后每个字段保留出现最多的 limit 个取值
+// scope 为除时间范围、字段与条数以外的查询条件，用于区分缓存
+func (s *LogService) facets(ctx context.Context, model interface{}, kind string, scope interface{},
+	startTime, endTime int64, fields []string, limit int, query facetQuery) (responses.GetLogFacetsResp, error) {
+	resp := responses.GetLogFacetsResp{}
+	if err := storage.ValidateFacetFields(model, fields); err != nil {
+		return resp, err
+	}
+	start, end, err := facetRange(startTime, endTime)
+	if err != nil {
+		return resp, err
+	}
+	limits := storage.Limits(ctx, storage.OpFacets)
+	if limits.MaxSpanDays <= 0 {
+		limits.MaxSpanDays = maxFacetDays
+	}
+	if err = limits.CheckRange(start, end, kind == logKindCall, false); err != nil {
+		return resp, err
+	}
+	// 脱敏列不同的调用方不共用缓存，未命中时由存储校验查询条件
+	raw, err := json.Marshal([]interface{}{scope, storage.Masks(ctx)})
+	if err != nil {
+		return resp, err
+	}
+	sum := sha1.Sum(raw)
+	scopeHash := hex.EncodeToString(sum[:8])
+	gen := s.queryCacheGen(ctx, kind)
+
+	parts := make(map[string][]*storage.Facet, len(fields))
+	now := time.Now()
+	today := truncateLocalDay(now)
+	for day := truncateLocalDay(start); !day.After(end); day = day.AddDate(0, 0, 1) {
+		dayEnd := day.AddDate(0, 0, 1).Unix() - 1
+		segStart := max(day.Unix(), start.Unix())
+		segEnd := min(dayEnd, end.Unix())
+		if segEnd >= now.Unix() {
+			// 截止到当前时刻与截止到当天结束统计结果相同，统一缓存键
+			segEnd = dayEnd
+		}
+		key := fmt.Sprintf("facets:%s:%s:%s:%d-%d:%s", kind, gen, day.Format("20060102"), segStart, segEnd, scopeHash)
+		ttl := facetClosedTTL
+		if !day.Before(today) {
+			ttl = facetOpenTTL
+		}
+		segment, err := s.facetSegment(ctx, key, ttl, segStart, segEnd, fields, query)
+		if err != nil {
+			return resp, err
+		}
+		for _, field := range fields {
+			parts[field] = append(parts[field], segment[field])
+		}
+	}
+
+	if limit <= 0 {
+		limit = facetDefaultLimit
+	}
+	limit = min(limit, maxFacetLimit)
+	resp.Facets = make(map[string]*storage.Facet, len(fields))
+	for _, field := range fields {
+		merged := storage.MergeFacets(parts[field]...)
+		if len(merged.Values) > limit {
+			merged.Values, merged.Truncated = merged.Values[:limit], true
+		}
+		resp.Facets[field] = merged
+	}
+	resp.StartTime, resp.EndTime = start.Unix(), end.Unix()
+	return resp, nil
+}
+
+// facetSegment 读取单天的缓存，缺少的字段查询存储后回写；Redis 不可用时直接查询存储
+func (s *LogService) facetSegment(ctx context.Context, key, ttl string, start, end int64,
+	fields []string, query facetQuery) (map[string]*storage.Facet, error) {
+	cached := make(map[string]*storage.Facet)
+	if raw, err := s.rds.Get(ctx, key); err == nil && len(raw) > 0 {
+		if err = json.Unmarshal(raw, &cached); err != nil {
+			cached = make(map[string]*storage.Facet)
+		}
+	}
+	var missing []string
+	for _, field := range fields {
+		if cached[field] == nil {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) == 0 {
+		metrics.Counter("facet_cache_hits").Add(1)
+		return cached, nil
+	}
+	metrics.Counter("facet_cache_misses").Add(1)
+
+	fresh, err := query(ctx, start, end, missing)
+	if err != nil {
+		return nil, err
+	}
+	for field, facet := range fresh {
+		cached[field] = facet
+	}
+	raw, err := json.Marshal(cached)
+	if err == nil {
+		err = s.rds.Set(ctx, key, raw, ttl)
+	}
+	if err != nil {
+		s.logger.Warn("缓存日志取值分布失败", zap.String("key", key), zap.Error(err))
+	}
+	return cached, nil
+}
+
+// facetRange 补全并校验秒级时间范围，默认最近 facetDefaultDays 个自然日
+func facetRange(startTime, endTime int64) (time.Time, time.Time, error) {
+	end := time.Now()
+	if endTime > 0 {
+		end = time.Unix(endTime, 0)
+	}
+	start := truncateLocalDay(end).AddDate(0, 0, 1-facetDefaultDays)
+	if startTime > 0 {
+		start = time.Unix(startTime, 0)
+	}
+	if start.After(end) {
+		return start, end, &storage.ValidationError{Err: storage.ErrInvalidFacet, Errors: []storage.FieldError{{
+			Field:  "start_time",
+			Value:  start.Format(time.DateTime),
+			Reason: "after end_time",
+		}}}
+	}
+	return start, end, nil
+}
+
+func truncateLocalDay(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
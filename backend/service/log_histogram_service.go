@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopLib/protocol"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/protocol/requests"
+	"github.com/stardustagi/TopModelsLogs/protocol/responses"
+	"go.uber.org/zap"
+)
+
+// histogramDefaultSpan 未指定时间范围时统计的时长
+const histogramDefaultSpan = 24 * time.Hour
+
+// GetApiLogHistogram 获取API日志时间分布
+// @Summary 获取API日志时间分布
+// @Description 按时间分桶统计API日志条数，可按状态码等维度拆分，用于日志列表上方的柱状图
+// @Tags Log
+// @Accept json
+// @Produce json
+// @Param request body requests.GetApiLogHistogramReq true "获取API日志时间分布请求"
+// @Success 200 {object} responses.GetLogHistogramResp
+// @Router /log/getApiLogHistogram [post]
+func (s *LogService) GetApiLogHistogram(ctx echo.Context,
+	req requests.GetApiLogHistogramReq, resp responses.GetLogHistogramResp) error {
+	req.UserId = tenantUserId(ctx, req.UserId)
+	s.logger.Info("获取API日志时间分布",
+		zap.String("interval", req.Interval),
+		zap.String("splitBy", req.SplitBy))
+
+	start, end := histogramRange(req.StartTime, req.EndTime)
+	q, err := histogramQuery(req.Interval, req.SplitBy)
+	if err != nil {
+		return s.queryFailed(ctx, "解析时间分布参数失败", err)
+	}
+	filter, err := apiLogFilter(req.UserId, req.ApiPath, start, end, req.Filter)
+	if err != nil {
+		return s.queryFailed(ctx, "解析API日志过滤条件失败", err)
+	}
+	if req.Explain {
+		return s.explain(ctx, func(c context.Context) error {
+			_, err := s.store.ApiLogHistogram(c, filter, q)
+			return err
+		})
+	}
+	h, err := cachedQuery(s, ctx.Request().Context(), logKindApi, storage.OpHistogram, req, req.EndTime, req.NoCache,
+		func(c context.Context) (*storage.Histogram, error) { return s.store.ApiLogHistogram(c, filter, q) })
+	if err != nil {
+		return s.queryFailed(ctx, "统计API日志时间分布失败", err)
+	}
+
+	resp.Histogram = *h
+	resp.StartTime, resp.EndTime = start, end
+	return protocol.Response(ctx, nil, resp)
+}
+
+// GetModelTrainingLogHistogram 获取模型训练日志时间分布
+// @Summary 获取模型训练日志时间分布
+// @Description 按时间分桶统计模型训练日志条数，可按日志级别等维度拆分
+// @Tags Log
+// @Accept json
+// @Produce json
+// @Param request body requests.GetModelTrainingLogHistogramReq true "获取模型训练日志时间分布请求"
+// @Success 200 {object} responses.GetLogHistogramResp
+// @Router /log/getModelTrainingLogHistogram [post]
+func (s *LogService) GetModelTrainingLogHistogram(ctx echo.Context,
+	req requests.GetModelTrainingLogHistogramReq, resp responses.GetLogHistogramResp) error {
+	req.UserId = tenantUserId(ctx, req.UserId)
+	s.logger.Info("获取模型训练日志时间分布",
+		zap.String("interval", req.Interval),
+		zap.String("splitBy", req.SplitBy))
+
+	start, end := histogramRange(req.StartTime, req.EndTime)
+	q, err := histogramQuery(req.Interval, req.SplitBy)
+	if err != nil {
+		return s.queryFailed(ctx, "解析时间分布参数失败", err)
+	}
+	filter, err := trainingLogFilter(req.UserId, req.ModelId, req.Status, req.LogLevel, start, end, req.Filter)
+	if err != nil {
+		return s.queryFailed(ctx, "解析模型训练日志过滤条件失败", err)
+	}
+	if req.Explain {
+		return s.explain(ctx, func(c context.Context) error {
+			_, err := s.store.ModelTrainingLogHistogram(c, filter, q)
+			return err
+		})
+	}
+	h, err := cachedQuery(s, ctx.Request().Context(), logKindTraining, storage.OpHistogram, req, req.EndTime, req.NoCache,
+		func(c context.Context) (*storage.Histogram, error) {
+			return s.store.ModelTrainingLogHistogram(c, filter, q)
+		})
+	if err != nil {
+		return s.queryFailed(ctx, "统计模型训练日志时间分布失败", err)
+	}
+
+	resp.Histogram = *h
+	resp.StartTime, resp.EndTime = start, end
+	return protocol.Response(ctx, nil, resp)
+}
+
+// GetModelsCallLogHistogram 获取模型调用日志时间分布
+// @Summary 获取模型调用日志时间分布
+// @Description 按时间分桶统计模型调用日志条数，可按步骤、状态码等维度拆分
+// @Tags Log
+// @Accept json
+// @Produce json
+// @Param request body requests.GetModelsCallLogHistogramReq true "获取模型调用日志时间分布请求"
+// @Success 200 {object} responses.GetLogHistogramResp
+// @Router /log/getModelsCallLogHistogram [post]
+func (s *LogService) GetModelsCallLogHistogram(ctx echo.Context,
+	req requests.GetModelsCallLogHistogramReq, resp responses.GetLogHistogramResp) error {
+	req.UserId = tenantUserId(ctx, req.UserId)
+	s.logger.Info("获取模型调用日志时间分布",
+		zap.String("interval", req.Interval),
+		zap.String("splitBy", req.SplitBy))
+
+	start, end := histogramRange(req.StartTime, req.EndTime)
+	q, err := histogramQuery(req.Interval, req.SplitBy)
+	if err != nil {
+		return s.queryFailed(ctx, "解析时间分布参数失败", err)
+	}
+	filter, err := callLogFilter(req.UserId, req.Model, req.CallerKey, req.Step, req.ActualProviderId, start, end, req.Filter)
+	if err != nil {
+		return s.queryFailed(ctx, "解析模型调用日志过滤条件失败", err)
+	}
+	filter.TraceId = req.TraceId
+	if req.Explain {
+		return s.explain(ctx, func(c context.Context) error {
+			_, err := s.store.StatusReportHistogram(c, filter, q)
+			return err
+		})
+	}
+	h, err := cachedQuery(s, ctx.Request().Context(), logKindCall, storage.OpHistogram, req, req.EndTime, req.NoCache,
+		func(c context.Context) (*storage.Histogram, error) {
+			return s.store.StatusReportHistogram(c, filter, q)
+		})
+	if err != nil {
+		return s.queryFailed(ctx, "统计模型调用日志时间分布失败", err)
+	}
+
+	resp.Histogram = *h
+	resp.StartTime, resp.EndTime = start, end
+	return protocol.Response(ctx, nil, resp)
+}
+
+// histogramRange 补全秒级时间范围，默认截止当前的 histogramDefaultSpan
+func histogramRange(startTime, endTime int64) (int64, int64) {
+	if endTime <= 0 {
+		endTime = time.Now().Unix()
+	}
+	if startTime <= 0 {
+		startTime = endTime - int64(histogramDefaultSpan/time.Second)
+	}
+	return startTime, endTime
+}
+
+// histogramQuery 解析分桶间隔，除 time.ParseDuration 的格式外支持以 d 结尾的天数
+func histogramQuery(interval, splitBy string) (storage.HistogramQuery, error) {
+	q := storage.HistogramQuery{SplitBy: splitBy}
+	if interval == "" {
+		return q, nil
+	}
+	var err error
+	if days, ok := strings.CutSuffix(interval, "d"); ok {
+		var n int
+		if n, err = strconv.Atoi(days); err == nil {
+			q.Interval = time.Duration(n) * 24 * time.Hour
+		}
+	} else {
+		q.Interval, err = time.ParseDuration(interval)
+	}
+	if err != nil || q.Interval <= 0 {
+		return q, &storage.ValidationError{Err: storage.ErrInvalidHistogram, Errors: []storage.FieldError{{
+			Field:  "interval",
+			Value:  interval,
+			Reason: "must be a positive duration such as 30s, 5m, 1h or 1d",
+		}}}
+	}
+	return q, nil
+}
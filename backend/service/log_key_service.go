@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopLib/protocol"
+	"github.com/stardustagi/TopModelsLogs/backend"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/constants"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"github.com/stardustagi/TopModelsLogs/protocol/requests"
+	"github.com/stardustagi/TopModelsLogs/protocol/responses"
+	"go.uber.org/zap"
+)
+
+// CreateApiKey 创建服务密钥
+// @Summary 创建服务密钥
+// @Description 为网关、训练节点等创建上报日志用的服务密钥，明文密钥只在响应中返回一次
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.CreateApiKeyReq true "创建服务密钥请求"
+// @Success 200 {object} responses.ApiKeySecretResp
+// @Router /log/createApiKey [post]
+func (s *LogService) CreateApiKey(ctx echo.Context,
+	req requests.CreateApiKeyReq, resp responses.ApiKeySecretResp) error {
+	keys := storage.GetKeyStore()
+	if keys == nil {
+		return protocol.Response(ctx, constants.ErrNotEnabled, nil)
+	}
+	if err := backend.ValidateKeyScopes(req.Scopes); err != nil {
+		return protocol.Response(ctx, constants.ErrInvalidParams.AppendErrors(err), nil)
+	}
+	if req.UserId == 0 && slices.ContainsFunc(req.Scopes, func(scope string) bool {
+		return strings.HasPrefix(scope, backend.ActionRead+":") || strings.HasPrefix(scope, backend.ActionStats+":")
+	}) {
+		return protocol.Response(ctx, constants.ErrInvalidParams.AppendErrors(errors.New("read and stats scopes require user_id")), nil)
+	}
+	if err := backend.ValidateKeyIps(req.AllowedIps); err != nil {
+		return protocol.Response(ctx, constants.ErrInvalidParams.AppendErrors(err), nil)
+	}
+	now := time.Now().Unix()
+	if req.ExpiresAt != 0 && req.ExpiresAt <= now {
+		return protocol.Response(ctx, constants.ErrInvalidParams.AppendErrors(errors.New("expires_at is in the past")), nil)
+	}
+
+	keyId, plaintext, hash, err := backend.NewApiKey("")
+	if err != nil {
+		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+	}
+	key := &models.ApiKey{
+		KeyId:      keyId,
+		Name:       req.Name,
+		UserId:     req.UserId,
+		Scopes:     strings.Join(req.Scopes, ","),
+		AllowedIps: strings.Join(req.AllowedIps, ","),
+		SecretHash: hash,
+		ExpiresAt:  req.ExpiresAt,
+		CreatedBy:  callerId(ctx),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err = keys.Create(ctx.Request().Context(), key); err != nil {
+		s.logger.Error("创建服务密钥失败", zap.Error(err))
+		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+	}
+	s.logger.Info("创建服务密钥",
+		zap.String("keyId", keyId),
+		zap.Int64("userId", key.UserId),
+		zap.String("scopes", key.Scopes))
+
+	resp.Key = plaintext
+	resp.ApiKey = apiKeyInfo(key)
+	return protocol.Response(ctx, nil, resp)
+}
+
+// GetApiKeyList 获取服务密钥列表
+// @Summary 获取服务密钥列表
+// @Description 列出服务密钥，不含明文与哈希
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.GetApiKeyListReq true "获取服务密钥列表请求"
+// @Success 200 {object} responses.GetApiKeyListResp
+// @Router /log/getApiKeyList [post]
+func (s *LogService) GetApiKeyList(ctx echo.Context,
+	req requests.GetApiKeyListReq, resp responses.GetApiKeyListResp) error {
+	keys := storage.GetKeyStore()
+	if keys == nil {
+		return protocol.Response(ctx, constants.ErrNotEnabled, nil)
+	}
+	list, err := keys.List(ctx.Request().Context(), req.UserId, req.IncludeRevoked)
+	if err != nil {
+		s.logger.Error("查询服务密钥失败", zap.Error(err))
+		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+	}
+	resp.Keys = make([]responses.ApiKeyInfo, 0, len(list))
+	for i := range list {
+		resp.Keys = append(resp.Keys, apiKeyInfo(&list[i]))
+	}
+	return protocol.Response(ctx, nil, resp)
+}
+
+// RotateApiKey 轮换服务密钥
+// @Summary 轮换服务密钥
+// @Description 保持密钥标识与权限不变生成新的明文密钥，旧密钥在 grace_seconds 内继续有效
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.RotateApiKeyReq true "轮换服务密钥请求"
+// @Success 200 {object} responses.ApiKeySecretResp
+// @Router /log/rotateApiKey [post]
+func (s *LogService) RotateApiKey(ctx echo.Context,
+	req requests.RotateApiKeyReq, resp responses.ApiKeySecretResp) error {
+	key, err := s.activeApiKey(ctx, req.KeyId)
+	if err != nil {
+		return s.keyFailed(ctx, "查询服务密钥失败", err)
+	}
+	_, plaintext, hash, err := backend.NewApiKey(key.KeyId)
+	if err != nil {
+		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+	}
+	now := time.Now().Unix()
+	key.PrevSecretHash, key.PrevExpiresAt = "", 0
+	if req.GraceSeconds > 0 {
+		key.PrevSecretHash, key.PrevExpiresAt = key.SecretHash, now+req.GraceSeconds
+	}
+	key.SecretHash = hash
+	key.UpdatedAt = now
+	err = storage.GetKeyStore().Update(ctx.Request().Context(), key,
+		"secret_hash", "prev_secret_hash", "prev_expires_at", "updated_at")
+	if err != nil {
+		return s.keyFailed(ctx, "轮换服务密钥失败", err)
+	}
+	backend.ForgetApiKey(ctx.Request().Context(), key.KeyId)
+	s.logger.Info("轮换服务密钥", zap.String("keyId", key.KeyId), zap.Int64("graceSeconds", req.GraceSeconds))
+
+	resp.Key = plaintext
+	resp.ApiKey = apiKeyInfo(key)
+	return protocol.Response(ctx, nil, resp)
+}
+
+// RevokeApiKey 吊销服务密钥
+// @Summary 吊销服务密钥
+// @Description 吊销后密钥与轮换前的旧密钥立即失效
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.RevokeApiKeyReq true "吊销服务密钥请求"
+// @Success 200 {object} responses.DefaultResponse
+// @Router /log/revokeApiKey [post]
+func (s *LogService) RevokeApiKey(ctx echo.Context,
+	req requests.RevokeApiKeyReq, resp responses.DefaultResponse) error {
+	key, err := s.activeApiKey(ctx, req.KeyId)
+	if err != nil {
+		return s.keyFailed(ctx, "查询服务密钥失败", err)
+	}
+	key.RevokedAt = time.Now().Unix()
+	key.UpdatedAt = key.RevokedAt
+	if err = storage.GetKeyStore().Update(ctx.Request().Context(), key, "revoked_at", "updated_at"); err != nil {
+		return s.keyFailed(ctx, "吊销服务密钥失败", err)
+	}
+	backend.ForgetApiKey(ctx.Request().Context(), key.KeyId)
+	s.logger.Info("吊销服务密钥", zap.String("keyId", key.KeyId))
+
+	resp.Message = "吊销服务密钥成功"
+	return protocol.Response(ctx, nil, resp)
+}
+
+// activeApiKey 查找未吊销的密钥，已吊销的密钥不能轮换或再次吊销
+func (s *LogService) activeApiKey(ctx echo.Context, keyId string) (*models.ApiKey, error) {
+	keys := storage.GetKeyStore()
+	if keys == nil {
+		return nil, storage.ErrKeyNotFound
+	}
+	key, err := keys.Get(ctx.Request().Context(), keyId)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt > 0 {
+		return nil, storage.ErrKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *LogService) keyFailed(ctx echo.Context, msg string, err error) error {
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return protocol.Response(ctx, constants.ErrNotDataSet, nil)
+	}
+	s.logger.Error(msg, zap.Error(err))
+	return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+}
+
+// callerId 当前调用方的用户ID，未认证时为 0
+func callerId(ctx echo.Context) int64 {
+	if p := backend.PrincipalFrom(ctx.Request().Context()); p != nil {
+		return p.UserId
+	}
+	return 0
+}
+
+func apiKeyInfo(key *models.ApiKey) responses.ApiKeyInfo {
+	info := responses.ApiKeyInfo{
+		KeyId:      key.KeyId,
+		Name:       key.Name,
+		UserId:     key.UserId,
+		Scopes:     key.ScopeList(),
+		AllowedIps: key.IpList(),
+		ExpiresAt:  key.ExpiresAt,
+		RevokedAt:  key.RevokedAt,
+		CreatedBy:  key.CreatedBy,
+		CreatedAt:  key.CreatedAt,
+		UpdatedAt:  key.UpdatedAt,
+	}
+	if key.PrevExpiresAt > time.Now().Unix() {
+		info.PrevExpiresAt = key.PrevExpiresAt
+	}
+	return info
+}
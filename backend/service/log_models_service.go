@@ -1,11 +1,15 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stardustagi/TopLib/protocol"
+	"github.com/stardustagi/TopModelsLogs/backend"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
 	"github.com/stardustagi/TopModelsLogs/constants"
 	"github.com/stardustagi/TopModelsLogs/models"
 	"github.com/stardustagi/TopModelsLogs/protocol/requests"
@@ -24,14 +28,26 @@ import (
 // @Router /log/createModelsCallLog [post]
 func (s *LogService) CreateModelsCallLog(ctx echo.Context,
 	req requests.CreateModelsCallLogReq, resp responses.DefaultResponse) error {
+	node := backend.NodeFrom(ctx.Request().Context())
+	if node == nil && backend.NodeSigningRequired() {
+		return protocol.Response(ctx, constants.ErrAuthFailed.AppendErrors(errors.New("missing node signature")), nil)
+	}
+	if limited := backend.LimitCallerKey(ctx.Request().Context(), req.CallerKey); limited != nil {
+		return backend.RejectLimited(ctx, limited)
+	}
+	req.UserId = ingestUserId(ctx, req.UserId)
+	if req.UserId == 0 {
+		req.UserId = s.callerKeyOwner(ctx.Request().Context(), req.CallerKey)
+	}
+	charge, limited := backend.ChargeIngest(ctx.Request().Context(), req.UserId, 1, int64(len(req.StatusMessage)))
+	if limited != nil {
+		return backend.RejectLimited(ctx, limited)
+	}
 	s.logger.Info("创建模型调用日志",
 		zap.String("traceId", req.TraceId),
 		zap.String("model", req.Model),
 		zap.String("step", req.Step))
 
-	session := s.dao.NewSession()
-	defer session.Close()
-
 	// 处理 Stream 字段转换
 	stream := 0
 	if req.Stream {
@@ -50,6 +66,7 @@ func (s *LogService) CreateModelsCallLog(ctx echo.Context,
 	latency := fmt.Sprintf("%.4f", req.Latency)
 
 	statusReport := &models.StatusReport{
+		UserId:           req.UserId,
 		TraceId:          req.TraceId,
 		NodeAddr:         req.NodeAddr,
 		Model:            req.Model,
@@ -68,32 +85,22 @@ func (s *LogService) CreateModelsCallLog(ctx echo.Context,
 		StatusMessage:    req.StatusMessage,
 		CreatedAt:        createdAt,
 	}
-
-	// 获取日分表表名
-	tbName := statusReport.GetSliceDateDayTable()
-
-	// 检查表是否存在，不存在则创建
-	exist, err := session.Native().IsTableExist(tbName)
-	if err != nil {
-		s.logger.Error("检查日志表是否存在失败", zap.Error(err), zap.String("table", tbName))
-		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
-	}
-	if !exist {
-		// 创建日分表
-		err = session.Native().Table(tbName).Sync2(new(models.StatusReport))
-		if err != nil {
-			s.logger.Error("创建日志表失败", zap.Error(err), zap.String("table", tbName))
-			return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+	// 签名上报时记录校验通过的节点，节点配置了地址时以配置为准
+	if node != nil {
+		statusReport.NodeId = node.Id
+		if node.Addr != "" {
+			statusReport.NodeAddr = node.Addr
 		}
-		s.logger.Info("创建日志表成功", zap.String("table", tbName))
 	}
 
-	// 插入数据到日分表
-	_, err = session.Native().Table(tbName).InsertOne(statusReport)
+	// 写入记录所在日的分片
+	err := s.store.InsertStatusReport(ctx.Request().Context(), statusReport)
 	if err != nil {
-		s.logger.Error("创建模型调用日志失败", zap.Error(err), zap.String("table", tbName))
+		charge.Refund(ctx.Request().Context())
+		s.logger.Error("创建模型调用日志失败", zap.Error(err))
 		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
 	}
+	s.historyChanged(ctx.Request().Context(), logKindCall, createdAt.Unix())
 
 	return protocol.Response(ctx, nil, map[string]interface{}{
 		"id":      statusReport.Id,
@@ -112,59 +119,43 @@ func (s *LogService) CreateModelsCallLog(ctx echo.Context,
 // @Router /log/getModelsCallLogList [post]
 func (s *LogService) GetModelsCallLogList(ctx echo.Context,
 	req requests.GetModelsCallLogListReq, resp responses.GetModelsCallLogListResp) error {
+	req.UserId = tenantUserId(ctx, req.UserId)
 	s.logger.Info("获取模型调用日志列表",
 		zap.String("traceId", req.TraceId),
 		zap.String("model", req.Model))
 
-	session := s.dao.NewSession()
-	defer session.Close()
-
 	// 默认分页
 	if req.PageInfo.Limit <= 0 {
 		req.PageInfo.Limit = 20
 	}
-	if req.PageInfo.Sort == "" {
-		req.PageInfo.Sort = "id desc"
+	if len(req.PageInfo.Sort) == 0 {
+		req.PageInfo.Sort = []requests.SortReq{{Field: "created_at", Order: storage.OrderDesc}}
 	}
 
-	query := session.Native().NewSession()
-	defer query.Close()
-
-	// 可选条件
-	if req.TraceId != "" {
-		query = query.Where("trace_id = ?", req.TraceId)
-	}
-	if req.Model != "" {
-		query = query.And("model = ?", req.Model)
-	}
-	if req.CallerKey != "" {
-		query = query.And("caller_key = ?", req.CallerKey)
-	}
-	if req.Step != "" {
-		query = query.And("step = ?", req.Step)
-	}
-	if req.ActualProviderId != "" {
-		query = query.And("actual_provider_id = ?", req.ActualProviderId)
-	}
-	if req.StartTime > 0 {
-		query = query.And("created_at >= ?", time.Unix(req.StartTime, 0))
+	filter, err := callLogFilter(req.UserId, req.Model, req.CallerKey, req.Step, req.ActualProviderId, req.StartTime, req.EndTime, req.Filter)
+	if err != nil {
+		return s.queryFailed(ctx, "解析模型调用日志过滤条件失败", err)
 	}
-	if req.EndTime > 0 {
-		query = query.And("created_at <= ?", time.Unix(req.EndTime, 0))
+	filter.TraceId = req.TraceId
+	if req.Explain {
+		return s.explain(ctx, func(c context.Context) error {
+			_, err := s.store.ListStatusReports(c, filter, pageOf(req.PageInfo, req.Fields))
+			return err
+		})
 	}
-
-	var logs []models.StatusReport
-	total, err := query.
-		OrderBy(req.PageInfo.Sort).
-		Limit(req.PageInfo.Limit, req.PageInfo.Skip).
-		FindAndCount(&logs)
+	result, err := cachedQuery(s, ctx.Request().Context(), logKindCall, storage.OpList, req, req.EndTime, req.NoCache,
+		func(c context.Context) (*storage.PageResult[models.StatusReport], error) {
+			return s.store.ListStatusReports(c, filter, pageOf(req.PageInfo, req.Fields))
+		})
 	if err != nil {
-		s.logger.Error("查询模型调用日志列表失败", zap.Error(err))
-		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+		return s.queryFailed(ctx, "查询模型调用日志列表失败", err)
 	}
 
-	resp.Logs = logs
-	resp.Total = int(total)
+	resp.Logs = storage.Project(result)
+	resp.Total = int(result.Total)
+	resp.TotalExact = result.TotalExact
+	resp.NextCursor = result.NextCursor
+	backend.AuditResult(ctx, int64(len(result.Rows)))
 
 	return protocol.Response(ctx, nil, resp)
 }
@@ -182,18 +173,95 @@ func (s *LogService) GetModelsCallLogDetail(ctx echo.Context,
 	req requests.GetModelsCallLogDetailReq, resp responses.DefaultResponse) error {
 	s.logger.Info("获取模型调用日志详情", zap.Uint64("id", req.Id))
 
-	session := s.dao.NewSession()
-	defer session.Close()
-
-	statusReport := &models.StatusReport{Id: req.Id}
-	ok, err := session.FindOne(statusReport)
+	var day time.Time
+	if req.CreatedAt > 0 {
+		day = time.Unix(req.CreatedAt, 0)
+	}
+	statusReport, err := s.store.GetStatusReport(ctx.Request().Context(), req.Id, day)
+	if errors.Is(err, storage.ErrNotFound) {
+		return protocol.Response(ctx, constants.ErrNotDataSet, nil)
+	}
+	if errors.Is(err, storage.ErrAmbiguousId) {
+		return protocol.Response(ctx, constants.ErrInvalidParams.AppendErrors(err), nil)
+	}
 	if err != nil {
-		s.logger.Error("查询模型调用日志失败", zap.Error(err))
-		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+		return s.queryFailed(ctx, "查询模型调用日志失败", err)
 	}
-	if !ok {
+	if !canRead(ctx, statusReport.UserId) {
 		return protocol.Response(ctx, constants.ErrNotDataSet, nil)
 	}
+	if encryptor := storage.GetEncryptStore(); encryptor != nil {
+		if err = encryptor.DecryptStatusReport(ctx.Request().Context(), statusReport); err != nil {
+			return s.queryFailed(ctx, "解密模型调用日志失败", err)
+		}
+	}
+
+	backend.AuditResult(ctx, 1)
+	return protocol.Response(ctx, nil, storage.ProjectRow(*statusReport))
+}
+
+// GetModelsCallLogStats 获取模型调用日志统计
+// @Summary 获取模型调用日志统计
+// @Description 统计时间范围内的调用量、失败数、平均延迟与延迟分位值
+// @Tags Log
+// @Accept json
+// @Produce json
+// @Param request body requests.GetModelsCallLogStatsReq true "获取模型调用日志统计请求"
+// @Success 200 {object} responses.GetModelsCallLogStatsResp
+// @Router /log/getModelsCallLogStats [post]
+func (s *LogService) GetModelsCallLogStats(ctx echo.Context,
+	req requests.GetModelsCallLogStatsReq, resp responses.GetModelsCallLogStatsResp) error {
+	req.UserId = tenantUserId(ctx, req.UserId)
+	s.logger.Info("获取模型调用日志统计",
+		zap.String("model", req.Model),
+		zap.String("step", req.Step))
+
+	filter, err := callLogFilter(req.UserId, req.Model, req.CallerKey, req.Step, req.ActualProviderId, req.StartTime, req.EndTime, req.Filter)
+	if err != nil {
+		return s.queryFailed(ctx, "解析模型调用日志过滤条件失败", err)
+	}
+	if req.Explain {
+		return s.explain(ctx, func(c context.Context) error {
+			_, err := s.store.StatusReportStats(c, filter)
+			return err
+		})
+	}
+	stats, err := cachedQuery(s, ctx.Request().Context(), logKindCall, storage.OpStats, req, req.EndTime, req.NoCache,
+		func(c context.Context) (*storage.CallLogStats, error) { return s.store.StatusReportStats(c, filter) })
+	if err != nil {
+		return s.queryFailed(ctx, "统计模型调用日志失败", err)
+	}
 
-	return protocol.Response(ctx, nil, statusReport)
+	resp.Total = stats.Total
+	resp.Failed = stats.Failed
+	resp.AvgLatency = stats.AvgLatency
+	resp.AvgTokensPerSec = stats.AvgTokensPerSec
+	resp.P50Latency = stats.P50Latency
+	resp.P95Latency = stats.P95Latency
+	resp.P99Latency = stats.P99Latency
+
+	return protocol.Response(ctx, nil, resp)
+}
+
+// callLogFilter 构造模型调用日志的公共过滤条件，秒级时间戳 0 表示不限
+func callLogFilter(userId int64, model, callerKey, step, actualProviderId string, startTime, endTime int64, expr string) (storage.StatusReportFilter, error) {
+	parsed, err := storage.ParseExpr(expr, models.StatusReport{})
+	if err != nil {
+		return storage.StatusReportFilter{}, err
+	}
+	filter := storage.StatusReportFilter{
+		UserId:           userId,
+		Model:            model,
+		CallerKey:        callerKey,
+		Step:             step,
+		ActualProviderId: actualProviderId,
+		Expr:             parsed,
+	}
+	if startTime > 0 {
+		filter.StartTime = time.Unix(startTime, 0)
+	}
+	if endTime > 0 {
+		filter.EndTime = time.Unix(endTime, 0)
+	}
+	return filter, nil
 }
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopLib/protocol"
+	"github.com/stardustagi/TopModelsLogs/backend"
+	"github.com/stardustagi/TopModelsLogs/constants"
+	"github.com/stardustagi/TopModelsLogs/protocol/requests"
+	"github.com/stardustagi/TopModelsLogs/protocol/responses"
+	"go.uber.org/zap"
+)
+
+// GetRateLimitUsage 查询限流与写入配额用量
+// @Summary 查询限流与写入配额用量
+// @Description 查询租户某天已写入的日志条数与字节数、每日上限，以及调用方各分组令牌桶的剩余令牌；没有 admin:quota 权限时只能查询自己的用量
+// @Tags Log
+// @Accept json
+// @Produce json
+// @Param request body requests.GetRateLimitUsageReq true "查询限流与写入配额用量请求"
+// @Success 200 {object} responses.GetRateLimitUsageResp
+// @Router /log/getRateLimitUsage [post]
+func (s *LogService) GetRateLimitUsage(ctx echo.Context,
+	req requests.GetRateLimitUsageReq, resp responses.GetRateLimitUsageResp) error {
+	if !backend.RateLimitEnabled() {
+		return protocol.Response(ctx, nil, resp)
+	}
+	c := ctx.Request().Context()
+	req = ownUsage(ctx, req)
+	usage, err := backend.GetIngestUsage(c, req.UserId, req.KeyId, req.Day)
+	if err != nil {
+		s.logger.Error("查询写入用量失败", zap.Int64("userId", req.UserId), zap.Error(err))
+		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+	}
+	buckets, err := backend.GetBucketUsage(c, backend.RateSubjects(req.UserId, req.KeyId, req.CallerKey))
+	if err != nil {
+		s.logger.Error("查询令牌桶失败", zap.Int64("userId", req.UserId), zap.Error(err))
+		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+	}
+
+	resp.Enabled = true
+	resp.Day = usage.Day
+	resp.UserId = usage.UserId
+	resp.KeyId = usage.KeyId
+	resp.Rows = usage.Rows
+	resp.Bytes = usage.Bytes
+	resp.DailyRows = usage.DailyRows
+	resp.DailyBytes = usage.DailyBytes
+	resp.Buckets = make([]responses.RateBucketInfo, 0, len(buckets))
+	for _, bucket := range buckets {
+		resp.Buckets = append(resp.Buckets, responses.RateBucketInfo{
+			Group:   bucket.Group,
+			Subject: bucket.Subject,
+			Tokens:  bucket.Tokens,
+			Rate:    bucket.Rate,
+			Burst:   bucket.Burst,
+		})
+	}
+	return protocol.Response(ctx, nil, resp)
+}
+
+// ownUsage 没有 admin:quota 权限的调用方只能查询自己：用户与服务密钥固定为调用方，不查询 caller_key
+func ownUsage(ctx echo.Context, req requests.GetRateLimitUsageReq) requests.GetRateLimitUsageReq {
+	p := backend.PrincipalFrom(ctx.Request().Context())
+	if p == nil || p.Allowed(backend.ScopeQuota) {
+		return req
+	}
+	req.UserId, req.KeyId, req.CallerKey = p.UserId, p.KeyId, ""
+	return req
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopLib/protocol"
+	"github.com/stardustagi/TopModelsLogs/backend"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/constants"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"github.com/stardustagi/TopModelsLogs/protocol/requests"
+	"github.com/stardustagi/TopModelsLogs/protocol/responses"
+	"go.uber.org/zap"
+)
+
+// SaveRole 创建或更新角色
+// @Summary 创建或更新角色
+// @Description 按名称创建或更新角色的权限与隐藏的列，绑定该角色的用户立即生效
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.SaveRoleReq true "创建或更新角色请求"
+// @Success 200 {object} models.Role
+// @Router /log/saveRole [post]
+func (s *LogService) SaveRole(ctx echo.Context,
+	req requests.SaveRoleReq, resp responses.DefaultResponse) error {
+	roles := storage.GetRoleStore()
+	if roles == nil {
+		return protocol.Response(ctx, constants.ErrNotEnabled, nil)
+	}
+	if err := backend.ValidateRoleScopes(req.Scopes); err != nil {
+		return protocol.Response(ctx, constants.ErrInvalidParams.AppendErrors(err), nil)
+	}
+	if err := storage.ValidateMaskFields(req.MaskFields); err != nil {
+		return protocol.Response(ctx, constants.ErrInvalidParams.AppendErrors(err), nil)
+	}
+	// 修改已有角色时，原有权限同样受审计员职责分离限制
+	existing, err := roles.Get(ctx.Request().Context(), req.Name)
+	if err != nil && !errors.Is(err, storage.ErrRoleNotFound) {
+		return s.roleFailed(ctx, "查询角色失败", err)
+	}
+	granted := [][]string{req.Scopes}
+	if existing != nil {
+		granted = append(granted, existing.ScopeList())
+	}
+	if err = backend.CheckRoleGrant(ctx.Request().Context(), granted...); err != nil {
+		return protocol.Response(ctx, constants.ErrPermissionDenied.AppendErrors(err), nil)
+	}
+	now := time.Now().Unix()
+	role := &models.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Scopes:      strings.Join(req.Scopes, ","),
+		MaskFields:  strings.Join(req.MaskFields, ","),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := roles.Save(ctx.Request().Context(), role); err != nil {
+		s.logger.Error("保存角色失败", zap.Error(err))
+		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+	}
+	backend.ForgetRoles(ctx.Request().Context())
+	s.logger.Info("保存角色",
+		zap.String("role", role.Name),
+		zap.String("scopes", role.Scopes),
+		zap.String("maskFields", role.MaskFields))
+	return protocol.Response(ctx, nil, role)
+}
+
+// DeleteRole 删除角色
+// @Summary 删除角色
+// @Description 删除角色并解除该角色的全部绑定
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.DeleteRoleReq true "删除角色请求"
+// @Success 200 {object} responses.DefaultResponse
+// @Router /log/deleteRole [post]
+func (s *LogService) DeleteRole(ctx echo.Context,
+	req requests.DeleteRoleReq, resp responses.DefaultResponse) error {
+	roles := storage.GetRoleStore()
+	if roles == nil {
+		return protocol.Response(ctx, constants.ErrNotEnabled, nil)
+	}
+	role, err := roles.Get(ctx.Request().Context(), req.Name)
+	if err != nil {
+		return s.roleFailed(ctx, "查询角色失败", err)
+	}
+	if err = backend.CheckRoleGrant(ctx.Request().Context(), role.ScopeList()); err != nil {
+		return protocol.Response(ctx, constants.ErrPermissionDenied.AppendErrors(err), nil)
+	}
+	if err = roles.Delete(ctx.Request().Context(), req.Name); err != nil {
+		return s.roleFailed(ctx, "删除角色失败", err)
+	}
+	backend.ForgetRoles(ctx.Request().Context())
+	s.logger.Info("删除角色", zap.String("role", req.Name))
+	resp.Message = "删除角色成功"
+	return protocol.Response(ctx, nil, resp)
+}
+
+// GetRoleList 获取角色列表
+// @Summary 获取角色列表
+// @Description 列出全部角色
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.GetRoleListReq true "获取角色列表请求"
+// @Success 200 {object} responses.GetRoleListResp
+// @Router /log/getRoleList [post]
+func (s *LogService) GetRoleList(ctx echo.Context,
+	req requests.GetRoleListReq, resp responses.GetRoleListResp) error {
+	roles := storage.GetRoleStore()
+	if roles == nil {
+		return protocol.Response(ctx, constants.ErrNotEnabled, nil)
+	}
+	list, err := roles.List(ctx.Request().Context())
+	if err != nil {
+		return s.roleFailed(ctx, "查询角色失败", err)
+	}
+	resp.Roles = list
+	return protocol.Response(ctx, nil, resp)
+}
+
+// BindUserRole 为用户绑定角色
+// @Summary 为用户绑定角色
+// @Description 绑定角色后用户不再使用默认权限，而是拥有所绑定角色权限的并集
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.BindUserRoleReq true "为用户绑定角色请求"
+// @Success 200 {object} responses.DefaultResponse
+// @Router /log/bindUserRole [post]
+func (s *LogService) BindUserRole(ctx echo.Context,
+	req requests.BindUserRoleReq, resp responses.DefaultResponse) error {
+	roles := storage.GetRoleStore()
+	if roles == nil {
+		return protocol.Response(ctx, constants.ErrNotEnabled, nil)
+	}
+	role, err := roles.Get(ctx.Request().Context(), req.Role)
+	if err != nil {
+		return s.roleFailed(ctx, "查询角色失败", err)
+	}
+	if err = backend.CheckRoleGrant(ctx.Request().Context(), role.ScopeList()); err != nil {
+		return protocol.Response(ctx, constants.ErrPermissionDenied.AppendErrors(err), nil)
+	}
+	binding := &models.UserRole{
+		UserId:    req.UserId,
+		RoleId:    role.Id,
+		CreatedBy: callerId(ctx),
+		CreatedAt: time.Now().Unix(),
+	}
+	if err = roles.Bind(ctx.Request().Context(), binding); err != nil {
+		return s.roleFailed(ctx, "绑定用户角色失败", err)
+	}
+	backend.ForgetRoles(ctx.Request().Context())
+	s.logger.Info("绑定用户角色", zap.Int64("userId", req.UserId), zap.String("role", req.Role))
+	resp.Message = "绑定用户角色成功"
+	return protocol.Response(ctx, nil, resp)
+}
+
+// UnbindUserRole 解除用户角色
+// @Summary 解除用户角色
+// @Description 解除全部角色后用户恢复默认权限
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.UnbindUserRoleReq true "解除用户角色请求"
+// @Success 200 {object} responses.DefaultResponse
+// @Router /log/unbindUserRole [post]
+func (s *LogService) UnbindUserRole(ctx echo.Context,
+	req requests.UnbindUserRoleReq, resp responses.DefaultResponse) error {
+	roles := storage.GetRoleStore()
+	if roles == nil {
+		return protocol.Response(ctx, constants.ErrNotEnabled, nil)
+	}
+	role, err := roles.Get(ctx.Request().Context(), req.Role)
+	if err != nil {
+		return s.roleFailed(ctx, "查询角色失败", err)
+	}
+	if err = backend.CheckRoleGrant(ctx.Request().Context(), role.ScopeList()); err != nil {
+		return protocol.Response(ctx, constants.ErrPermissionDenied.AppendErrors(err), nil)
+	}
+	ok, err := roles.Unbind(ctx.Request().Context(), req.UserId, role.Id)
+	if err != nil {
+		return s.roleFailed(ctx, "解除用户角色失败", err)
+	}
+	if !ok {
+		return protocol.Response(ctx, constants.ErrNotDataSet, nil)
+	}
+	backend.ForgetRoles(ctx.Request().Context())
+	s.logger.Info("解除用户角色", zap.Int64("userId", req.UserId), zap.String("role", req.Role))
+	resp.Message = "解除用户角色成功"
+	return protocol.Response(ctx, nil, resp)
+}
+
+// GetUserRoleList 获取用户角色绑定列表
+// @Summary 获取用户角色绑定列表
+// @Description 列出用户与角色的绑定
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.GetUserRoleListReq true "获取用户角色绑定列表请求"
+// @Success 200 {object} responses.GetUserRoleListResp
+// @Router /log/getUserRoleList [post]
+func (s *LogService) GetUserRoleList(ctx echo.Context,
+	req requests.GetUserRoleListReq, resp responses.GetUserRoleListResp) error {
+	roles := storage.GetRoleStore()
+	if roles == nil {
+		return protocol.Response(ctx, constants.ErrNotEnabled, nil)
+	}
+	list, err := roles.List(ctx.Request().Context())
+	if err != nil {
+		return s.roleFailed(ctx, "查询角色失败", err)
+	}
+	names := make(map[int64]string, len(list))
+	for _, role := range list {
+		names[role.Id] = role.Name
+	}
+	bindings, err := roles.Bindings(ctx.Request().Context(), req.UserId)
+	if err != nil {
+		return s.roleFailed(ctx, "查询用户角色失败", err)
+	}
+	resp.Bindings = make([]responses.UserRoleInfo, 0, len(bindings))
+	for _, binding := range bindings {
+		resp.Bindings = append(resp.Bindings, responses.UserRoleInfo{
+			UserId:    binding.UserId,
+			Role:      names[binding.RoleId],
+			CreatedBy: binding.CreatedBy,
+			CreatedAt: binding.CreatedAt,
+		})
+	}
+	return protocol.Response(ctx, nil, resp)
+}
+
+func (s *LogService) roleFailed(ctx echo.Context, msg string, err error) error {
+	if errors.Is(err, storage.ErrRoleNotFound) {
+		return protocol.Response(ctx, constants.ErrNotDataSet, nil)
+	}
+	s.logger.Error(msg, zap.Error(err))
+	return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+}
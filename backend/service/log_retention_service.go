@@ -0,0 +1,90 @@
+package service
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopLib/protocol"
+	"github.com/stardustagi/TopModelsLogs/backend"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/constants"
+	"github.com/stardustagi/TopModelsLogs/protocol/requests"
+	"github.com/stardustagi/TopModelsLogs/protocol/responses"
+	"go.uber.org/zap"
+)
+
+// retentionInterval 过期日志清理间隔
+const retentionInterval = time.Hour
+
+// retentionDays 配置的日志保留天数，0 表示不清理
+func retentionDays() int {
+	if config := storage.GetConfig(); config != nil {
+		return config.RetentionDays
+	}
+	return 0
+}
+
+// retentionLoop 按配置的保留天数定期清理过期日志，服务停止时退出
+func (s *LogService) retentionLoop(days int) {
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := s.purge(days); err != nil {
+			s.logger.Error("清理过期日志失败", zap.Error(err))
+		}
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *LogService) purge(days int) (*responses.PurgeLogsResp, error) {
+	before := time.Now().AddDate(0, 0, -days)
+	result, err := s.store.PurgeBefore(s.ctx, before)
+	if err != nil {
+		return nil, err
+	}
+	s.invalidateQueryCache(s.ctx, logKinds...)
+	s.logger.Info("清理过期日志",
+		zap.Time("before", before),
+		zap.Int64("apiLogs", result.ApiLogs),
+		zap.Int64("trainingLogs", result.TrainingLogs),
+		zap.Strings("droppedShards", result.DroppedShards))
+	return &responses.PurgeLogsResp{
+		Before:        before.Unix(),
+		ApiLogs:       result.ApiLogs,
+		TrainingLogs:  result.TrainingLogs,
+		DroppedShards: result.DroppedShards,
+	}, nil
+}
+
+// PurgeLogs 清理过期日志
+// @Summary 清理过期日志
+// @Description 删除保留天数之前的API日志、训练日志与模型调用日志分片
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.PurgeLogsReq true "清理过期日志请求"
+// @Success 200 {object} responses.PurgeLogsResp
+// @Router /log/purgeLogs [post]
+func (s *LogService) PurgeLogs(ctx echo.Context,
+	req requests.PurgeLogsReq, resp responses.PurgeLogsResp) error {
+	days := req.RetentionDays
+	if days <= 0 {
+		days = retentionDays()
+	}
+	if days <= 0 {
+		return protocol.Response(ctx, constants.ErrInvalidParams, nil)
+	}
+	s.logger.Info("手动清理过期日志", zap.Int("retentionDays", days))
+
+	result, err := s.purge(days)
+	if err != nil {
+		s.logger.Error("清理过期日志失败", zap.Error(err))
+		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+	}
+	backend.AuditResult(ctx, result.ApiLogs+result.TrainingLogs)
+	return protocol.Response(ctx, nil, result)
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopLib/protocol"
+	"github.com/stardustagi/TopModelsLogs/backend"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/protocol/requests"
+	"github.com/stardustagi/TopModelsLogs/protocol/responses"
+	"go.uber.org/zap"
+)
+
+// maxSearchLimit 单页检索结果上限
+const maxSearchLimit = 100
+
+// SearchApiLogs 检索API日志
+// @Summary 检索API日志
+// @Description 全文检索请求体与响应体，返回带高亮的摘要，默认按相关度排序
+// @Tags Log
+// @Accept json
+// @Produce json
+// @Param request body requests.SearchLogsReq true "全文检索请求"
+// @Success 200 {object} responses.SearchApiLogsResp
+// @Router /log/searchApiLogs [post]
+func (s *LogService) SearchApiLogs(ctx echo.Context,
+	req requests.SearchLogsReq, resp responses.SearchApiLogsResp) error {
+	req.UserId = tenantUserId(ctx, req.UserId)
+	s.logger.Info("检索API日志", zap.String("query", req.Query))
+
+	result, err := s.store.SearchApiLogs(ctx.Request().Context(), searchQuery(req))
+	if err != nil {
+		return s.queryFailed(ctx, "检索API日志失败", err)
+	}
+
+	resp.Hits = make([]responses.ApiLogSearchHit, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		resp.Hits = append(resp.Hits, responses.ApiLogSearchHit{Log: storage.ProjectRow(hit.Row), Score: hit.Score, Snippets: hit.Snippets})
+	}
+	resp.Total = int(result.Total)
+	resp.TotalExact = result.TotalExact
+	backend.AuditResult(ctx, int64(len(result.Hits)))
+
+	return protocol.Response(ctx, nil, resp)
+}
+
+// SearchModelsCallLogs 检索模型调用日志
+// @Summary 检索模型调用日志
+// @Description 全文检索状态消息，用于按上游错误信息定位调用，返回带高亮的摘要
+// @Tags Log
+// @Accept json
+// @Produce json
+// @Param request body requests.SearchLogsReq true "全文检索请求"
+// @Success 200 {object} responses.SearchModelsCallLogsResp
+// @Router /log/searchModelsCallLogs [post]
+func (s *LogService) SearchModelsCallLogs(ctx echo.Context,
+	req requests.SearchLogsReq, resp responses.SearchModelsCallLogsResp) error {
+	req.UserId = tenantUserId(ctx, req.UserId)
+	s.logger.Info("检索模型调用日志", zap.String("query", req.Query))
+
+	result, err := s.store.SearchStatusReports(ctx.Request().Context(), searchQuery(req))
+	if err != nil {
+		return s.queryFailed(ctx, "检索模型调用日志失败", err)
+	}
+
+	resp.Hits = make([]responses.CallLogSearchHit, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		resp.Hits = append(resp.Hits, responses.CallLogSearchHit{Log: storage.ProjectRow(hit.Row), Score: hit.Score, Snippets: hit.Snippets})
+	}
+	resp.Total = int(result.Total)
+	resp.TotalExact = result.TotalExact
+	backend.AuditResult(ctx, int64(len(result.Hits)))
+
+	return protocol.Response(ctx, nil, resp)
+}
+
+func searchQuery(req requests.SearchLogsReq) storage.SearchQuery {
+	q := storage.SearchQuery{
+		Text:    req.Query,
+		UserId:  req.UserId,
+		OrderBy: req.Order,
+		Skip:    max(req.Skip, 0),
+		Limit:   req.Limit,
+	}
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+	q.Limit = min(q.Limit, maxSearchLimit)
+	if req.StartTime > 0 {
+		q.StartTime = time.Unix(req.StartTime, 0)
+	}
+	if req.EndTime > 0 {
+		q.EndTime = time.Unix(req.EndTime, 0)
+	}
+	return q
+}
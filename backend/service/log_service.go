@@ -2,15 +2,17 @@ package service
 
 import (
 	"context"
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/labstack/echo/v4"
-	"github.com/stardustagi/TopLib/libs/databases"
 	"github.com/stardustagi/TopLib/libs/logs"
 	"github.com/stardustagi/TopLib/libs/redis"
 	"github.com/stardustagi/TopLib/libs/server"
 	"github.com/stardustagi/TopLib/protocol"
 	"github.com/stardustagi/TopModelsLogs/backend"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
 	"github.com/stardustagi/TopModelsLogs/constants"
 	"github.com/stardustagi/TopModelsLogs/models"
 	"github.com/stardustagi/TopModelsLogs/protocol/requests"
@@ -22,7 +24,7 @@ type LogService struct {
 	logger    *zap.Logger
 	ctx       context.Context
 	cancelCtx context.CancelFunc
-	dao       databases.BaseDao
+	store     storage.LogStore
 	rds       redis.RedisCli
 	app       *backend.Application
 }
@@ -42,12 +44,17 @@ func GetLogServiceInstance() *LogService {
 
 // NewLogService 创建新的日志服务
 func NewLogService() *LogService {
+	return NewLogServiceWithStore(storage.GetStore())
+}
+
+// NewLogServiceWithStore 使用指定存储创建日志服务
+func NewLogServiceWithStore(store storage.LogStore) *LogService {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &LogService{
 		logger:    logs.GetLogger("LogService"),
 		ctx:       ctx,
 		cancelCtx: cancel,
-		dao:       databases.GetDao(),
+		store:     store,
 		rds: redis.NewRedisView(redis.GetRedisDb(),
 			constants.ApplicationPrefix,
 			logs.GetLogger("LogRedis")),
@@ -60,6 +67,24 @@ func (s *LogService) Start(app *backend.Application) {
 	}
 	s.app = app
 	s.initialization()
+	if days := retentionDays(); days > 0 {
+		go s.retentionLoop(days)
+	}
+	if spooler := storage.GetSpoolStore(); spooler != nil {
+		go s.spoolReplayLoop(spooler)
+	}
+	if encryptor := storage.GetEncryptStore(); encryptor != nil {
+		go encryptor.Run(s.ctx)
+	}
+	if replicas := storage.GetReplicaSet(); replicas != nil {
+		go replicas.Run(s.ctx)
+	}
+	if audits := storage.GetAuditStore(); audits != nil && storage.GetConfig().Audit.RetentionDays > 0 {
+		go s.auditRetentionLoop(audits, storage.GetConfig().Audit.RetentionDays)
+	}
+	if chain := storage.GetHashChain(); chain != nil {
+		go chain.Run(s.ctx)
+	}
 	s.logger.Info("Starting LogService...")
 }
 
@@ -70,52 +95,202 @@ func (s *LogService) Stop() {
 }
 
 func (s *LogService) initialization() {
-	s.app.AddGroup("log", server.Request())
+	s.app.AddGroup("log", server.Request(), backend.LogUserAccess(), backend.NodeSignature(), backend.ReadPreference(), backend.QueryGuard())
 
 	s.app.AddPostHandler("log", server.NewHandler(
 		"createApiLog",
-		[]string{"log", "api"},
+		[]string{"log", "api", "ingest"},
 		s.CreateApiLog))
 
 	s.app.AddPostHandler("log", server.NewHandler(
 		"getApiLogList",
-		[]string{"log", "api"},
+		[]string{"log", "api", "read"},
 		s.GetApiLogList))
 
 	s.app.AddPostHandler("log", server.NewHandler(
 		"getApiLogDetail",
-		[]string{"log", "api"},
+		[]string{"log", "api", "read"},
 		s.GetApiLogDetail))
 
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getApiLogStats",
+		[]string{"log", "api", "stats"},
+		s.GetApiLogStats))
+
 	s.app.AddPostHandler("log", server.NewHandler(
 		"createModelTrainingLog",
-		[]string{"log", "training"},
+		[]string{"log", "training", "ingest"},
 		s.CreateModelTrainingLog))
 
 	s.app.AddPostHandler("log", server.NewHandler(
 		"getModelTrainingLogList",
-		[]string{"log", "training"},
+		[]string{"log", "training", "read"},
 		s.GetModelTrainingLogList))
 
 	s.app.AddPostHandler("log", server.NewHandler(
 		"getModelTrainingLogDetail",
-		[]string{"log", "training"},
+		[]string{"log", "training", "read"},
 		s.GetModelTrainingLogDetail))
 
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getModelTrainingLogStats",
+		[]string{"log", "training", "stats"},
+		s.GetModelTrainingLogStats))
+
 	s.app.AddPostHandler("log", server.NewHandler(
 		"createModelsCallLog",
-		[]string{"log", "call"},
+		[]string{"log", "call", "ingest"},
 		s.CreateModelsCallLog))
 
 	s.app.AddPostHandler("log", server.NewHandler(
 		"getModelsCallLogList",
-		[]string{"log", "call"},
+		[]string{"log", "call", "read"},
 		s.GetModelsCallLogList))
 
 	s.app.AddPostHandler("log", server.NewHandler(
 		"getModelsCallLogDetail",
-		[]string{"log", "call"},
+		[]string{"log", "call", "read"},
 		s.GetModelsCallLogDetail))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getModelsCallLogStats",
+		[]string{"log", "call", "stats"},
+		s.GetModelsCallLogStats))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"searchApiLogs",
+		[]string{"log", "api", "read"},
+		s.SearchApiLogs))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"searchModelsCallLogs",
+		[]string{"log", "call", "read"},
+		s.SearchModelsCallLogs))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getApiLogFacets",
+		[]string{"log", "api", "stats"},
+		s.GetApiLogFacets))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getModelTrainingLogFacets",
+		[]string{"log", "training", "stats"},
+		s.GetModelTrainingLogFacets))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getModelsCallLogFacets",
+		[]string{"log", "call", "stats"},
+		s.GetModelsCallLogFacets))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getApiLogHistogram",
+		[]string{"log", "api", "stats"},
+		s.GetApiLogHistogram))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getModelTrainingLogHistogram",
+		[]string{"log", "training", "stats"},
+		s.GetModelTrainingLogHistogram))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getModelsCallLogHistogram",
+		[]string{"log", "call", "stats"},
+		s.GetModelsCallLogHistogram))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"purgeLogs",
+		[]string{"log", "admin", "retention"},
+		s.PurgeLogs))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getSpoolStatus",
+		[]string{"log", "admin", "spool"},
+		s.GetSpoolStatus))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getMetrics",
+		[]string{"log", "admin", "metrics"},
+		s.GetMetrics))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"bindCallerKey",
+		[]string{"log", "admin", "tenants"},
+		s.BindCallerKey))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"unbindCallerKey",
+		[]string{"log", "admin", "tenants"},
+		s.UnbindCallerKey))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getCallerKeyList",
+		[]string{"log", "admin", "tenants"},
+		s.GetCallerKeyList))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"createApiKey",
+		[]string{"log", "admin", "keys"},
+		s.CreateApiKey))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getApiKeyList",
+		[]string{"log", "admin", "keys"},
+		s.GetApiKeyList))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"rotateApiKey",
+		[]string{"log", "admin", "keys"},
+		s.RotateApiKey))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"revokeApiKey",
+		[]string{"log", "admin", "keys"},
+		s.RevokeApiKey))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"saveRole",
+		[]string{"log", "admin", "rbac"},
+		s.SaveRole))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"deleteRole",
+		[]string{"log", "admin", "rbac"},
+		s.DeleteRole))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getRoleList",
+		[]string{"log", "admin", "rbac"},
+		s.GetRoleList))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"bindUserRole",
+		[]string{"log", "admin", "rbac"},
+		s.BindUserRole))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"unbindUserRole",
+		[]string{"log", "admin", "rbac"},
+		s.UnbindUserRole))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getUserRoleList",
+		[]string{"log", "admin", "rbac"},
+		s.GetUserRoleList))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getAuditEventList",
+		[]string{"log", "admin", "audit"},
+		s.GetAuditEventList))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"getRateLimitUsage",
+		[]string{"log", "self"},
+		s.GetRateLimitUsage))
+
+	s.app.AddPostHandler("log", server.NewHandler(
+		"verifyHashChain",
+		[]string{"log", "admin", "chain"},
+		s.VerifyHashChain))
 }
 
 // CreateApiLog 创建API调用日志
@@ -129,13 +304,20 @@ func (s *LogService) initialization() {
 // @Router /log/createApiLog [post]
 func (s *LogService) CreateApiLog(ctx echo.Context,
 	req requests.CreateApiLogReq, resp responses.DefaultResponse) error {
+	req.UserId = ingestUserId(ctx, req.UserId)
 	s.logger.Info("创建API调用日志",
 		zap.Int64("userId", req.UserId),
 		zap.String("apiPath", req.ApiPath))
+	charge, limited := backend.ChargeIngest(ctx.Request().Context(), req.UserId, 1,
+		int64(len(req.RequestBody)+len(req.ResponseBody)))
+	if limited != nil {
+		return backend.RejectLimited(ctx, limited)
+	}
 
-	session := s.dao.NewSession()
-	defer session.Close()
-
+	// 未指定创建时间时取当前时间，保证按保留期清理
+	if req.CreatedAt <= 0 {
+		req.CreatedAt = time.Now().Unix()
+	}
 	apiLog := &models.ApiLog{
 		UserId:       req.UserId,
 		ApiPath:      req.ApiPath,
@@ -149,11 +331,13 @@ func (s *LogService) CreateApiLog(ctx echo.Context,
 		CreatedAt:    req.CreatedAt,
 	}
 
-	_, err := session.InsertOne(apiLog)
+	err := s.store.InsertApiLog(ctx.Request().Context(), apiLog)
 	if err != nil {
+		charge.Refund(ctx.Request().Context())
 		s.logger.Error("创建API日志失败", zap.Error(err))
 		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
 	}
+	s.historyChanged(ctx.Request().Context(), logKindApi, apiLog.CreatedAt)
 
 	return protocol.Response(ctx, nil, map[string]interface{}{
 		"id":      apiLog.Id,
@@ -172,48 +356,40 @@ func (s *LogService) CreateApiLog(ctx echo.Context,
 // @Router /log/getApiLogList [post]
 func (s *LogService) GetApiLogList(ctx echo.Context,
 	req requests.GetApiLogListReq, resp responses.GetApiLogListResp) error {
+	req.UserId = tenantUserId(ctx, req.UserId)
 	s.logger.Info("获取API日志列表", zap.Int64("userId", req.UserId))
 
-	session := s.dao.NewSession()
-	defer session.Close()
-
 	// 默认分页
 	if req.PageInfo.Limit <= 0 {
 		req.PageInfo.Limit = 20
 	}
-	if req.PageInfo.Sort == "" {
-		req.PageInfo.Sort = "id desc"
+	if len(req.PageInfo.Sort) == 0 {
+		req.PageInfo.Sort = []requests.SortReq{{Field: "id", Order: storage.OrderDesc}}
 	}
 
-	query := session.Native().NewSession()
-	defer query.Close()
-
-	// 可选条件
-	if req.UserId > 0 {
-		query = query.Where("user_id = ?", req.UserId)
-	}
-	if req.ApiPath != "" {
-		query = query.And("api_path LIKE ?", "%"+req.ApiPath+"%")
-	}
-	if req.StartTime > 0 {
-		query = query.And("created_at >= ?", req.StartTime)
+	filter, err := apiLogFilter(req.UserId, req.ApiPath, req.StartTime, req.EndTime, req.Filter)
+	if err != nil {
+		return s.queryFailed(ctx, "解析API日志过滤条件失败", err)
 	}
-	if req.EndTime > 0 {
-		query = query.And("created_at <= ?", req.EndTime)
+	if req.Explain {
+		return s.explain(ctx, func(c context.Context) error {
+			_, err := s.store.ListApiLogs(c, filter, pageOf(req.PageInfo, req.Fields))
+			return err
+		})
 	}
-
-	var logs []models.ApiLog
-	total, err := query.
-		OrderBy(req.PageInfo.Sort).
-		Limit(req.PageInfo.Limit, req.PageInfo.Skip).
-		FindAndCount(&logs)
+	result, err := cachedQuery(s, ctx.Request().Context(), logKindApi, storage.OpList, req, req.EndTime, req.NoCache,
+		func(c context.Context) (*storage.PageResult[models.ApiLog], error) {
+			return s.store.ListApiLogs(c, filter, pageOf(req.PageInfo, req.Fields))
+		})
 	if err != nil {
-		s.logger.Error("查询API日志列表失败", zap.Error(err))
-		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+		return s.queryFailed(ctx, "查询API日志列表失败", err)
 	}
 
-	resp.Logs = logs
-	resp.Total = int(total)
+	resp.Logs = storage.Project(result)
+	resp.Total = int(result.Total)
+	resp.TotalExact = result.TotalExact
+	resp.NextCursor = result.NextCursor
+	backend.AuditResult(ctx, int64(len(result.Rows)))
 
 	return protocol.Response(ctx, nil, resp)
 }
@@ -231,20 +407,65 @@ func (s *LogService) GetApiLogDetail(ctx echo.Context,
 	req requests.GetApiLogDetailReq, resp responses.DefaultResponse) error {
 	s.logger.Info("获取API日志详情", zap.Int64("id", req.Id))
 
-	session := s.dao.NewSession()
-	defer session.Close()
-
-	apiLog := &models.ApiLog{Id: req.Id}
-	ok, err := session.FindOne(apiLog)
+	apiLog, err := s.store.GetApiLog(ctx.Request().Context(), req.Id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return protocol.Response(ctx, constants.ErrNotDataSet, nil)
+	}
 	if err != nil {
 		s.logger.Error("查询API日志失败", zap.Error(err))
 		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
 	}
-	if !ok {
+	if !canRead(ctx, apiLog.UserId) {
 		return protocol.Response(ctx, constants.ErrNotDataSet, nil)
 	}
+	if encryptor := storage.GetEncryptStore(); encryptor != nil {
+		if err = encryptor.DecryptApiLog(ctx.Request().Context(), apiLog); err != nil {
+			return s.queryFailed(ctx, "解密API日志失败", err)
+		}
+	}
 
-	return protocol.Response(ctx, nil, apiLog)
+	backend.AuditResult(ctx, 1)
+	return protocol.Response(ctx, nil, storage.ProjectRow(*apiLog))
+}
+
+// GetApiLogStats 获取API日志统计
+// @Summary 获取API日志统计
+// @Description 统计API调用量、失败数与耗时分位值
+// @Tags Log
+// @Accept json
+// @Produce json
+// @Param request body requests.GetApiLogStatsReq true "获取API日志统计请求"
+// @Success 200 {object} responses.GetApiLogStatsResp
+// @Router /log/getApiLogStats [post]
+func (s *LogService) GetApiLogStats(ctx echo.Context,
+	req requests.GetApiLogStatsReq, resp responses.GetApiLogStatsResp) error {
+	req.UserId = tenantUserId(ctx, req.UserId)
+	s.logger.Info("获取API日志统计", zap.Int64("userId", req.UserId))
+
+	filter, err := apiLogFilter(req.UserId, req.ApiPath, req.StartTime, req.EndTime, req.Filter)
+	if err != nil {
+		return s.queryFailed(ctx, "解析API日志过滤条件失败", err)
+	}
+	if req.Explain {
+		return s.explain(ctx, func(c context.Context) error {
+			_, err := s.store.ApiLogStats(c, filter)
+			return err
+		})
+	}
+	stats, err := cachedQuery(s, ctx.Request().Context(), logKindApi, storage.OpStats, req, req.EndTime, req.NoCache,
+		func(c context.Context) (*storage.ApiLogStats, error) { return s.store.ApiLogStats(c, filter) })
+	if err != nil {
+		return s.queryFailed(ctx, "统计API日志失败", err)
+	}
+
+	resp.Total = stats.Total
+	resp.Failed = stats.Failed
+	resp.AvgDuration = stats.AvgDuration
+	resp.P50Duration = stats.P50Duration
+	resp.P95Duration = stats.P95Duration
+	resp.P99Duration = stats.P99Duration
+
+	return protocol.Response(ctx, nil, resp)
 }
 
 // CreateModelTrainingLog 创建模型训练日志
@@ -258,13 +479,18 @@ func (s *LogService) GetApiLogDetail(ctx echo.Context,
 // @Router /log/createModelTrainingLog [post]
 func (s *LogService) CreateModelTrainingLog(ctx echo.Context,
 	req requests.CreateModelTrainingLogReq, resp responses.DefaultResponse) error {
+	req.UserId = ingestUserId(ctx, req.UserId)
 	s.logger.Info("创建模型训练日志",
 		zap.Int64("userId", req.UserId),
 		zap.String("modelName", req.ModelName))
+	charge, limited := backend.ChargeIngest(ctx.Request().Context(), req.UserId, 1, int64(len(req.LogMessage)))
+	if limited != nil {
+		return backend.RejectLimited(ctx, limited)
+	}
 
-	session := s.dao.NewSession()
-	defer session.Close()
-
+	if req.CreatedAt <= 0 {
+		req.CreatedAt = time.Now().Unix()
+	}
 	trainingLog := &models.ModelTrainingLog{
 		UserId:       req.UserId,
 		ModelId:      req.ModelId,
@@ -279,11 +505,13 @@ func (s *LogService) CreateModelTrainingLog(ctx echo.Context,
 		CreatedAt:    req.CreatedAt,
 	}
 
-	_, err := session.InsertOne(trainingLog)
+	err := s.store.InsertModelTrainingLog(ctx.Request().Context(), trainingLog)
 	if err != nil {
+		charge.Refund(ctx.Request().Context())
 		s.logger.Error("创建模型训练日志失败", zap.Error(err))
 		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
 	}
+	s.historyChanged(ctx.Request().Context(), logKindTraining, trainingLog.CreatedAt)
 
 	return protocol.Response(ctx, nil, map[string]interface{}{
 		"id":      trainingLog.Id,
@@ -302,54 +530,40 @@ func (s *LogService) CreateModelTrainingLog(ctx echo.Context,
 // @Router /log/getModelTrainingLogList [post]
 func (s *LogService) GetModelTrainingLogList(ctx echo.Context,
 	req requests.GetModelTrainingLogListReq, resp responses.GetModelTrainingLogListResp) error {
+	req.UserId = tenantUserId(ctx, req.UserId)
 	s.logger.Info("获取模型训练日志列表", zap.Int64("modelId", req.ModelId))
 
-	session := s.dao.NewSession()
-	defer session.Close()
-
 	// 默认分页
 	if req.PageInfo.Limit <= 0 {
 		req.PageInfo.Limit = 20
 	}
-	if req.PageInfo.Sort == "" {
-		req.PageInfo.Sort = "id desc"
+	if len(req.PageInfo.Sort) == 0 {
+		req.PageInfo.Sort = []requests.SortReq{{Field: "id", Order: storage.OrderDesc}}
 	}
 
-	query := session.Native().NewSession()
-	defer query.Close()
-
-	// 可选条件
-	if req.UserId > 0 {
-		query = query.Where("user_id = ?", req.UserId)
-	}
-	if req.ModelId > 0 {
-		query = query.And("model_id = ?", req.ModelId)
-	}
-	if req.Status != "" {
-		query = query.And("status = ?", req.Status)
-	}
-	if req.LogLevel != "" {
-		query = query.And("log_level = ?", req.LogLevel)
-	}
-	if req.StartTime > 0 {
-		query = query.And("created_at >= ?", req.StartTime)
+	filter, err := trainingLogFilter(req.UserId, req.ModelId, req.Status, req.LogLevel, req.StartTime, req.EndTime, req.Filter)
+	if err != nil {
+		return s.queryFailed(ctx, "解析模型训练日志过滤条件失败", err)
 	}
-	if req.EndTime > 0 {
-		query = query.And("created_at <= ?", req.EndTime)
+	if req.Explain {
+		return s.explain(ctx, func(c context.Context) error {
+			_, err := s.store.ListModelTrainingLogs(c, filter, pageOf(req.PageInfo, req.Fields))
+			return err
+		})
 	}
-
-	var logs []models.ModelTrainingLog
-	total, err := query.
-		OrderBy(req.PageInfo.Sort).
-		Limit(req.PageInfo.Limit, req.PageInfo.Skip).
-		FindAndCount(&logs)
+	result, err := cachedQuery(s, ctx.Request().Context(), logKindTraining, storage.OpList, req, req.EndTime, req.NoCache,
+		func(c context.Context) (*storage.PageResult[models.ModelTrainingLog], error) {
+			return s.store.ListModelTrainingLogs(c, filter, pageOf(req.PageInfo, req.Fields))
+		})
 	if err != nil {
-		s.logger.Error("查询模型训练日志列表失败", zap.Error(err))
-		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+		return s.queryFailed(ctx, "查询模型训练日志列表失败", err)
 	}
 
-	resp.Logs = logs
-	resp.Total = int(total)
+	resp.Logs = storage.Project(result)
+	resp.Total = int(result.Total)
+	resp.TotalExact = result.TotalExact
+	resp.NextCursor = result.NextCursor
+	backend.AuditResult(ctx, int64(len(result.Rows)))
 
 	return protocol.Response(ctx, nil, resp)
 }
@@ -367,18 +581,150 @@ func (s *LogService) GetModelTrainingLogDetail(ctx echo.Context,
 	req requests.GetModelTrainingLogDetailReq, resp responses.DefaultResponse) error {
 	s.logger.Info("获取模型训练日志详情", zap.Int64("id", req.Id))
 
-	session := s.dao.NewSession()
-	defer session.Close()
-
-	trainingLog := &models.ModelTrainingLog{Id: req.Id}
-	ok, err := session.FindOne(trainingLog)
+	trainingLog, err := s.store.GetModelTrainingLog(ctx.Request().Context(), req.Id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return protocol.Response(ctx, constants.ErrNotDataSet, nil)
+	}
 	if err != nil {
 		s.logger.Error("查询模型训练日志失败", zap.Error(err))
 		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
 	}
-	if !ok {
+	if !canRead(ctx, trainingLog.UserId) {
 		return protocol.Response(ctx, constants.ErrNotDataSet, nil)
 	}
 
+	backend.AuditResult(ctx, 1)
 	return protocol.Response(ctx, nil, trainingLog)
 }
+
+// GetModelTrainingLogStats 获取模型训练日志统计
+// @Summary 获取模型训练日志统计
+// @Description 统计训练日志数量、错误数与损失/准确率
+// @Tags Log
+// @Accept json
+// @Produce json
+// @Param request body requests.GetModelTrainingLogStatsReq true "获取模型训练日志统计请求"
+// @Success 200 {object} responses.GetModelTrainingLogStatsResp
+// @Router /log/getModelTrainingLogStats [post]
+func (s *LogService) GetModelTrainingLogStats(ctx echo.Context,
+	req requests.GetModelTrainingLogStatsReq, resp responses.GetModelTrainingLogStatsResp) error {
+	req.UserId = tenantUserId(ctx, req.UserId)
+	s.logger.Info("获取模型训练日志统计", zap.Int64("modelId", req.ModelId))
+
+	filter, err := trainingLogFilter(req.UserId, req.ModelId, req.Status, req.LogLevel, req.StartTime, req.EndTime, req.Filter)
+	if err != nil {
+		return s.queryFailed(ctx, "解析模型训练日志过滤条件失败", err)
+	}
+	if req.Explain {
+		return s.explain(ctx, func(c context.Context) error {
+			_, err := s.store.ModelTrainingLogStats(c, filter)
+			return err
+		})
+	}
+	stats, err := cachedQuery(s, ctx.Request().Context(), logKindTraining, storage.OpStats, req, req.EndTime, req.NoCache,
+		func(c context.Context) (*storage.ModelTrainingLogStats, error) {
+			return s.store.ModelTrainingLogStats(c, filter)
+		})
+	if err != nil {
+		return s.queryFailed(ctx, "统计模型训练日志失败", err)
+	}
+
+	resp.Total = stats.Total
+	resp.Errors = stats.Errors
+	resp.AvgLoss = stats.AvgLoss
+	resp.MinLoss = stats.MinLoss
+	resp.MaxAccuracy = stats.MaxAccuracy
+	resp.MaxEpoch = stats.MaxEpoch
+
+	return protocol.Response(ctx, nil, resp)
+}
+
+// pageOf 构造分页参数，fields 为列表返回的列
+func pageOf(page requests.PageReq, fields []string) storage.Page {
+	sort := make([]storage.SortField, 0, len(page.Sort))
+	for _, field := range page.Sort {
+		sort = append(sort, storage.SortField{Field: field.Field, Order: field.Order})
+	}
+	return storage.Page{
+		Skip:      page.Skip,
+		Limit:     page.Limit,
+		Sort:      sort,
+		Cursor:    page.Cursor,
+		CountMode: page.CountMode,
+		Fields:    fields,
+	}
+}
+
+// explain 试运行查询，返回执行计划而不返回数据
+func (s *LogService) explain(ctx echo.Context, query func(ctx context.Context) error) error {
+	plan, err := storage.Explain(ctx.Request().Context(), query)
+	if err != nil {
+		return s.queryFailed(ctx, "获取查询执行计划失败", err)
+	}
+	return protocol.Response(ctx, nil, responses.ExplainResp{Explain: plan})
+}
+
+// queryFailed 查询失败的响应：参数校验错误逐项返回不合法的参数，超出查询上限时返回触发的上限，游标错误按参数错误返回，未开启的功能单独提示，其余按服务器错误返回
+func (s *LogService) queryFailed(ctx echo.Context, msg string, err error) error {
+	var invalid *storage.ValidationError
+	if errors.As(err, &invalid) && errors.Is(err, storage.ErrMaskedField) {
+		return ctx.JSON(200, protocol.BaseResponse{
+			ErrCode: constants.ErrPermissionDenied.Code(),
+			ErrMsg:  invalid.Error(),
+			Data:    responses.ValidationErrorResp{Errors: invalid.Errors},
+		})
+	}
+	if errors.As(err, &invalid) {
+		return ctx.JSON(200, protocol.BaseResponse{
+			ErrCode: constants.ErrInvalidParams.Code(),
+			ErrMsg:  invalid.Error(),
+			Data:    responses.ValidationErrorResp{Errors: invalid.Errors},
+		})
+	}
+	var limited *storage.LimitError
+	if errors.As(err, &limited) {
+		return ctx.JSON(200, protocol.BaseResponse{
+			ErrCode: constants.ErrQueryLimited.Code(),
+			ErrMsg:  limited.Error(),
+			Data:    responses.QueryLimitResp{Limit: limited},
+		})
+	}
+	if errors.Is(err, storage.ErrInvalidCursor) {
+		return protocol.Response(ctx, constants.ErrInvalidParams.AppendErrors(err), nil)
+	}
+	if errors.Is(err, storage.ErrSearchDisabled) {
+		return protocol.Response(ctx, constants.ErrNotEnabled.AppendErrors(err), nil)
+	}
+	s.logger.Error(msg, zap.Error(err))
+	return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+}
+
+func apiLogFilter(userId int64, apiPath string, startTime, endTime int64, expr string) (storage.ApiLogFilter, error) {
+	parsed, err := storage.ParseExpr(expr, models.ApiLog{})
+	if err != nil {
+		return storage.ApiLogFilter{}, err
+	}
+	return storage.ApiLogFilter{
+		UserId:    userId,
+		ApiPath:   apiPath,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Expr:      parsed,
+	}, nil
+}
+
+func trainingLogFilter(userId, modelId int64, status, logLevel string, startTime, endTime int64, expr string) (storage.ModelTrainingLogFilter, error) {
+	parsed, err := storage.ParseExpr(expr, models.ModelTrainingLog{})
+	if err != nil {
+		return storage.ModelTrainingLogFilter{}, err
+	}
+	return storage.ModelTrainingLogFilter{
+		UserId:    userId,
+		ModelId:   modelId,
+		Status:    status,
+		LogLevel:  logLevel,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Expr:      parsed,
+	}, nil
+}
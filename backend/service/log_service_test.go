@@ -0,0 +1,487 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/constants"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"github.com/stardustagi/TopModelsLogs/protocol/requests"
+	"github.com/stardustagi/TopModelsLogs/protocol/responses"
+	"xorm.io/xorm"
+	"xorm.io/xorm/names"
+)
+
+// 处理函数测试：同一组请求分别在内存存储与嵌入式 SQLite 存储上执行，两者的过滤与分页结果必须一致
+
+// testStores 内存存储与 SQLite 存储
+func testStores(t *testing.T) map[string]storage.LogStore {
+	t.Helper()
+	e, err := xorm.NewEngine("sqlite", "file:"+filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetMapper(names.GonicMapper{})
+	e.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = e.Close() })
+	if err = e.Sync2(new(models.ApiLog), new(models.ModelTrainingLog)); err != nil {
+		t.Fatal(err)
+	}
+	d, err := storage.NewDialect(storage.DialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := storage.NewShardManager(e, d, storage.ShardModeTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sql, err := storage.NewSQLStore(e, d, m, nil, storage.SearchConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]storage.LogStore{"memory": storage.NewMemoryStore(), "sqlite": sql}
+}
+
+// call 调用处理函数，响应的 data 解析到 out，返回错误码
+func call[Req, Resp any](t *testing.T, handler func(echo.Context, Req, Resp) error, req Req, out any) int {
+	t.Helper()
+	return callAs(t, context.Background(), handler, req, out)
+}
+
+// callAs 以 ctx（记录调用方与脱敏列）调用处理函数
+func callAs[Req, Resp any](t *testing.T, ctx context.Context, handler func(echo.Context, Req, Resp) error, req Req, out any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil).WithContext(ctx), rec)
+	var resp Resp
+	if err := handler(c, req, resp); err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Errcode int             `json:"errcode"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Errcode == 0 && out != nil {
+		if err := json.Unmarshal(body.Data, out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return body.Errcode
+}
+
+// listResp 列表响应，Projected 只用于序列化，按完整结构解析
+type listResp[T any] struct {
+	Logs       []T    `json:"logs"`
+	Total      int    `json:"total"`
+	TotalExact bool   `json:"total_exact"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// seedApiLogs 30 条 API 日志：user_id 依次为 1/2/3，偶数为 /v1/Chat，奇数为 /v1/embeddings，每 5 条一条 500
+func seedApiLogs(t *testing.T, store storage.LogStore) {
+	t.Helper()
+	for i := 1; i <= 30; i++ {
+		log := &models.ApiLog{
+			UserId:     int64(1 + (i-1)%3),
+			ApiPath:    "/v1/embeddings",
+			Method:     "POST",
+			StatusCode: 200,
+			Duration:   int64(i * 10),
+			CreatedAt:  int64(1000 + i),
+		}
+		if i%2 == 0 {
+			log.ApiPath = "/v1/Chat"
+		}
+		if i%5 == 0 {
+			log.StatusCode = 500
+		}
+		if err := store.InsertApiLog(context.Background(), log); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func apiLogIds(logs []models.ApiLog) []int64 {
+	ids := make([]int64, 0, len(logs))
+	for _, l := range logs {
+		ids = append(ids, l.Id)
+	}
+	return ids
+}
+
+func TestGetApiLogList(t *testing.T) {
+	page := func(skip, limit int, sort ...requests.SortReq) requests.PageReq {
+		return requests.PageReq{Skip: skip, Limit: limit, Sort: sort}
+	}
+	cases := []struct {
+		name      string
+		req       requests.GetApiLogListReq
+		wantIds   []int64
+		wantTotal int
+	}{
+		{"default sort by id desc", requests.GetApiLogListReq{PageInfo: page(0, 5)},
+			[]int64{30, 29, 28, 27, 26}, 30},
+		{"skip", requests.GetApiLogListReq{PageInfo: page(27, 5)},
+			[]int64{3, 2, 1}, 30},
+		{"user", requests.GetApiLogListReq{UserId: 2, PageInfo: page(0, 3)},
+			[]int64{29, 26, 23}, 10},
+		{"api path is a case-insensitive substring", requests.GetApiLogListReq{ApiPath: "chat", PageInfo: page(0, 2)},
+			[]int64{30, 28}, 15},
+		{"time range is inclusive", requests.GetApiLogListReq{StartTime: 1005, EndTime: 1008, PageInfo: page(0, 10)},
+			[]int64{8, 7, 6, 5}, 4},
+		{"filter expression", requests.GetApiLogListReq{Filter: "status_code >= 500 and duration > 100", PageInfo: page(0, 10)},
+			[]int64{30, 25, 20, 15}, 4},
+		{"filter like", requests.GetApiLogListReq{Filter: `api_path like "/v1/emb%" and user_id in (1, 3)`, EndTime: 1010, PageInfo: page(0, 10)},
+			[]int64{9, 7, 3, 1}, 4},
+		{"sort by user then id asc", requests.GetApiLogListReq{PageInfo: page(0, 4,
+			requests.SortReq{Field: "user_id", Order: storage.OrderDesc}, requests.SortReq{Field: "id", Order: storage.OrderAsc})},
+			[]int64{3, 6, 9, 12}, 30},
+		{"no match", requests.GetApiLogListReq{UserId: 9, PageInfo: page(0, 10)},
+			[]int64{}, 0},
+	}
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := NewLogServiceWithStore(store)
+			seedApiLogs(t, store)
+			for _, c := range cases {
+				var resp listResp[models.ApiLog]
+				code := call(t, s.GetApiLogList, c.req, &resp)
+				if code != 0 {
+					t.Fatalf("%s: errcode %d", c.name, code)
+				}
+				if ids := apiLogIds(resp.Logs); !slices.Equal(ids, c.wantIds) {
+					t.Errorf("%s: ids %v, want %v", c.name, ids, c.wantIds)
+				}
+				if resp.Total != c.wantTotal || !resp.TotalExact {
+					t.Errorf("%s: total %d (exact %v), want %d", c.name, resp.Total, resp.TotalExact, c.wantTotal)
+				}
+			}
+		})
+	}
+}
+
+func TestGetApiLogListCursor(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := NewLogServiceWithStore(store)
+			seedApiLogs(t, store)
+			req := requests.GetApiLogListReq{
+				ApiPath: "/v1/",
+				PageInfo: requests.PageReq{Limit: 7, CountMode: storage.CountNone, Sort: []requests.SortReq{
+					{Field: "api_path", Order: storage.OrderAsc}, {Field: "created_at", Order: storage.OrderDesc}}},
+			}
+			var got []int64
+			for pages := 0; ; pages++ {
+				if pages > 10 {
+					t.Fatal("cursor does not advance")
+				}
+				var resp listResp[models.ApiLog]
+				code := call(t, s.GetApiLogList, req, &resp)
+				if code != 0 {
+					t.Fatalf("errcode %d", code)
+				}
+				if resp.Total != -1 {
+					t.Errorf("total %d with count_mode none", resp.Total)
+				}
+				got = append(got, apiLogIds(resp.Logs)...)
+				if resp.NextCursor == "" {
+					break
+				}
+				req.PageInfo.Cursor = resp.NextCursor
+			}
+			// /v1/Chat 的偶数 id 在前（大写字母排在小写之前），各自按时间倒序
+			var want []int64
+			for i := int64(30); i >= 2; i -= 2 {
+				want = append(want, i)
+			}
+			for i := int64(29); i >= 1; i -= 2 {
+				want = append(want, i)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("ids %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestGetApiLogListInvalid(t *testing.T) {
+	cases := []struct {
+		name string
+		req  requests.GetApiLogListReq
+	}{
+		{"unsortable field", requests.GetApiLogListReq{PageInfo: requests.PageReq{Sort: []requests.SortReq{{Field: "duration"}}}}},
+		{"bad filter", requests.GetApiLogListReq{Filter: "status_code >>= 1"}},
+		{"unknown field", requests.GetApiLogListReq{Fields: []string{"password"}}},
+		{"bad cursor", requests.GetApiLogListReq{PageInfo: requests.PageReq{Cursor: "not-a-cursor"}}},
+	}
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := NewLogServiceWithStore(store)
+			for _, c := range cases {
+				if code := call(t, s.GetApiLogList, c.req, nil); code == 0 {
+					t.Errorf("%s: accepted", c.name)
+				}
+			}
+		})
+	}
+}
+
+// seedCallLogs 2026-03-01、02 两天各 6 条模型调用日志，created_at 各不相同，model 交替为 gpt / claude
+func seedCallLogs(t *testing.T, store storage.LogStore) {
+	t.Helper()
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	for day := 0; day < 2; day++ {
+		for i := 0; i < 6; i++ {
+			report := &models.StatusReport{
+				TraceId:   fmt.Sprintf("t%d-%d", day, i),
+				Model:     []string{"gpt", "claude"}[i%2],
+				UserId:    int64(1 + i%3),
+				Latency:   fmt.Sprintf("%d.5", i),
+				CreatedAt: base.AddDate(0, 0, day).Add(time.Duration(i) * time.Minute),
+			}
+			if i == 5 {
+				report.StatusCode = "500"
+			}
+			if err := store.InsertStatusReport(context.Background(), report); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func traceIds(reports []models.StatusReport) []string {
+	ids := make([]string, 0, len(reports))
+	for _, r := range reports {
+		ids = append(ids, r.TraceId)
+	}
+	return ids
+}
+
+func TestGetModelsCallLogList(t *testing.T) {
+	base := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	cases := []struct {
+		name      string
+		req       requests.GetModelsCallLogListReq
+		want      []string
+		wantTotal int
+	}{
+		{"newest first across shards", requests.GetModelsCallLogListReq{PageInfo: requests.PageReq{Limit: 3}},
+			[]string{"t1-5", "t1-4", "t1-3"}, 12},
+		{"skip crosses the day boundary", requests.GetModelsCallLogListReq{PageInfo: requests.PageReq{Skip: 5, Limit: 3}},
+			[]string{"t1-0", "t0-5", "t0-4"}, 12},
+		{"model", requests.GetModelsCallLogListReq{Model: "claude", PageInfo: requests.PageReq{Limit: 10}},
+			[]string{"t1-5", "t1-3", "t1-1", "t0-5", "t0-3", "t0-1"}, 6},
+		{"time range is inclusive", requests.GetModelsCallLogListReq{
+			StartTime: base.Add(4 * time.Minute).Unix(), EndTime: base.AddDate(0, 0, 1).Add(time.Minute).Unix(),
+			PageInfo: requests.PageReq{Limit: 10}},
+			[]string{"t1-1", "t1-0", "t0-5", "t0-4"}, 4},
+		{"filter expression", requests.GetModelsCallLogListReq{Filter: `status_code != "" or latency < 1`,
+			PageInfo: requests.PageReq{Limit: 10, Sort: []requests.SortReq{{Field: "created_at", Order: storage.OrderAsc}}}},
+			[]string{"t0-0", "t0-5", "t1-0", "t1-5"}, 4},
+		{"user and trace", requests.GetModelsCallLogListReq{UserId: 3, TraceId: "t0-2", PageInfo: requests.PageReq{Limit: 10}},
+			[]string{"t0-2"}, 1},
+	}
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := NewLogServiceWithStore(store)
+			seedCallLogs(t, store)
+			for _, c := range cases {
+				var resp listResp[models.StatusReport]
+				code := call(t, s.GetModelsCallLogList, c.req, &resp)
+				if code != 0 {
+					t.Fatalf("%s: errcode %d", c.name, code)
+				}
+				got := make([]string, 0, len(resp.Logs))
+				for _, l := range resp.Logs {
+					got = append(got, l.TraceId)
+				}
+				if !slices.Equal(got, c.want) {
+					t.Errorf("%s: traces %v, want %v", c.name, got, c.want)
+				}
+				if resp.Total != c.wantTotal {
+					t.Errorf("%s: total %d, want %d", c.name, resp.Total, c.wantTotal)
+				}
+			}
+
+			// 游标翻页跨日分片不重不漏
+			req := requests.GetModelsCallLogListReq{PageInfo: requests.PageReq{Limit: 5}}
+			var got []string
+			for {
+				var resp listResp[models.StatusReport]
+				code := call(t, s.GetModelsCallLogList, req, &resp)
+				if code != 0 {
+					t.Fatalf("cursor: errcode %d", code)
+				}
+				for _, l := range resp.Logs {
+					got = append(got, l.TraceId)
+				}
+				if resp.NextCursor == "" || len(got) > 12 {
+					break
+				}
+				req.PageInfo.Cursor = resp.NextCursor
+			}
+			want := []string{"t1-5", "t1-4", "t1-3", "t1-2", "t1-1", "t1-0", "t0-5", "t0-4", "t0-3", "t0-2", "t0-1", "t0-0"}
+			if !slices.Equal(got, want) {
+				t.Errorf("cursor: traces %v, want %v", got, want)
+			}
+
+			// 其它排序下游标翻页与一次取全部的顺序一致
+			for _, sort := range [][]requests.SortReq{
+				{{Field: "created_at", Order: storage.OrderAsc}},
+				{{Field: "model", Order: storage.OrderAsc}},
+				{{Field: "model", Order: storage.OrderDesc}, {Field: "trace_id", Order: storage.OrderAsc}},
+			} {
+				var all listResp[models.StatusReport]
+				call(t, s.GetModelsCallLogList, requests.GetModelsCallLogListReq{PageInfo: requests.PageReq{Limit: 100, Sort: sort}}, &all)
+				req := requests.GetModelsCallLogListReq{PageInfo: requests.PageReq{Limit: 5, Sort: sort}}
+				var paged []models.StatusReport
+				for {
+					var resp listResp[models.StatusReport]
+					if code := call(t, s.GetModelsCallLogList, req, &resp); code != 0 {
+						t.Fatalf("cursor %v: errcode %d", sort, code)
+					}
+					paged = append(paged, resp.Logs...)
+					if resp.NextCursor == "" || len(paged) > 12 {
+						break
+					}
+					req.PageInfo.Cursor = resp.NextCursor
+				}
+				if len(all.Logs) != 12 || !slices.Equal(traceIds(paged), traceIds(all.Logs)) {
+					t.Errorf("cursor %v: traces %v, want %v", sort, traceIds(paged), traceIds(all.Logs))
+				}
+			}
+		})
+	}
+}
+
+func TestGetModelsCallLogDetail(t *testing.T) {
+	day1 := time.Date(2026, 3, 2, 10, 0, 0, 0, time.Local).Unix()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := NewLogServiceWithStore(store)
+			seedCallLogs(t, store)
+			// 内存存储的ID全局自增，SQLite 日分表的ID按天从 1 开始
+			id := uint64(1)
+			if name == "memory" {
+				id = 7
+			}
+			var report models.StatusReport
+			if code := call(t, s.GetModelsCallLogDetail, requests.GetModelsCallLogDetailReq{Id: id, CreatedAt: day1}, &report); code != 0 {
+				t.Fatalf("with created_at: errcode %d", code)
+			}
+			if report.TraceId != "t1-0" {
+				t.Errorf("with created_at: trace %s, want t1-0", report.TraceId)
+			}
+			// 分表模式下每个日分表都有 id 1，未指定日期时不能任选一条返回
+			code := call(t, s.GetModelsCallLogDetail, requests.GetModelsCallLogDetailReq{Id: 1}, nil)
+			if name == "sqlite" && code != constants.ErrInvalidParams.Code() {
+				t.Errorf("ambiguous id: errcode %d, want %d", code, constants.ErrInvalidParams.Code())
+			}
+			if code = call(t, s.GetModelsCallLogDetail, requests.GetModelsCallLogDetailReq{Id: 99, CreatedAt: day1}, nil); code != constants.ErrNotDataSet.Code() {
+				t.Errorf("missing id: errcode %d, want %d", code, constants.ErrNotDataSet.Code())
+			}
+		})
+	}
+}
+
+func TestGetApiLogStats(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := NewLogServiceWithStore(store)
+			seedApiLogs(t, store)
+			var resp responses.GetApiLogStatsResp
+			code := call(t, s.GetApiLogStats, requests.GetApiLogStatsReq{UserId: 1}, &resp)
+			if code != 0 {
+				t.Fatalf("errcode %d", code)
+			}
+			// user 1: id 1,4,...,28，其中 10、25 为 500
+			want := responses.GetApiLogStatsResp{Total: 10, Failed: 2, AvgDuration: 145}
+			if resp.Total != want.Total || resp.Failed != want.Failed || resp.AvgDuration != want.AvgDuration {
+				t.Errorf("stats %+v, want %+v", resp, want)
+			}
+		})
+	}
+}
+
+func TestMaskedFields(t *testing.T) {
+	testRedis(t)
+	denied := constants.ErrPermissionDenied.Code()
+	for name, base := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			store := storage.NewMaskStore(base)
+			s := NewLogServiceWithStore(store)
+			ctx := context.Background()
+			if err := store.InsertApiLog(ctx, &models.ApiLog{UserId: 1, ApiPath: "/v1/chat", Method: "POST",
+				RequestBody: "secret", ResponseBody: "answer", CreatedAt: time.Now().Unix()}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.InsertStatusReport(ctx, &models.StatusReport{TraceId: "t", Model: "gpt", UserId: 1,
+				CallerKey: "sk-live", CreatedAt: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+			apiMasked := storage.WithMasks(asUser(1), []string{"request_body", "response_body", "method"})
+			callMasked := storage.WithMasks(asUser(1), []string{"caller_key", "model"})
+
+			// 返回结果中脱敏列替换为 ***
+			var list listResp[models.ApiLog]
+			code := callAs(t, apiMasked, s.GetApiLogList, requests.GetApiLogListReq{Fields: []string{"id", "request_body", "method"}}, &list)
+			if code != 0 || len(list.Logs) != 1 {
+				t.Fatalf("api list: errcode %d, rows %d", code, len(list.Logs))
+			}
+			if list.Logs[0].RequestBody != storage.MaskedValue || list.Logs[0].Method != storage.MaskedValue {
+				t.Errorf("api list: request_body %q, method %q", list.Logs[0].RequestBody, list.Logs[0].Method)
+			}
+			var detail models.ApiLog
+			if code = callAs(t, apiMasked, s.GetApiLogDetail, requests.GetApiLogDetailReq{Id: list.Logs[0].Id}, &detail); code != 0 {
+				t.Fatalf("api detail: errcode %d", code)
+			}
+			if detail.RequestBody != storage.MaskedValue || detail.ResponseBody != storage.MaskedValue || detail.ApiPath != "/v1/chat" {
+				t.Errorf("api detail: %+v", detail)
+			}
+			var calls listResp[models.StatusReport]
+			if code = callAs(t, callMasked, s.GetModelsCallLogList, requests.GetModelsCallLogListReq{}, &calls); code != 0 || len(calls.Logs) != 1 {
+				t.Fatalf("call list: errcode %d, rows %d", code, len(calls.Logs))
+			}
+			if calls.Logs[0].CallerKey != storage.MaskedValue || calls.Logs[0].Model != storage.MaskedValue || calls.Logs[0].TraceId != "t" {
+				t.Errorf("call list: caller_key %q, model %q", calls.Logs[0].CallerKey, calls.Logs[0].Model)
+			}
+
+			// 脱敏列不能用于过滤、排序、取值分布与时间分布拆分
+			rejected := map[string]int{
+				"api filter": callAs(t, apiMasked, s.GetApiLogList,
+					requests.GetApiLogListReq{Filter: `request_body like "%sec%"`}, nil),
+				"api facets": callAs(t, apiMasked, s.GetApiLogFacets,
+					requests.GetApiLogFacetsReq{Fields: []string{"method"}}, nil),
+				"api split_by": callAs(t, apiMasked, s.GetApiLogHistogram,
+					requests.GetApiLogHistogramReq{SplitBy: "method"}, nil),
+				"call filter": callAs(t, callMasked, s.GetModelsCallLogList,
+					requests.GetModelsCallLogListReq{Filter: `caller_key = "sk-live"`}, nil),
+				"call caller_key param": callAs(t, callMasked, s.GetModelsCallLogList,
+					requests.GetModelsCallLogListReq{CallerKey: "sk-live"}, nil),
+				"call sort": callAs(t, callMasked, s.GetModelsCallLogList,
+					requests.GetModelsCallLogListReq{PageInfo: requests.PageReq{Sort: []requests.SortReq{{Field: "caller_key"}}}}, nil),
+				"call facets": callAs(t, callMasked, s.GetModelsCallLogFacets,
+					requests.GetModelsCallLogFacetsReq{Fields: []string{"model"}}, nil),
+				"call split_by": callAs(t, callMasked, s.GetModelsCallLogHistogram,
+					requests.GetModelsCallLogHistogramReq{SplitBy: "model"}, nil),
+			}
+			for param, code := range rejected {
+				if code != denied {
+					t.Errorf("%s: errcode %d, want %d", param, code, denied)
+				}
+			}
+		})
+	}
+}
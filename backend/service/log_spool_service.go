@@ -0,0 +1,82 @@
+package service
+
+import (
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopLib/protocol"
+	"github.com/stardustagi/TopModelsLogs/backend/metrics"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/constants"
+	"github.com/stardustagi/TopModelsLogs/protocol/requests"
+	"github.com/stardustagi/TopModelsLogs/protocol/responses"
+	"go.uber.org/zap"
+)
+
+// spoolReplayInterval 本地缓冲回放间隔
+const spoolReplayInterval = 5 * time.Second
+
+// spoolReplayLoop 定期将本地缓冲中的日志回写数据库，服务停止时退出
+func (s *LogService) spoolReplayLoop(spooler *storage.SpoolStore) {
+	ticker := time.NewTicker(spoolReplayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		replayed, err := spooler.Replay(s.ctx)
+		if replayed > 0 {
+			s.logger.Info("回放缓冲日志", zap.Int("records", replayed))
+			// 回放的日志按原始时间写入，可能落在历史日分片
+			s.invalidateQueryCache(s.ctx, logKinds...)
+		}
+		if err != nil {
+			s.logger.Warn("回放缓冲日志中断，等待数据库恢复", zap.Error(err))
+		}
+	}
+}
+
+// GetSpoolStatus 查看本地缓冲
+// @Summary 查看本地缓冲
+// @Description 查看数据库不可用时写入本地缓冲的日志：分段、积压量、死信数与最旧的待回放记录
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.GetSpoolStatusReq true "查看本地缓冲请求"
+// @Success 200 {object} responses.GetSpoolStatusResp
+// @Router /log/getSpoolStatus [post]
+func (s *LogService) GetSpoolStatus(ctx echo.Context,
+	req requests.GetSpoolStatusReq, resp responses.GetSpoolStatusResp) error {
+	spooler := storage.GetSpoolStore()
+	if spooler == nil {
+		return protocol.Response(ctx, nil, resp)
+	}
+	resp.Enabled = true
+	resp.Stats = spooler.Spool().Stats()
+	resp.Records = make([]storage.SpoolRecord, 0)
+	if req.Limit > 0 {
+		records, err := spooler.Spool().Peek(min(req.Limit, 100))
+		if err != nil {
+			s.logger.Error("读取本地缓冲失败", zap.Error(err))
+			return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+		}
+		resp.Records = records
+	}
+	return protocol.Response(ctx, nil, resp)
+}
+
+// GetMetrics 查看服务指标
+// @Summary 查看服务指标
+// @Description 输出缓冲积压、脱敏命中、限流、缓存命中等服务指标
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.GetMetricsReq true "查看服务指标请求"
+// @Success 200 {object} responses.DefaultResponse
+// @Router /log/getMetrics [post]
+func (s *LogService) GetMetrics(ctx echo.Context,
+	req requests.GetMetricsReq, resp responses.DefaultResponse) error {
+	return protocol.Response(ctx, nil, metrics.Snapshot())
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stardustagi/TopLib/protocol"
+	"github.com/stardustagi/TopModelsLogs/backend"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/constants"
+	"github.com/stardustagi/TopModelsLogs/protocol/requests"
+	"github.com/stardustagi/TopModelsLogs/protocol/responses"
+	"go.uber.org/zap"
+)
+
+// 租户隔离：非管理员调用方只能读取自己的日志，请求中的 user_id 被替换为调用方的用户ID；
+// 绑定了用户的调用方写入的日志归属自己，未绑定用户的服务密钥（如网关）可代写任意用户的日志。
+// 模型调用日志未上报 user_id 时按 caller_key 的归属用户补全
+const (
+	callerKeyOwnerKey = "callerkey:%s"
+	callerKeyOwnerTTL = "5m"
+)
+
+// tenantUserId 读取日志时的用户过滤条件：管理员按请求过滤，其他调用方固定为自己
+func tenantUserId(ctx echo.Context, requested int64) int64 {
+	p := backend.PrincipalFrom(ctx.Request().Context())
+	if p == nil || p.Admin() {
+		return requested
+	}
+	return p.UserId
+}
+
+// canRead 详情接口校验日志是否属于调用方
+func canRead(ctx echo.Context, owner int64) bool {
+	p := backend.PrincipalFrom(ctx.Request().Context())
+	return p == nil || p.Admin() || p.UserId == owner
+}
+
+// ingestUserId 写入日志时的归属用户：绑定了用户的非管理员调用方固定为自己
+func ingestUserId(ctx echo.Context, requested int64) int64 {
+	p := backend.PrincipalFrom(ctx.Request().Context())
+	if p == nil || p.Admin() || p.UserId == 0 {
+		return requested
+	}
+	return p.UserId
+}
+
+// callerKeyOwner 客户端 key 的归属用户，未登记时为 0；结果缓存在 Redis 中，查询失败时不补全
+func (s *LogService) callerKeyOwner(ctx context.Context, callerKey string) int64 {
+	callers := storage.GetCallerKeyStore()
+	if callerKey == "" || callers == nil {
+		return 0
+	}
+	key := fmt.Sprintf(callerKeyOwnerKey, callerKey)
+	if raw, err := s.rds.Get(ctx, key); err == nil && len(raw) > 0 {
+		if owner, err := strconv.ParseInt(string(raw), 10, 64); err == nil {
+			return owner
+		}
+	}
+	owner, err := callers.Owner(ctx, callerKey)
+	if err != nil {
+		s.logger.Warn("查询客户端key归属失败", zap.String("callerKey", callerKey), zap.Error(err))
+		return 0
+	}
+	if err = s.rds.Set(ctx, key, []byte(strconv.FormatInt(owner, 10)), callerKeyOwnerTTL); err != nil {
+		s.logger.Warn("缓存客户端key归属失败", zap.String("callerKey", callerKey), zap.Error(err))
+	}
+	return owner
+}
+
+func (s *LogService) forgetCallerKeyOwner(ctx context.Context, callerKey string) {
+	if _, err := s.rds.Del(ctx, fmt.Sprintf(callerKeyOwnerKey, callerKey)); err != nil {
+		s.logger.Warn("删除客户端key归属缓存失败", zap.String("callerKey", callerKey), zap.Error(err))
+	}
+}
+
+// BindCallerKey 登记客户端 key 归属用户
+// @Summary 登记客户端 key 归属用户
+// @Description 之后写入的、未上报 user_id 的模型调用日志按此归属到用户，已写入的日志不变
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.BindCallerKeyReq true "登记客户端 key 归属用户请求"
+// @Success 200 {object} models.CallerKeyOwner
+// @Router /log/bindCallerKey [post]
+func (s *LogService) BindCallerKey(ctx echo.Context,
+	req requests.BindCallerKeyReq, resp responses.DefaultResponse) error {
+	callers := storage.GetCallerKeyStore()
+	if callers == nil {
+		return protocol.Response(ctx, constants.ErrNotEnabled, nil)
+	}
+	owner, err := callers.Bind(ctx.Request().Context(), req.CallerKey, req.UserId)
+	if err != nil {
+		s.logger.Error("登记客户端key归属失败", zap.Error(err))
+		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+	}
+	s.forgetCallerKeyOwner(ctx.Request().Context(), req.CallerKey)
+	s.logger.Info("登记客户端key归属", zap.String("callerKey", req.CallerKey), zap.Int64("userId", req.UserId))
+	return protocol.Response(ctx, nil, owner)
+}
+
+// UnbindCallerKey 取消客户端 key 归属
+// @Summary 取消客户端 key 归属
+// @Description 之后写入的、未上报 user_id 的模型调用日志不再归属用户
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.UnbindCallerKeyReq true "取消客户端 key 归属请求"
+// @Success 200 {object} responses.DefaultResponse
+// @Router /log/unbindCallerKey [post]
+func (s *LogService) UnbindCallerKey(ctx echo.Context,
+	req requests.UnbindCallerKeyReq, resp responses.DefaultResponse) error {
+	callers := storage.GetCallerKeyStore()
+	if callers == nil {
+		return protocol.Response(ctx, constants.ErrNotEnabled, nil)
+	}
+	ok, err := callers.Unbind(ctx.Request().Context(), req.CallerKey)
+	if err != nil {
+		s.logger.Error("取消客户端key归属失败", zap.Error(err))
+		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+	}
+	if !ok {
+		return protocol.Response(ctx, constants.ErrNotDataSet, nil)
+	}
+	s.forgetCallerKeyOwner(ctx.Request().Context(), req.CallerKey)
+	resp.Message = "取消客户端key归属成功"
+	return protocol.Response(ctx, nil, resp)
+}
+
+// GetCallerKeyList 获取客户端 key 归属列表
+// @Summary 获取客户端 key 归属列表
+// @Description 列出已登记的客户端 key 与归属用户
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body requests.GetCallerKeyListReq true "获取客户端 key 归属列表请求"
+// @Success 200 {object} responses.GetCallerKeyListResp
+// @Router /log/getCallerKeyList [post]
+func (s *LogService) GetCallerKeyList(ctx echo.Context,
+	req requests.GetCallerKeyListReq, resp responses.GetCallerKeyListResp) error {
+	callers := storage.GetCallerKeyStore()
+	if callers == nil {
+		return protocol.Response(ctx, constants.ErrNotEnabled, nil)
+	}
+	owners, err := callers.List(ctx.Request().Context(), req.UserId)
+	if err != nil {
+		s.logger.Error("查询客户端key归属失败", zap.Error(err))
+		return protocol.Response(ctx, constants.ErrInternalServer.AppendErrors(err), nil)
+	}
+	resp.Owners = owners
+	return protocol.Response(ctx, nil, resp)
+}
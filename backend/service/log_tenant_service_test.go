@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stardustagi/TopLib/libs/redis"
+	"github.com/stardustagi/TopModelsLogs/backend"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/constants"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"github.com/stardustagi/TopModelsLogs/protocol/requests"
+	"github.com/stardustagi/TopModelsLogs/protocol/responses"
+)
+
+// testRedis 以 miniredis 作为缓存与限流使用的 Redis，需在创建 LogService 之前调用
+func testRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	if _, err := redis.Init([]byte(`{"addrs":["` + mr.Addr() + `"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	return mr
+}
+
+// asUser 以只读权限、绑定 userId 的非管理员调用方
+func asUser(userId int64) context.Context {
+	return backend.WithPrincipal(context.Background(), &backend.Principal{
+		UserId: userId,
+		Scopes: []string{"read:*", "stats:*", "ingest:*"},
+	})
+}
+
+func TestTenantListForcedToCaller(t *testing.T) {
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := NewLogServiceWithStore(store)
+			seedApiLogs(t, store)
+			// 请求 user 1 的日志，按调用方 user 2 过滤
+			var resp listResp[models.ApiLog]
+			code := callAs(t, asUser(2), s.GetApiLogList, requests.GetApiLogListReq{UserId: 1, PageInfo: requests.PageReq{Limit: 100}}, &resp)
+			if code != 0 {
+				t.Fatalf("errcode %d", code)
+			}
+			if resp.Total != 10 || len(resp.Logs) != 10 {
+				t.Fatalf("total %d, rows %d, want 10", resp.Total, len(resp.Logs))
+			}
+			for _, l := range resp.Logs {
+				if l.UserId != 2 {
+					t.Errorf("id %d of user %d returned to user 2", l.Id, l.UserId)
+				}
+			}
+			var stats responses.GetApiLogStatsResp
+			if code = callAs(t, asUser(2), s.GetApiLogStats, requests.GetApiLogStatsReq{UserId: 1}, &stats); code != 0 {
+				t.Fatalf("stats: errcode %d", code)
+			}
+			if stats.Total != 10 {
+				t.Errorf("stats total %d, want 10", stats.Total)
+			}
+
+			// 管理员按请求过滤
+			admin := backend.WithPrincipal(context.Background(), &backend.Principal{Scopes: []string{backend.ScopeAdmin}})
+			resp = listResp[models.ApiLog]{}
+			callAs(t, admin, s.GetApiLogList, requests.GetApiLogListReq{UserId: 1, PageInfo: requests.PageReq{Limit: 100}}, &resp)
+			if resp.Total != 10 || len(resp.Logs) == 0 || resp.Logs[0].UserId != 1 {
+				t.Errorf("admin: total %d, want user 1 rows", resp.Total)
+			}
+		})
+	}
+}
+
+func TestTenantDetailOfForeignRow(t *testing.T) {
+	day := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local).Unix()
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := NewLogServiceWithStore(store)
+			seedApiLogs(t, store)
+			seedCallLogs(t, store)
+			// id 1 属于 user 1
+			if code := callAs(t, asUser(2), s.GetApiLogDetail, requests.GetApiLogDetailReq{Id: 1}, nil); code != constants.ErrNotDataSet.Code() {
+				t.Errorf("foreign api log: errcode %d, want %d", code, constants.ErrNotDataSet.Code())
+			}
+			var log models.ApiLog
+			if code := callAs(t, asUser(1), s.GetApiLogDetail, requests.GetApiLogDetailReq{Id: 1}, &log); code != 0 || log.UserId != 1 {
+				t.Errorf("own api log: errcode %d, user %d", code, log.UserId)
+			}
+			// 2026-03-01 的第一条模型调用日志属于 user 1
+			if code := callAs(t, asUser(2), s.GetModelsCallLogDetail, requests.GetModelsCallLogDetailReq{Id: 1, CreatedAt: day}, nil); code != constants.ErrNotDataSet.Code() {
+				t.Errorf("foreign call log: errcode %d, want %d", code, constants.ErrNotDataSet.Code())
+			}
+		})
+	}
+}
+
+func TestTenantIngestOwnedByCaller(t *testing.T) {
+	testRedis(t)
+	for name, store := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			s := NewLogServiceWithStore(store)
+			now := time.Now().Unix()
+			// 绑定用户的调用方代写其他用户的日志，归属改为自己
+			if code := callAs(t, asUser(2), s.CreateApiLog, requests.CreateApiLogReq{UserId: 1, ApiPath: "/v1/chat", CreatedAt: now}, nil); code != 0 {
+				t.Fatalf("bound caller: errcode %d", code)
+			}
+			// 未绑定用户的服务密钥（如网关）按请求归属
+			gateway := backend.WithPrincipal(context.Background(), &backend.Principal{KeyId: "gw", Scopes: []string{"ingest:*"}})
+			if code := callAs(t, gateway, s.CreateApiLog, requests.CreateApiLogReq{UserId: 3, ApiPath: "/v1/chat", CreatedAt: now}, nil); code != 0 {
+				t.Fatalf("gateway: errcode %d", code)
+			}
+			result, err := store.ListApiLogs(context.Background(), storage.ApiLogFilter{}, storage.Page{Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			owners := make([]int64, 0, len(result.Rows))
+			for _, l := range result.Rows {
+				owners = append(owners, l.UserId)
+			}
+			slices.Sort(owners)
+			if !slices.Equal(owners, []int64{2, 3}) {
+				t.Errorf("owners %v, want 2 and 3", owners)
+			}
+		})
+	}
+}
+
+func TestRateLimitUsageOwnSubject(t *testing.T) {
+	testRedis(t)
+	if err := backend.InitAuth([]byte(`{"enabled":true,"rate_limit":{"enabled":true,"caller_key":{"rate":10},"quota":{"daily_rows":100}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = backend.InitAuth([]byte(`{"enabled":true}`)) })
+	s := NewLogServiceWithStore(storage.NewMemoryStore())
+	now := time.Now().Unix()
+	for _, userId := range []int64{1, 1, 2} {
+		if code := callAs(t, asUser(userId), s.CreateApiLog, requests.CreateApiLogReq{ApiPath: "/v1/chat", CreatedAt: now}, nil); code != 0 {
+			t.Fatalf("ingest as user %d: errcode %d", userId, code)
+		}
+	}
+
+	// 非管理员查询其他用户时返回自己的用量
+	var usage responses.GetRateLimitUsageResp
+	if code := callAs(t, asUser(2), s.GetRateLimitUsage, requests.GetRateLimitUsageReq{UserId: 1, CallerKey: "sk-other"}, &usage); code != 0 {
+		t.Fatalf("own usage: errcode %d", code)
+	}
+	if usage.UserId != 2 || usage.Rows != 1 || usage.DailyRows != 100 {
+		t.Errorf("own usage = %+v, want user 2 with 1 row", usage)
+	}
+	for _, bucket := range usage.Buckets {
+		if bucket.Subject == "sk-other" {
+			t.Errorf("caller_key bucket returned to a non-admin caller: %+v", bucket)
+		}
+	}
+
+	// admin:quota 可查询任意用户
+	quota := backend.WithPrincipal(context.Background(), &backend.Principal{KeyId: "ops", Scopes: []string{backend.ScopeQuota}})
+	usage = responses.GetRateLimitUsageResp{}
+	if code := callAs(t, quota, s.GetRateLimitUsage, requests.GetRateLimitUsageReq{UserId: 1}, &usage); code != 0 {
+		t.Fatalf("admin:quota: errcode %d", code)
+	}
+	if usage.UserId != 1 || usage.Rows != 2 {
+		t.Errorf("admin:quota usage = %+v, want user 1 with 2 rows", usage)
+	}
+
+	// 接口对全部已认证的调用方开放
+	if scope := backend.ScopeOf([]string{"log", "self"}); !(&backend.Principal{Scopes: []string{"ingest:api"}}).Allowed(scope) {
+		t.Errorf("scope %s not allowed for an ingest-only caller", scope)
+	}
+}
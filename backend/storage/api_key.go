@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/stardustagi/TopLib/libs/databases"
+	"github.com/stardustagi/TopModelsLogs/models"
+)
+
+// ErrKeyNotFound 服务密钥不存在
+var ErrKeyNotFound = errors.New("api key not found")
+
+// KeyStore 服务密钥存储，读写都走主库，避免轮换、吊销后从库延迟导致旧密钥仍可用
+type KeyStore struct {
+	engine databases.DBInterface
+}
+
+// NewKeyStore 创建服务密钥存储并同步表结构
+func NewKeyStore(engine databases.DBInterface) (*KeyStore, error) {
+	if err := engine.Sync2(new(models.ApiKey)); err != nil {
+		return nil, err
+	}
+	return &KeyStore{engine: engine}, nil
+}
+
+// Create 保存新密钥
+func (s *KeyStore) Create(ctx context.Context, key *models.ApiKey) error {
+	_, err := s.engine.Context(ctx).InsertOne(key)
+	return err
+}
+
+// Get 按密钥标识查找
+func (s *KeyStore) Get(ctx context.Context, keyId string) (*models.ApiKey, error) {
+	key := &models.ApiKey{}
+	ok, err := s.engine.Context(ctx).Where("key_id = ?", keyId).Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// List 列出密钥，userId 非零时只列出该用户的密钥，按创建时间从新到旧
+func (s *KeyStore) List(ctx context.Context, userId int64, includeRevoked bool) ([]models.ApiKey, error) {
+	session := s.engine.Context(ctx).Desc("id")
+	if userId != 0 {
+		session = session.Where("user_id = ?", userId)
+	}
+	if !includeRevoked {
+		session = session.And("revoked_at = 0")
+	}
+	keys := make([]models.ApiKey, 0)
+	if err := session.Find(&keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Update 按 key_id 更新指定列
+func (s *KeyStore) Update(ctx context.Context, key *models.ApiKey, cols ...string) error {
+	n, err := s.engine.Context(ctx).Where("key_id = ?", key.KeyId).Cols(cols...).Update(key)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
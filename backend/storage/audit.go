@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/stardustagi/TopLib/libs/databases"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"xorm.io/builder"
+)
+
+// AuditConfig [storage.audit] 日志数据访问审计配置
+type AuditConfig struct {
+	Enabled         bool `json:"enabled"`
+	RetentionDays   int  `json:"retention_days"`    // 审计记录保留天数，与日志的 retention_days 分开，0 表示不清理
+	MaxFiltersBytes int  `json:"max_filters_bytes"` // 记录的请求参数上限，默认 4096
+}
+
+// AuditFilter 审计记录查询条件，零值表示不限
+type AuditFilter struct {
+	UserId    int64
+	KeyId     string
+	Action    string
+	StartTime int64 // 秒级时间戳
+	EndTime   int64
+}
+
+// AuditStore 审计记录存储，只追加，除按保留天数清理外不修改、不删除，读写都走主库
+type AuditStore struct {
+	engine databases.DBInterface
+}
+
+// NewAuditStore 创建审计记录存储并同步表结构
+func NewAuditStore(engine databases.DBInterface) (*AuditStore, error) {
+	if err := engine.Sync2(new(models.AuditEvent)); err != nil {
+		return nil, err
+	}
+	return &AuditStore{engine: engine}, nil
+}
+
+// Append 追加审计记录
+func (s *AuditStore) Append(ctx context.Context, event *models.AuditEvent) error {
+	_, err := s.engine.Context(ctx).InsertOne(event)
+	return err
+}
+
+// List 按条件查询审计记录，按时间从新到旧
+func (s *AuditStore) List(ctx context.Context, filter AuditFilter, skip, limit int) ([]models.AuditEvent, int64, error) {
+	cond := builder.NewCond()
+	if filter.UserId != 0 {
+		cond = cond.And(builder.Eq{"user_id": filter.UserId})
+	}
+	if filter.KeyId != "" {
+		cond = cond.And(builder.Eq{"key_id": filter.KeyId})
+	}
+	if filter.Action != "" {
+		cond = cond.And(builder.Eq{"action": filter.Action})
+	}
+	if filter.StartTime > 0 {
+		cond = cond.And(builder.Gte{"created_at": filter.StartTime})
+	}
+	if filter.EndTime > 0 {
+		cond = cond.And(builder.Lte{"created_at": filter.EndTime})
+	}
+	events := make([]models.AuditEvent, 0)
+	total, err := s.engine.Context(ctx).Where(cond).Desc("id").Limit(limit, skip).FindAndCount(&events)
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// PurgeBefore 删除 before 之前的审计记录，返回删除的条数
+func (s *AuditStore) PurgeBefore(ctx context.Context, before time.Time) (int64, error) {
+	return s.engine.Context(ctx).Where("created_at < ?", before.Unix()).Delete(new(models.AuditEvent))
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/stardustagi/TopLib/libs/databases"
+	"github.com/stardustagi/TopModelsLogs/models"
+)
+
+// CallerKeyStore 客户端 key 与用户的归属关系
+type CallerKeyStore struct {
+	engine databases.DBInterface
+}
+
+// NewCallerKeyStore 创建归属关系存储并同步表结构
+func NewCallerKeyStore(engine databases.DBInterface) (*CallerKeyStore, error) {
+	if err := engine.Sync2(new(models.CallerKeyOwner)); err != nil {
+		return nil, err
+	}
+	return &CallerKeyStore{engine: engine}, nil
+}
+
+// Owner 客户端 key 的归属用户，未登记时返回 0
+func (s *CallerKeyStore) Owner(ctx context.Context, callerKey string) (int64, error) {
+	owner := &models.CallerKeyOwner{}
+	ok, err := s.engine.Context(ctx).Where("caller_key = ?", callerKey).Get(owner)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return owner.UserId, nil
+}
+
+// Bind 登记或变更客户端 key 的归属用户
+func (s *CallerKeyStore) Bind(ctx context.Context, callerKey string, userId int64) (*models.CallerKeyOwner, error) {
+	now := time.Now().Unix()
+	owner := &models.CallerKeyOwner{}
+	ok, err := s.engine.Context(ctx).Where("caller_key = ?", callerKey).Get(owner)
+	if err != nil {
+		return nil, err
+	}
+	owner.UserId, owner.UpdatedAt = userId, now
+	if ok {
+		_, err = s.engine.Context(ctx).ID(owner.Id).Cols("user_id", "updated_at").Update(owner)
+		return owner, err
+	}
+	owner.CallerKey, owner.CreatedAt = callerKey, now
+	_, err = s.engine.Context(ctx).InsertOne(owner)
+	return owner, err
+}
+
+// Unbind 取消登记，返回是否存在
+func (s *CallerKeyStore) Unbind(ctx context.Context, callerKey string) (bool, error) {
+	n, err := s.engine.Context(ctx).Where("caller_key = ?", callerKey).Delete(new(models.CallerKeyOwner))
+	return n > 0, err
+}
+
+// List 列出归属关系，userId 非零时只列出该用户的 key
+func (s *CallerKeyStore) List(ctx context.Context, userId int64) ([]models.CallerKeyOwner, error) {
+	session := s.engine.Context(ctx).Asc("caller_key")
+	if userId != 0 {
+		session = session.Where("user_id = ?", userId)
+	}
+	owners := make([]models.CallerKeyOwner, 0)
+	if err := session.Find(&owners); err != nil {
+		return nil, err
+	}
+	return owners, nil
+}
@@ -0,0 +1,135 @@
+package storage
+
+import "github.com/stardustagi/TopLib/utils"
+
+const (
+	// ModeDatabase 使用 [mysql] 配置的 MySQL / PostgreSQL
+	ModeDatabase = "database"
+	// ModeSQLite 嵌入式 SQLite 单机模式，未配置 [redis] 时同时启动进程内 Redis
+	ModeSQLite = "sqlite"
+)
+
+const (
+	// ShardModeTable 按日分表（status_report_YYYYMMDD）
+	ShardModeTable = "table"
+	// ShardModePartition PostgreSQL 原生按日范围分区
+	ShardModePartition = "partition"
+)
+
+// Config 存储配置
+type Config struct {
+	Mode          string `json:"mode"`           // 存储模式: database / sqlite
+	ShardMode     string `json:"shard_mode"`     // 模型调用日志分片方式: table / partition
+	SQLitePath    string `json:"sqlite_path"`    // sqlite 模式下的数据库文件
+	RetentionDays int    `json:"retention_days"` // 日志保留天数，0 表示不清理
+
+	Spool   SpoolConfig   `json:"spool"`
+	Replica ReplicaConfig `json:"replica"`
+	Search  SearchConfig  `json:"search"`
+	Guard   GuardConfig   `json:"guard"`
+	Redact  RedactConfig  `json:"redact"`
+
+	Encryption EncryptionConfig `json:"encryption"`
+	Audit      AuditConfig      `json:"audit"`
+	HashChain  HashChainConfig  `json:"hash_chain"`
+
+	QueryCache QueryCacheConfig `json:"query_cache"`
+}
+
+// QueryCacheConfig 查询结果缓存配置，结果缓存在 Redis 中
+type QueryCacheConfig struct {
+	Enabled    bool   `json:"enabled"`
+	HistoryTTL string `json:"history_ttl"` // 结束时间早于今天的查询，只涉及不再变化的历史日分片
+	RecentTTL  string `json:"recent_ttl"`  // 包含今天或未指定结束时间的查询
+}
+
+// SpoolConfig 数据库不可用时的本地缓冲配置
+type SpoolConfig struct {
+	Enabled   bool   `json:"enabled"`
+	Dir       string `json:"dir"`        // 缓冲目录
+	SegmentMB int64  `json:"segment_mb"` // 单个分段文件上限
+	MaxMB     int64  `json:"max_mb"`     // 缓冲总量上限，超过后写入失败
+}
+
+// ReplicaConfig 读写分离配置，从库取自 [mysql] 的 slaves（use_master_slave = true 时生效）
+type ReplicaConfig struct {
+	MaxLagMs        int64 `json:"max_lag_ms"`        // 复制延迟超过该值的从库不参与查询
+	CheckIntervalMs int64 `json:"check_interval_ms"` // 复制延迟检测间隔
+}
+
+// LoadConfig 解析 [storage] 配置，未配置时使用默认值
+func LoadConfig(configBytes []byte) (*Config, error) {
+	config := &Config{}
+	if len(configBytes) > 0 {
+		var err error
+		if config, err = utils.Bytes2Struct[*Config](configBytes); err != nil {
+			return nil, err
+		}
+	}
+	if config.Mode == "" {
+		config.Mode = ModeDatabase
+	}
+	if config.ShardMode == "" {
+		config.ShardMode = ShardModeTable
+	}
+	if config.SQLitePath == "" {
+		config.SQLitePath = "data/logs.db"
+	}
+	if config.Spool.Dir == "" {
+		config.Spool.Dir = "data/spool"
+	}
+	if config.Spool.SegmentMB <= 0 {
+		config.Spool.SegmentMB = 16
+	}
+	if config.Spool.MaxMB <= 0 {
+		config.Spool.MaxMB = 1024
+	}
+	if config.Replica.MaxLagMs <= 0 {
+		config.Replica.MaxLagMs = 5000
+	}
+	if config.Replica.CheckIntervalMs <= 0 {
+		config.Replica.CheckIntervalMs = 1000
+	}
+	if config.Search.MaxDocKB <= 0 {
+		config.Search.MaxDocKB = 64
+	}
+	if config.QueryCache.HistoryTTL == "" {
+		config.QueryCache.HistoryTTL = "1h"
+	}
+	if config.QueryCache.RecentTTL == "" {
+		config.QueryCache.RecentTTL = "5s"
+	}
+	if config.Encryption.Keyring == "" {
+		config.Encryption.Keyring = "data/keyring.json"
+	}
+	if config.Encryption.RewrapInterval == "" {
+		config.Encryption.RewrapInterval = "1m"
+	}
+	if config.Encryption.RewrapBatch <= 0 {
+		config.Encryption.RewrapBatch = 500
+	}
+	if config.Audit.MaxFiltersBytes <= 0 {
+		config.Audit.MaxFiltersBytes = 4096
+	}
+	if config.HashChain.SigningKey == "" {
+		config.HashChain.SigningKey = "data/chain_signing_key.json"
+	}
+	if config.HashChain.Interval == "" {
+		config.HashChain.Interval = "5s"
+	}
+	if config.HashChain.CheckpointInterval == "" {
+		config.HashChain.CheckpointInterval = "10m"
+	}
+	if config.HashChain.Batch <= 0 {
+		config.HashChain.Batch = 1000
+	}
+	if config.Guard.Default == (QueryLimits{}) {
+		config.Guard.Default = QueryLimits{MaxSpanDays: 31, MaxShards: 31, TimeoutMs: 10000, RequireRange: true}
+	}
+	return config, nil
+}
+
+// Embedded 是否为不依赖外部数据库的嵌入式模式
+func (c *Config) Embedded() bool {
+	return c.Mode == ModeSQLite
+}
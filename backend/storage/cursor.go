@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stardustagi/TopModelsLogs/models"
+	"xorm.io/builder"
+)
+
+// 列表总数的计算方式
+const (
+	CountExact  = "exact"  // 精确 COUNT(*)，默认
+	CountApprox = "approx" // 按执行计划估算，数据库不支持估算时按 capped 计算
+	CountCapped = "capped" // 最多数到 CountCap 条，超过时返回 CountCap
+	CountNone   = "none"   // 不计算总数
+)
+
+// CountCap capped 模式下的计数上限
+const CountCap = 10000
+
+// shardKey 模型调用日志按日分表时的排序与游标列，取值为记录所在分表名
+const shardKey = "shard"
+
+// ErrInvalidCursor 游标无法解析或与排序方式不匹配
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PageResult 分页查询结果
+type PageResult[T any] struct {
+	Rows       []T
+	Total      int64    // CountMode 为 none 时为 -1
+	TotalExact bool     // approx / capped 模式下可能为估算值或下限
+	NextCursor string   // 下一页游标，为空表示没有更多数据
+	Fields     []string // 列表返回的列，见 Page.Fields
+}
+
+// cursorPayload 游标内容：排序方式与上一页最后一条记录的排序键取值
+type cursorPayload struct {
+	Sort   string            `json:"s"`
+	Values []json.RawMessage `json:"v"`
+}
+
+// orderBy 生成 ORDER BY 子句（不含关键字）
+func orderBy(keys []sortKey) string {
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key.desc {
+			parts = append(parts, key.column+" DESC")
+		} else {
+			parts = append(parts, key.column+" ASC")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sortSignature 游标绑定的排序方式，排序变化后旧游标失效
+func sortSignature(keys []sortKey) string {
+	return orderBy(keys)
+}
+
+// keyValue 读取记录的排序键取值，shard 由记录时间推算所在分表
+func keyValue(row interface{}, column string) (interface{}, error) {
+	if column == shardKey {
+		if report, ok := row.(*models.StatusReport); ok {
+			return report.GetSliceDateDayTableByTime(report.CreatedAt), nil
+		}
+	}
+	return columnValue(row, column)
+}
+
+// encodeCursor 以最后一条记录的排序键生成不透明游标
+func encodeCursor(keys []sortKey, row interface{}) (string, error) {
+	payload := cursorPayload{Sort: sortSignature(keys), Values: make([]json.RawMessage, 0, len(keys))}
+	for _, key := range keys {
+		v, err := keyValue(row, key.column)
+		if err != nil {
+			return "", err
+		}
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		payload.Values = append(payload.Values, raw)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor 解析游标，按模型字段类型还原排序键取值
+func decodeCursor(token string, keys []sortKey, model reflect.Type) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var payload cursorPayload
+	if err = json.Unmarshal(data, &payload); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if payload.Sort != sortSignature(keys) || len(payload.Values) != len(keys) {
+		return nil, ErrInvalidCursor
+	}
+	fields := modelFields(model)
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		var target reflect.Type
+		numeric := false
+		if info, ok := fields[key.column]; ok {
+			target = model.Field(info.index).Type
+			numeric = info.numeric
+		} else {
+			target = reflect.TypeOf("")
+		}
+		if values[i], err = decodeKeyValue(payload.Values[i], target, numeric); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return values, nil
+}
+
+func decodeKeyValue(raw json.RawMessage, target reflect.Type, numeric bool) (interface{}, error) {
+	if numeric {
+		var f float64
+		err := json.Unmarshal(raw, &f)
+		return f, err
+	}
+	if target == reflect.TypeOf(time.Time{}) {
+		var t time.Time
+		err := json.Unmarshal(raw, &t)
+		return t, err
+	}
+	switch target.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n json.Number
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, err
+		}
+		return n.Int64()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n json.Number
+		if err := json.Unmarshal(raw, &n); err != nil {
+			return nil, err
+		}
+		return strconv.ParseUint(n.String(), 10, 64)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		err := json.Unmarshal(raw, &f)
+		return f, err
+	case reflect.String:
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	}
+	return nil, errors.New("unsupported cursor column type: " + target.String())
+}
+
+// keysetCond 生成“排在游标之后”的条件：
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ...，降序列使用 <
+func keysetCond(keys []sortKey, values []interface{}) builder.Cond {
+	cond := builder.NewCond()
+	for i, key := range keys {
+		branch := builder.NewCond()
+		for j := 0; j < i; j++ {
+			branch = branch.And(builder.Eq{keys[j].column: values[j]})
+		}
+		if key.desc {
+			branch = branch.And(builder.Lt{key.column: values[i]})
+		} else {
+			branch = branch.And(builder.Gt{key.column: values[i]})
+		}
+		cond = cond.Or(branch)
+	}
+	return cond
+}
+
+// shardKeysetCond 分表 table 中排在游标之后的条件。shard 列在单个分表内为常量，直接比较后从条件中去掉；
+// ok 为 false 表示该分表没有游标之后的记录
+func shardKeysetCond(keys []sortKey, values []interface{}, table string) (cond builder.Cond, ok bool) {
+	cond = builder.NewCond()
+	for i, key := range keys {
+		branch := builder.NewCond()
+		possible := true
+		for j := 0; j < i; j++ {
+			if keys[j].column == shardKey {
+				possible = possible && values[j] == table
+				continue
+			}
+			branch = branch.And(builder.Eq{keys[j].column: values[j]})
+		}
+		switch shard, _ := values[i].(string); {
+		case key.column == shardKey:
+			possible = possible && (key.desc && table < shard || !key.desc && table > shard)
+		case key.desc:
+			branch = branch.And(builder.Lt{key.column: values[i]})
+		default:
+			branch = branch.And(builder.Gt{key.column: values[i]})
+		}
+		if !possible {
+			continue
+		}
+		if !branch.IsValid() {
+			// 整个分表都在游标之后
+			return builder.NewCond(), true
+		}
+		cond, ok = cond.Or(branch), true
+	}
+	return cond, ok
+}
+
+// afterCursor 判断记录是否排在游标之后，内存实现使用
+func afterCursor(row interface{}, keys []sortKey, values []interface{}) bool {
+	for i, key := range keys {
+		v, err := keyValue(row, key.column)
+		if err != nil {
+			return false
+		}
+		c := compareValues(v, values[i])
+		if c == 0 {
+			continue
+		}
+		return (c > 0) != key.desc
+	}
+	return false
+}
+
+// pageResult 截取多查的一条判断是否还有下一页，并生成下一页游标
+func pageResult[T any](rows []T, limit int, keys []sortKey) (*PageResult[T], error) {
+	result := &PageResult[T]{Rows: rows, TotalExact: true}
+	if result.Rows == nil {
+		result.Rows = make([]T, 0)
+	}
+	if limit <= 0 || len(rows) <= limit {
+		return result, nil
+	}
+	result.Rows = rows[:limit]
+	cursor, err := encodeCursor(keys, &result.Rows[limit-1])
+	if err != nil {
+		return nil, err
+	}
+	result.NextCursor = cursor
+	return result, nil
+}
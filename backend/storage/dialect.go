@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+const (
+	DialectMySQL    = "mysql"
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite3"
+)
+
+// Dialect 屏蔽不同数据库之间的 SQL 差异
+type Dialect interface {
+	// Name 方言名称
+	Name() string
+	// LikeOp 大小写不敏感的模糊匹配操作符
+	LikeOp() string
+	// ListTablesSQL 列出当前库中名称匹配 ? 的表，结果列名为 table_name
+	ListTablesSQL() string
+	// Percentile 计算子查询 from 中列 column 的第 p (0~1) 分位值，结果列名为 value
+	Percentile(column, from string, p float64) string
+	// ExplainSQL 返回查询的执行计划语句
+	ExplainSQL(query string) string
+	// EstimatedRows 从 ExplainSQL 的结果估算查询返回的行数，不支持估算时返回 false
+	EstimatedRows(plan []map[string]string) (int64, bool)
+	// WallSeconds 把日期时间列按存储的字面时间（不做时区换算）转换为距 1970-01-01 00:00:00 的秒数
+	WallSeconds(column string) string
+}
+
+// NewDialect 根据数据库类型创建方言
+func NewDialect(dbType string) (Dialect, error) {
+	switch dbType {
+	case DialectMySQL, "":
+		return mysqlDialect{}, nil
+	case DialectPostgres:
+		return postgresDialect{}, nil
+	case DialectSQLite:
+		return sqliteDialect{}, nil
+	}
+	return nil, fmt.Errorf("unsupported db type: %s", dbType)
+}
+
+func formatFraction(p float64) string {
+	return strconv.FormatFloat(p, 'f', -1, 64)
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string {
+	return DialectMySQL
+}
+
+func (mysqlDialect) LikeOp() string {
+	// 默认排序规则下 LIKE 本身不区分大小写
+	return "LIKE"
+}
+
+func (mysqlDialect) ListTablesSQL() string {
+	return "SELECT table_name AS table_name FROM information_schema.tables " +
+		"WHERE table_schema = DATABASE() AND table_name LIKE ?"
+}
+
+// Percentile MySQL 没有 percentile_cont，使用 8.0 窗口函数 CUME_DIST 取最近秩
+func (mysqlDialect) Percentile(column, from string, p float64) string {
+	return fmt.Sprintf("SELECT MIN(v) AS value FROM (SELECT %s AS v, CUME_DIST() OVER (ORDER BY %s) AS cd FROM (%s) p0) p1 WHERE cd >= %s",
+		column, column, from, formatFraction(p))
+}
+
+func (mysqlDialect) ExplainSQL(query string) string {
+	return "EXPLAIN " + query
+}
+
+// EstimatedRows 累加每个（UNION 分支）访问计划的 rows * filtered%
+func (mysqlDialect) EstimatedRows(plan []map[string]string) (int64, bool) {
+	var total float64
+	found := false
+	for _, row := range plan {
+		rows, err := strconv.ParseFloat(row["rows"], 64)
+		if err != nil {
+			continue
+		}
+		filtered, err := strconv.ParseFloat(row["filtered"], 64)
+		if err != nil {
+			filtered = 100
+		}
+		total += rows * filtered / 100
+		found = true
+	}
+	return int64(total), found
+}
+
+func (mysqlDialect) WallSeconds(column string) string {
+	return fmt.Sprintf("TIMESTAMPDIFF(SECOND, '1970-01-01 00:00:00', %s)", column)
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string {
+	return DialectPostgres
+}
+
+func (postgresDialect) LikeOp() string {
+	return "ILIKE"
+}
+
+func (postgresDialect) ListTablesSQL() string {
+	return "SELECT tablename AS table_name FROM pg_tables " +
+		"WHERE schemaname = current_schema() AND tablename LIKE ?"
+}
+
+func (postgresDialect) Percentile(column, from string, p float64) string {
+	return fmt.Sprintf("SELECT percentile_cont(%s) WITHIN GROUP (ORDER BY CAST(%s AS DOUBLE PRECISION)) AS value FROM (%s) p0",
+		formatFraction(p), column, from)
+}
+
+func (postgresDialect) ExplainSQL(query string) string {
+	return "EXPLAIN (FORMAT JSON) " + query
+}
+
+func (postgresDialect) EstimatedRows(plan []map[string]string) (int64, bool) {
+	if len(plan) == 0 {
+		return 0, false
+	}
+	var result []struct {
+		Plan struct {
+			PlanRows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal([]byte(plan[0]["QUERY PLAN"]), &result); err != nil || len(result) == 0 {
+		return 0, false
+	}
+	return int64(result[0].Plan.PlanRows), true
+}
+
+// WallSeconds timestamp without time zone 的 epoch 即按字面时间计算
+func (postgresDialect) WallSeconds(column string) string {
+	return fmt.Sprintf("CAST(FLOOR(EXTRACT(EPOCH FROM %s)) AS BIGINT)", column)
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string {
+	return DialectSQLite
+}
+
+func (sqliteDialect) LikeOp() string {
+	// ASCII 范围内 LIKE 不区分大小写
+	return "LIKE"
+}
+
+func (sqliteDialect) ListTablesSQL() string {
+	return "SELECT name AS table_name FROM sqlite_master WHERE type = 'table' AND name LIKE ?"
+}
+
+// Percentile SQLite 3.25 起支持窗口函数，与 MySQL 一致取最近秩
+func (sqliteDialect) Percentile(column, from string, p float64) string {
+	return mysqlDialect{}.Percentile(column, from, p)
+}
+
+func (sqliteDialect) ExplainSQL(query string) string {
+	return "EXPLAIN QUERY PLAN " + query
+}
+
+// EstimatedRows SQLite 的执行计划不包含行数估算
+func (sqliteDialect) EstimatedRows([]map[string]string) (int64, bool) {
+	return 0, false
+}
+
+// WallSeconds 日期时间以文本存储，strftime 按 UTC 解析即为字面时间
+func (sqliteDialect) WallSeconds(column string) string {
+	return fmt.Sprintf("CAST(strftime('%%s', %s) AS INTEGER)", column)
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+var (
+	embeddedRedisMu sync.Mutex
+	embeddedRedis   *miniredis.Miniredis
+)
+
+// StartEmbeddedRedis 启动进程内 Redis 替身，返回可直接传给 redis.Init 的配置
+// 数据只保存在内存中，仅用于 sqlite 单机模式下的缓存与计数
+func StartEmbeddedRedis() ([]byte, error) {
+	embeddedRedisMu.Lock()
+	defer embeddedRedisMu.Unlock()
+	if embeddedRedis == nil {
+		server, err := miniredis.Run()
+		if err != nil {
+			return nil, err
+		}
+		embeddedRedis = server
+	}
+	return json.Marshal(map[string]interface{}{
+		"addrs":    []string{embeddedRedis.Addr()},
+		"db_index": 0,
+	})
+}
+
+func stopEmbeddedRedis() {
+	embeddedRedisMu.Lock()
+	defer embeddedRedisMu.Unlock()
+	if embeddedRedis != nil {
+		embeddedRedis.Close()
+		embeddedRedis = nil
+	}
+}
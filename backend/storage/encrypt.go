@@ -0,0 +1,568 @@
+package storage
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stardustagi/TopLib/libs/databases"
+	"github.com/stardustagi/TopLib/libs/logs"
+	"github.com/stardustagi/TopModelsLogs/backend/metrics"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"go.uber.org/zap"
+)
+
+// 字段加密（信封加密）：每条日志生成随机数据密钥，以 AES-256-GCM 加密 API 日志的请求体与响应体（可选模型调用日志的状态消息），
+// 数据密钥再由密钥环中的当前主密钥加密，主密钥ID与加密后的数据密钥随行保存。
+// 数据库与列表结果中只有密文：列表不返回加密列，详情在确认调用方可读且未脱敏这些列后由 DecryptApiLog 等解密；
+// 加密列不能用于过滤与排序，全文检索不能与字段加密同时开启。
+// 密钥环文件变更（新增主密钥并切换 active）后自动重新加载，后台任务用新主密钥重新加密旧数据密钥，
+// 旧主密钥在全部数据重新加密前不能从密钥环中删除
+const (
+	ciphertextPrefix = "enc:v1:"
+	dataKeySize      = 32
+)
+
+// EncryptionConfig 字段加密配置
+type EncryptionConfig struct {
+	Enabled              bool   `json:"enabled"`
+	Keyring              string `json:"keyring"`                // 密钥环文件，不存在时生成，默认 data/keyring.json
+	EncryptStatusMessage bool   `json:"encrypt_status_message"` // 同时加密模型调用日志的状态消息
+	RewrapInterval       string `json:"rewrap_interval"`        // 检查密钥环变更与重新加密的间隔，默认 1m
+	RewrapBatch          int    `json:"rewrap_batch"`           // 每批重新加密的行数，默认 500
+}
+
+var (
+	// ErrUnknownKey 行的主密钥不在密钥环中
+	ErrUnknownKey = errors.New("unknown encryption key")
+	// ErrDecrypt 密文或数据密钥无法解密
+	ErrDecrypt = errors.New("decrypt failed")
+	// ErrEncryptedField 查询条件或列表返回列使用了加密列，具体列见 ValidationError
+	ErrEncryptedField = errors.New("encrypted field")
+)
+
+// keyringFile 密钥环文件格式，主密钥为 base64 编码的 32 字节
+type keyringFile struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+}
+
+// Keyring 本地密钥环
+type Keyring struct {
+	path    string
+	mu      sync.RWMutex
+	active  string
+	keys    map[string]cipher.AEAD
+	modTime time.Time
+}
+
+// OpenKeyring 加载密钥环，文件不存在时生成只含一个主密钥的密钥环
+func OpenKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err = createKeyring(path); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func createKeyring(path string) error {
+	id, key, err := newMasterKey()
+	if err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(keyringFile{Active: id, Keys: map[string]string{id: key}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0o600)
+}
+
+// newMasterKey 生成主密钥，ID 为日期加随机后缀
+func newMasterKey() (id, key string, err error) {
+	suffix := make([]byte, 4)
+	secret := make([]byte, dataKeySize)
+	if _, err = rand.Read(suffix); err != nil {
+		return "", "", err
+	}
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	return time.Now().Format("20060102") + "-" + hex.EncodeToString(suffix), base64.StdEncoding.EncodeToString(secret), nil
+}
+
+// Reload 文件修改时间变化时重新加载，返回是否重新加载；加载失败时保留原密钥环
+func (k *Keyring) Reload() (bool, error) {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return false, err
+	}
+	k.mu.RLock()
+	unchanged := info.ModTime().Equal(k.modTime)
+	k.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	raw, err := os.ReadFile(k.path)
+	if err != nil {
+		return false, err
+	}
+	var file keyringFile
+	if err = json.Unmarshal(raw, &file); err != nil {
+		return false, fmt.Errorf("invalid keyring %s: %w", k.path, err)
+	}
+	keys := make(map[string]cipher.AEAD, len(file.Keys))
+	for id, encoded := range file.Keys {
+		secret, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(secret) != dataKeySize || id == "" || len(id) > 32 {
+			return false, fmt.Errorf("invalid keyring key %q: want base64 of %d bytes and id up to 32 chars", id, dataKeySize)
+		}
+		if keys[id], err = newAEAD(secret); err != nil {
+			return false, err
+		}
+	}
+	if keys[file.Active] == nil {
+		return false, fmt.Errorf("keyring active key %q not found", file.Active)
+	}
+	k.mu.Lock()
+	k.active, k.keys, k.modTime = file.Active, keys, info.ModTime()
+	k.mu.Unlock()
+	return true, nil
+}
+
+// Active 当前主密钥ID
+func (k *Keyring) Active() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// master 查找主密钥，未找到时重新加载一次，以便读取其它实例用新主密钥写入的数据
+func (k *Keyring) master(id string) (cipher.AEAD, error) {
+	k.mu.RLock()
+	aead := k.keys[id]
+	k.mu.RUnlock()
+	if aead != nil {
+		return aead, nil
+	}
+	if reloaded, _ := k.Reload(); reloaded {
+		k.mu.RLock()
+		aead = k.keys[id]
+		k.mu.RUnlock()
+	}
+	if aead == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	return aead, nil
+}
+
+// newDataKey 生成数据密钥并用当前主密钥加密
+func (k *Keyring) newDataKey() (keyId, wrapped string, aead cipher.AEAD, err error) {
+	secret := make([]byte, dataKeySize)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", nil, err
+	}
+	k.mu.RLock()
+	keyId, master := k.active, k.keys[k.active]
+	k.mu.RUnlock()
+	if aead, err = newAEAD(secret); err != nil {
+		return "", "", nil, err
+	}
+	if wrapped, err = seal(master, secret, keyId); err != nil {
+		return "", "", nil, err
+	}
+	return keyId, wrapped, aead, nil
+}
+
+// openDataKey 解密行的数据密钥
+func (k *Keyring) openDataKey(keyId, wrapped string) (cipher.AEAD, error) {
+	secret, err := k.unwrap(keyId, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return newAEAD(secret)
+}
+
+func (k *Keyring) unwrap(keyId, wrapped string) ([]byte, error) {
+	master, err := k.master(keyId)
+	if err != nil {
+		return nil, err
+	}
+	return open(master, wrapped, keyId)
+}
+
+// rewrap 用当前主密钥重新加密数据密钥，数据本身不变
+func (k *Keyring) rewrap(keyId, wrapped string) (newKeyId, newWrapped string, err error) {
+	secret, err := k.unwrap(keyId, wrapped)
+	if err != nil {
+		return "", "", err
+	}
+	k.mu.RLock()
+	newKeyId, master := k.active, k.keys[k.active]
+	k.mu.RUnlock()
+	if newWrapped, err = seal(master, secret, newKeyId); err != nil {
+		return "", "", err
+	}
+	return newKeyId, newWrapped, nil
+}
+
+func newAEAD(secret []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal 加密为 base64(nonce || 密文)，aad 绑定密文所属的列或主密钥，防止密文被挪用到其它列
+func seal(aead cipher.AEAD, plaintext []byte, aad string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, []byte(aad))), nil
+}
+
+func open(aead cipher.AEAD, encoded, aad string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(raw) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], []byte(aad))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// isCiphertext 是否为加密后的列值
+func isCiphertext(s string) bool {
+	return strings.HasPrefix(s, ciphertextPrefix)
+}
+
+// encryptFields 加密非空的列，全部为空时不生成数据密钥；本地缓冲回放不经过加密存储，不会重复加密
+func (k *Keyring) encryptFields(keyId, wrapped *string, fields map[string]*string) error {
+	var aead cipher.AEAD
+	for column, value := range fields {
+		if *value == "" {
+			continue
+		}
+		if aead == nil {
+			var err error
+			if *keyId, *wrapped, aead, err = k.newDataKey(); err != nil {
+				return err
+			}
+		}
+		sealed, err := seal(aead, []byte(*value), column)
+		if err != nil {
+			return err
+		}
+		*value = ciphertextPrefix + sealed
+	}
+	return nil
+}
+
+// decryptFields 解密加密过的列，未加密的行（主密钥ID为空）原样返回
+func (k *Keyring) decryptFields(keyId, wrapped string, fields map[string]*string) error {
+	if keyId == "" {
+		return nil
+	}
+	var aead cipher.AEAD
+	for column, value := range fields {
+		if !isCiphertext(*value) {
+			continue
+		}
+		if aead == nil {
+			var err error
+			if aead, err = k.openDataKey(keyId, wrapped); err != nil {
+				return err
+			}
+		}
+		plaintext, err := open(aead, strings.TrimPrefix(*value, ciphertextPrefix), column)
+		if err != nil {
+			return err
+		}
+		*value = string(plaintext)
+	}
+	return nil
+}
+
+// EncryptStore 写入前加密，并在后台用当前主密钥重新加密旧的数据密钥
+type EncryptStore struct {
+	LogStore
+	keyring       *Keyring
+	statusMessage bool
+
+	engine   databases.DBInterface
+	shards   *ShardManager
+	interval time.Duration
+	batch    int
+	logger   *zap.Logger
+}
+
+var _ LogStore = (*EncryptStore)(nil)
+
+// NewEncryptStore 创建字段加密存储，engine 与 shards 用于后台重新加密
+func NewEncryptStore(store LogStore, keyring *Keyring, c EncryptionConfig,
+	engine databases.DBInterface, shards *ShardManager) (*EncryptStore, error) {
+	interval, err := time.ParseDuration(c.RewrapInterval)
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("invalid encryption.rewrap_interval %q", c.RewrapInterval)
+	}
+	return &EncryptStore{
+		LogStore:      store,
+		keyring:       keyring,
+		statusMessage: c.EncryptStatusMessage,
+		engine:        engine,
+		shards:        shards,
+		interval:      interval,
+		batch:         c.RewrapBatch,
+		logger:        logs.GetLogger("Encryption"),
+	}, nil
+}
+
+func (s *EncryptStore) InsertApiLog(ctx context.Context, log *models.ApiLog) error {
+	err := s.keyring.encryptFields(&log.EncKeyId, &log.EncDataKey, map[string]*string{
+		"request_body":  &log.RequestBody,
+		"response_body": &log.ResponseBody,
+	})
+	if err != nil {
+		return err
+	}
+	return s.LogStore.InsertApiLog(ctx, log)
+}
+
+func (s *EncryptStore) InsertStatusReport(ctx context.Context, report *models.StatusReport) error {
+	if s.statusMessage {
+		err := s.keyring.encryptFields(&report.EncKeyId, &report.EncDataKey, map[string]*string{
+			"status_message": &report.StatusMessage,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return s.LogStore.InsertStatusReport(ctx, report)
+}
+
+// apiLogColumns API 日志的加密列
+func (s *EncryptStore) apiLogColumns() []string {
+	return []string{"request_body", "response_body"}
+}
+
+// statusReportColumns 模型调用日志的加密列，未开启状态消息加密时为空
+func (s *EncryptStore) statusReportColumns() []string {
+	if s.statusMessage {
+		return []string{"status_message"}
+	}
+	return nil
+}
+
+// encryptedCheck 加密列在数据库中为密文，过滤与排序无法得到正确结果
+func encryptedCheck(columns []string) *maskCheck {
+	return &maskCheck{masks: columns, reason: "field is encrypted at rest", cause: ErrEncryptedField}
+}
+
+// listPage 列表不返回加密列：显式选择加密列时报错，未选择返回列时从默认列中去掉
+func listPage(model reflect.Type, page Page, encrypted []string, check *maskCheck) Page {
+	check.fields("fields", page.Fields...)
+	if len(page.Fields) > 0 || len(encrypted) == 0 {
+		return page
+	}
+	fields, _ := projectFields(model, nil)
+	page.Fields = slices.DeleteFunc(fields, func(f string) bool { return slices.Contains(encrypted, f) })
+	return page
+}
+
+// DecryptApiLog 解密 API 日志详情的请求体与响应体，调用方脱敏的列不解密
+func (s *EncryptStore) DecryptApiLog(ctx context.Context, log *models.ApiLog) error {
+	return s.keyring.decryptFields(log.EncKeyId, log.EncDataKey, unmasked(ctx, map[string]*string{
+		"request_body":  &log.RequestBody,
+		"response_body": &log.ResponseBody,
+	}))
+}
+
+// DecryptStatusReport 解密模型调用日志详情的状态消息，调用方脱敏时不解密
+func (s *EncryptStore) DecryptStatusReport(ctx context.Context, report *models.StatusReport) error {
+	return s.keyring.decryptFields(report.EncKeyId, report.EncDataKey, unmasked(ctx, map[string]*string{
+		"status_message": &report.StatusMessage,
+	}))
+}
+
+// unmasked 去掉 ctx 中脱敏的列
+func unmasked(ctx context.Context, fields map[string]*string) map[string]*string {
+	for _, column := range Masks(ctx) {
+		delete(fields, column)
+	}
+	return fields
+}
+
+func (s *EncryptStore) ListApiLogs(ctx context.Context, filter ApiLogFilter, page Page) (*PageResult[models.ApiLog], error) {
+	check := encryptedCheck(s.apiLogColumns()).apiLogFilter(filter)
+	check.sort(page)
+	page = listPage(reflect.TypeOf(models.ApiLog{}), page, s.apiLogColumns(), check)
+	if err := check.err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.ListApiLogs(ctx, filter, page)
+}
+
+func (s *EncryptStore) ApiLogStats(ctx context.Context, filter ApiLogFilter) (*ApiLogStats, error) {
+	if err := encryptedCheck(s.apiLogColumns()).apiLogFilter(filter).err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.ApiLogStats(ctx, filter)
+}
+
+func (s *EncryptStore) ApiLogFacets(ctx context.Context, filter ApiLogFilter, fields []string) (map[string]*Facet, error) {
+	if err := encryptedCheck(s.apiLogColumns()).apiLogFilter(filter).err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.ApiLogFacets(ctx, filter, fields)
+}
+
+func (s *EncryptStore) ApiLogHistogram(ctx context.Context, filter ApiLogFilter, q HistogramQuery) (*Histogram, error) {
+	if err := encryptedCheck(s.apiLogColumns()).apiLogFilter(filter).err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.ApiLogHistogram(ctx, filter, q)
+}
+
+func (s *EncryptStore) ListStatusReports(ctx context.Context, filter StatusReportFilter, page Page) (*PageResult[models.StatusReport], error) {
+	check := encryptedCheck(s.statusReportColumns()).statusReportFilter(filter)
+	check.sort(page)
+	page = listPage(reflect.TypeOf(models.StatusReport{}), page, s.statusReportColumns(), check)
+	if err := check.err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.ListStatusReports(ctx, filter, page)
+}
+
+func (s *EncryptStore) StatusReportStats(ctx context.Context, filter StatusReportFilter) (*CallLogStats, error) {
+	if err := encryptedCheck(s.statusReportColumns()).statusReportFilter(filter).err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.StatusReportStats(ctx, filter)
+}
+
+func (s *EncryptStore) StatusReportFacets(ctx context.Context, filter StatusReportFilter, fields []string) (map[string]*Facet, error) {
+	if err := encryptedCheck(s.statusReportColumns()).statusReportFilter(filter).err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.StatusReportFacets(ctx, filter, fields)
+}
+
+func (s *EncryptStore) StatusReportHistogram(ctx context.Context, filter StatusReportFilter, q HistogramQuery) (*Histogram, error) {
+	if err := encryptedCheck(s.statusReportColumns()).statusReportFilter(filter).err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.StatusReportHistogram(ctx, filter, q)
+}
+
+// Run 定期检查密钥环变更，启动时与切换主密钥后重新加密使用旧主密钥的数据密钥，ctx 结束时退出
+func (s *EncryptStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	pending := true
+	for {
+		if reloaded, err := s.keyring.Reload(); err != nil {
+			s.logger.Error("加载密钥环失败，继续使用已加载的主密钥", zap.Error(err))
+		} else if reloaded {
+			s.logger.Info("密钥环已更新", zap.String("active", s.keyring.Active()))
+			pending = true
+		}
+		if pending {
+			pending = !s.rewrapAll(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// encryptedRow 重新加密时读取的列
+type encryptedRow struct {
+	Id         int64  `xorm:"'id'"`
+	EncKeyId   string `xorm:"'enc_key_id'"`
+	EncDataKey string `xorm:"'enc_data_key'"`
+}
+
+// rewrapAll 重新加密全部表，全部完成时返回 true，出错的行留待下次重试
+func (s *EncryptStore) rewrapAll(ctx context.Context) bool {
+	tables := []string{models.ApiLog{}.TableName()}
+	shards, err := s.shards.syncedShards()
+	if err != nil {
+		s.logger.Warn("列出日分片失败", zap.Error(err))
+		return false
+	}
+	for name := range shards {
+		tables = append(tables, name)
+	}
+	done := true
+	for _, table := range tables {
+		if ctx.Err() != nil {
+			return false
+		}
+		rewrapped, failed, err := s.rewrapTable(ctx, table)
+		if rewrapped > 0 {
+			s.logger.Info("重新加密数据密钥", zap.String("table", table), zap.Int("rows", rewrapped))
+		}
+		if err != nil || failed > 0 {
+			s.logger.Warn("重新加密数据密钥未完成", zap.String("table", table), zap.Int("failed", failed), zap.Error(err))
+			done = false
+		}
+	}
+	return done
+}
+
+func (s *EncryptStore) rewrapTable(ctx context.Context, table string) (rewrapped, failed int, err error) {
+	active := s.keyring.Active()
+	var cursor int64
+	for {
+		var rows []encryptedRow
+		err = s.engine.Context(ctx).Table(table).Cols("id", "enc_key_id", "enc_data_key").
+			Where("enc_key_id <> '' AND enc_key_id <> ? AND id > ?", active, cursor).
+			Asc("id").Limit(s.batch).Find(&rows)
+		if err != nil || len(rows) == 0 {
+			return rewrapped, failed, err
+		}
+		for _, row := range rows {
+			cursor = row.Id
+			keyId, wrapped, err := s.keyring.rewrap(row.EncKeyId, row.EncDataKey)
+			if err != nil {
+				metrics.Counter("encryption_rewrap_errors").Add(1)
+				failed++
+				continue
+			}
+			// 只在数据密钥未被并发修改时更新
+			_, err = s.engine.Context(ctx).Table(table).Where("id = ? AND enc_key_id = ?", row.Id, row.EncKeyId).
+				Update(map[string]interface{}{"enc_key_id": keyId, "enc_data_key": wrapped})
+			if err != nil {
+				return rewrapped, failed, err
+			}
+			metrics.Counter("encryption_rewrapped_rows").Add(1)
+			rewrapped++
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stardustagi/TopModelsLogs/models"
+	"xorm.io/xorm"
+	"xorm.io/xorm/names"
+)
+
+// openEncrypted SQLite 存储之上的字段加密存储
+func openEncrypted(t *testing.T) *EncryptStore {
+	t.Helper()
+	dir := t.TempDir()
+	e, err := xorm.NewEngine("sqlite", "file:"+filepath.Join(dir, "logs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetMapper(names.GonicMapper{})
+	e.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = e.Close() })
+	if err = e.Sync2(new(models.ApiLog)); err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDialect(DialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewShardManager(e, d, ShardModeTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewSQLStore(e, d, m, nil, SearchConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring, err := OpenKeyring(filepath.Join(dir, "keyring.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewEncryptStore(store, keyring, EncryptionConfig{EncryptStatusMessage: true, RewrapInterval: "1m", RewrapBatch: 10}, e, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestEncryptStoreDecryptsDetailOnly(t *testing.T) {
+	s := openEncrypted(t)
+	ctx := context.Background()
+	log := &models.ApiLog{UserId: 1, ApiPath: "/v1/chat", RequestBody: `{"q":"hello"}`, ResponseBody: "world", CreatedAt: 1000}
+	if err := s.InsertApiLog(ctx, log); err != nil {
+		t.Fatal(err)
+	}
+	if !isCiphertext(log.RequestBody) {
+		t.Fatalf("request body stored as %q", log.RequestBody)
+	}
+
+	// 读取不解密，由详情在权限检查后解密
+	got, err := s.GetApiLog(ctx, log.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isCiphertext(got.RequestBody) || !isCiphertext(got.ResponseBody) {
+		t.Fatalf("read decrypted: %q / %q", got.RequestBody, got.ResponseBody)
+	}
+	masked := *got
+	if err = s.DecryptApiLog(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.RequestBody != `{"q":"hello"}` || got.ResponseBody != "world" {
+		t.Errorf("detail = %q / %q", got.RequestBody, got.ResponseBody)
+	}
+	// 调用方脱敏的列不解密
+	if err = s.DecryptApiLog(WithMasks(ctx, []string{"response_body"}), &masked); err != nil {
+		t.Fatal(err)
+	}
+	if masked.RequestBody != `{"q":"hello"}` || !isCiphertext(masked.ResponseBody) {
+		t.Errorf("masked detail = %q / %q", masked.RequestBody, masked.ResponseBody)
+	}
+
+	// 列表不能选择加密列
+	_, err = s.ListApiLogs(ctx, ApiLogFilter{}, Page{Limit: 10, Fields: []string{"id", "request_body"}})
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || !errors.Is(err, ErrEncryptedField) || invalid.Errors[0].Value != "request_body" {
+		t.Errorf("list with encrypted field: %v", err)
+	}
+
+	// 默认列中去掉加密的状态消息，行的密钥缺失不影响列表
+	report := &models.StatusReport{TraceId: "t", Model: "gpt", StatusCode: "500", StatusMessage: "upstream timeout", CreatedAt: time.Now()}
+	if err = s.InsertStatusReport(ctx, report); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.engine.Table(report.GetSliceDateDayTableByTime(report.CreatedAt)).Where("id = ?", report.Id).
+		Update(map[string]interface{}{"enc_key_id": "retired"}); err != nil {
+		t.Fatal(err)
+	}
+	reports, err := s.ListStatusReports(ctx, StatusReportFilter{}, Page{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports.Rows) != 1 || reports.Rows[0].StatusMessage != "" || slices.Contains(reports.Fields, "status_message") {
+		t.Errorf("call log list = %v %+v", reports.Fields, reports.Rows)
+	}
+	detail, err := s.GetStatusReport(ctx, report.Id, report.CreatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.DecryptStatusReport(ctx, detail); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("detail with retired key: %v", err)
+	}
+}
+
+func TestEncryptStoreRejectsEncryptedFilters(t *testing.T) {
+	s := openEncrypted(t)
+	_, err := s.ListApiLogs(context.Background(), ApiLogFilter{Expr: mustExpr(t, `request_body like "hello"`, models.ApiLog{})}, Page{Limit: 10})
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || !errors.Is(err, ErrEncryptedField) {
+		t.Errorf("filter on encrypted column: %v", err)
+	}
+	_, err = s.StatusReportStats(context.Background(), StatusReportFilter{Expr: mustExpr(t, `status_message = "x"`, models.StatusReport{})})
+	if !errors.Is(err, ErrEncryptedField) {
+		t.Errorf("stats filter on encrypted column: %v", err)
+	}
+}
+
+func mustExpr(t *testing.T, src string, model interface{}) *Expr {
+	t.Helper()
+	expr, err := ParseExpr(src, model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expr
+}
+
+func TestKeyColumnsInternal(t *testing.T) {
+	if _, err := ParseExpr(`enc_key_id = "k1"`, models.ApiLog{}); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("filter on key column: %v", err)
+	}
+	if _, err := projectFields(reflect.TypeOf(models.StatusReport{}), []string{"enc_data_key"}); !errors.Is(err, ErrInvalidFields) {
+		t.Errorf("key column in fields: %v", err)
+	}
+	if err := ValidateMaskFields([]string{"enc_key_id"}); err == nil {
+		t.Error("key column accepted as mask field")
+	}
+	raw, err := json.Marshal(ProjectRow(models.ApiLog{Id: 1, RequestBody: "x", EncKeyId: "k1", EncDataKey: "wrapped"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "enc_") || !strings.Contains(string(raw), `"request_body":"x"`) {
+		t.Errorf("detail json = %s", raw)
+	}
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/stardustagi/TopLib/libs/databases"
+	"xorm.io/xorm/contexts"
+)
+
+// errExplained 试运行时拦截查询语句，不实际执行
+var errExplained = errors.New("statement captured for explain")
+
+// ExplainPlan 查询的执行计划
+type ExplainPlan struct {
+	Tables        []string            `json:"tables,omitempty"` // 模型调用日志涉及的日分片，按日期从新到旧
+	SQL           string              `json:"sql"`              // 生成的查询语句，没有需要查询的分片时为空
+	Args          []interface{}       `json:"args"`
+	Plan          []map[string]string `json:"plan"`           // 数据库 EXPLAIN 输出，UNION 查询每个分片各有对应的行
+	EstimatedRows int64               `json:"estimated_rows"` // 估算的扫描行数，数据库不提供估算时为 -1
+}
+
+type explainKey struct{}
+
+// explainRecorder 记录试运行中发出的第一条查询语句
+type explainRecorder struct {
+	tables []string
+	sql    string
+	args   []interface{}
+}
+
+func explainFrom(ctx context.Context) *explainRecorder {
+	r, _ := ctx.Value(explainKey{}).(*explainRecorder)
+	return r
+}
+
+// noteTables 试运行时记录查询涉及的分片
+func noteTables(ctx context.Context, tables []string) {
+	if r := explainFrom(ctx); r != nil {
+		r.tables = tables
+	}
+}
+
+// explainHook 拦截带 explainRecorder 的 ctx 发出的查询，记录后中止执行
+type explainHook struct{}
+
+func (explainHook) BeforeProcess(c *contexts.ContextHook) (context.Context, error) {
+	if r := explainFrom(c.Ctx); r != nil {
+		r.sql, r.args = c.SQL, c.Args
+		return c.Ctx, errExplained
+	}
+	return c.Ctx, nil
+}
+
+func (explainHook) AfterProcess(*contexts.ContextHook) error {
+	return nil
+}
+
+func addExplainHook(engines ...databases.DBInterface) {
+	for _, e := range engines {
+		e.AddHook(explainHook{})
+	}
+}
+
+// Explain 试运行 fn：fn 发出的第一条查询语句（列表为取数查询，统计为聚合查询）被拦截而不执行，
+// 在主库上对其执行 EXPLAIN 后返回；参数校验与查询上限的错误照常返回
+func Explain(ctx context.Context, fn func(ctx context.Context) error) (*ExplainPlan, error) {
+	r := &explainRecorder{}
+	if err := fn(context.WithValue(ctx, explainKey{}, r)); err != nil && !errors.Is(err, errExplained) {
+		return nil, err
+	}
+	plan := &ExplainPlan{Tables: r.tables, SQL: r.sql, Args: r.args, Plan: []map[string]string{}}
+	if r.sql == "" {
+		return plan, nil
+	}
+	if engine == nil {
+		return nil, fmt.Errorf("explain is not supported by the current store")
+	}
+	// 屏蔽 ctx 中的 recorder，EXPLAIN 语句本身需要执行
+	qctx := context.WithValue(ctx, explainKey{}, (*explainRecorder)(nil))
+	rows, err := engine.Context(qctx).QueryString(append([]interface{}{dialect.ExplainSQL(r.sql)}, r.args...)...)
+	if err != nil {
+		return nil, err
+	}
+	plan.Plan = rows
+	plan.EstimatedRows = -1
+	if n, ok := dialect.EstimatedRows(rows); ok {
+		plan.EstimatedRows = n
+	}
+	return plan, nil
+}
@@ -0,0 +1,639 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"xorm.io/builder"
+)
+
+// 过滤表达式，例如：
+//
+//	model = "gpt-4o" and latency > 2.5 and status_code != "" and step in ("select_provider", "send_llm_request")
+//
+// 支持 and / or / not 与括号，比较运算 = != > >= < <=，[not] in (...) 与 [not] like "..."（% 与 _ 通配）
+// 表达式先解析为 AST，再按模型字段校验并把字面量转换为字段类型，最后编译为参数化条件；
+// 列名只取自模型字段，字面量一律作为参数传递
+const (
+	maxExprLength = 4096
+	maxExprNodes  = 64
+	maxInValues   = 100
+)
+
+// ErrInvalidFilter 过滤表达式语法错误或字段、取值不合法，具体原因见 ValidationError
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// exprTimeLayouts 时间字段接受的字符串格式，按本地时区解析；数字按 Unix 秒处理
+var exprTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+// Expr 校验过的过滤表达式
+type Expr struct {
+	src  string
+	root exprNode
+}
+
+// String 原始表达式
+func (e *Expr) String() string {
+	return e.src
+}
+
+// ParseExpr 解析过滤表达式并按 model 的字段校验，空表达式返回 nil
+func ParseExpr(src string, model interface{}) (*Expr, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, nil
+	}
+	if len(src) > maxExprLength {
+		return nil, filterError(FieldError{
+			Field:  "filter",
+			Value:  fmt.Sprintf("%d bytes", len(src)),
+			Reason: fmt.Sprintf("longer than %d bytes", maxExprLength),
+		})
+	}
+	tokens, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.unexpected(tok, "and / or")
+	}
+	t := reflect.Indirect(reflect.ValueOf(model)).Type()
+	v := &exprValidator{model: t, fields: modelFields(t)}
+	v.validate(root)
+	if len(v.errs) > 0 {
+		return nil, filterError(v.errs...)
+	}
+	return &Expr{src: src, root: root}, nil
+}
+
+// cond 编译为参数化查询条件
+func (e *Expr) cond(d Dialect) builder.Cond {
+	return e.root.cond(d)
+}
+
+// match 内存实现使用，row 为模型指针
+func (e *Expr) match(row interface{}) bool {
+	return e.root.match(row)
+}
+
+func filterError(errs ...FieldError) error {
+	return &ValidationError{Err: ErrInvalidFilter, Errors: errs}
+}
+
+// ---- AST ----
+
+type exprNode interface {
+	cond(d Dialect) builder.Cond
+	match(row interface{}) bool
+}
+
+type logicalNode struct {
+	or          bool
+	left, right exprNode
+}
+
+func (n *logicalNode) cond(d Dialect) builder.Cond {
+	if n.or {
+		return builder.Or(n.left.cond(d), n.right.cond(d))
+	}
+	return builder.And(n.left.cond(d), n.right.cond(d))
+}
+
+func (n *logicalNode) match(row interface{}) bool {
+	if n.or {
+		return n.left.match(row) || n.right.match(row)
+	}
+	return n.left.match(row) && n.right.match(row)
+}
+
+type notNode struct {
+	x exprNode
+}
+
+func (n *notNode) cond(d Dialect) builder.Cond {
+	return builder.Not{n.x.cond(d)}
+}
+
+func (n *notNode) match(row interface{}) bool {
+	return !n.x.match(row)
+}
+
+// literal 字面量，校验后 value 为字段类型对应的取值
+type literal struct {
+	str   bool
+	text  string
+	pos   int
+	value interface{}
+}
+
+type compareNode struct {
+	field string
+	pos   int
+	op    string
+	lit   *literal
+}
+
+func (n *compareNode) cond(d Dialect) builder.Cond {
+	v := n.lit.value
+	switch n.op {
+	case "!=":
+		return builder.Neq{n.field: v}
+	case ">":
+		return builder.Gt{n.field: v}
+	case ">=":
+		return builder.Gte{n.field: v}
+	case "<":
+		return builder.Lt{n.field: v}
+	case "<=":
+		return builder.Lte{n.field: v}
+	}
+	return builder.Eq{n.field: v}
+}
+
+func (n *compareNode) match(row interface{}) bool {
+	v, err := columnValue(row, n.field)
+	if err != nil {
+		return false
+	}
+	c := compareValues(v, n.lit.value)
+	switch n.op {
+	case "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	}
+	return c == 0
+}
+
+type inNode struct {
+	field  string
+	pos    int
+	not    bool
+	values []*literal
+}
+
+func (n *inNode) cond(d Dialect) builder.Cond {
+	values := make([]interface{}, len(n.values))
+	for i, lit := range n.values {
+		values[i] = lit.value
+	}
+	if n.not {
+		return builder.NotIn(n.field, values...)
+	}
+	return builder.In(n.field, values...)
+}
+
+func (n *inNode) match(row interface{}) bool {
+	v, err := columnValue(row, n.field)
+	if err != nil {
+		return false
+	}
+	for _, lit := range n.values {
+		if compareValues(v, lit.value) == 0 {
+			return !n.not
+		}
+	}
+	return n.not
+}
+
+type likeNode struct {
+	field string
+	pos   int
+	not   bool
+	lit   *literal
+	re    *regexp.Regexp
+}
+
+func (n *likeNode) cond(d Dialect) builder.Cond {
+	c := builder.Expr(n.field+" "+d.LikeOp()+" ?", n.lit.value)
+	if n.not {
+		return builder.Not{c}
+	}
+	return c
+}
+
+func (n *likeNode) match(row interface{}) bool {
+	v, err := columnValue(row, n.field)
+	if err != nil {
+		return false
+	}
+	s, _ := v.(string)
+	return n.re.MatchString(s) != n.not
+}
+
+// likePattern 把 LIKE 通配转换为不区分大小写的正则
+func likePattern(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// ---- 校验 ----
+
+type exprValidator struct {
+	model  reflect.Type
+	fields map[string]fieldInfo
+	errs   []FieldError
+}
+
+func (v *exprValidator) validate(node exprNode) {
+	switch n := node.(type) {
+	case *logicalNode:
+		v.validate(n.left)
+		v.validate(n.right)
+	case *notNode:
+		v.validate(n.x)
+	case *compareNode:
+		if target, ok := v.field(n.field, n.pos); ok {
+			v.convert(n.field, target, n.lit)
+		}
+	case *inNode:
+		if target, ok := v.field(n.field, n.pos); ok {
+			for _, lit := range n.values {
+				v.convert(n.field, target, lit)
+			}
+		}
+	case *likeNode:
+		target, ok := v.field(n.field, n.pos)
+		if !ok {
+			return
+		}
+		if target.Kind() != reflect.String || v.fields[n.field].numeric || !n.lit.str {
+			v.fail(n.lit.text, n.lit.pos, "like only applies to text fields with a string pattern")
+			return
+		}
+		n.lit.value = n.lit.text
+		n.re = likePattern(n.lit.text)
+	}
+}
+
+func (v *exprValidator) field(name string, pos int) (reflect.Type, bool) {
+	info, ok := v.fields[name]
+	if !ok {
+		v.fail(name, pos, "unknown field")
+		return nil, false
+	}
+	return v.model.Field(info.index).Type, true
+}
+
+// convert 把字面量转换为字段类型
+func (v *exprValidator) convert(field string, target reflect.Type, lit *literal) {
+	if v.fields[field].numeric {
+		target = reflect.TypeOf(float64(0))
+	}
+	if target == reflect.TypeOf(time.Time{}) {
+		if !lit.str {
+			n, err := strconv.ParseInt(lit.text, 10, 64)
+			if err != nil {
+				v.fail(lit.text, lit.pos, "expected unix seconds or a time string")
+				return
+			}
+			lit.value = time.Unix(n, 0)
+			return
+		}
+		for _, layout := range exprTimeLayouts {
+			if t, err := time.ParseInLocation(layout, lit.text, time.Local); err == nil {
+				lit.value = t
+				return
+			}
+		}
+		v.fail(lit.text, lit.pos, "expected time like 2006-01-02 15:04:05")
+		return
+	}
+	if target.Kind() == reflect.String {
+		if !lit.str {
+			v.fail(lit.text, lit.pos, field+" is a text field, quote the value")
+			return
+		}
+		lit.value = lit.text
+		return
+	}
+	if lit.str {
+		v.fail(lit.text, lit.pos, field+" is a numeric field")
+		return
+	}
+	var err error
+	switch target.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		lit.value, err = strconv.ParseInt(lit.text, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		lit.value, err = strconv.ParseUint(lit.text, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(lit.text, 64); err == nil && (math.IsInf(f, 0) || math.IsNaN(f)) {
+			err = errors.New("out of range")
+		}
+		lit.value = f
+	default:
+		v.fail(field, lit.pos, "field is not filterable")
+		return
+	}
+	if err != nil {
+		v.fail(lit.text, lit.pos, "invalid number for "+field)
+	}
+}
+
+func (v *exprValidator) fail(value string, pos int, reason string) {
+	v.errs = append(v.errs, FieldError{
+		Field:  "filter",
+		Value:  value,
+		Reason: fmt.Sprintf("position %d: %s", pos, reason),
+	})
+}
+
+// ---- 词法 ----
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // 从 1 开始的字符位置
+}
+
+func lexExpr(src string) ([]token, error) {
+	runes := []rune(src)
+	var tokens []token
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: pos})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokComma, text: ",", pos: pos})
+			i++
+		case r == '"' || r == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				b.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, filterError(FieldError{Field: "filter", Value: string(runes[i:]),
+					Reason: fmt.Sprintf("position %d: unterminated string", pos)})
+			}
+			tokens = append(tokens, token{kind: tokString, text: b.String(), pos: pos})
+			i = j + 1
+		case r == '-' || r == '.' || unicode.IsDigit(r):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || strings.ContainsRune(".eE", runes[j]) ||
+				(strings.ContainsRune("+-", runes[j]) && strings.ContainsRune("eE", runes[j-1]))) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: string(runes[i:j]), pos: pos})
+			i = j
+		case r == '_' || unicode.IsLetter(r):
+			j := i + 1
+			for j < len(runes) && (runes[j] == '_' || unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: string(runes[i:j]), pos: pos})
+			i = j
+		case strings.ContainsRune("=!<>", r):
+			op, width := string(r), 1
+			if i+1 < len(runes) && (runes[i+1] == '=' || (r == '<' && runes[i+1] == '>')) {
+				op, width = op+string(runes[i+1]), 2
+			}
+			switch op {
+			case "==":
+				op = "="
+			case "<>":
+				op = "!="
+			case "!":
+				return nil, filterError(FieldError{Field: "filter", Value: op,
+					Reason: fmt.Sprintf("position %d: unknown operator", pos)})
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: pos})
+			i += width
+		default:
+			return nil, filterError(FieldError{Field: "filter", Value: string(r),
+				Reason: fmt.Sprintf("position %d: unexpected character", pos)})
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(runes) + 1}), nil
+}
+
+// ---- 语法 ----
+//
+//	or      := and { "or" and }
+//	and     := unary { "and" unary }
+//	unary   := "not" unary | "(" or ")" | predicate
+//	predicate := field op value | field ["not"] "in" "(" value { "," value } ")" | field ["not"] "like" string
+
+type exprParser struct {
+	tokens []token
+	at     int
+	nodes  int
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.at]
+}
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.at]
+	if tok.kind != tokEOF {
+		p.at++
+	}
+	return tok
+}
+
+func (p *exprParser) keyword(word string) bool {
+	tok := p.peek()
+	if tok.kind == tokIdent && strings.EqualFold(tok.text, word) {
+		p.at++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) node() error {
+	p.nodes++
+	if p.nodes > maxExprNodes {
+		return filterError(FieldError{Field: "filter", Value: p.peek().text,
+			Reason: fmt.Sprintf("more than %d conditions", maxExprNodes)})
+	}
+	return nil
+}
+
+func (p *exprParser) unexpected(tok token, expected string) error {
+	value := tok.text
+	if tok.kind == tokEOF {
+		value = "end of filter"
+	}
+	return filterError(FieldError{Field: "filter", Value: value,
+		Reason: fmt.Sprintf("position %d: expected %s", tok.pos, expected)})
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.keyword("not") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{x: x}, nil
+	}
+	if p.peek().kind == tokLParen {
+		p.next()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.next(); tok.kind != tokRParen {
+			return nil, p.unexpected(tok, ")")
+		}
+		return x, nil
+	}
+	return p.parsePredicate()
+}
+
+func (p *exprParser) parsePredicate() (exprNode, error) {
+	if err := p.node(); err != nil {
+		return nil, err
+	}
+	field := p.next()
+	if field.kind != tokIdent || isExprKeyword(field.text) {
+		return nil, p.unexpected(field, "field name")
+	}
+	name := strings.ToLower(field.text)
+	not := p.keyword("not")
+	switch {
+	case p.keyword("in"):
+		n := &inNode{field: name, pos: field.pos, not: not}
+		if tok := p.next(); tok.kind != tokLParen {
+			return nil, p.unexpected(tok, "(")
+		}
+		for {
+			lit, err := p.parseLiteral()
+			if err != nil {
+				return nil, err
+			}
+			if n.values = append(n.values, lit); len(n.values) > maxInValues {
+				return nil, filterError(FieldError{Field: "filter", Value: field.text,
+					Reason: fmt.Sprintf("position %d: more than %d values in list", field.pos, maxInValues)})
+			}
+			tok := p.next()
+			if tok.kind == tokRParen {
+				return n, nil
+			}
+			if tok.kind != tokComma {
+				return nil, p.unexpected(tok, ", or )")
+			}
+		}
+	case p.keyword("like"):
+		lit, err := p.parseLiteral()
+		if err != nil {
+			return nil, err
+		}
+		return &likeNode{field: name, pos: field.pos, not: not, lit: lit}, nil
+	case not:
+		return nil, p.unexpected(p.peek(), "in or like after not")
+	}
+	op := p.next()
+	if op.kind != tokOp {
+		return nil, p.unexpected(op, "operator")
+	}
+	lit, err := p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	return &compareNode{field: name, pos: field.pos, op: op.text, lit: lit}, nil
+}
+
+func (p *exprParser) parseLiteral() (*literal, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokString:
+		return &literal{str: true, text: tok.text, pos: tok.pos}, nil
+	case tokNumber:
+		return &literal{text: tok.text, pos: tok.pos}, nil
+	}
+	return nil, p.unexpected(tok, "quoted string or number")
+}
+
+func isExprKeyword(word string) bool {
+	switch strings.ToLower(word) {
+	case "and", "or", "not", "in", "like":
+		return true
+	}
+	return false
+}
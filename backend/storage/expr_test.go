@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stardustagi/TopModelsLogs/models"
+	"xorm.io/xorm"
+	"xorm.io/xorm/names"
+)
+
+// exprRows 过滤表达式测试用的 API 日志
+var exprRows = []models.ApiLog{
+	{Id: 1, UserId: 1, ApiPath: "/v1/chat", Method: "POST", StatusCode: 200, Duration: 120, CreatedAt: 1000},
+	{Id: 2, UserId: 1, ApiPath: "/v1/chat", Method: "GET", StatusCode: 500, Duration: 900, CreatedAt: 2000},
+	{Id: 3, UserId: 2, ApiPath: "/v1/embeddings", Method: "POST", StatusCode: 500, Duration: 40, CreatedAt: 3000},
+	{Id: 4, UserId: 2, ApiPath: "/V1/Images", Method: "GET", StatusCode: 404, Duration: 15, CreatedAt: 4000},
+	{Id: 5, UserId: 3, ApiPath: "/v2/chat_stream", Method: "POST", StatusCode: 200, Duration: 3000, CreatedAt: 5000},
+}
+
+// exprCases 表达式与内存匹配的行 id
+var exprCases = []struct {
+	src string
+	ids []int64
+}{
+	// and 优先于 or：status_code = 200 or (user_id = 2 and method = "GET")
+	{`status_code = 200 or user_id = 2 and method = "GET"`, []int64{1, 4, 5}},
+	{`(status_code = 200 or user_id = 2) and method = "GET"`, []int64{4}},
+	// not 只作用于紧随的条件
+	{`not status_code = 500 and user_id = 2`, []int64{4}},
+	{`not (status_code = 500 and user_id = 2)`, []int64{1, 2, 4, 5}},
+	{`not not user_id = 3`, []int64{5}},
+	{`status_code in (404, 500)`, []int64{2, 3, 4}},
+	{`status_code not in (404, 500)`, []int64{1, 5}},
+	{`method IN ("GET")`, []int64{2, 4}},
+	{`api_path like "/v1/%"`, []int64{1, 2, 3, 4}},
+	{`api_path like "/v1/chat"`, []int64{1, 2}},
+	{`api_path not like "%chat%"`, []int64{3, 4}},
+	{`api_path like "/v_/images"`, []int64{4}},
+	{`duration >= 900 and duration < 3000`, []int64{2}},
+	{`status_code <> 200 and created_at <= 3000`, []int64{2, 3}},
+	{`status_code == 404 or method != 'POST' and user_id > 1`, []int64{4}},
+}
+
+func TestParseExprMatch(t *testing.T) {
+	for _, c := range exprCases {
+		e, err := ParseExpr(c.src, models.ApiLog{})
+		if err != nil {
+			t.Fatalf("%s: %v", c.src, err)
+		}
+		ids := make([]int64, 0)
+		for i := range exprRows {
+			if e.match(&exprRows[i]) {
+				ids = append(ids, exprRows[i].Id)
+			}
+		}
+		if !slices.Equal(ids, c.ids) {
+			t.Errorf("%s: matched %v, want %v", c.src, ids, c.ids)
+		}
+	}
+}
+
+// TestParseExprCondMatchesMemory SQL 条件与内存匹配对同一批行的结果一致
+func TestParseExprCondMatchesMemory(t *testing.T) {
+	e, err := xorm.NewEngine("sqlite", "file:"+filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetMapper(names.GonicMapper{})
+	e.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = e.Close() })
+	if err = e.Sync2(new(models.ApiLog)); err != nil {
+		t.Fatal(err)
+	}
+	for i := range exprRows {
+		row := exprRows[i]
+		if _, err = e.InsertOne(&row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d, err := NewDialect(DialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range exprCases {
+		expr, err := ParseExpr(c.src, models.ApiLog{})
+		if err != nil {
+			t.Fatalf("%s: %v", c.src, err)
+		}
+		var logs []models.ApiLog
+		if err = e.Where(expr.cond(d)).Asc("id").Find(&logs); err != nil {
+			t.Fatalf("%s: %v", c.src, err)
+		}
+		ids := make([]int64, 0, len(logs))
+		for _, l := range logs {
+			ids = append(ids, l.Id)
+		}
+		if !slices.Equal(ids, c.ids) {
+			t.Errorf("%s: sql matched %v, memory %v", c.src, ids, c.ids)
+		}
+	}
+}
+
+func TestParseExprErrors(t *testing.T) {
+	many := make([]string, maxExprNodes+1)
+	for i := range many {
+		many[i] = "user_id = 1"
+	}
+	values := make([]string, maxInValues+1)
+	for i := range values {
+		values[i] = "1"
+	}
+	cases := []struct {
+		src    string
+		model  interface{}
+		reason string
+	}{
+		{`api_path = 5`, models.ApiLog{}, "quote the value"},
+		{`status_code = "500"`, models.ApiLog{}, "numeric field"},
+		{`status_code = 1.5`, models.ApiLog{}, "invalid number"},
+		{`status_code in (200, "x")`, models.ApiLog{}, "numeric field"},
+		{`latency > "slow"`, models.StatusReport{}, "numeric field"},
+		{`created_at > "yesterday"`, models.StatusReport{}, "expected time"},
+		{`created_at > 1.5`, models.StatusReport{}, "unix seconds"},
+		{`status_code like "5%"`, models.ApiLog{}, "like only applies"},
+		{`api_path like 5`, models.ApiLog{}, "like only applies"},
+		{`password = "x"`, models.ApiLog{}, "unknown field"},
+		{`api_path = "/v1`, models.ApiLog{}, "unterminated string"},
+		{`api_path = '/v1" and user_id = 1`, models.ApiLog{}, "unterminated string"},
+		{`user_id = 1 and`, models.ApiLog{}, "expected field name"},
+		{`(user_id = 1`, models.ApiLog{}, "expected )"},
+		{`user_id = 1 user_id = 2`, models.ApiLog{}, "expected and / or"},
+		{`user_id not = 1`, models.ApiLog{}, "in or like after not"},
+		{`user_id in 1`, models.ApiLog{}, "expected ("},
+		{`user_id ! 1`, models.ApiLog{}, "unknown operator"},
+		{`user_id = 1; drop table api_log`, models.ApiLog{}, "unexpected character"},
+		{strings.Join(many, " or "), models.ApiLog{}, "more than 64 conditions"},
+		{"user_id in (" + strings.Join(values, ",") + ")", models.ApiLog{}, "more than 100 values"},
+		{strings.Repeat(" ", maxExprLength) + "user_id = 1", models.ApiLog{}, "longer than"},
+	}
+	for _, c := range cases {
+		_, err := ParseExpr(c.src, c.model)
+		var invalid *ValidationError
+		if !errors.Is(err, ErrInvalidFilter) || !errors.As(err, &invalid) {
+			t.Errorf("%.40s: got %v, want invalid filter", c.src, err)
+			continue
+		}
+		if !strings.Contains(invalid.Errors[0].Reason, c.reason) {
+			t.Errorf("%.40s: reason %q, want %q", c.src, invalid.Errors[0].Reason, c.reason)
+		}
+	}
+}
+
+func TestParseExprLimits(t *testing.T) {
+	many := make([]string, maxExprNodes)
+	for i := range many {
+		many[i] = "user_id = 1"
+	}
+	if _, err := ParseExpr(strings.Join(many, " or "), models.ApiLog{}); err != nil {
+		t.Errorf("%d conditions: %v", maxExprNodes, err)
+	}
+	values := make([]string, maxInValues)
+	for i := range values {
+		values[i] = "1"
+	}
+	if _, err := ParseExpr("user_id in ("+strings.Join(values, ",")+")", models.ApiLog{}); err != nil {
+		t.Errorf("%d values: %v", maxInValues, err)
+	}
+	if e, err := ParseExpr("  ", models.ApiLog{}); e != nil || err != nil {
+		t.Errorf("blank filter: %v, %v", e, err)
+	}
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/stardustagi/TopModelsLogs/models"
+	"xorm.io/builder"
+)
+
+// MaxFacetValues 单个字段最多统计的取值数，超出时按出现次数保留前 MaxFacetValues 个
+const MaxFacetValues = 1000
+
+// ErrInvalidFacet 分布统计字段不合法，具体原因见 ValidationError
+var ErrInvalidFacet = errors.New("invalid facet")
+
+// facetable 各日志类型允许统计取值分布的列，均为取值有限的维度列
+var facetable = map[reflect.Type][]string{
+	reflect.TypeOf(models.ApiLog{}):           {"api_path", "method", "status_code"},
+	reflect.TypeOf(models.ModelTrainingLog{}): {"status", "log_level"},
+	reflect.TypeOf(models.StatusReport{}): {"model", "actual_model", "provider", "actual_provider",
+		"step", "report_type", "node_addr", "node_id", "status_code"},
+}
+
+// FacetCount 字段取值与出现次数
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+// Facet 单个字段的取值分布，按出现次数从多到少排列
+type Facet struct {
+	Values    []FacetCount `json:"values"`
+	Truncated bool         `json:"truncated"` // 取值超过 MaxFacetValues，只保留了出现最多的部分
+}
+
+// ValidateFacetFields 校验分布统计字段
+func ValidateFacetFields(model interface{}, fields []string) error {
+	allowed := facetable[reflect.Indirect(reflect.ValueOf(model)).Type()]
+	var errs []FieldError
+	seen := make(map[string]bool, len(fields))
+	for i, field := range fields {
+		switch {
+		case !slices.Contains(allowed, field):
+			errs = append(errs, FieldError{
+				Field:  fmt.Sprintf("fields[%d]", i),
+				Value:  field,
+				Reason: "not facetable, allowed: " + strings.Join(allowed, ", "),
+			})
+		case seen[field]:
+			errs = append(errs, FieldError{Field: fmt.Sprintf("fields[%d]", i), Value: field, Reason: "duplicate field"})
+		}
+		seen[field] = true
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Err: ErrInvalidFacet, Errors: errs}
+	}
+	return nil
+}
+
+// MergeFacets 合并多个分片（或时间段）的取值分布
+func MergeFacets(parts ...*Facet) *Facet {
+	counts := make(map[string]int64)
+	merged := &Facet{}
+	for _, part := range parts {
+		if part == nil {
+			continue
+		}
+		merged.Truncated = merged.Truncated || part.Truncated
+		for _, v := range part.Values {
+			counts[v.Value] += v.Count
+		}
+	}
+	merged.Values = make([]FacetCount, 0, len(counts))
+	for value, count := range counts {
+		merged.Values = append(merged.Values, FacetCount{Value: value, Count: count})
+	}
+	sortFacet(merged.Values)
+	return merged
+}
+
+func sortFacet(values []FacetCount) {
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Count != values[j].Count {
+			return values[i].Count > values[j].Count
+		}
+		return values[i].Value < values[j].Value
+	})
+}
+
+// countFacets 内存实现使用，统计记录各字段的取值分布
+func countFacets[T any](rows []T, fields []string) (map[string]*Facet, error) {
+	result := make(map[string]*Facet, len(fields))
+	for _, field := range fields {
+		counts := make(map[string]int64)
+		for i := range rows {
+			v, err := columnValue(&rows[i], field)
+			if err != nil {
+				return nil, err
+			}
+			counts[fmt.Sprint(v)]++
+		}
+		facet := &Facet{Values: make([]FacetCount, 0, len(counts))}
+		for value, count := range counts {
+			facet.Values = append(facet.Values, FacetCount{Value: value, Count: count})
+		}
+		sortFacet(facet.Values)
+		if len(facet.Values) > MaxFacetValues {
+			facet.Values, facet.Truncated = facet.Values[:MaxFacetValues], true
+		}
+		result[field] = facet
+	}
+	return result, nil
+}
+
+func (s *sqlStore) ApiLogFacets(ctx context.Context, filter ApiLogFilter, fields []string) (facets map[string]*Facet, err error) {
+	if err = ValidateFacetFields(models.ApiLog{}, fields); err != nil {
+		return nil, err
+	}
+	err = s.read(ctx, func(ctx context.Context) (err error) {
+		facets, err = s.facets(ctx, []string{models.ApiLog{}.TableName()}, s.apiLogCond(filter), fields)
+		return err
+	})
+	return facets, err
+}
+
+func (s *sqlStore) ModelTrainingLogFacets(ctx context.Context, filter ModelTrainingLogFilter, fields []string) (facets map[string]*Facet, err error) {
+	if err = ValidateFacetFields(models.ModelTrainingLog{}, fields); err != nil {
+		return nil, err
+	}
+	err = s.read(ctx, func(ctx context.Context) (err error) {
+		facets, err = s.facets(ctx, []string{models.ModelTrainingLog{}.TableName()}, s.trainingLogCond(filter), fields)
+		return err
+	})
+	return facets, err
+}
+
+func (s *sqlStore) StatusReportFacets(ctx context.Context, filter StatusReportFilter, fields []string) (facets map[string]*Facet, err error) {
+	if err = ValidateFacetFields(models.StatusReport{}, fields); err != nil {
+		return nil, err
+	}
+	err = s.read(ctx, func(ctx context.Context) error {
+		tables, err := s.statusReportTables(ctx, filter.StartTime, filter.EndTime)
+		if err != nil {
+			return err
+		}
+		facets, err = s.facets(ctx, tables, s.statusReportCond(filter), fields)
+		return err
+	})
+	return facets, err
+}
+
+// facets 对每个字段执行一次 GROUP BY，多取一个取值判断是否截断
+func (s *sqlStore) facets(ctx context.Context, tables []string, cond builder.Cond, fields []string) (map[string]*Facet, error) {
+	result := make(map[string]*Facet, len(fields))
+	for _, field := range fields {
+		facet := &Facet{Values: make([]FacetCount, 0)}
+		result[field] = facet
+		if len(tables) == 0 {
+			continue
+		}
+		from, args, err := s.source(tables, field+" AS value", cond)
+		if err != nil {
+			return nil, err
+		}
+		query := fmt.Sprintf("SELECT value, COUNT(*) AS cnt FROM (%s) t GROUP BY value ORDER BY cnt DESC, value LIMIT %d",
+			from, MaxFacetValues+1)
+		rows, err := s.reader(ctx).Context(ctx).QueryString(append([]interface{}{query}, args...)...)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			facet.Values = append(facet.Values, FacetCount{Value: row["value"], Count: parseInt(row["cnt"])})
+		}
+		if len(facet.Values) > MaxFacetValues {
+			facet.Values, facet.Truncated = facet.Values[:MaxFacetValues], true
+		}
+	}
+	return result, nil
+}
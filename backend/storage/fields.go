@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fieldInfo 模型字段与列名的对应关系
+type fieldInfo struct {
+	index   int
+	numeric bool // DECIMAL 等以字符串保存的数值列
+}
+
+var modelFieldsCache sync.Map
+
+// internalColumns 存储层内部使用的列（解密所需的数据密钥），不能用于查询条件、返回列与脱敏配置，也不出现在响应中
+var internalColumns = []string{"enc_key_id", "enc_data_key"}
+
+// modelFields 以 json 标签（与列名一致）为键索引模型字段，不包含 internalColumns
+func modelFields(t reflect.Type) map[string]fieldInfo {
+	if cached, ok := modelFieldsCache.Load(t); ok {
+		return cached.(map[string]fieldInfo)
+	}
+	fields := make(map[string]fieldInfo, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" || slices.Contains(internalColumns, name) {
+			continue
+		}
+		fields[name] = fieldInfo{
+			index:   i,
+			numeric: strings.Contains(strings.ToUpper(field.Tag.Get("xorm")), "DECIMAL"),
+		}
+	}
+	modelFieldsCache.Store(t, fields)
+	return fields
+}
+
+// columnValue 读取模型某列的值，numeric 列转换为 float64
+func columnValue(row interface{}, column string) (interface{}, error) {
+	v := reflect.Indirect(reflect.ValueOf(row))
+	info, ok := modelFields(v.Type())[column]
+	if !ok {
+		return nil, fmt.Errorf("unknown column: %s", column)
+	}
+	value := v.Field(info.index).Interface()
+	if info.numeric {
+		if s, ok := value.(string); ok {
+			f, _ := strconv.ParseFloat(s, 64)
+			return f, nil
+		}
+	}
+	return value, nil
+}
+
+// compareValues 比较两个同类型的列值
+func compareValues(a, b interface{}) int {
+	switch x := a.(type) {
+	case string:
+		return strings.Compare(x, b.(string))
+	case time.Time:
+		return x.Compare(b.(time.Time))
+	}
+	fa, fb := toFloat(a), toFloat(b)
+	switch {
+	case fa < fb:
+		return -1
+	case fa > fb:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(v interface{}) float64 {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	}
+	return 0
+}
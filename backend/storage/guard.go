@@ -0,0 +1,385 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stardustagi/TopModelsLogs/models"
+)
+
+// 查询护栏：限制单次查询的时间跨度、涉及的日分片数与执行时长，避免不带时间范围或前置通配的查询扫描全表
+const (
+	OpList      = "list"
+	OpStats     = "stats"
+	OpFacets    = "facets"
+	OpHistogram = "histogram"
+	OpSearch    = "search"
+	OpGet       = "get"
+)
+
+// QueryLimits 查询上限，零值字段表示不限
+type QueryLimits struct {
+	MaxSpanDays  int   `json:"max_span_days"` // 时间范围最大跨度，未指定结束时间时截止到当前
+	MaxShards    int   `json:"max_shards"`    // 模型调用日志单次查询最多涉及的日分片数
+	TimeoutMs    int64 `json:"timeout_ms"`    // 查询超时，随请求取消一并取消
+	RequireRange bool  `json:"require_range"` // 模型调用日志必须指定开始时间
+}
+
+// GuardConfig 查询护栏配置
+type GuardConfig struct {
+	Enabled    bool                   `json:"enabled"`
+	Default    QueryLimits            `json:"default"`
+	Endpoints  map[string]QueryLimits `json:"endpoints"`   // 按操作（list / stats / facets / histogram / search / get）覆盖，零值字段沿用 default
+	Admin      QueryLimits            `json:"admin"`       // 管理员调用方的上限，零值字段沿用普通上限
+	AdminToken string                 `json:"admin_token"` // 请求头 X-Admin-Token 与之相同时按管理员上限查询，空为不启用
+}
+
+// ErrQueryLimited 查询超出护栏上限，具体原因见 LimitError
+var ErrQueryLimited = errors.New("query limit exceeded")
+
+// LimitError 查询触发的护栏上限
+type LimitError struct {
+	Limit  string `json:"limit"`  // 触发的上限：max_span_days / max_shards / timeout_ms / require_range
+	Value  string `json:"value"`  // 查询的实际取值
+	Max    string `json:"max"`    // 允许的上限
+	Reason string `json:"reason"` // 说明与调整建议
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s (value %s, limit %s): %s", ErrQueryLimited, e.Limit, e.Value, e.Max, e.Reason)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrQueryLimited
+}
+
+type adminLimitsKey struct{}
+
+// WithAdminLimits 本次请求按管理员上限查询
+func WithAdminLimits(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adminLimitsKey{}, true)
+}
+
+// isAdminLimits 是否按管理员上限查询
+func isAdminLimits(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminLimitsKey{}).(bool)
+	return admin
+}
+
+// Limits 操作 op 在 ctx 下生效的上限，护栏未开启时返回零值
+func (c GuardConfig) Limits(ctx context.Context, op string) QueryLimits {
+	if !c.Enabled {
+		return QueryLimits{}
+	}
+	limits := c.Default.merge(c.Endpoints[op])
+	if isAdminLimits(ctx) {
+		limits = limits.merge(c.Admin)
+		// 管理员未配置 require_range 时不强制指定时间范围
+		limits.RequireRange = c.Admin.RequireRange
+	}
+	return limits
+}
+
+// Limits 当前存储配置下操作 op 的上限，未初始化存储时不限
+func Limits(ctx context.Context, op string) QueryLimits {
+	if config == nil {
+		return QueryLimits{}
+	}
+	return config.Guard.Limits(ctx, op)
+}
+
+// merge 用 o 的非零字段覆盖 l
+func (l QueryLimits) merge(o QueryLimits) QueryLimits {
+	if o.MaxSpanDays > 0 {
+		l.MaxSpanDays = o.MaxSpanDays
+	}
+	if o.MaxShards > 0 {
+		l.MaxShards = o.MaxShards
+	}
+	if o.TimeoutMs > 0 {
+		l.TimeoutMs = o.TimeoutMs
+	}
+	l.RequireRange = l.RequireRange || o.RequireRange
+	return l
+}
+
+// CheckRange 校验时间范围，sharded 为按日分片的模型调用日志，wildcard 为带前置通配的模糊匹配
+// 零值 start 表示不限开始时间，零值 end 截止到当前
+func (l QueryLimits) CheckRange(start, end time.Time, sharded, wildcard bool) error {
+	if start.IsZero() {
+		switch {
+		case sharded && l.RequireRange:
+			return &LimitError{Limit: "require_range", Value: "unbounded", Max: "start_time required",
+				Reason: "call logs are sharded by day, specify start_time and end_time"}
+		case wildcard && (l.MaxSpanDays > 0 || l.RequireRange):
+			return &LimitError{Limit: "require_range", Value: "unbounded", Max: "start_time required",
+				Reason: "a pattern starting with a wildcard scans every row, specify start_time and end_time or anchor the pattern"}
+		case sharded && l.MaxShards > 0:
+			return &LimitError{Limit: "max_shards", Value: "all shards", Max: fmt.Sprintf("%d shards", l.MaxShards),
+				Reason: "no start_time given so every daily shard would be scanned, specify start_time"}
+		}
+		return nil
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if !end.After(start) {
+		return nil
+	}
+	if l.MaxSpanDays > 0 && end.Sub(start) > time.Duration(l.MaxSpanDays)*24*time.Hour {
+		return &LimitError{
+			Limit:  "max_span_days",
+			Value:  fmt.Sprintf("%.1f days", end.Sub(start).Hours()/24),
+			Max:    fmt.Sprintf("%d days", l.MaxSpanDays),
+			Reason: "narrow the time range or split the query",
+		}
+	}
+	if sharded && l.MaxShards > 0 {
+		if n := int(truncateDay(end).Sub(truncateDay(start))/(24*time.Hour)) + 1; n > l.MaxShards {
+			return &LimitError{
+				Limit:  "max_shards",
+				Value:  fmt.Sprintf("%d shards", n),
+				Max:    fmt.Sprintf("%d shards", l.MaxShards),
+				Reason: "the time range touches too many daily shards, narrow it",
+			}
+		}
+	}
+	return nil
+}
+
+// GuardStore 在 LogStore 之上校验查询上限并为查询设置超时，写入与清理不受限制
+type GuardStore struct {
+	LogStore
+	config GuardConfig
+}
+
+var _ LogStore = (*GuardStore)(nil)
+
+// NewGuardStore 创建带查询护栏的日志存储
+func NewGuardStore(store LogStore, config GuardConfig) *GuardStore {
+	return &GuardStore{LogStore: store, config: config}
+}
+
+// guarded 校验上限后在带超时的 ctx 中执行查询，超时按 LimitError 返回
+func (s *GuardStore) guarded(ctx context.Context, op string, check func(QueryLimits) error, fn func(ctx context.Context) error) error {
+	limits := s.config.Limits(ctx, op)
+	if check != nil {
+		if err := check(limits); err != nil {
+			return err
+		}
+	}
+	if limits.TimeoutMs <= 0 {
+		return fn(ctx)
+	}
+	timeout := time.Duration(limits.TimeoutMs) * time.Millisecond
+	qctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := fn(qctx)
+	if err != nil && ctx.Err() == nil && errors.Is(qctx.Err(), context.DeadlineExceeded) {
+		return &LimitError{
+			Limit:  "timeout_ms",
+			Value:  fmt.Sprintf("> %d ms", limits.TimeoutMs),
+			Max:    fmt.Sprintf("%d ms", limits.TimeoutMs),
+			Reason: "the query was cancelled, narrow the time range or add more selective filters",
+		}
+	}
+	return err
+}
+
+func (s *GuardStore) apiLogCheck(filter ApiLogFilter) func(QueryLimits) error {
+	wildcard := filter.ApiPath != "" || filter.Expr.leadingWildcard()
+	return func(l QueryLimits) error {
+		return l.CheckRange(unixTime(filter.StartTime), unixTime(filter.EndTime), false, wildcard)
+	}
+}
+
+func (s *GuardStore) trainingLogCheck(filter ModelTrainingLogFilter) func(QueryLimits) error {
+	return func(l QueryLimits) error {
+		return l.CheckRange(unixTime(filter.StartTime), unixTime(filter.EndTime), false, filter.Expr.leadingWildcard())
+	}
+}
+
+func (s *GuardStore) statusReportCheck(filter StatusReportFilter) func(QueryLimits) error {
+	return func(l QueryLimits) error {
+		return l.CheckRange(filter.StartTime, filter.EndTime, true, filter.Expr.leadingWildcard())
+	}
+}
+
+func (s *GuardStore) ListApiLogs(ctx context.Context, filter ApiLogFilter, page Page) (result *PageResult[models.ApiLog], err error) {
+	err = s.guarded(ctx, OpList, s.apiLogCheck(filter), func(ctx context.Context) (err error) {
+		result, err = s.LogStore.ListApiLogs(ctx, filter, page)
+		return err
+	})
+	return result, err
+}
+
+func (s *GuardStore) GetApiLog(ctx context.Context, id int64) (log *models.ApiLog, err error) {
+	err = s.guarded(ctx, OpGet, nil, func(ctx context.Context) (err error) {
+		log, err = s.LogStore.GetApiLog(ctx, id)
+		return err
+	})
+	return log, err
+}
+
+func (s *GuardStore) ApiLogStats(ctx context.Context, filter ApiLogFilter) (stats *ApiLogStats, err error) {
+	err = s.guarded(ctx, OpStats, s.apiLogCheck(filter), func(ctx context.Context) (err error) {
+		stats, err = s.LogStore.ApiLogStats(ctx, filter)
+		return err
+	})
+	return stats, err
+}
+
+func (s *GuardStore) ListModelTrainingLogs(ctx context.Context, filter ModelTrainingLogFilter, page Page) (result *PageResult[models.ModelTrainingLog], err error) {
+	err = s.guarded(ctx, OpList, s.trainingLogCheck(filter), func(ctx context.Context) (err error) {
+		result, err = s.LogStore.ListModelTrainingLogs(ctx, filter, page)
+		return err
+	})
+	return result, err
+}
+
+func (s *GuardStore) GetModelTrainingLog(ctx context.Context, id int64) (log *models.ModelTrainingLog, err error) {
+	err = s.guarded(ctx, OpGet, nil, func(ctx context.Context) (err error) {
+		log, err = s.LogStore.GetModelTrainingLog(ctx, id)
+		return err
+	})
+	return log, err
+}
+
+func (s *GuardStore) ModelTrainingLogStats(ctx context.Context, filter ModelTrainingLogFilter) (stats *ModelTrainingLogStats, err error) {
+	err = s.guarded(ctx, OpStats, s.trainingLogCheck(filter), func(ctx context.Context) (err error) {
+		stats, err = s.LogStore.ModelTrainingLogStats(ctx, filter)
+		return err
+	})
+	return stats, err
+}
+
+func (s *GuardStore) ListStatusReports(ctx context.Context, filter StatusReportFilter, page Page) (result *PageResult[models.StatusReport], err error) {
+	err = s.guarded(ctx, OpList, s.statusReportCheck(filter), func(ctx context.Context) (err error) {
+		result, err = s.LogStore.ListStatusReports(ctx, filter, page)
+		return err
+	})
+	return result, err
+}
+
+// statusReportGetCheck 未指定日期的详情查询逐个查找全部日分片，开启 max_shards 或 require_range 时必须指定日期
+func (s *GuardStore) statusReportGetCheck(day time.Time) func(QueryLimits) error {
+	return func(l QueryLimits) error {
+		if !day.IsZero() || (l.MaxShards <= 0 && !l.RequireRange) {
+			return nil
+		}
+		limit, max := "max_shards", fmt.Sprintf("%d shards", l.MaxShards)
+		if l.RequireRange {
+			limit, max = "require_range", "created_at required"
+		}
+		return &LimitError{Limit: limit, Value: "all shards", Max: max,
+			Reason: "no created_at given so every daily shard would be searched for the id, specify created_at"}
+	}
+}
+
+func (s *GuardStore) GetStatusReport(ctx context.Context, id uint64, day time.Time) (report *models.StatusReport, err error) {
+	err = s.guarded(ctx, OpGet, s.statusReportGetCheck(day), func(ctx context.Context) (err error) {
+		report, err = s.LogStore.GetStatusReport(ctx, id, day)
+		return err
+	})
+	return report, err
+}
+
+func (s *GuardStore) StatusReportStats(ctx context.Context, filter StatusReportFilter) (stats *CallLogStats, err error) {
+	err = s.guarded(ctx, OpStats, s.statusReportCheck(filter), func(ctx context.Context) (err error) {
+		stats, err = s.LogStore.StatusReportStats(ctx, filter)
+		return err
+	})
+	return stats, err
+}
+
+func (s *GuardStore) SearchApiLogs(ctx context.Context, q SearchQuery) (result *SearchResult[models.ApiLog], err error) {
+	check := func(l QueryLimits) error { return l.CheckRange(q.StartTime, q.EndTime, false, false) }
+	err = s.guarded(ctx, OpSearch, check, func(ctx context.Context) (err error) {
+		result, err = s.LogStore.SearchApiLogs(ctx, q)
+		return err
+	})
+	return result, err
+}
+
+func (s *GuardStore) SearchStatusReports(ctx context.Context, q SearchQuery) (result *SearchResult[models.StatusReport], err error) {
+	check := func(l QueryLimits) error { return l.CheckRange(q.StartTime, q.EndTime, true, false) }
+	err = s.guarded(ctx, OpSearch, check, func(ctx context.Context) (err error) {
+		result, err = s.LogStore.SearchStatusReports(ctx, q)
+		return err
+	})
+	return result, err
+}
+
+// 取值分布由服务层按天拆分查询，时间跨度在服务层按 OpFacets 的上限校验，这里只限制单天查询的范围与超时
+
+func (s *GuardStore) ApiLogFacets(ctx context.Context, filter ApiLogFilter, fields []string) (facets map[string]*Facet, err error) {
+	err = s.guarded(ctx, OpFacets, s.apiLogCheck(filter), func(ctx context.Context) (err error) {
+		facets, err = s.LogStore.ApiLogFacets(ctx, filter, fields)
+		return err
+	})
+	return facets, err
+}
+
+func (s *GuardStore) ModelTrainingLogFacets(ctx context.Context, filter ModelTrainingLogFilter, fields []string) (facets map[string]*Facet, err error) {
+	err = s.guarded(ctx, OpFacets, s.trainingLogCheck(filter), func(ctx context.Context) (err error) {
+		facets, err = s.LogStore.ModelTrainingLogFacets(ctx, filter, fields)
+		return err
+	})
+	return facets, err
+}
+
+func (s *GuardStore) StatusReportFacets(ctx context.Context, filter StatusReportFilter, fields []string) (facets map[string]*Facet, err error) {
+	err = s.guarded(ctx, OpFacets, s.statusReportCheck(filter), func(ctx context.Context) (err error) {
+		facets, err = s.LogStore.StatusReportFacets(ctx, filter, fields)
+		return err
+	})
+	return facets, err
+}
+
+func (s *GuardStore) ApiLogHistogram(ctx context.Context, filter ApiLogFilter, q HistogramQuery) (h *Histogram, err error) {
+	err = s.guarded(ctx, OpHistogram, s.apiLogCheck(filter), func(ctx context.Context) (err error) {
+		h, err = s.LogStore.ApiLogHistogram(ctx, filter, q)
+		return err
+	})
+	return h, err
+}
+
+func (s *GuardStore) ModelTrainingLogHistogram(ctx context.Context, filter ModelTrainingLogFilter, q HistogramQuery) (h *Histogram, err error) {
+	err = s.guarded(ctx, OpHistogram, s.trainingLogCheck(filter), func(ctx context.Context) (err error) {
+		h, err = s.LogStore.ModelTrainingLogHistogram(ctx, filter, q)
+		return err
+	})
+	return h, err
+}
+
+func (s *GuardStore) StatusReportHistogram(ctx context.Context, filter StatusReportFilter, q HistogramQuery) (h *Histogram, err error) {
+	err = s.guarded(ctx, OpHistogram, s.statusReportCheck(filter), func(ctx context.Context) (err error) {
+		h, err = s.LogStore.StatusReportHistogram(ctx, filter, q)
+		return err
+	})
+	return h, err
+}
+
+// leadingWildcard 表达式中是否有以 % 或 _ 开头的 LIKE 模式（取反的匹配同样需要扫描）
+func (e *Expr) leadingWildcard() bool {
+	if e == nil {
+		return false
+	}
+	return hasLeadingWildcard(e.root)
+}
+
+func hasLeadingWildcard(n exprNode) bool {
+	switch n := n.(type) {
+	case *logicalNode:
+		return hasLeadingWildcard(n.left) || hasLeadingWildcard(n.right)
+	case *notNode:
+		return hasLeadingWildcard(n.x)
+	case *likeNode:
+		pattern, _ := n.lit.value.(string)
+		return strings.HasPrefix(pattern, "%") || strings.HasPrefix(pattern, "_")
+	}
+	return false
+}
@@ -0,0 +1,630 @@
+package storage
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/stardustagi/TopLib/libs/databases"
+	"github.com/stardustagi/TopLib/libs/logs"
+	"github.com/stardustagi/TopModelsLogs/backend/metrics"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"go.uber.org/zap"
+	"xorm.io/builder"
+	"xorm.io/xorm"
+)
+
+// 哈希链：API 日志（可选模型调用日志的每个日分片）按入链顺序串成哈希链，每行保存链上序号 chain_seq、
+// 前一行的哈希 chain_prev 与 chain_hash = SHA-256(chain_prev + "\n" + 规范化的行内容)。
+// 后台任务在行写入后的下一个周期按 id 顺序入链，等待并发写入的事务提交；多实例时以 chain_head 的比较更新保证只有一个实例入链成功。
+// 行从提交到入链之间不受保护，此时被修改无法发现：入链任务正常时该窗口不超过两个入链间隔，入链间隔不得超过 1 分钟，
+// 入链失败时窗口随之延长，计入 hash_chain_errors 指标，校验报告中的 pending 为尚未入链的行数。
+// 链头定期以 Ed25519 私钥签名保存为检查点，检查点记录签名密钥标识，轮换后以密钥文件中保留的旧公钥校验之前的检查点。
+// 校验时重新计算每行哈希，比对序号、前后链接与检查点，发现被修改、插入或删除的行。
+// 规范化内容不含加密数据密钥列，轮换主密钥不影响哈希；按保留天数清理的行在校验全链时不报告，指定起始序号时报告为删除
+const (
+	ChainIssueModified   = "modified"     // 行内容或链接与哈希不符
+	ChainIssueInserted   = "inserted"     // 重复的序号
+	ChainIssueDeleted    = "deleted"      // 缺失的序号
+	ChainIssueOutOfOrder = "out_of_order" // 入链顺序与 id 顺序不符，如补插的旧 id
+	ChainIssueCheckpoint = "checkpoint"   // 检查点签名无效或与链不符
+
+	chainVerifyBatch = 1000
+	maxChainIssues   = 100
+	maxChainInterval = time.Minute
+)
+
+// HashChainConfig 哈希链配置
+type HashChainConfig struct {
+	Enabled            bool   `json:"enabled"`
+	StatusReports      bool   `json:"status_reports"`      // 模型调用日志的每个日分片各自成链
+	SigningKey         string `json:"signing_key"`         // Ed25519 签名密钥文件，不存在时生成，默认 data/chain_signing_key.json
+	Interval           string `json:"interval"`            // 入链间隔，默认 5s，不超过 1m
+	CheckpointInterval string `json:"checkpoint_interval"` // 签名检查点间隔，默认 10m
+	Batch              int    `json:"batch"`               // 每批入链的行数，默认 1000
+}
+
+var (
+	// ErrChainConflict 其他实例同时入链，本批放弃
+	ErrChainConflict = errors.New("hash chain head changed concurrently")
+	// ErrUnknownChain 不参与哈希链的日志类型或日分片
+	ErrUnknownChain = errors.New("unknown hash chain")
+)
+
+// chainKeyFile 签名密钥文件格式，私钥为 base64 编码的 32 字节种子；
+// 轮换时换上新的 key_id 与 private_key，并将原 key_id 与 base64 公钥移入 retired_keys，用于校验之前的检查点
+type chainKeyFile struct {
+	KeyId       string            `json:"key_id"`
+	PrivateKey  string            `json:"private_key"`
+	RetiredKeys map[string]string `json:"retired_keys,omitempty"`
+}
+
+// chainSigner 检查点签名密钥与校验用的全部公钥
+type chainSigner struct {
+	keyId      string
+	key        ed25519.PrivateKey
+	publicKeys map[string]ed25519.PublicKey
+}
+
+// openChainSigner 加载签名密钥，文件不存在时生成
+func openChainSigner(path string) (*chainSigner, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err = createChainKey(path); err != nil {
+			return nil, err
+		}
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file chainKeyFile
+	if err = json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("invalid chain signing key %s: %w", path, err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(file.PrivateKey)
+	if err != nil || len(seed) != ed25519.SeedSize || file.KeyId == "" {
+		return nil, fmt.Errorf("invalid chain signing key %s", path)
+	}
+	s := &chainSigner{keyId: file.KeyId, key: ed25519.NewKeyFromSeed(seed), publicKeys: make(map[string]ed25519.PublicKey)}
+	for keyId, encoded := range file.RetiredKeys {
+		public, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(public) != ed25519.PublicKeySize || keyId == file.KeyId {
+			return nil, fmt.Errorf("invalid retired chain key %q in %s", keyId, path)
+		}
+		s.publicKeys[keyId] = public
+	}
+	s.publicKeys[file.KeyId] = s.key.Public().(ed25519.PublicKey)
+	return s, nil
+}
+
+func createChainKey(path string) error {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(chainKeyFile{
+		KeyId:      time.Now().Format("20060102") + "-" + hex.EncodeToString(suffix),
+		PrivateKey: base64.StdEncoding.EncodeToString(seed),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0o600)
+}
+
+// PublicKey base64 编码的当前公钥，用于在服务外校验检查点
+func (s *chainSigner) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(s.publicKeys[s.keyId])
+}
+
+// PublicKeys 按密钥标识的全部公钥，含已轮换的旧公钥，base64
+func (s *chainSigner) PublicKeys() map[string]string {
+	keys := make(map[string]string, len(s.publicKeys))
+	for keyId, public := range s.publicKeys {
+		keys[keyId] = base64.StdEncoding.EncodeToString(public)
+	}
+	return keys
+}
+
+func (s *chainSigner) sign(cp *models.ChainCheckpoint) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, checkpointMessage(cp)))
+}
+
+// verify 以检查点记录的密钥标识对应的公钥校验签名，未知的密钥标识视为无效
+func (s *chainSigner) verify(cp *models.ChainCheckpoint) bool {
+	public, ok := s.publicKeys[cp.KeyId]
+	if !ok {
+		return false
+	}
+	sig, err := base64.StdEncoding.DecodeString(cp.Signature)
+	return err == nil && ed25519.Verify(public, checkpointMessage(cp), sig)
+}
+
+// checkpointMessage 检查点的签名内容
+func checkpointMessage(cp *models.ChainCheckpoint) []byte {
+	return fmt.Appendf(nil, "%s\n%d\n%d\n%s\n%d", cp.Chain, cp.Seq, cp.RowId, cp.Hash, cp.CreatedAt)
+}
+
+// chainHash SHA-256(prev + "\n" + canonical) 的十六进制
+func chainHash(prev string, canonical []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write([]byte{'\n'})
+	h.Write(canonical)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// apiLogCanonical API 日志的规范化内容：按固定顺序的列值 JSON 数组，不含加密数据密钥与哈希链列
+func apiLogCanonical(l *models.ApiLog) []byte {
+	raw, _ := json.Marshal([]interface{}{
+		l.Id, l.UserId, l.ApiPath, l.Method, l.RequestBody, l.ResponseBody,
+		l.StatusCode, l.Duration, l.ClientIP, l.UserAgent, l.CreatedAt,
+	})
+	return raw
+}
+
+// statusReportCanonical 模型调用日志的规范化内容，created_at 取秒级时间戳
+func statusReportCanonical(r *models.StatusReport) []byte {
+	raw, _ := json.Marshal([]interface{}{
+		r.Id, r.TraceId, r.NodeAddr, r.NodeId, r.Model, r.ModelId, r.ActualModel, r.Provider,
+		r.ActualProvider, r.ActualProviderId, r.UserId, r.CallerKey, r.Stream, r.ReportType,
+		r.TokensPerSec, r.Latency, r.Step, r.StatusCode, r.StatusMessage, r.CreatedAt.Unix(),
+	})
+	return raw
+}
+
+// chainRow 入链与校验时读取的行
+type chainRow struct {
+	id        int64
+	seq       int64
+	prev      string
+	hash      string
+	canonical []byte
+}
+
+// findChainRows 按条件读取表中的行并计算规范化内容
+func findChainRows(session *xorm.Session, table string, cond builder.Cond, limit int, orderBy ...string) ([]chainRow, error) {
+	session = session.Table(table).Where(cond).Asc(orderBy...).Limit(limit)
+	if table == (models.ApiLog{}).TableName() {
+		var logs []models.ApiLog
+		if err := session.Find(&logs); err != nil {
+			return nil, err
+		}
+		rows := make([]chainRow, len(logs))
+		for i := range logs {
+			l := &logs[i]
+			rows[i] = chainRow{id: l.Id, seq: l.ChainSeq, prev: l.ChainPrev, hash: l.ChainHash, canonical: apiLogCanonical(l)}
+		}
+		return rows, nil
+	}
+	var reports []models.StatusReport
+	if err := session.Find(&reports); err != nil {
+		return nil, err
+	}
+	rows := make([]chainRow, len(reports))
+	for i := range reports {
+		r := &reports[i]
+		rows[i] = chainRow{id: int64(r.Id), seq: r.ChainSeq, prev: r.ChainPrev, hash: r.ChainHash, canonical: statusReportCanonical(r)}
+	}
+	return rows, nil
+}
+
+// HashChain 哈希链的入链、签名检查点与校验，读写都走主库
+type HashChain struct {
+	engine             databases.DBInterface
+	shards             *ShardManager
+	signer             *chainSigner
+	statusReports      bool
+	batch              int
+	interval           time.Duration
+	checkpointInterval time.Duration
+	// settled 上一周期各表的最大 id，本周期只入链不超过它的行
+	settled map[string]int64
+	logger  *zap.Logger
+}
+
+// NewHashChain 创建哈希链并同步链头与检查点表
+func NewHashChain(engine databases.DBInterface, shards *ShardManager, c HashChainConfig) (*HashChain, error) {
+	interval, err := time.ParseDuration(c.Interval)
+	if err != nil || interval <= 0 || interval > maxChainInterval {
+		return nil, fmt.Errorf("invalid hash chain interval %q, must be within (0, %s]", c.Interval, maxChainInterval)
+	}
+	checkpointInterval, err := time.ParseDuration(c.CheckpointInterval)
+	if err != nil || checkpointInterval <= 0 {
+		return nil, fmt.Errorf("invalid hash chain checkpoint_interval %q", c.CheckpointInterval)
+	}
+	signer, err := openChainSigner(c.SigningKey)
+	if err != nil {
+		return nil, err
+	}
+	if err = engine.Sync2(new(models.ChainHead), new(models.ChainCheckpoint)); err != nil {
+		return nil, err
+	}
+	return &HashChain{
+		engine:             engine,
+		shards:             shards,
+		signer:             signer,
+		statusReports:      c.StatusReports,
+		batch:              c.Batch,
+		interval:           interval,
+		checkpointInterval: checkpointInterval,
+		settled:            make(map[string]int64),
+		logger:             logs.GetLogger("HashChain"),
+	}, nil
+}
+
+// PublicKey 检查点签名公钥，base64
+func (h *HashChain) PublicKey() string {
+	return h.signer.PublicKey()
+}
+
+// PublicKeys 按密钥标识的全部检查点公钥，含已轮换的旧公钥，base64
+func (h *HashChain) PublicKeys() map[string]string {
+	return h.signer.PublicKeys()
+}
+
+// ChainTable 日志类型对应的链：api 为 API 日志表，call 为 day（YYYYMMDD）的模型调用日志日分片，分片不存在时返回 ErrUnknownChain
+func (h *HashChain) ChainTable(logType, day string) (string, error) {
+	switch logType {
+	case "api":
+		return models.ApiLog{}.TableName(), nil
+	case "call":
+		if !h.statusReports {
+			return "", ErrUnknownChain
+		}
+		t, err := time.ParseInLocation(shardDayLayout, day, time.Local)
+		if err != nil {
+			return "", fmt.Errorf("%w: invalid day %q", ErrUnknownChain, day)
+		}
+		shards, err := h.shards.syncedShards()
+		if err != nil {
+			return "", err
+		}
+		table := new(models.StatusReport).GetSliceDateDayTableByTime(t)
+		if _, ok := shards[table]; !ok {
+			return "", fmt.Errorf("%w: no shard for day %s", ErrUnknownChain, day)
+		}
+		return table, nil
+	}
+	return "", ErrUnknownChain
+}
+
+// tables 参与哈希链的表
+func (h *HashChain) tables() ([]string, error) {
+	tables := []string{models.ApiLog{}.TableName()}
+	if !h.statusReports {
+		return tables, nil
+	}
+	shards, err := h.shards.syncedShards()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(shards))
+	for name := range shards {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return append(tables, names...), nil
+}
+
+// Run 定期入链并签名检查点，ctx 结束时退出
+func (h *HashChain) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	checkpointAt := time.Now().Add(h.checkpointInterval)
+	for {
+		h.chainAll(ctx)
+		if time.Now().After(checkpointAt) {
+			h.checkpointAll(ctx)
+			checkpointAt = time.Now().Add(h.checkpointInterval)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *HashChain) chainAll(ctx context.Context) {
+	tables, err := h.tables()
+	if err != nil {
+		metrics.Counter("hash_chain_errors").Add(1)
+		h.logger.Warn("列出哈希链表失败", zap.Error(err))
+		return
+	}
+	for _, table := range tables {
+		var last models.ApiLog
+		if _, err = h.engine.Context(ctx).Table(table).Cols("id").Desc("id").Limit(1).Get(&last); err != nil {
+			metrics.Counter("hash_chain_errors").Add(1)
+			h.logger.Warn("读取最大ID失败", zap.String("table", table), zap.Error(err))
+			continue
+		}
+		limit := h.settled[table]
+		h.settled[table] = last.Id
+		for limit > 0 && ctx.Err() == nil {
+			n, err := h.chainTable(ctx, table, limit)
+			if errors.Is(err, ErrChainConflict) {
+				break
+			}
+			if err != nil {
+				metrics.Counter("hash_chain_errors").Add(1)
+				h.logger.Warn("入链失败", zap.String("table", table), zap.Error(err))
+				break
+			}
+			if n < h.batch {
+				break
+			}
+		}
+	}
+}
+
+// chainTable 将 id 不超过 limit 的未入链行按 id 顺序接到链尾，返回入链的行数
+func (h *HashChain) chainTable(ctx context.Context, table string, limit int64) (int, error) {
+	session := h.engine.NewSession()
+	defer session.Close()
+	if err := session.Begin(); err != nil {
+		return 0, err
+	}
+	head := &models.ChainHead{}
+	exists, err := session.Context(ctx).Where("chain = ?", table).Get(head)
+	if err != nil {
+		_ = session.Rollback()
+		return 0, err
+	}
+	rows, err := findChainRows(session.Context(ctx), table,
+		builder.Eq{"chain_seq": 0}.And(builder.Lte{"id": limit}), h.batch, "id")
+	if err != nil || len(rows) == 0 {
+		_ = session.Rollback()
+		return 0, err
+	}
+	seq, prev, lastId := head.Seq, head.Hash, head.RowId
+	for _, row := range rows {
+		if row.id < lastId {
+			metrics.Counter("hash_chain_out_of_order").Add(1)
+			h.logger.Warn("入链的行早于链尾", zap.String("table", table), zap.Int64("id", row.id), zap.Int64("tailId", lastId))
+		}
+		seq++
+		hash := chainHash(prev, row.canonical)
+		n, err := session.Context(ctx).Table(table).Where("id = ? AND chain_seq = 0", row.id).
+			Update(map[string]interface{}{"chain_seq": seq, "chain_prev": prev, "chain_hash": hash})
+		if err == nil && n != 1 {
+			err = ErrChainConflict
+		}
+		if err != nil {
+			_ = session.Rollback()
+			return 0, err
+		}
+		prev, lastId = hash, row.id
+	}
+	next := map[string]interface{}{"seq": seq, "row_id": lastId, "hash": prev, "updated_at": time.Now().Unix()}
+	if exists {
+		n, err := session.Context(ctx).Table(models.ChainHead{}.TableName()).
+			Where("chain = ? AND seq = ?", table, head.Seq).Update(next)
+		if err == nil && n != 1 {
+			err = ErrChainConflict
+		}
+		if err != nil {
+			_ = session.Rollback()
+			return 0, err
+		}
+	} else if _, err = session.Context(ctx).InsertOne(&models.ChainHead{
+		Chain: table, Seq: seq, RowId: lastId, Hash: prev, UpdatedAt: time.Now().Unix(),
+	}); err != nil {
+		_ = session.Rollback()
+		return 0, ErrChainConflict
+	}
+	if err = session.Commit(); err != nil {
+		return 0, err
+	}
+	metrics.Counter("hash_chain_rows").Add(int64(len(rows)))
+	return len(rows), nil
+}
+
+// checkpointAll 为自上次检查点后有新行的链签名检查点
+func (h *HashChain) checkpointAll(ctx context.Context) {
+	var heads []models.ChainHead
+	if err := h.engine.Context(ctx).Find(&heads); err != nil {
+		h.logger.Warn("读取链头失败", zap.Error(err))
+		return
+	}
+	for i := range heads {
+		head := &heads[i]
+		last := &models.ChainCheckpoint{}
+		if _, err := h.engine.Context(ctx).Where("chain = ?", head.Chain).Desc("seq").Get(last); err != nil {
+			h.logger.Warn("读取检查点失败", zap.String("chain", head.Chain), zap.Error(err))
+			continue
+		}
+		if last.Seq >= head.Seq {
+			continue
+		}
+		cp := &models.ChainCheckpoint{
+			Chain:     head.Chain,
+			Seq:       head.Seq,
+			RowId:     head.RowId,
+			Hash:      head.Hash,
+			KeyId:     h.signer.keyId,
+			CreatedAt: time.Now().Unix(),
+		}
+		cp.Signature = h.signer.sign(cp)
+		// 多实例同时签名时唯一索引冲突，忽略
+		if _, err := h.engine.Context(ctx).InsertOne(cp); err != nil {
+			h.logger.Debug("保存检查点失败", zap.String("chain", head.Chain), zap.Error(err))
+			continue
+		}
+		metrics.Counter("hash_chain_checkpoints").Add(1)
+	}
+}
+
+// ChainIssue 校验发现的问题
+type ChainIssue struct {
+	Kind   string `json:"kind"`
+	Seq    int64  `json:"seq"`
+	RowId  int64  `json:"row_id"`
+	Detail string `json:"detail"`
+}
+
+// ChainReport 哈希链校验结果
+type ChainReport struct {
+	Chain       string       `json:"chain"`
+	FromSeq     int64        `json:"from_seq"`
+	ToSeq       int64        `json:"to_seq"`
+	HeadSeq     int64        `json:"head_seq"`
+	Rows        int64        `json:"rows"`        // 校验的行数
+	Pending     int64        `json:"pending"`     // 尚未入链的行数
+	Checkpoints int          `json:"checkpoints"` // 校验的检查点数
+	Valid       bool         `json:"valid"`
+	Issues      []ChainIssue `json:"issues"`
+	Truncated   bool         `json:"truncated"` // 问题超过 100 条，只列出前 100 条
+}
+
+func (r *ChainReport) add(kind string, seq, rowId int64, detail string) {
+	if len(r.Issues) >= maxChainIssues {
+		r.Truncated = true
+		return
+	}
+	r.Issues = append(r.Issues, ChainIssue{Kind: kind, Seq: seq, RowId: rowId, Detail: detail})
+}
+
+// Verify 校验链上序号 [fromSeq, toSeq] 的行与检查点，fromSeq 为 0 时从现存的第一行开始，toSeq 为 0 时到链头
+func (h *HashChain) Verify(ctx context.Context, table string, fromSeq, toSeq int64) (*ChainReport, error) {
+	report := &ChainReport{Chain: table, Issues: make([]ChainIssue, 0)}
+	head := &models.ChainHead{}
+	if _, err := h.engine.Context(ctx).Where("chain = ?", table).Get(head); err != nil {
+		return nil, err
+	}
+	report.HeadSeq = head.Seq
+	pending, err := h.engine.Context(ctx).Table(table).Where("chain_seq = 0").Count()
+	if err != nil {
+		return nil, err
+	}
+	report.Pending = pending
+	if toSeq <= 0 || toSeq > head.Seq {
+		toSeq = head.Seq
+	}
+	if fromSeq <= 0 {
+		// 保留天数清理后链的开头不再存在，从现存的第一行开始
+		var first models.ApiLog
+		ok, err := h.engine.Context(ctx).Table(table).Cols("chain_seq").Where("chain_seq > 0").Asc("chain_seq").Limit(1).Get(&first)
+		if err != nil {
+			return nil, err
+		}
+		fromSeq = head.Seq + 1
+		if ok {
+			fromSeq = first.ChainSeq
+		}
+	}
+	report.FromSeq, report.ToSeq = fromSeq, toSeq
+	if fromSeq > toSeq {
+		report.Valid = true
+		return report, nil
+	}
+
+	// 起点之前一行的哈希，起点为链首时为空
+	prevHash, anchored := "", fromSeq == 1
+	if fromSeq > 1 {
+		before, err := findChainRows(h.engine.Context(ctx), table, builder.Eq{"chain_seq": fromSeq - 1}, 1, "id")
+		if err != nil {
+			return nil, err
+		}
+		if len(before) > 0 {
+			prevHash, anchored = before[0].hash, true
+		}
+	}
+	lastSeq, lastId := fromSeq-1, int64(0)
+	var cond builder.Cond = builder.Gte{"chain_seq": fromSeq}
+	for {
+		rows, err := findChainRows(h.engine.Context(ctx), table,
+			builder.And(cond, builder.Lte{"chain_seq": toSeq}), chainVerifyBatch, "chain_seq", "id")
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			switch {
+			case row.seq == lastSeq:
+				report.add(ChainIssueInserted, row.seq, row.id, "重复的序号")
+				continue
+			case row.seq > lastSeq+1:
+				report.add(ChainIssueDeleted, lastSeq+1, 0, fmt.Sprintf("序号 %d-%d 的行不存在", lastSeq+1, row.seq-1))
+				anchored = false
+			}
+			if anchored && row.prev != prevHash {
+				report.add(ChainIssueModified, row.seq, row.id, "chain_prev 与前一行的哈希不符")
+			}
+			if chainHash(row.prev, row.canonical) != row.hash {
+				report.add(ChainIssueModified, row.seq, row.id, "行内容与 chain_hash 不符")
+			}
+			if row.id < lastId {
+				report.add(ChainIssueOutOfOrder, row.seq, row.id, fmt.Sprintf("id 小于前一行的 %d", lastId))
+			}
+			prevHash, anchored, lastSeq, lastId = row.hash, true, row.seq, row.id
+			report.Rows++
+		}
+		if len(rows) < chainVerifyBatch {
+			break
+		}
+		last := rows[len(rows)-1]
+		cond = builder.Or(builder.Gt{"chain_seq": last.seq}, builder.Eq{"chain_seq": last.seq}.And(builder.Gt{"id": last.id}))
+	}
+	if lastSeq < toSeq {
+		report.add(ChainIssueDeleted, lastSeq+1, 0, fmt.Sprintf("序号 %d-%d 的行不存在", lastSeq+1, toSeq))
+	}
+	if err = h.verifyCheckpoints(ctx, table, fromSeq, head.Seq, toSeq, report); err != nil {
+		return nil, err
+	}
+	report.Valid = len(report.Issues) == 0
+	return report, nil
+}
+
+// verifyCheckpoints 校验范围内检查点的签名与对应行的哈希，超出链头的检查点说明链尾被删除或链头被回退
+func (h *HashChain) verifyCheckpoints(ctx context.Context, table string, fromSeq, headSeq, toSeq int64, report *ChainReport) error {
+	var checkpoints []models.ChainCheckpoint
+	err := h.engine.Context(ctx).Where("chain = ? AND seq >= ?", table, fromSeq).Asc("seq").Find(&checkpoints)
+	if err != nil {
+		return err
+	}
+	for i := range checkpoints {
+		cp := &checkpoints[i]
+		if cp.Seq > toSeq && cp.Seq <= headSeq {
+			continue
+		}
+		report.Checkpoints++
+		if !h.signer.verify(cp) {
+			report.add(ChainIssueCheckpoint, cp.Seq, cp.RowId, "检查点签名无效")
+			continue
+		}
+		if cp.Seq > headSeq {
+			report.add(ChainIssueCheckpoint, cp.Seq, cp.RowId, fmt.Sprintf("检查点超出链头 %d，链尾的行被删除或链头被回退", headSeq))
+			continue
+		}
+		rows, err := findChainRows(h.engine.Context(ctx), table, builder.Eq{"chain_seq": cp.Seq}, 2, "id")
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			report.add(ChainIssueCheckpoint, cp.Seq, cp.RowId, "检查点对应的行不存在")
+			continue
+		}
+		if rows[0].id != cp.RowId || rows[0].hash != cp.Hash {
+			report.add(ChainIssueCheckpoint, cp.Seq, rows[0].id, "行的哈希与检查点不符，链被重写")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stardustagi/TopModelsLogs/models"
+	"xorm.io/xorm"
+	"xorm.io/xorm/names"
+)
+
+// openChain SQLite 上的 API 日志哈希链，签名密钥在 keyPath
+func openChain(t *testing.T, e *xorm.Engine, keyPath string) *HashChain {
+	t.Helper()
+	d, err := NewDialect(DialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewShardManager(e, d, ShardModeTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHashChain(e, m, HashChainConfig{Enabled: true, SigningKey: keyPath, Interval: "5s", CheckpointInterval: "10m", Batch: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// chainApiLog 写入一行 API 日志，入链并签名检查点
+func chainApiLog(t *testing.T, e *xorm.Engine, h *HashChain, path string) {
+	t.Helper()
+	ctx := context.Background()
+	log := &models.ApiLog{UserId: 1, ApiPath: path, CreatedAt: 1000}
+	if _, err := e.InsertOne(log); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.chainTable(ctx, log.TableName(), log.Id); err != nil {
+		t.Fatal(err)
+	}
+	h.checkpointAll(ctx)
+}
+
+func TestHashChainVerifiesCheckpointsAfterKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	e, err := xorm.NewEngine("sqlite", "file:"+filepath.Join(dir, "logs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetMapper(names.GonicMapper{})
+	e.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = e.Close() })
+	if err = e.Sync2(new(models.ApiLog)); err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "chain_signing_key.json")
+	table := models.ApiLog{}.TableName()
+
+	h := openChain(t, e, keyPath)
+	oldKeyId, oldPublic := h.signer.keyId, h.PublicKey()
+	chainApiLog(t, e, h, "/v1/a")
+
+	// 轮换：新密钥签名，旧公钥移入 retired_keys
+	if err = os.Remove(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	if err = createChainKey(keyPath); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file chainKeyFile
+	if err = json.Unmarshal(raw, &file); err != nil {
+		t.Fatal(err)
+	}
+	file.KeyId += "-new"
+	file.RetiredKeys = map[string]string{oldKeyId: oldPublic}
+	if raw, err = json.Marshal(file); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyPath, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	h = openChain(t, e, keyPath)
+	if h.signer.keyId == oldKeyId || h.PublicKeys()[oldKeyId] != oldPublic {
+		t.Fatalf("rotated signer: key %s, public keys %v", h.signer.keyId, h.PublicKeys())
+	}
+	chainApiLog(t, e, h, "/v1/b")
+
+	report, err := h.Verify(context.Background(), table, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Valid || report.Checkpoints != 2 || report.Rows != 2 {
+		t.Fatalf("report after rotation: %+v", report)
+	}
+
+	// 未保留的密钥签名的检查点视为无效
+	if _, err = e.Table(models.ChainCheckpoint{}.TableName()).Where("seq = 1").
+		Update(map[string]interface{}{"key_id": "unknown"}); err != nil {
+		t.Fatal(err)
+	}
+	report, err = h.Verify(context.Background(), table, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Valid || len(report.Issues) != 1 || report.Issues[0].Kind != ChainIssueCheckpoint {
+		t.Fatalf("report with unknown key id: %+v", report)
+	}
+}
+
+func TestHashChainRejectsLongInterval(t *testing.T) {
+	dir := t.TempDir()
+	e, err := xorm.NewEngine("sqlite", "file:"+filepath.Join(dir, "logs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = e.Close() })
+	c := HashChainConfig{Enabled: true, SigningKey: filepath.Join(dir, "key.json"), Interval: "2m", CheckpointInterval: "10m", Batch: 100}
+	if _, err = NewHashChain(e, nil, c); err == nil {
+		t.Fatal("interval above the tamper window bound accepted")
+	}
+}
@@ -0,0 +1,287 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/stardustagi/TopModelsLogs/models"
+	"xorm.io/builder"
+)
+
+// 时间直方图：按固定间隔统计日志条数，可按一个维度列拆分。分桶按本地时区的字面时间对齐，
+// 整天的间隔从本地零点开始；时间范围内没有日志的桶也会返回，计数为 0
+const (
+	// MaxHistogramBuckets 单次查询最多的分桶数
+	MaxHistogramBuckets = 1000
+	// MaxHistogramSeries 拆分维度最多保留的取值数，其余取值合并到 HistogramOther
+	MaxHistogramSeries = 20
+	// HistogramOther 拆分维度中合并后的其余取值
+	HistogramOther = "__other__"
+
+	histogramTargetBuckets = 60 // 自动选择间隔时期望的分桶数
+)
+
+// ErrInvalidHistogram 直方图参数不合法，具体原因见 ValidationError
+var ErrInvalidHistogram = errors.New("invalid histogram")
+
+// histogramIntervals 自动选择时可用的间隔
+var histogramIntervals = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 5 * time.Minute, 10 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+	24 * time.Hour, 7 * 24 * time.Hour,
+}
+
+// HistogramQuery 直方图参数，时间范围取自过滤条件且必须指定
+type HistogramQuery struct {
+	Interval time.Duration // 分桶间隔，整秒，0 时按时间范围自动选择
+	SplitBy  string        // 拆分维度，只允许取值分布白名单内的列，空为不拆分
+}
+
+// HistogramBucket 单个时间桶
+type HistogramBucket struct {
+	Start  int64            `json:"start"` // 桶起始时间，秒级时间戳
+	Count  int64            `json:"count"`
+	Series map[string]int64 `json:"series,omitempty"` // 拆分维度各取值的条数
+}
+
+// Histogram 时间直方图
+type Histogram struct {
+	Interval int64             `json:"interval"` // 分桶间隔，秒
+	SplitBy  string            `json:"split_by,omitempty"`
+	Buckets  []HistogramBucket `json:"buckets"`
+}
+
+// histogramPlan 校验后的分桶方案，桶以字面时间秒数标识
+type histogramPlan struct {
+	interval int64
+	splitBy  string
+	first    int64
+	last     int64
+	counts   map[int64]map[string]int64
+}
+
+// newHistogramPlan 校验参数并确定分桶间隔
+func newHistogramPlan(model interface{}, start, end time.Time, q HistogramQuery) (*histogramPlan, error) {
+	var errs []FieldError
+	if start.IsZero() || end.IsZero() {
+		errs = append(errs, FieldError{Field: "start_time", Reason: "time range is required"})
+	} else if start.After(end) {
+		errs = append(errs, FieldError{Field: "start_time", Value: start.Format(time.DateTime), Reason: "after end_time"})
+	}
+	if q.SplitBy != "" {
+		allowed := facetable[reflect.Indirect(reflect.ValueOf(model)).Type()]
+		if !slices.Contains(allowed, q.SplitBy) {
+			errs = append(errs, FieldError{Field: "split_by", Value: q.SplitBy, Reason: "not splittable, allowed: " + strings.Join(allowed, ", ")})
+		}
+	}
+	if q.Interval < 0 || q.Interval%time.Second != 0 {
+		errs = append(errs, FieldError{Field: "interval", Value: q.Interval.String(), Reason: "must be a positive whole number of seconds"})
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Err: ErrInvalidHistogram, Errors: errs}
+	}
+
+	plan := &histogramPlan{splitBy: q.SplitBy, counts: make(map[int64]map[string]int64)}
+	if q.Interval == 0 {
+		span := end.Sub(start)
+		q.Interval = histogramIntervals[len(histogramIntervals)-1]
+		for _, interval := range histogramIntervals {
+			if span/interval < histogramTargetBuckets {
+				q.Interval = interval
+				break
+			}
+		}
+	}
+	plan.interval = int64(q.Interval / time.Second)
+	plan.first = plan.bucketOf(wallSeconds(start))
+	plan.last = plan.bucketOf(wallSeconds(end))
+	if n := (plan.last-plan.first)/plan.interval + 1; n > MaxHistogramBuckets {
+		return nil, &ValidationError{Err: ErrInvalidHistogram, Errors: []FieldError{{
+			Field:  "interval",
+			Value:  q.Interval.String(),
+			Reason: fmt.Sprintf("%d buckets exceed the limit of %d, use a larger interval", n, MaxHistogramBuckets),
+		}}}
+	}
+	return plan, nil
+}
+
+// wallSeconds 本地时区字面时间距 1970-01-01 00:00:00 的秒数
+func wallSeconds(t time.Time) int64 {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC).Unix()
+}
+
+// fromWallSeconds wallSeconds 的逆运算，返回秒级时间戳
+func fromWallSeconds(wall int64) int64 {
+	t := time.Unix(wall, 0).UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local).Unix()
+}
+
+// unixOffset 秒级时间戳列换算为字面时间需要加上的秒数，按范围结束时刻的时区偏移计算
+func unixOffset(end time.Time) int64 {
+	return wallSeconds(end) - end.Unix()
+}
+
+func (p *histogramPlan) bucketOf(wall int64) int64 {
+	return wall - wall%p.interval
+}
+
+func (p *histogramPlan) add(bucket int64, value string, n int64) {
+	if bucket < p.first || bucket > p.last {
+		return
+	}
+	series := p.counts[bucket]
+	if series == nil {
+		series = make(map[string]int64)
+		p.counts[bucket] = series
+	}
+	series[value] += n
+}
+
+// result 补齐空桶，拆分维度只保留总数最多的 MaxHistogramSeries 个取值
+func (p *histogramPlan) result() *Histogram {
+	keep := make(map[string]bool)
+	if p.splitBy != "" {
+		totals := make(map[string]int64)
+		for _, series := range p.counts {
+			for value, n := range series {
+				totals[value] += n
+			}
+		}
+		ranked := make([]FacetCount, 0, len(totals))
+		for value, n := range totals {
+			ranked = append(ranked, FacetCount{Value: value, Count: n})
+		}
+		sortFacet(ranked)
+		for i := 0; i < len(ranked) && i < MaxHistogramSeries; i++ {
+			keep[ranked[i].Value] = true
+		}
+	}
+
+	h := &Histogram{Interval: p.interval, SplitBy: p.splitBy, Buckets: make([]HistogramBucket, 0, (p.last-p.first)/p.interval+1)}
+	for wall := p.first; wall <= p.last; wall += p.interval {
+		bucket := HistogramBucket{Start: fromWallSeconds(wall)}
+		if p.splitBy != "" {
+			bucket.Series = make(map[string]int64)
+		}
+		for value, n := range p.counts[wall] {
+			bucket.Count += n
+			if p.splitBy == "" {
+				continue
+			}
+			if !keep[value] {
+				value = HistogramOther
+			}
+			bucket.Series[value] += n
+		}
+		h.Buckets = append(h.Buckets, bucket)
+	}
+	return h
+}
+
+// histogramRows 内存实现使用，wall 返回记录的字面时间秒数
+func histogramRows[T any](plan *histogramPlan, rows []T, wall func(*T) int64) (*Histogram, error) {
+	for i := range rows {
+		value := ""
+		if plan.splitBy != "" {
+			v, err := columnValue(&rows[i], plan.splitBy)
+			if err != nil {
+				return nil, err
+			}
+			value = fmt.Sprint(v)
+		}
+		plan.add(plan.bucketOf(wall(&rows[i])), value, 1)
+	}
+	return plan.result(), nil
+}
+
+func (s *sqlStore) ApiLogHistogram(ctx context.Context, filter ApiLogFilter, q HistogramQuery) (h *Histogram, err error) {
+	start, end := unixTime(filter.StartTime), unixTime(filter.EndTime)
+	plan, err := newHistogramPlan(models.ApiLog{}, start, end, q)
+	if err != nil {
+		return nil, err
+	}
+	wall := fmt.Sprintf("(created_at + (%d))", unixOffset(end))
+	err = s.read(ctx, func(ctx context.Context) (err error) {
+		h, err = s.histogram(ctx, plan, []string{models.ApiLog{}.TableName()}, wall, s.apiLogCond(filter))
+		return err
+	})
+	return h, err
+}
+
+func (s *sqlStore) ModelTrainingLogHistogram(ctx context.Context, filter ModelTrainingLogFilter, q HistogramQuery) (h *Histogram, err error) {
+	start, end := unixTime(filter.StartTime), unixTime(filter.EndTime)
+	plan, err := newHistogramPlan(models.ModelTrainingLog{}, start, end, q)
+	if err != nil {
+		return nil, err
+	}
+	wall := fmt.Sprintf("(created_at + (%d))", unixOffset(end))
+	err = s.read(ctx, func(ctx context.Context) (err error) {
+		h, err = s.histogram(ctx, plan, []string{models.ModelTrainingLog{}.TableName()}, wall, s.trainingLogCond(filter))
+		return err
+	})
+	return h, err
+}
+
+func (s *sqlStore) StatusReportHistogram(ctx context.Context, filter StatusReportFilter, q HistogramQuery) (h *Histogram, err error) {
+	plan, err := newHistogramPlan(models.StatusReport{}, filter.StartTime, filter.EndTime, q)
+	if err != nil {
+		return nil, err
+	}
+	err = s.read(ctx, func(ctx context.Context) error {
+		tables, err := s.statusReportTables(ctx, filter.StartTime, filter.EndTime)
+		if err != nil {
+			return err
+		}
+		// 日期时间按数据库时区存储（SQLite 为 UTC），换算为本地字面时间
+		dbTZ := s.engine.GetTZDatabase()
+		if dbTZ == nil {
+			dbTZ = time.Local
+		}
+		_, dbOffset := filter.EndTime.In(dbTZ).Zone()
+		wall := fmt.Sprintf("(%s + (%d))", s.dialect.WallSeconds("created_at"), unixOffset(filter.EndTime)-int64(dbOffset))
+		h, err = s.histogram(ctx, plan, tables, wall, s.statusReportCond(filter))
+		return err
+	})
+	return h, err
+}
+
+// histogram wall 为记录字面时间秒数的 SQL 表达式，分桶在数据库中完成
+func (s *sqlStore) histogram(ctx context.Context, plan *histogramPlan, tables []string, wall string, cond builder.Cond) (*Histogram, error) {
+	if len(tables) == 0 {
+		return plan.result(), nil
+	}
+	columns := fmt.Sprintf("%s - %s %% %d AS bucket", wall, wall, plan.interval)
+	group := "bucket"
+	if plan.splitBy != "" {
+		columns += ", " + plan.splitBy + " AS value"
+		group += ", value"
+	}
+	from, args, err := s.source(tables, columns, cond)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT %s, COUNT(*) AS cnt FROM (%s) t GROUP BY %s", group, from, group)
+	rows, err := s.reader(ctx).Context(ctx).QueryString(append([]interface{}{query}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		plan.add(parseInt(row["bucket"]), row["value"], parseInt(row["cnt"]))
+	}
+	return plan.result(), nil
+}
+
+// unixTime 秒级时间戳转时间，0 为零值
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/stardustagi/TopModelsLogs/models"
+)
+
+// 字段脱敏：ctx 中记录调用方需要隐藏的列（如 request_body、response_body、caller_key），
+// 返回结果中这些列的字符串值替换为 MaskedValue、其它类型置零；
+// 这些列也不能用于过滤、排序、取值分布、时间分布拆分与全文检索，避免通过查询条件推断原值
+const MaskedValue = "***"
+
+// ErrMaskedField 查询条件使用了对调用方隐藏的列，具体列见 ValidationError
+var ErrMaskedField = errors.New("masked field")
+
+type maskKey struct{}
+
+// WithMasks 在 ctx 中记录需要隐藏的列，fields 为空时不脱敏
+func WithMasks(ctx context.Context, fields []string) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, maskKey{}, fields)
+}
+
+// Masks ctx 中需要隐藏的列
+func Masks(ctx context.Context) []string {
+	fields, _ := ctx.Value(maskKey{}).([]string)
+	return fields
+}
+
+// MaskStore 按 ctx 中的脱敏列校验查询条件并处理返回结果，没有脱敏列时直接调用下层存储
+type MaskStore struct {
+	LogStore
+}
+
+var _ LogStore = (*MaskStore)(nil)
+
+// NewMaskStore 创建字段脱敏存储
+func NewMaskStore(store LogStore) *MaskStore {
+	return &MaskStore{LogStore: store}
+}
+
+// maskCheck 收集使用了脱敏列的参数，加密列复用同一检查（见 encryptedCheck）
+type maskCheck struct {
+	masks []string
+	errs  []FieldError
+
+	reason string // 默认为脱敏的原因
+	cause  error  // 默认为 ErrMaskedField
+}
+
+func (c *maskCheck) use(param, column string) {
+	if slices.Contains(c.masks, column) {
+		reason := c.reason
+		if reason == "" {
+			reason = "field is masked for the caller"
+		}
+		c.errs = append(c.errs, FieldError{Field: param, Value: column, Reason: reason})
+	}
+}
+
+func (c *maskCheck) expr(e *Expr) {
+	if e != nil {
+		exprColumns(e.root, func(column string) { c.use("filter", column) })
+	}
+}
+
+func (c *maskCheck) sort(page Page) {
+	for i, field := range page.Sort {
+		c.use(fmt.Sprintf("sort[%d].field", i), field.Field)
+	}
+}
+
+func (c *maskCheck) fields(param string, fields ...string) {
+	for _, field := range fields {
+		c.use(param, field)
+	}
+}
+
+func (c *maskCheck) err() error {
+	if len(c.errs) == 0 {
+		return nil
+	}
+	if c.cause != nil {
+		return &ValidationError{Err: c.cause, Errors: c.errs}
+	}
+	return &ValidationError{Err: ErrMaskedField, Errors: c.errs}
+}
+
+// exprColumns 表达式引用的列
+func exprColumns(n exprNode, emit func(column string)) {
+	switch n := n.(type) {
+	case *logicalNode:
+		exprColumns(n.left, emit)
+		exprColumns(n.right, emit)
+	case *notNode:
+		exprColumns(n.x, emit)
+	case *compareNode:
+		emit(n.field)
+	case *inNode:
+		emit(n.field)
+	case *likeNode:
+		emit(n.field)
+	}
+}
+
+// 过滤条件中的用户ID为租户隔离条件，不做校验
+func (c *maskCheck) apiLogFilter(filter ApiLogFilter) *maskCheck {
+	if filter.ApiPath != "" {
+		c.use("api_path", "api_path")
+	}
+	c.expr(filter.Expr)
+	return c
+}
+
+func (c *maskCheck) trainingLogFilter(filter ModelTrainingLogFilter) *maskCheck {
+	if filter.ModelId > 0 {
+		c.use("model_id", "model_id")
+	}
+	if filter.Status != "" {
+		c.use("status", "status")
+	}
+	if filter.LogLevel != "" {
+		c.use("log_level", "log_level")
+	}
+	c.expr(filter.Expr)
+	return c
+}
+
+func (c *maskCheck) statusReportFilter(filter StatusReportFilter) *maskCheck {
+	params := [][2]string{
+		{"trace_id", filter.TraceId},
+		{"model", filter.Model},
+		{"caller_key", filter.CallerKey},
+		{"step", filter.Step},
+		{"actual_provider_id", filter.ActualProviderId},
+	}
+	for _, param := range params {
+		if param[1] != "" {
+			c.use(param[0], param[0])
+		}
+	}
+	c.expr(filter.Expr)
+	return c
+}
+
+// maskRow 隐藏 row（模型指针）中的脱敏列
+func maskRow(row interface{}, masks []string) {
+	v := reflect.ValueOf(row).Elem()
+	fields := modelFields(v.Type())
+	for _, column := range masks {
+		info, ok := fields[column]
+		if !ok || column == "id" {
+			continue
+		}
+		field := v.Field(info.index)
+		if field.Kind() == reflect.String {
+			field.SetString(MaskedValue)
+		} else {
+			field.Set(reflect.Zero(field.Type()))
+		}
+	}
+}
+
+func maskPage[T any](result *PageResult[T], masks []string) {
+	if result == nil {
+		return
+	}
+	for i := range result.Rows {
+		maskRow(&result.Rows[i], masks)
+	}
+}
+
+// maskHits 隐藏检索结果的脱敏列与对应的摘要
+func maskHits[T any](result *SearchResult[T], masks []string) {
+	if result == nil {
+		return
+	}
+	for i := range result.Hits {
+		maskRow(&result.Hits[i].Row, masks)
+		for _, column := range masks {
+			delete(result.Hits[i].Snippets, column)
+		}
+	}
+}
+
+func (s *MaskStore) ListApiLogs(ctx context.Context, filter ApiLogFilter, page Page) (*PageResult[models.ApiLog], error) {
+	masks := Masks(ctx)
+	if len(masks) == 0 {
+		return s.LogStore.ListApiLogs(ctx, filter, page)
+	}
+	check := &maskCheck{masks: masks}
+	check.apiLogFilter(filter).sort(page)
+	if err := check.err(); err != nil {
+		return nil, err
+	}
+	result, err := s.LogStore.ListApiLogs(ctx, filter, page)
+	maskPage(result, masks)
+	return result, err
+}
+
+func (s *MaskStore) GetApiLog(ctx context.Context, id int64) (*models.ApiLog, error) {
+	log, err := s.LogStore.GetApiLog(ctx, id)
+	if masks := Masks(ctx); len(masks) > 0 && log != nil {
+		maskRow(log, masks)
+	}
+	return log, err
+}
+
+func (s *MaskStore) ApiLogStats(ctx context.Context, filter ApiLogFilter) (*ApiLogStats, error) {
+	if err := (&maskCheck{masks: Masks(ctx)}).apiLogFilter(filter).err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.ApiLogStats(ctx, filter)
+}
+
+func (s *MaskStore) ListModelTrainingLogs(ctx context.Context, filter ModelTrainingLogFilter, page Page) (*PageResult[models.ModelTrainingLog], error) {
+	masks := Masks(ctx)
+	if len(masks) == 0 {
+		return s.LogStore.ListModelTrainingLogs(ctx, filter, page)
+	}
+	check := &maskCheck{masks: masks}
+	check.trainingLogFilter(filter).sort(page)
+	if err := check.err(); err != nil {
+		return nil, err
+	}
+	result, err := s.LogStore.ListModelTrainingLogs(ctx, filter, page)
+	maskPage(result, masks)
+	return result, err
+}
+
+func (s *MaskStore) GetModelTrainingLog(ctx context.Context, id int64) (*models.ModelTrainingLog, error) {
+	log, err := s.LogStore.GetModelTrainingLog(ctx, id)
+	if masks := Masks(ctx); len(masks) > 0 && log != nil {
+		maskRow(log, masks)
+	}
+	return log, err
+}
+
+func (s *MaskStore) ModelTrainingLogStats(ctx context.Context, filter ModelTrainingLogFilter) (*ModelTrainingLogStats, error) {
+	if err := (&maskCheck{masks: Masks(ctx)}).trainingLogFilter(filter).err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.ModelTrainingLogStats(ctx, filter)
+}
+
+func (s *MaskStore) ListStatusReports(ctx context.Context, filter StatusReportFilter, page Page) (*PageResult[models.StatusReport], error) {
+	masks := Masks(ctx)
+	if len(masks) == 0 {
+		return s.LogStore.ListStatusReports(ctx, filter, page)
+	}
+	check := &maskCheck{masks: masks}
+	check.statusReportFilter(filter).sort(page)
+	if err := check.err(); err != nil {
+		return nil, err
+	}
+	result, err := s.LogStore.ListStatusReports(ctx, filter, page)
+	maskPage(result, masks)
+	return result, err
+}
+
+func (s *MaskStore) GetStatusReport(ctx context.Context, id uint64, day time.Time) (*models.StatusReport, error) {
+	report, err := s.LogStore.GetStatusReport(ctx, id, day)
+	if masks := Masks(ctx); len(masks) > 0 && report != nil {
+		maskRow(report, masks)
+	}
+	return report, err
+}
+
+func (s *MaskStore) StatusReportStats(ctx context.Context, filter StatusReportFilter) (*CallLogStats, error) {
+	if err := (&maskCheck{masks: Masks(ctx)}).statusReportFilter(filter).err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.StatusReportStats(ctx, filter)
+}
+
+func (s *MaskStore) SearchApiLogs(ctx context.Context, q SearchQuery) (*SearchResult[models.ApiLog], error) {
+	masks := Masks(ctx)
+	check := &maskCheck{masks: masks}
+	check.fields("query", "request_body", "response_body")
+	if err := check.err(); err != nil {
+		return nil, err
+	}
+	result, err := s.LogStore.SearchApiLogs(ctx, q)
+	maskHits(result, masks)
+	return result, err
+}
+
+func (s *MaskStore) SearchStatusReports(ctx context.Context, q SearchQuery) (*SearchResult[models.StatusReport], error) {
+	masks := Masks(ctx)
+	check := &maskCheck{masks: masks}
+	check.fields("query", "status_message")
+	if err := check.err(); err != nil {
+		return nil, err
+	}
+	result, err := s.LogStore.SearchStatusReports(ctx, q)
+	maskHits(result, masks)
+	return result, err
+}
+
+func (s *MaskStore) ApiLogFacets(ctx context.Context, filter ApiLogFilter, fields []string) (map[string]*Facet, error) {
+	check := (&maskCheck{masks: Masks(ctx)}).apiLogFilter(filter)
+	check.fields("fields", fields...)
+	if err := check.err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.ApiLogFacets(ctx, filter, fields)
+}
+
+func (s *MaskStore) ModelTrainingLogFacets(ctx context.Context, filter ModelTrainingLogFilter, fields []string) (map[string]*Facet, error) {
+	check := (&maskCheck{masks: Masks(ctx)}).trainingLogFilter(filter)
+	check.fields("fields", fields...)
+	if err := check.err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.ModelTrainingLogFacets(ctx, filter, fields)
+}
+
+func (s *MaskStore) StatusReportFacets(ctx context.Context, filter StatusReportFilter, fields []string) (map[string]*Facet, error) {
+	check := (&maskCheck{masks: Masks(ctx)}).statusReportFilter(filter)
+	check.fields("fields", fields...)
+	if err := check.err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.StatusReportFacets(ctx, filter, fields)
+}
+
+func (s *MaskStore) ApiLogHistogram(ctx context.Context, filter ApiLogFilter, q HistogramQuery) (*Histogram, error) {
+	check := (&maskCheck{masks: Masks(ctx)}).apiLogFilter(filter)
+	check.fields("split_by", q.SplitBy)
+	if err := check.err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.ApiLogHistogram(ctx, filter, q)
+}
+
+func (s *MaskStore) ModelTrainingLogHistogram(ctx context.Context, filter ModelTrainingLogFilter, q HistogramQuery) (*Histogram, error) {
+	check := (&maskCheck{masks: Masks(ctx)}).trainingLogFilter(filter)
+	check.fields("split_by", q.SplitBy)
+	if err := check.err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.ModelTrainingLogHistogram(ctx, filter, q)
+}
+
+func (s *MaskStore) StatusReportHistogram(ctx context.Context, filter StatusReportFilter, q HistogramQuery) (*Histogram, error) {
+	check := (&maskCheck{masks: Masks(ctx)}).statusReportFilter(filter)
+	check.fields("split_by", q.SplitBy)
+	if err := check.err(); err != nil {
+		return nil, err
+	}
+	return s.LogStore.StatusReportHistogram(ctx, filter, q)
+}
+
+// ValidateMaskFields 校验脱敏列，必须是任一日志表除 id 以外的列
+func ValidateMaskFields(fields []string) error {
+	types := []reflect.Type{
+		reflect.TypeOf(models.ApiLog{}),
+		reflect.TypeOf(models.ModelTrainingLog{}),
+		reflect.TypeOf(models.StatusReport{}),
+	}
+	for _, field := range fields {
+		known := false
+		for _, t := range types {
+			if _, ok := modelFields(t)[field]; ok && field != "id" {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("invalid mask field %q", field)
+		}
+	}
+	return nil
+}
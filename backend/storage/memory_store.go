@@ -0,0 +1,549 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stardustagi/TopModelsLogs/models"
+)
+
+// memoryStore 进程内日志存储，过滤与分页语义与 sqlStore 一致，用于测试和无数据库运行
+type memoryStore struct {
+	mu           sync.RWMutex
+	apiLogs      []models.ApiLog
+	trainingLogs []models.ModelTrainingLog
+	reports      []models.StatusReport
+
+	apiLogSeq      int64
+	trainingLogSeq int64
+	reportSeq      uint64
+}
+
+var _ LogStore = (*memoryStore)(nil)
+
+// NewMemoryStore 创建内存日志存储
+func NewMemoryStore() LogStore {
+	return &memoryStore{}
+}
+
+func (s *memoryStore) InsertApiLog(_ context.Context, log *models.ApiLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiLogSeq++
+	log.Id = s.apiLogSeq
+	s.apiLogs = append(s.apiLogs, *log)
+	return nil
+}
+
+func (s *memoryStore) ListApiLogs(_ context.Context, filter ApiLogFilter, page Page) (*PageResult[models.ApiLog], error) {
+	s.mu.RLock()
+	rows := filterRows(s.apiLogs, func(log *models.ApiLog) bool { return matchApiLog(filter, log) })
+	s.mu.RUnlock()
+	return paginate(rows, page, "id")
+}
+
+func (s *memoryStore) GetApiLog(_ context.Context, id int64) (*models.ApiLog, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, log := range s.apiLogs {
+		if log.Id == id {
+			return &log, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) ApiLogStats(_ context.Context, filter ApiLogFilter) (*ApiLogStats, error) {
+	s.mu.RLock()
+	rows := filterRows(s.apiLogs, func(log *models.ApiLog) bool { return matchApiLog(filter, log) })
+	s.mu.RUnlock()
+
+	stats := &ApiLogStats{Total: int64(len(rows))}
+	durations := make([]float64, 0, len(rows))
+	for _, log := range rows {
+		if log.StatusCode >= 400 {
+			stats.Failed++
+		}
+		durations = append(durations, float64(log.Duration))
+	}
+	stats.AvgDuration = average(durations)
+	values := nearestRanks(durations)
+	stats.P50Duration, stats.P95Duration, stats.P99Duration = values[0], values[1], values[2]
+	return stats, nil
+}
+
+func (s *memoryStore) InsertModelTrainingLog(_ context.Context, log *models.ModelTrainingLog) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trainingLogSeq++
+	log.Id = s.trainingLogSeq
+	s.trainingLogs = append(s.trainingLogs, *log)
+	return nil
+}
+
+func (s *memoryStore) ListModelTrainingLogs(_ context.Context, filter ModelTrainingLogFilter, page Page) (*PageResult[models.ModelTrainingLog], error) {
+	s.mu.RLock()
+	rows := filterRows(s.trainingLogs, func(log *models.ModelTrainingLog) bool { return matchTrainingLog(filter, log) })
+	s.mu.RUnlock()
+	return paginate(rows, page, "id")
+}
+
+func (s *memoryStore) GetModelTrainingLog(_ context.Context, id int64) (*models.ModelTrainingLog, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, log := range s.trainingLogs {
+		if log.Id == id {
+			return &log, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) ModelTrainingLogStats(_ context.Context, filter ModelTrainingLogFilter) (*ModelTrainingLogStats, error) {
+	s.mu.RLock()
+	rows := filterRows(s.trainingLogs, func(log *models.ModelTrainingLog) bool { return matchTrainingLog(filter, log) })
+	s.mu.RUnlock()
+
+	stats := &ModelTrainingLogStats{Total: int64(len(rows))}
+	losses := make([]float64, 0, len(rows))
+	for i, log := range rows {
+		if log.LogLevel == "error" {
+			stats.Errors++
+		}
+		losses = append(losses, log.Loss)
+		if i == 0 || log.Loss < stats.MinLoss {
+			stats.MinLoss = log.Loss
+		}
+		stats.MaxAccuracy = math.Max(stats.MaxAccuracy, log.Accuracy)
+		stats.MaxEpoch = max(stats.MaxEpoch, int64(log.Epoch))
+	}
+	stats.AvgLoss = average(losses)
+	return stats, nil
+}
+
+func (s *memoryStore) InsertStatusReport(_ context.Context, report *models.StatusReport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reportSeq++
+	report.Id = s.reportSeq
+	s.reports = append(s.reports, *report)
+	return nil
+}
+
+func (s *memoryStore) ListStatusReports(_ context.Context, filter StatusReportFilter, page Page) (*PageResult[models.StatusReport], error) {
+	s.mu.RLock()
+	rows := filterRows(s.reports, func(report *models.StatusReport) bool { return matchStatusReport(filter, report) })
+	s.mu.RUnlock()
+	return paginate(rows, page, shardKey, "id")
+}
+
+func (s *memoryStore) GetStatusReport(_ context.Context, id uint64, day time.Time) (*models.StatusReport, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, report := range s.reports {
+		if report.Id != id {
+			continue
+		}
+		if !day.IsZero() && !truncateDay(report.CreatedAt).Equal(truncateDay(day)) {
+			continue
+		}
+		return &report, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) StatusReportStats(_ context.Context, filter StatusReportFilter) (*CallLogStats, error) {
+	s.mu.RLock()
+	rows := filterRows(s.reports, func(report *models.StatusReport) bool { return matchStatusReport(filter, report) })
+	s.mu.RUnlock()
+
+	stats := &CallLogStats{Total: int64(len(rows))}
+	latencies := make([]float64, 0, len(rows))
+	tokens := make([]float64, 0, len(rows))
+	for _, report := range rows {
+		if report.StatusCode != "" {
+			stats.Failed++
+		}
+		latencies = append(latencies, parseFloat(report.Latency))
+		tokens = append(tokens, float64(report.TokensPerSec))
+	}
+	stats.AvgLatency = average(latencies)
+	stats.AvgTokensPerSec = average(tokens)
+	values := nearestRanks(latencies)
+	stats.P50Latency, stats.P95Latency, stats.P99Latency = values[0], values[1], values[2]
+	return stats, nil
+}
+
+func (s *memoryStore) ApiLogFacets(_ context.Context, filter ApiLogFilter, fields []string) (map[string]*Facet, error) {
+	if err := ValidateFacetFields(models.ApiLog{}, fields); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	rows := filterRows(s.apiLogs, func(log *models.ApiLog) bool { return matchApiLog(filter, log) })
+	s.mu.RUnlock()
+	return countFacets(rows, fields)
+}
+
+func (s *memoryStore) ModelTrainingLogFacets(_ context.Context, filter ModelTrainingLogFilter, fields []string) (map[string]*Facet, error) {
+	if err := ValidateFacetFields(models.ModelTrainingLog{}, fields); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	rows := filterRows(s.trainingLogs, func(log *models.ModelTrainingLog) bool { return matchTrainingLog(filter, log) })
+	s.mu.RUnlock()
+	return countFacets(rows, fields)
+}
+
+func (s *memoryStore) StatusReportFacets(_ context.Context, filter StatusReportFilter, fields []string) (map[string]*Facet, error) {
+	if err := ValidateFacetFields(models.StatusReport{}, fields); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	rows := filterRows(s.reports, func(report *models.StatusReport) bool { return matchStatusReport(filter, report) })
+	s.mu.RUnlock()
+	return countFacets(rows, fields)
+}
+
+func (s *memoryStore) ApiLogHistogram(_ context.Context, filter ApiLogFilter, q HistogramQuery) (*Histogram, error) {
+	end := unixTime(filter.EndTime)
+	plan, err := newHistogramPlan(models.ApiLog{}, unixTime(filter.StartTime), end, q)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	rows := filterRows(s.apiLogs, func(log *models.ApiLog) bool { return matchApiLog(filter, log) })
+	s.mu.RUnlock()
+	offset := unixOffset(end)
+	return histogramRows(plan, rows, func(log *models.ApiLog) int64 { return log.CreatedAt + offset })
+}
+
+func (s *memoryStore) ModelTrainingLogHistogram(_ context.Context, filter ModelTrainingLogFilter, q HistogramQuery) (*Histogram, error) {
+	end := unixTime(filter.EndTime)
+	plan, err := newHistogramPlan(models.ModelTrainingLog{}, unixTime(filter.StartTime), end, q)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	rows := filterRows(s.trainingLogs, func(log *models.ModelTrainingLog) bool { return matchTrainingLog(filter, log) })
+	s.mu.RUnlock()
+	offset := unixOffset(end)
+	return histogramRows(plan, rows, func(log *models.ModelTrainingLog) int64 { return log.CreatedAt + offset })
+}
+
+func (s *memoryStore) StatusReportHistogram(_ context.Context, filter StatusReportFilter, q HistogramQuery) (*Histogram, error) {
+	plan, err := newHistogramPlan(models.StatusReport{}, filter.StartTime, filter.EndTime, q)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	rows := filterRows(s.reports, func(report *models.StatusReport) bool { return matchStatusReport(filter, report) })
+	s.mu.RUnlock()
+	return histogramRows(plan, rows, func(report *models.StatusReport) int64 { return wallSeconds(report.CreatedAt) })
+}
+
+func (s *memoryStore) PurgeBefore(_ context.Context, before time.Time) (*PurgeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := &PurgeResult{DroppedShards: make([]string, 0)}
+	expired := func(createdAt int64) bool { return createdAt < before.Unix() }
+
+	apiLogs := filterRows(s.apiLogs, func(log *models.ApiLog) bool { return !expired(log.CreatedAt) })
+	result.ApiLogs = int64(len(s.apiLogs) - len(apiLogs))
+	s.apiLogs = apiLogs
+
+	trainingLogs := filterRows(s.trainingLogs, func(log *models.ModelTrainingLog) bool { return !expired(log.CreatedAt) })
+	result.TrainingLogs = int64(len(s.trainingLogs) - len(trainingLogs))
+	s.trainingLogs = trainingLogs
+
+	// 与分片删除保持一致：只清理整天早于 before 的记录
+	dropped := make(map[string]bool)
+	s.reports = filterRows(s.reports, func(report *models.StatusReport) bool {
+		if truncateDay(report.CreatedAt).AddDate(0, 0, 1).After(before) {
+			return true
+		}
+		dropped[report.GetSliceDateDayTableByTime(report.CreatedAt)] = true
+		return false
+	})
+	for name := range dropped {
+		result.DroppedShards = append(result.DroppedShards, name)
+	}
+	sort.Strings(result.DroppedShards)
+	return result, nil
+}
+
+func matchApiLog(filter ApiLogFilter, log *models.ApiLog) bool {
+	if filter.UserId > 0 && log.UserId != filter.UserId {
+		return false
+	}
+	if filter.ApiPath != "" && !strings.Contains(strings.ToLower(log.ApiPath), strings.ToLower(filter.ApiPath)) {
+		return false
+	}
+	if filter.StartTime > 0 && log.CreatedAt < filter.StartTime {
+		return false
+	}
+	if filter.EndTime > 0 && log.CreatedAt > filter.EndTime {
+		return false
+	}
+	if filter.Expr != nil && !filter.Expr.match(log) {
+		return false
+	}
+	return true
+}
+
+func matchTrainingLog(filter ModelTrainingLogFilter, log *models.ModelTrainingLog) bool {
+	if filter.UserId > 0 && log.UserId != filter.UserId {
+		return false
+	}
+	if filter.ModelId > 0 && log.ModelId != filter.ModelId {
+		return false
+	}
+	if filter.Status != "" && log.Status != filter.Status {
+		return false
+	}
+	if filter.LogLevel != "" && log.LogLevel != filter.LogLevel {
+		return false
+	}
+	if filter.StartTime > 0 && log.CreatedAt < filter.StartTime {
+		return false
+	}
+	if filter.EndTime > 0 && log.CreatedAt > filter.EndTime {
+		return false
+	}
+	if filter.Expr != nil && !filter.Expr.match(log) {
+		return false
+	}
+	return true
+}
+
+func matchStatusReport(filter StatusReportFilter, report *models.StatusReport) bool {
+	if filter.UserId > 0 && report.UserId != filter.UserId {
+		return false
+	}
+	if filter.TraceId != "" && report.TraceId != filter.TraceId {
+		return false
+	}
+	if filter.Model != "" && report.Model != filter.Model {
+		return false
+	}
+	if filter.CallerKey != "" && report.CallerKey != filter.CallerKey {
+		return false
+	}
+	if filter.Step != "" && report.Step != filter.Step {
+		return false
+	}
+	if filter.ActualProviderId != "" && report.ActualProviderId != filter.ActualProviderId {
+		return false
+	}
+	if !filter.StartTime.IsZero() && report.CreatedAt.Before(filter.StartTime) {
+		return false
+	}
+	if !filter.EndTime.IsZero() && report.CreatedAt.After(filter.EndTime) {
+		return false
+	}
+	if filter.Expr != nil && !filter.Expr.match(report) {
+		return false
+	}
+	return true
+}
+
+func (s *memoryStore) SearchApiLogs(_ context.Context, q SearchQuery) (*SearchResult[models.ApiLog], error) {
+	terms, err := parseSearch(&q)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	rows := filterRows(s.apiLogs, func(log *models.ApiLog) bool {
+		return log.CreatedAt >= q.StartTime.Unix() && log.CreatedAt <= q.EndTime.Unix() &&
+			(q.UserId == 0 || log.UserId == q.UserId)
+	})
+	s.mu.RUnlock()
+	return searchRows(rows, terms, q,
+		func(log *models.ApiLog) int64 { return log.CreatedAt },
+		func(log *models.ApiLog) map[string]string {
+			return map[string]string{"request_body": log.RequestBody, "response_body": log.ResponseBody}
+		}), nil
+}
+
+func (s *memoryStore) SearchStatusReports(_ context.Context, q SearchQuery) (*SearchResult[models.StatusReport], error) {
+	terms, err := parseSearch(&q)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	rows := filterRows(s.reports, func(report *models.StatusReport) bool {
+		return !report.CreatedAt.Before(q.StartTime) && !report.CreatedAt.After(q.EndTime) &&
+			(q.UserId == 0 || report.UserId == q.UserId)
+	})
+	s.mu.RUnlock()
+	return searchRows(rows, terms, q,
+		func(report *models.StatusReport) int64 { return report.CreatedAt.Unix() },
+		func(report *models.StatusReport) map[string]string {
+			return map[string]string{"status_message": report.StatusMessage}
+		}), nil
+}
+
+// searchRows 逐条分词计算 BM25，排序与分页规则与 sqlStore 一致
+func searchRows[T any](rows []T, terms *searchTerms, q SearchQuery, createdAt func(*T) int64, fields func(*T) map[string]string) *SearchResult[T] {
+	type doc struct {
+		row    *T
+		tf     map[string]int
+		length int
+		score  float64
+	}
+	docs := make([]doc, 0, len(rows))
+	df := make(map[string]int64)
+	var totalLen int
+	for i := range rows {
+		texts := make([]string, 0, 2)
+		for _, text := range fields(&rows[i]) {
+			texts = append(texts, text)
+		}
+		tf, length := termFrequencies(0, texts...)
+		if length == 0 {
+			continue
+		}
+		totalLen += length
+		for _, token := range terms.tokens {
+			if tf[token] > 0 {
+				df[token]++
+			}
+		}
+		docs = append(docs, doc{row: &rows[i], tf: tf, length: length})
+	}
+	result := &SearchResult[T]{Hits: make([]SearchHit[T], 0), TotalExact: true}
+	if len(docs) == 0 {
+		return result
+	}
+	avgLen := float64(totalLen) / float64(len(docs))
+	matched := make([]doc, 0)
+	for _, d := range docs {
+		ok := true
+		for _, token := range terms.tokens {
+			if d.tf[token] == 0 {
+				ok = false
+				break
+			}
+			d.score += bm25(d.tf[token], d.length, avgLen, idf(int64(len(rows)), df[token]))
+		}
+		if !ok {
+			continue
+		}
+		texts := make([]string, 0, 2)
+		for _, text := range fields(d.row) {
+			texts = append(texts, text)
+		}
+		if containsPhrases(terms.phrases, texts...) {
+			matched = append(matched, d)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if q.OrderBy != SearchOrderTime && a.score != b.score {
+			return a.score > b.score
+		}
+		return createdAt(a.row) > createdAt(b.row)
+	})
+	result.Total = int64(len(matched))
+	for _, d := range matched[min(q.Skip, len(matched)):min(q.Skip+q.Limit, len(matched))] {
+		result.Hits = append(result.Hits, SearchHit[T]{Row: *d.row, Score: d.score, Snippets: hitSnippets(terms, fields(d.row))})
+	}
+	return result
+}
+
+// filterRows 复制满足条件的记录
+func filterRows[T any](rows []T, match func(*T) bool) []T {
+	result := make([]T, 0)
+	for i := range rows {
+		if match(&rows[i]) {
+			result = append(result, rows[i])
+		}
+	}
+	return result
+}
+
+// paginate 按 Page.Sort（补充 tiebreak 列）排序后按游标或偏移截取分页
+func paginate[T any](rows []T, page Page, tiebreak ...string) (*PageResult[T], error) {
+	model := reflect.TypeOf((*T)(nil)).Elem()
+	keys, err := orderKeys(model, page.Sort, tiebreak...)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := projectFields(model, page.Fields)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, key := range keys {
+			a, _ := keyValue(&rows[i], key.column)
+			b, _ := keyValue(&rows[j], key.column)
+			if c := compareValues(a, b); c != 0 {
+				return (c < 0) != key.desc
+			}
+		}
+		return false
+	})
+
+	start := min(max(page.Skip, 0), len(rows))
+	if page.Cursor != "" {
+		values, err := decodeCursor(page.Cursor, keys, model)
+		if err != nil {
+			return nil, err
+		}
+		start = sort.Search(len(rows), func(i int) bool { return afterCursor(&rows[i], keys, values) })
+	}
+	end := len(rows)
+	if page.Limit > 0 {
+		end = min(start+page.Limit+1, end)
+	}
+	result, err := pageResult(rows[start:end], page.Limit, keys)
+	if err != nil {
+		return nil, err
+	}
+	result.Fields = fields
+	result.Total, result.TotalExact = countRows(int64(len(rows)), page.CountMode)
+	return result, nil
+}
+
+// countRows 按 CountMode 返回内存数据的总数
+func countRows(total int64, mode string) (int64, bool) {
+	switch mode {
+	case CountNone:
+		return -1, false
+	case CountCapped:
+		if total > CountCap {
+			return CountCap, false
+		}
+	}
+	return total, true
+}
+
+func average(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// nearestRanks 按最近秩计算 percentileFractions 对应的分位值
+func nearestRanks(values []float64) []float64 {
+	result := make([]float64, len(percentileFractions))
+	if len(values) == 0 {
+		return result
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	for i, p := range percentileFractions {
+		rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+		result[i] = sorted[min(max(rank, 0), len(sorted)-1)]
+	}
+	return result
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/stardustagi/TopModelsLogs/models"
+)
+
+// ErrInvalidFields 列表返回列不合法，具体原因见 ValidationError
+var ErrInvalidFields = errors.New("invalid fields")
+
+// listOmitted 列表默认不返回的大字段，需要时通过 Page.Fields 显式选择或查看详情
+var listOmitted = map[reflect.Type][]string{
+	reflect.TypeOf(models.ApiLog{}): {"request_body", "response_body"},
+}
+
+var modelColumnsCache sync.Map
+
+// modelColumns 按字段声明顺序返回模型的列名
+func modelColumns(t reflect.Type) []string {
+	if cached, ok := modelColumnsCache.Load(t); ok {
+		return cached.([]string)
+	}
+	fields := modelFields(t)
+	columns := make([]string, 0, len(fields))
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if _, ok := fields[name]; ok {
+			columns = append(columns, name)
+		}
+	}
+	modelColumnsCache.Store(t, columns)
+	return columns
+}
+
+// projectFields 校验并确定列表返回的列，按模型字段顺序排列；fields 为空时返回除 listOmitted 外的全部列，id 总是返回
+func projectFields(model reflect.Type, fields []string) ([]string, error) {
+	columns := modelColumns(model)
+	if len(fields) == 0 {
+		omitted := listOmitted[model]
+		projected := make([]string, 0, len(columns))
+		for _, column := range columns {
+			if !slices.Contains(omitted, column) {
+				projected = append(projected, column)
+			}
+		}
+		return projected, nil
+	}
+
+	var errs []FieldError
+	selected := map[string]bool{"id": true}
+	for i, field := range fields {
+		if !slices.Contains(columns, field) {
+			errs = append(errs, FieldError{
+				Field:  fmt.Sprintf("fields[%d]", i),
+				Value:  field,
+				Reason: "unknown field, allowed: " + strings.Join(columns, ", "),
+			})
+			continue
+		}
+		selected[field] = true
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Err: ErrInvalidFields, Errors: errs}
+	}
+	projected := make([]string, 0, len(selected))
+	for _, column := range columns {
+		if selected[column] {
+			projected = append(projected, column)
+		}
+	}
+	return projected, nil
+}
+
+// selectColumns SQL 查询的列：返回列加上排序与游标需要的列
+func selectColumns(fields []string, keys []sortKey) []string {
+	columns := append([]string(nil), fields...)
+	for _, key := range keys {
+		if key.column != shardKey && !slices.Contains(columns, key.column) {
+			columns = append(columns, key.column)
+		}
+	}
+	return columns
+}
+
+// Projected 只序列化 Fields 中列的记录，未选择的列不出现在 JSON 中
+type Projected[T any] struct {
+	Row    T
+	Fields []string
+}
+
+func (p Projected[T]) MarshalJSON() ([]byte, error) {
+	v := reflect.ValueOf(p.Row)
+	fields := modelFields(v.Type())
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for _, column := range p.Fields {
+		info, ok := fields[column]
+		if !ok {
+			continue
+		}
+		value, err := json.Marshal(v.Field(info.index).Interface())
+		if err != nil {
+			return nil, err
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`"` + column + `":`)
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// ProjectRow 包装详情等单条记录用于序列化，输出模型的全部列
+func ProjectRow[T any](row T) Projected[T] {
+	return Projected[T]{Row: row, Fields: modelColumns(reflect.TypeOf(row))}
+}
+
+// Project 按 PageResult.Fields 包装列表结果用于序列化
+func Project[T any](result *PageResult[T]) []Projected[T] {
+	projected := make([]Projected[T], 0, len(result.Rows))
+	for _, row := range result.Rows {
+		projected = append(projected, Projected[T]{Row: row, Fields: result.Fields})
+	}
+	return projected
+}
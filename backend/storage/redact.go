@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/stardustagi/TopModelsLogs/backend/metrics"
+	"github.com/stardustagi/TopModelsLogs/models"
+)
+
+// 写入前脱敏：API 日志的请求体与响应体、模型调用日志的状态消息、训练日志的日志内容在写入（含本地缓冲与全文索引）前
+// 先按 drop_fields 删除 JSON 请求体中的字段，再按内置检测器与自定义正则把命中的内容替换为带类型的占位符，如 [EMAIL]。
+// 每条规则的命中次数以 redact_hits_<规则名> 指标输出
+const (
+	DetectorPrivateKey = "private_key"
+	DetectorJwt        = "jwt"
+	DetectorBearer     = "bearer"
+	DetectorApiKey     = "api_key"
+	DetectorEmail      = "email"
+	DetectorCnIdCard   = "cn_id_card"
+	DetectorCnMobile   = "cn_mobile"
+)
+
+// builtinDetectors 内置检测器，按顺序执行，较具体的格式在前，避免被宽泛的规则拆开
+var builtinDetectors = []struct {
+	name        string
+	pattern     string
+	placeholder string
+}{
+	{DetectorPrivateKey, `-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`, "[PRIVATE_KEY]"},
+	{DetectorJwt, `\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{5,}`, "[JWT]"},
+	{DetectorBearer, `(?i)\bbearer\s+[A-Za-z0-9._~+/=-]{8,}`, "[BEARER_TOKEN]"},
+	// OpenAI / Anthropic、AWS、Google、GitHub、Slack 与本服务的密钥格式
+	{DetectorApiKey, `\b(?:sk-[A-Za-z0-9_-]{20,}|AKIA[0-9A-Z]{16}|AIza[0-9A-Za-z_-]{35}|gh[pousr]_[A-Za-z0-9]{36,}|xox[baprs]-[A-Za-z0-9-]{10,}|tml_[0-9a-f]{16}_[A-Za-z0-9_-]{43})`, "[API_KEY]"},
+	{DetectorEmail, `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`, "[EMAIL]"},
+	{DetectorCnIdCard, `\b[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`, "[CN_ID_CARD]"},
+	{DetectorCnMobile, `(?:\+86[- ]?|\b)1[3-9]\d{9}\b`, "[CN_MOBILE]"},
+}
+
+// redactDropPrefix 字段删除规则的指标名前缀
+const redactDropPrefix = "drop:"
+
+// RedactConfig 写入前脱敏配置
+type RedactConfig struct {
+	Enabled    bool         `json:"enabled"`
+	Detectors  []string     `json:"detectors"`   // 启用的内置检测器，空为全部
+	Rules      []RedactRule `json:"rules"`       // 自定义正则规则，在内置检测器之后执行
+	DropFields []string     `json:"drop_fields"` // 删除的 JSON 字段路径，以 . 分隔，* 匹配一层，** 匹配任意层，如 **.password、messages.*.content
+}
+
+// RedactRule 自定义正则规则
+type RedactRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Placeholder string `json:"placeholder"` // 默认为 [<规则名大写>]
+}
+
+type redactRule struct {
+	name        string
+	re          *regexp.Regexp
+	placeholder string
+	hits        *expvar.Int
+}
+
+type dropField struct {
+	path []string
+	hits *expvar.Int
+}
+
+// Redactor 按配置的规则脱敏文本与 JSON 请求体
+type Redactor struct {
+	rules []redactRule
+	drops []dropField
+}
+
+// NewRedactor 编译脱敏规则，未知的检测器、无效的正则或字段路径返回错误
+func NewRedactor(c RedactConfig) (*Redactor, error) {
+	r := &Redactor{}
+	for _, name := range c.Detectors {
+		if !slices.ContainsFunc(builtinDetectors, func(d struct{ name, pattern, placeholder string }) bool {
+			return d.name == name
+		}) {
+			return nil, fmt.Errorf("unknown redact detector %q", name)
+		}
+	}
+	for _, d := range builtinDetectors {
+		if len(c.Detectors) == 0 || slices.Contains(c.Detectors, d.name) {
+			r.rules = append(r.rules, redactRule{name: d.name, re: regexp.MustCompile(d.pattern), placeholder: d.placeholder})
+		}
+	}
+	for _, rule := range c.Rules {
+		if rule.Name == "" || slices.ContainsFunc(r.rules, func(existing redactRule) bool { return existing.name == rule.Name }) {
+			return nil, fmt.Errorf("redact rule name %q is empty or duplicated", rule.Name)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact rule %q: %w", rule.Name, err)
+		}
+		placeholder := rule.Placeholder
+		if placeholder == "" {
+			placeholder = "[" + strings.ToUpper(rule.Name) + "]"
+		}
+		r.rules = append(r.rules, redactRule{name: rule.Name, re: re, placeholder: placeholder})
+	}
+	for i := range r.rules {
+		r.rules[i].hits = metrics.Counter("redact_hits_" + r.rules[i].name)
+	}
+	for _, field := range c.DropFields {
+		path := strings.Split(strings.TrimPrefix(field, "$."), ".")
+		if slices.Contains(path, "") || path[len(path)-1] == "*" || path[len(path)-1] == "**" {
+			return nil, fmt.Errorf("invalid redact drop field %q", field)
+		}
+		r.drops = append(r.drops, dropField{path: path, hits: metrics.Counter("redact_hits_" + redactDropPrefix + field)})
+	}
+	return r, nil
+}
+
+// Text 替换文本中命中规则的内容
+func (r *Redactor) Text(s string) string {
+	if s == "" {
+		return s
+	}
+	for _, rule := range r.rules {
+		var n int64
+		s = rule.re.ReplaceAllStringFunc(s, func(string) string {
+			n++
+			return rule.placeholder
+		})
+		if n > 0 {
+			rule.hits.Add(n)
+		}
+	}
+	return s
+}
+
+// Body 删除 JSON 请求体中的字段后再替换文本，不是 JSON 对象或数组的内容只替换文本
+func (r *Redactor) Body(s string) string {
+	if len(r.drops) > 0 {
+		s = r.dropFields(s)
+	}
+	return r.Text(s)
+}
+
+func (r *Redactor) dropFields(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return s
+	}
+	decoder := json.NewDecoder(strings.NewReader(trimmed))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil || decoder.More() {
+		return s
+	}
+	dropped := 0
+	for _, drop := range r.drops {
+		if n := dropPath(doc, drop.path); n > 0 {
+			drop.hits.Add(int64(n))
+			dropped += n
+		}
+	}
+	if dropped == 0 {
+		return s
+	}
+	// 不转义 HTML 字符，保持请求体原样
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(doc); err != nil {
+		return s
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// dropPath 删除 v 中匹配 path 的对象字段，返回删除的个数
+func dropPath(v interface{}, path []string) int {
+	seg, last := path[0], len(path) == 1
+	n := 0
+	switch node := v.(type) {
+	case map[string]interface{}:
+		switch seg {
+		case "**":
+			n += dropPath(node, path[1:])
+			for _, child := range node {
+				n += dropPath(child, path)
+			}
+		case "*":
+			for _, child := range node {
+				n += dropPath(child, path[1:])
+			}
+		default:
+			if child, ok := node[seg]; ok {
+				if last {
+					delete(node, seg)
+					n++
+				} else {
+					n += dropPath(child, path[1:])
+				}
+			}
+		}
+	case []interface{}:
+		switch seg {
+		case "**":
+			for _, child := range node {
+				n += dropPath(child, path)
+			}
+		case "*":
+			for _, child := range node {
+				n += dropPath(child, path[1:])
+			}
+		default:
+			// 路径的最后一段只能是对象的键，数组元素不单独删除
+			if i, err := strconv.Atoi(seg); err == nil && i >= 0 && i < len(node) && !last {
+				n += dropPath(node[i], path[1:])
+			}
+		}
+	}
+	return n
+}
+
+// RedactStore 写入前按规则脱敏，查询直接调用下层存储
+type RedactStore struct {
+	LogStore
+	redactor *Redactor
+}
+
+var _ LogStore = (*RedactStore)(nil)
+
+// NewRedactStore 创建写入前脱敏的存储
+func NewRedactStore(store LogStore, redactor *Redactor) *RedactStore {
+	return &RedactStore{LogStore: store, redactor: redactor}
+}
+
+func (s *RedactStore) InsertApiLog(ctx context.Context, log *models.ApiLog) error {
+	log.RequestBody = s.redactor.Body(log.RequestBody)
+	log.ResponseBody = s.redactor.Body(log.ResponseBody)
+	return s.LogStore.InsertApiLog(ctx, log)
+}
+
+func (s *RedactStore) InsertModelTrainingLog(ctx context.Context, log *models.ModelTrainingLog) error {
+	log.LogMessage = s.redactor.Text(log.LogMessage)
+	return s.LogStore.InsertModelTrainingLog(ctx, log)
+}
+
+func (s *RedactStore) InsertStatusReport(ctx context.Context, report *models.StatusReport) error {
+	report.StatusMessage = s.redactor.Text(report.StatusMessage)
+	return s.LogStore.InsertStatusReport(ctx, report)
+}
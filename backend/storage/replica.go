@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/stardustagi/TopLib/libs/databases"
+	"github.com/stardustagi/TopLib/libs/logs"
+	"github.com/stardustagi/TopModelsLogs/backend/metrics"
+	"go.uber.org/zap"
+	"xorm.io/xorm"
+	"xorm.io/xorm/names"
+)
+
+type primaryKey struct{}
+
+// WithPrimary 标记本次请求的查询必须读主库，用于写后立即读
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func forcePrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryKey{}).(bool)
+	return v
+}
+
+// replicaHeartbeat 主库定期写入心跳，从库读到的心跳时间与当前时间之差即复制延迟
+type replicaHeartbeat struct {
+	Id     int64 `xorm:"'id' pk"`
+	BeatAt int64 `xorm:"'beat_at' BIGINT(20)"` // 毫秒
+}
+
+func (replicaHeartbeat) TableName() string {
+	return "replica_heartbeat"
+}
+
+type replica struct {
+	index  int
+	engine databases.DBInterface
+	lag    atomic.Int64 // 毫秒，-1 表示不可用
+}
+
+// ReplicaSet 读写分离：只读查询轮询分配到复制延迟在阈值内的从库，都不可用时回退主库
+type ReplicaSet struct {
+	primary  databases.DBInterface
+	replicas []*replica
+	maxLag   time.Duration
+	interval time.Duration
+	next     atomic.Uint64
+	logger   *zap.Logger
+}
+
+// NewReplicaSet 创建读写分离，从库在首次心跳检测前视为不可用
+func NewReplicaSet(primary databases.DBInterface, engines []databases.DBInterface, maxLag, interval time.Duration) (*ReplicaSet, error) {
+	if err := primary.Sync2(new(replicaHeartbeat)); err != nil {
+		return nil, err
+	}
+	r := &ReplicaSet{
+		primary:  primary,
+		maxLag:   maxLag,
+		interval: interval,
+		logger:   logs.GetLogger("ReplicaSet"),
+	}
+	for i, e := range engines {
+		rep := &replica{index: i, engine: e}
+		rep.lag.Store(-1)
+		r.replicas = append(r.replicas, rep)
+	}
+	return r, nil
+}
+
+// openReplicas 按 [mysql] 的 slaves 配置打开从库连接
+func openReplicas(c *databases.Config) ([]databases.DBInterface, error) {
+	driver := c.DbType
+	if driver == "" {
+		driver = DialectMySQL
+	}
+	engines := make([]databases.DBInterface, 0, len(c.Slaves))
+	for i, dsn := range c.Slaves {
+		if dsn == "" {
+			return nil, fmt.Errorf("slave %d dsn is empty", i)
+		}
+		e, err := xorm.NewEngine(driver, dsn)
+		if err != nil {
+			return nil, err
+		}
+		e.SetMapper(names.GonicMapper{})
+		e.ShowSQL(c.ShowSql)
+		e.SetMaxIdleConns(c.MaxIdle)
+		e.SetMaxOpenConns(c.MaxConn)
+		engines = append(engines, e)
+	}
+	return engines, nil
+}
+
+// Reader 返回本次只读查询使用的连接
+func (r *ReplicaSet) Reader(ctx context.Context) databases.DBInterface {
+	if len(r.replicas) == 0 || forcePrimary(ctx) {
+		return r.primary
+	}
+	start := r.next.Add(1)
+	for i := range r.replicas {
+		rep := r.replicas[(start+uint64(i))%uint64(len(r.replicas))]
+		if lag := rep.lag.Load(); lag >= 0 && time.Duration(lag)*time.Millisecond <= r.maxLag {
+			return rep.engine
+		}
+	}
+	return r.primary
+}
+
+// Serving 本次查询是否可能由从库执行
+func (r *ReplicaSet) Serving(ctx context.Context) bool {
+	return r != nil && len(r.replicas) > 0 && !forcePrimary(ctx)
+}
+
+// all 全部从库，r 为 nil 时为空
+func (r *ReplicaSet) all() []*replica {
+	if r == nil {
+		return nil
+	}
+	return r.replicas
+}
+
+// Run 定期写入心跳并检测各从库的复制延迟，ctx 结束时退出
+func (r *ReplicaSet) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		r.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *ReplicaSet) check(ctx context.Context) {
+	now := time.Now().UnixMilli()
+	beat := &replicaHeartbeat{Id: 1, BeatAt: now}
+	affected, err := r.primary.Context(ctx).ID(beat.Id).Cols("beat_at").Update(beat)
+	if err == nil && affected == 0 {
+		_, err = r.primary.Context(ctx).InsertOne(beat)
+	}
+	if err != nil {
+		r.logger.Warn("写入复制心跳失败", zap.Error(err))
+		return
+	}
+	for _, rep := range r.replicas {
+		lag := int64(-1)
+		seen := &replicaHeartbeat{}
+		ok, err := rep.engine.Context(ctx).ID(beat.Id).Get(seen)
+		switch {
+		case err != nil:
+			r.logger.Warn("从库不可用，查询回退主库", zap.Int("replica", rep.index), zap.Error(err))
+		case ok:
+			lag = max(time.Now().UnixMilli()-seen.BeatAt, 0)
+			if time.Duration(lag)*time.Millisecond > r.maxLag && rep.lag.Load() >= 0 {
+				r.logger.Warn("从库复制延迟过大，查询回退主库", zap.Int("replica", rep.index), zap.Int64("lagMs", lag))
+			}
+		}
+		rep.lag.Store(lag)
+		metrics.Gauge(fmt.Sprintf("replica_%d_lag_ms", rep.index)).Set(lag)
+	}
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/stardustagi/TopLib/libs/databases"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"xorm.io/builder"
+)
+
+// ErrRoleNotFound 角色不存在
+var ErrRoleNotFound = errors.New("role not found")
+
+// RoleStore 角色与用户角色绑定，读写都走主库
+type RoleStore struct {
+	engine databases.DBInterface
+}
+
+// NewRoleStore 创建角色存储并同步表结构
+func NewRoleStore(engine databases.DBInterface) (*RoleStore, error) {
+	if err := engine.Sync2(new(models.Role), new(models.UserRole)); err != nil {
+		return nil, err
+	}
+	return &RoleStore{engine: engine}, nil
+}
+
+// Get 按名称查找角色
+func (s *RoleStore) Get(ctx context.Context, name string) (*models.Role, error) {
+	role := &models.Role{}
+	ok, err := s.engine.Context(ctx).Where("name = ?", name).Get(role)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrRoleNotFound
+	}
+	return role, nil
+}
+
+// Save 按名称创建或更新角色
+func (s *RoleStore) Save(ctx context.Context, role *models.Role) error {
+	existing, err := s.Get(ctx, role.Name)
+	if errors.Is(err, ErrRoleNotFound) {
+		role.UpdatedAt = role.CreatedAt
+		_, err = s.engine.Context(ctx).InsertOne(role)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	role.Id, role.CreatedAt = existing.Id, existing.CreatedAt
+	_, err = s.engine.Context(ctx).ID(role.Id).Cols("description", "scopes", "mask_fields", "updated_at").Update(role)
+	return err
+}
+
+// Delete 删除角色及其绑定
+func (s *RoleStore) Delete(ctx context.Context, name string) error {
+	role, err := s.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	session := s.engine.NewSession()
+	defer session.Close()
+	if err = session.Begin(); err != nil {
+		return err
+	}
+	if _, err = session.Context(ctx).Where("role_id = ?", role.Id).Delete(new(models.UserRole)); err != nil {
+		_ = session.Rollback()
+		return err
+	}
+	if _, err = session.Context(ctx).ID(role.Id).Delete(new(models.Role)); err != nil {
+		_ = session.Rollback()
+		return err
+	}
+	return session.Commit()
+}
+
+// List 全部角色，按名称排序
+func (s *RoleStore) List(ctx context.Context) ([]models.Role, error) {
+	roles := make([]models.Role, 0)
+	if err := s.engine.Context(ctx).Asc("name").Find(&roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// Bind 为用户绑定角色，已绑定时不变
+func (s *RoleStore) Bind(ctx context.Context, binding *models.UserRole) error {
+	ok, err := s.engine.Context(ctx).Where("user_id = ? AND role_id = ?", binding.UserId, binding.RoleId).Exist(new(models.UserRole))
+	if err != nil || ok {
+		return err
+	}
+	_, err = s.engine.Context(ctx).InsertOne(binding)
+	return err
+}
+
+// Unbind 解除用户的角色，返回是否存在
+func (s *RoleStore) Unbind(ctx context.Context, userId, roleId int64) (bool, error) {
+	n, err := s.engine.Context(ctx).Where("user_id = ? AND role_id = ?", userId, roleId).Delete(new(models.UserRole))
+	return n > 0, err
+}
+
+// UserRoles 用户绑定的角色
+func (s *RoleStore) UserRoles(ctx context.Context, userId int64) ([]models.Role, error) {
+	var bindings []models.UserRole
+	if err := s.engine.Context(ctx).Where("user_id = ?", userId).Find(&bindings); err != nil {
+		return nil, err
+	}
+	roles := make([]models.Role, 0, len(bindings))
+	if len(bindings) == 0 {
+		return roles, nil
+	}
+	ids := make([]int64, len(bindings))
+	for i, binding := range bindings {
+		ids[i] = binding.RoleId
+	}
+	if err := s.engine.Context(ctx).Where(builder.In("id", ids)).Asc("name").Find(&roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// Bindings 用户角色绑定，userId 非零时只列出该用户的绑定
+func (s *RoleStore) Bindings(ctx context.Context, userId int64) ([]models.UserRole, error) {
+	session := s.engine.Context(ctx).Asc("user_id", "role_id")
+	if userId != 0 {
+		session = session.Where("user_id = ?", userId)
+	}
+	bindings := make([]models.UserRole, 0)
+	if err := session.Find(&bindings); err != nil {
+		return nil, err
+	}
+	return bindings, nil
+}
@@ -0,0 +1,342 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 全文检索：写入时对 ApiLog 的请求/响应体与模型调用日志的 StatusMessage 分词建立倒排索引，
+// 查询时按 BM25 计算相关度。英文与数字按单词切分，中日韩文字按相邻两字切分；
+// 查询中带双引号的部分作为短语，要求原文连续出现
+const (
+	// SearchOrderRelevance 按相关度排序，默认
+	SearchOrderRelevance = "relevance"
+	// SearchOrderTime 按时间倒序
+	SearchOrderTime = "time"
+
+	// SearchDefaultDays 未指定时间范围时检索最近的天数
+	SearchDefaultDays = 7
+
+	maxSearchTokens   = 16
+	maxTokenBytes     = 64
+	maxDocTokens      = 2048 // 单条日志最多索引的不同词数
+	maxSearchScan     = 2000 // 含短语的查询最多校验的候选数
+	snippetRadius     = 40   // 摘要中命中词前后保留的字符数
+	maxSnippets       = 3
+	bm25K1, bm25B     = 1.2, 0.75
+	searchBatchFactor = 4
+)
+
+var (
+	// ErrInvalidSearch 检索词为空或无法分词，具体原因见 ValidationError
+	ErrInvalidSearch = errors.New("invalid search")
+	// ErrSearchDisabled 未开启全文检索
+	ErrSearchDisabled = errors.New("full-text search is disabled")
+)
+
+// SearchConfig 全文检索配置，开启后写入日志时同步维护倒排索引表 search_posting
+type SearchConfig struct {
+	Enabled  bool `json:"enabled"`
+	MaxDocKB int  `json:"max_doc_kb"` // 单个字段参与索引的最大长度，超出部分不可检索
+}
+
+// SearchQuery 检索条件，零值时间按最近 SearchDefaultDays 天处理
+type SearchQuery struct {
+	Text      string
+	UserId    int64 // 非零时只检索该用户的日志
+	StartTime time.Time
+	EndTime   time.Time
+	OrderBy   string // relevance / time
+	Skip      int
+	Limit     int
+}
+
+// SearchHit 检索结果，Snippets 以字段名为键，命中词以 <em></em> 标出，其余内容已做 HTML 转义
+type SearchHit[T any] struct {
+	Row      T
+	Score    float64
+	Snippets map[string][]string
+}
+
+// SearchResult 检索结果分页
+type SearchResult[T any] struct {
+	Hits       []SearchHit[T]
+	Total      int64
+	TotalExact bool // 含短语或命中数超过 CountCap 时为下限
+}
+
+// searchTerms 解析后的检索词
+type searchTerms struct {
+	tokens  []string
+	phrases []string
+}
+
+// parseSearch 校验并补全检索条件，返回分词结果
+func parseSearch(q *SearchQuery) (*searchTerms, error) {
+	var errs []FieldError
+	terms := &searchTerms{}
+	text := q.Text
+	for {
+		start := strings.IndexByte(text, '"')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start+1:], '"')
+		if end < 0 {
+			break
+		}
+		if phrase := strings.TrimSpace(text[start+1 : start+1+end]); phrase != "" {
+			terms.phrases = append(terms.phrases, phrase)
+		}
+		text = text[start+2+end:]
+	}
+	seen := make(map[string]bool)
+	tokenize(q.Text, func(token string) {
+		if !seen[token] {
+			seen[token] = true
+			terms.tokens = append(terms.tokens, token)
+		}
+	})
+	switch {
+	case len(terms.tokens) == 0:
+		errs = append(errs, FieldError{Field: "query", Value: q.Text, Reason: "no searchable words, use at least two letters or digits"})
+	case len(terms.tokens) > maxSearchTokens:
+		errs = append(errs, FieldError{Field: "query", Value: q.Text, Reason: fmt.Sprintf("more than %d words", maxSearchTokens)})
+	}
+	switch q.OrderBy {
+	case "":
+		q.OrderBy = SearchOrderRelevance
+	case SearchOrderRelevance, SearchOrderTime:
+	default:
+		errs = append(errs, FieldError{Field: "order", Value: q.OrderBy, Reason: "must be relevance or time"})
+	}
+	if q.EndTime.IsZero() {
+		q.EndTime = time.Now()
+	}
+	if q.StartTime.IsZero() {
+		q.StartTime = q.EndTime.AddDate(0, 0, -SearchDefaultDays)
+	}
+	if q.StartTime.After(q.EndTime) {
+		errs = append(errs, FieldError{Field: "start_time", Value: q.StartTime.Format(time.DateTime), Reason: "after end_time"})
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Err: ErrInvalidSearch, Errors: errs}
+	}
+	return terms, nil
+}
+
+// tokenize 分词：转小写，字母数字按单词切分（至少两个字符），中日韩文字按相邻两字切分，单独出现的汉字单独成词
+func tokenize(text string, emit func(token string)) {
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case isCJK(r):
+			j := i
+			for j < len(runes) && isCJK(runes[j]) {
+				j++
+			}
+			if j-i == 1 {
+				emit(string(unicode.ToLower(r)))
+			}
+			for k := i; k+1 < j; k++ {
+				emit(string(runes[k : k+2]))
+			}
+			i = j
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) && !isCJK(runes[j]) {
+				j++
+			}
+			if j-i >= 2 {
+				word := strings.ToLower(string(runes[i:j]))
+				if len(word) > maxTokenBytes {
+					word = truncateUTF8(word, maxTokenBytes)
+				}
+				emit(word)
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// termFrequencies 统计文档中各词出现次数，返回不同词的词频与文档总词数
+func termFrequencies(maxBytes int, texts ...string) (map[string]int, int) {
+	tf := make(map[string]int)
+	length := 0
+	for _, text := range texts {
+		if maxBytes > 0 && len(text) > maxBytes {
+			text = truncateUTF8(text, maxBytes)
+		}
+		tokenize(text, func(token string) {
+			length++
+			if _, ok := tf[token]; ok || len(tf) < maxDocTokens {
+				tf[token]++
+			}
+		})
+	}
+	return tf, length
+}
+
+// idf BM25 的逆文档频率，docs 为范围内文档数，df 为包含该词的文档数
+func idf(docs, df int64) float64 {
+	docs = max(docs, df)
+	return math.Log(1 + (float64(docs-df)+0.5)/(float64(df)+0.5))
+}
+
+// bm25 单个词对文档相关度的贡献
+func bm25(tf, docLen int, avgLen, weight float64) float64 {
+	if avgLen <= 0 {
+		avgLen = 1
+	}
+	f := float64(tf)
+	return weight * f * (bm25K1 + 1) / (f + bm25K1*(1-bm25B+bm25B*float64(docLen)/avgLen))
+}
+
+// containsPhrases 短语是否都在任一字段中连续出现（不区分大小写）
+func containsPhrases(phrases []string, texts ...string) bool {
+	for _, phrase := range phrases {
+		p := lowerRunes(phrase)
+		found := false
+		for _, text := range texts {
+			if runeIndex(lowerRunes(text), p, 0) >= 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// snippets 截取命中词附近的片段并以 <em></em> 标出命中词
+func snippets(terms *searchTerms, text string) []string {
+	if text == "" {
+		return nil
+	}
+	runes := []rune(text)
+	lower := lowerRunes(text)
+	// 按长度从长到短匹配，短语优先于单词
+	needles := make([][]rune, 0, len(terms.phrases)+len(terms.tokens))
+	for _, p := range terms.phrases {
+		needles = append(needles, lowerRunes(p))
+	}
+	for _, t := range terms.tokens {
+		needles = append(needles, []rune(t))
+	}
+	sort.SliceStable(needles, func(i, j int) bool { return len(needles[i]) > len(needles[j]) })
+
+	type span struct{ start, end int }
+	var hits []span
+	for _, needle := range needles {
+		for at := runeIndex(lower, needle, 0); at >= 0; at = runeIndex(lower, needle, at+len(needle)) {
+			hits = append(hits, span{at, at + len(needle)})
+		}
+	}
+	if len(hits) == 0 {
+		return nil
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].start < hits[j].start })
+	merged := hits[:1]
+	for _, h := range hits[1:] {
+		last := &merged[len(merged)-1]
+		if h.start <= last.end {
+			last.end = max(last.end, h.end)
+			continue
+		}
+		merged = append(merged, h)
+	}
+
+	var result []string
+	for i := 0; i < len(merged) && len(result) < maxSnippets; {
+		from := max(merged[i].start-snippetRadius, 0)
+		to := min(merged[i].end+snippetRadius, len(runes))
+		var b strings.Builder
+		if from > 0 {
+			b.WriteString("…")
+		}
+		pos := from
+		for ; i < len(merged) && merged[i].start < to; i++ {
+			end := min(merged[i].end, len(runes))
+			b.WriteString(html.EscapeString(string(runes[pos:merged[i].start])))
+			b.WriteString("<em>")
+			b.WriteString(html.EscapeString(string(runes[merged[i].start:end])))
+			b.WriteString("</em>")
+			pos = end
+			if to-from < 4*snippetRadius {
+				to = max(to, min(end+snippetRadius, len(runes)))
+			}
+		}
+		to = max(to, pos)
+		b.WriteString(html.EscapeString(string(runes[pos:to])))
+		if to < len(runes) {
+			b.WriteString("…")
+		}
+		result = append(result, b.String())
+	}
+	return result
+}
+
+// lowerRunes 逐字符转小写，保证与原文字符位置一一对应
+func lowerRunes(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+func runeIndex(haystack, needle []rune, from int) int {
+	if len(needle) == 0 {
+		return -1
+	}
+	for i := from; i+len(needle) <= len(haystack); i++ {
+		match := true
+		for j := range needle {
+			if haystack[i+j] != needle[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+// hitSnippets 生成各字段的摘要，没有命中的字段不返回
+func hitSnippets(terms *searchTerms, fields map[string]string) map[string][]string {
+	result := make(map[string][]string)
+	for name, text := range fields {
+		if s := snippets(terms, text); len(s) > 0 {
+			result[name] = s
+		}
+	}
+	return result
+}
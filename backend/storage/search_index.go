@@ -0,0 +1,376 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/stardustagi/TopLib/libs/databases"
+	"github.com/stardustagi/TopLib/libs/logs"
+	"github.com/stardustagi/TopModelsLogs/backend/metrics"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"go.uber.org/zap"
+	"xorm.io/builder"
+)
+
+const (
+	searchKindApiLog       = "api_log"
+	searchKindStatusReport = "status_report"
+
+	searchInsertBatch = 500
+)
+
+// searchPosting 倒排索引：每条日志的每个不同词一行
+// 模型调用日志的 doc_id 只在日分片内唯一，按 (doc_id, created_at) 区分
+// user_id 为日志所属用户，按用户检索时过滤；增加该列之前写入的索引为 0，只有不限用户的检索可见
+type searchPosting struct {
+	Id        int64  `xorm:"'id' pk autoincr BIGINT(20)"`
+	Kind      string `xorm:"'kind' not null VARCHAR(16) index(token)"`
+	Token     string `xorm:"'token' not null VARCHAR(64) index(token)"`
+	CreatedAt int64  `xorm:"'created_at' not null BIGINT(20) index(token) index(created)"`
+	DocId     int64  `xorm:"'doc_id' not null BIGINT(20)"`
+	UserId    int64  `xorm:"'user_id' not null default 0 BIGINT(20)"`
+	Tf        int    `xorm:"'tf' not null INT(11)"`
+	DocLen    int    `xorm:"'doc_len' not null INT(11)"`
+}
+
+func (searchPosting) TableName() string {
+	return "search_posting"
+}
+
+// searchIndex 写入时维护倒排索引，索引失败只记录日志，不影响日志写入
+type searchIndex struct {
+	engine      databases.DBInterface
+	maxDocBytes int
+	logger      *zap.Logger
+}
+
+func newSearchIndex(engine databases.DBInterface, c SearchConfig) (*searchIndex, error) {
+	if err := engine.Sync2(new(searchPosting)); err != nil {
+		return nil, err
+	}
+	maxDocKB := c.MaxDocKB
+	if maxDocKB <= 0 {
+		maxDocKB = 64
+	}
+	return &searchIndex{
+		engine:      engine,
+		maxDocBytes: maxDocKB << 10,
+		logger:      logs.GetLogger("SearchIndex"),
+	}, nil
+}
+
+// add 为一条日志建立索引
+func (x *searchIndex) add(ctx context.Context, kind string, docId, userId, createdAt int64, texts ...string) {
+	// 加密的列不收录，避免索引泄露明文，也避免把密文当作词项
+	texts = slices.DeleteFunc(slices.Clone(texts), isCiphertext)
+	tf, length := termFrequencies(x.maxDocBytes, texts...)
+	if len(tf) == 0 {
+		return
+	}
+	if createdAt <= 0 {
+		createdAt = time.Now().Unix()
+	}
+	postings := make([]searchPosting, 0, len(tf))
+	for token, n := range tf {
+		postings = append(postings, searchPosting{
+			Kind:      kind,
+			Token:     token,
+			CreatedAt: createdAt,
+			DocId:     docId,
+			UserId:    userId,
+			Tf:        n,
+			DocLen:    length,
+		})
+	}
+	for start := 0; start < len(postings); start += searchInsertBatch {
+		batch := postings[start:min(start+searchInsertBatch, len(postings))]
+		if _, err := x.engine.Context(ctx).Insert(&batch); err != nil {
+			metrics.Counter("search_index_errors").Add(1)
+			x.logger.Warn("写入全文索引失败", zap.String("kind", kind), zap.Int64("docId", docId), zap.Error(err))
+			return
+		}
+	}
+}
+
+// purge 删除 before 之前的索引
+func (x *searchIndex) purge(ctx context.Context, before time.Time) (int64, error) {
+	return x.engine.Context(ctx).Where(builder.Lt{"created_at": before.Unix()}).Delete(new(searchPosting))
+}
+
+// searchKey 候选文档
+type searchKey struct {
+	id        int64
+	createdAt int64
+	score     float64
+}
+
+// searchSource 各日志类型的检索适配：统计范围内文档数、按候选批量取回记录、取出参与索引的字段
+type searchSource[T any] struct {
+	kind   string
+	count  func(ctx context.Context, q SearchQuery) (int64, error)
+	fetch  func(ctx context.Context, keys []searchKey) ([]*T, error) // 与 keys 一一对应，已删除的记录为 nil
+	fields func(row *T) map[string]string
+}
+
+// searchDocs 按倒排索引检索：所有词都命中的文档按 BM25 或时间排序，含短语时取回原文校验
+func searchDocs[T any](ctx context.Context, s *sqlStore, src searchSource[T], terms *searchTerms, q SearchQuery) (*SearchResult[T], error) {
+	result := &SearchResult[T]{Hits: make([]SearchHit[T], 0), TotalExact: true}
+	rangeCond := builder.Eq{"kind": src.kind}.
+		And(builder.In("token", stringArgs(terms.tokens)...)).
+		And(builder.Gte{"created_at": q.StartTime.Unix()}).
+		And(builder.Lte{"created_at": q.EndTime.Unix()})
+	if q.UserId != 0 {
+		rangeCond = rangeCond.And(builder.Eq{"user_id": q.UserId})
+	}
+	where, whereArgs, err := builder.ToSQL(rangeCond)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.reader(ctx).Context(ctx).QueryString(append([]interface{}{
+		"SELECT token, COUNT(*) AS df, AVG(doc_len) AS avg_len FROM search_posting WHERE " + where + " GROUP BY token",
+	}, whereArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) < len(terms.tokens) {
+		// 有词在范围内没有出现，不可能全部命中
+		return result, nil
+	}
+	docs, err := src.count(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	weights := make(map[string]float64, len(rows))
+	var avgLen float64
+	for _, row := range rows {
+		weights[row["token"]] = idf(docs, parseInt(row["df"]))
+		avgLen += parseFloat(row["avg_len"])
+	}
+	avgLen = max(avgLen/float64(len(rows)), 1)
+
+	// BM25：sum(idf * tf * (k1 + 1) / (tf + k1 * (1 - b + b * doc_len / avg_len)))，权重为计算所得的数值
+	var score strings.Builder
+	scoreArgs := make([]interface{}, 0, len(terms.tokens))
+	score.WriteString("SUM(CASE token")
+	for _, token := range terms.tokens {
+		fmt.Fprintf(&score, " WHEN ? THEN %f", weights[token])
+		scoreArgs = append(scoreArgs, token)
+	}
+	fmt.Fprintf(&score, " ELSE 0 END * tf * %f / (tf + %f * (%f + %f * doc_len / %f)))",
+		bm25K1+1, bm25K1, 1-bm25B, bm25B, avgLen)
+	grouped := fmt.Sprintf("SELECT doc_id, created_at, %s AS score FROM search_posting WHERE %s GROUP BY doc_id, created_at HAVING COUNT(*) = %d",
+		score.String(), where, len(terms.tokens))
+	args := append(scoreArgs, whereArgs...)
+	order := " ORDER BY score DESC, created_at DESC, doc_id DESC"
+	if q.OrderBy == SearchOrderTime {
+		order = " ORDER BY created_at DESC, doc_id DESC"
+	}
+
+	candidates := func(limit, offset int) ([]searchKey, error) {
+		rows, err := s.reader(ctx).Context(ctx).QueryString(append([]interface{}{
+			grouped + order + fmt.Sprintf(" LIMIT %d OFFSET %d", limit, offset),
+		}, args...)...)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]searchKey, len(rows))
+		for i, row := range rows {
+			keys[i] = searchKey{id: parseInt(row["doc_id"]), createdAt: parseInt(row["created_at"]), score: parseFloat(row["score"])}
+		}
+		return keys, nil
+	}
+	collect := func(keys []searchKey) error {
+		found, err := src.fetch(ctx, keys)
+		if err != nil {
+			return err
+		}
+		for i, row := range found {
+			if row == nil {
+				continue
+			}
+			fields := src.fields(row)
+			texts := make([]string, 0, len(fields))
+			for _, text := range fields {
+				texts = append(texts, text)
+			}
+			if !containsPhrases(terms.phrases, texts...) {
+				continue
+			}
+			result.Hits = append(result.Hits, SearchHit[T]{Row: *row, Score: keys[i].score, Snippets: hitSnippets(terms, fields)})
+		}
+		return nil
+	}
+
+	if len(terms.phrases) == 0 {
+		// 索引已保证所有词命中，直接按页取候选
+		keys, err := candidates(q.Limit, q.Skip)
+		if err != nil {
+			return nil, err
+		}
+		if err = collect(keys); err != nil {
+			return nil, err
+		}
+		result.Total, result.TotalExact, err = s.count(ctx, CountCapped, grouped, args)
+		return result, err
+	}
+
+	// 含短语：按批取候选并校验原文，直到凑够 skip + limit 条或达到校验上限
+	want := q.Skip + q.Limit
+	batch := max(want*searchBatchFactor, 100)
+	for offset := 0; ; offset += batch {
+		keys, err := candidates(batch, offset)
+		if err != nil {
+			return nil, err
+		}
+		if err = collect(keys); err != nil {
+			return nil, err
+		}
+		if len(keys) < batch {
+			break
+		}
+		if len(result.Hits) >= want || offset+batch >= maxSearchScan {
+			result.TotalExact = false
+			break
+		}
+	}
+	result.Total = int64(len(result.Hits))
+	result.Hits = result.Hits[min(q.Skip, len(result.Hits)):min(want, len(result.Hits))]
+	return result, nil
+}
+
+// searchUserCond 按用户检索时文档总数也只统计该用户的日志，与倒排索引的范围一致
+func searchUserCond(q SearchQuery, cond builder.Cond) builder.Cond {
+	if q.UserId != 0 {
+		return cond.And(builder.Eq{"user_id": q.UserId})
+	}
+	return cond
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+func (s *sqlStore) SearchApiLogs(ctx context.Context, q SearchQuery) (result *SearchResult[models.ApiLog], err error) {
+	if s.index == nil {
+		return nil, ErrSearchDisabled
+	}
+	terms, err := parseSearch(&q)
+	if err != nil {
+		return nil, err
+	}
+	src := searchSource[models.ApiLog]{
+		kind: searchKindApiLog,
+		count: func(ctx context.Context, q SearchQuery) (int64, error) {
+			from, args, err := s.source([]string{models.ApiLog{}.TableName()}, "1 AS one",
+				searchUserCond(q, builder.Gte{"created_at": q.StartTime.Unix()}.And(builder.Lte{"created_at": q.EndTime.Unix()})))
+			if err != nil {
+				return 0, err
+			}
+			n, _, err := s.count(ctx, CountApprox, from, args)
+			return n, err
+		},
+		fetch: func(ctx context.Context, keys []searchKey) ([]*models.ApiLog, error) {
+			ids := make([]int64, len(keys))
+			for i, key := range keys {
+				ids[i] = key.id
+			}
+			var logs []models.ApiLog
+			if err := s.reader(ctx).Context(ctx).In("id", ids).Find(&logs); err != nil {
+				return nil, err
+			}
+			byId := make(map[int64]*models.ApiLog, len(logs))
+			for i := range logs {
+				byId[logs[i].Id] = &logs[i]
+			}
+			found := make([]*models.ApiLog, len(keys))
+			for i, key := range keys {
+				found[i] = byId[key.id]
+			}
+			return found, nil
+		},
+		fields: func(log *models.ApiLog) map[string]string {
+			return map[string]string{"request_body": log.RequestBody, "response_body": log.ResponseBody}
+		},
+	}
+	err = s.read(ctx, func(ctx context.Context) (err error) {
+		result, err = searchDocs(ctx, s, src, terms, q)
+		return err
+	})
+	return result, err
+}
+
+func (s *sqlStore) SearchStatusReports(ctx context.Context, q SearchQuery) (result *SearchResult[models.StatusReport], err error) {
+	if s.index == nil {
+		return nil, ErrSearchDisabled
+	}
+	terms, err := parseSearch(&q)
+	if err != nil {
+		return nil, err
+	}
+	src := searchSource[models.StatusReport]{
+		kind: searchKindStatusReport,
+		count: func(ctx context.Context, q SearchQuery) (int64, error) {
+			tables, err := s.shards.StatusReportTables(q.StartTime, q.EndTime)
+			if err != nil || len(tables) == 0 {
+				return 0, err
+			}
+			from, args, err := s.source(tables, "1 AS one",
+				searchUserCond(q, builder.Gte{"created_at": q.StartTime}.And(builder.Lte{"created_at": q.EndTime})))
+			if err != nil {
+				return 0, err
+			}
+			n, _, err := s.count(ctx, CountApprox, from, args)
+			return n, err
+		},
+		fetch: func(ctx context.Context, keys []searchKey) ([]*models.StatusReport, error) {
+			// 按记录时间定位日分片，每个分片一次查询
+			byTable := make(map[string][]int64)
+			tableOf := make([]string, len(keys))
+			for i, key := range keys {
+				table, err := s.shards.StatusReportTable(time.Unix(key.createdAt, 0))
+				if err != nil {
+					return nil, err
+				}
+				tableOf[i] = table
+				if table != "" {
+					byTable[table] = append(byTable[table], key.id)
+				}
+			}
+			type rowKey struct {
+				table string
+				id    uint64
+			}
+			rows := make(map[rowKey]*models.StatusReport)
+			for table, ids := range byTable {
+				var reports []models.StatusReport
+				if err := s.reader(ctx).Context(ctx).Table(table).In("id", ids).Find(&reports); err != nil {
+					return nil, err
+				}
+				for i := range reports {
+					rows[rowKey{table, reports[i].Id}] = &reports[i]
+				}
+			}
+			found := make([]*models.StatusReport, len(keys))
+			for i, key := range keys {
+				found[i] = rows[rowKey{tableOf[i], uint64(key.id)}]
+			}
+			return found, nil
+		},
+		fields: func(report *models.StatusReport) map[string]string {
+			return map[string]string{"status_message": report.StatusMessage}
+		},
+	}
+	err = s.read(ctx, func(ctx context.Context) (err error) {
+		result, err = searchDocs(ctx, s, src, terms, q)
+		return err
+	})
+	return result, err
+}
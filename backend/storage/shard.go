@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stardustagi/TopLib/libs/databases"
+	"github.com/stardustagi/TopLib/libs/logs"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"go.uber.org/zap"
+	"xorm.io/xorm/dialects"
+	"xorm.io/xorm/schemas"
+)
+
+const shardDayLayout = "20060102"
+
+// ShardManager 管理模型调用日志的日分片（分表或分区）
+type ShardManager struct {
+	engine  databases.DBInterface
+	dialect Dialect
+	mode    string
+	parent  string
+	logger  *zap.Logger
+
+	mu    sync.Mutex
+	ready map[string]bool
+}
+
+// NewShardManager 创建分片管理器，partition 模式下会预先创建分区父表
+func NewShardManager(engine databases.DBInterface, dialect Dialect, mode string) (*ShardManager, error) {
+	if mode == ShardModePartition && dialect.Name() != DialectPostgres {
+		return nil, fmt.Errorf("shard mode %s is only supported on postgres", mode)
+	}
+	table, err := engine.TableInfo(new(models.StatusReport))
+	if err != nil {
+		return nil, err
+	}
+	m := &ShardManager{
+		engine:  engine,
+		dialect: dialect,
+		mode:    mode,
+		parent:  table.Name,
+		logger:  logs.GetLogger("ShardManager"),
+		ready:   make(map[string]bool),
+	}
+	if mode == ShardModePartition {
+		if err = m.preparePartitionedParent(table); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// EnsureStatusReportShard 确保记录所在日的分片存在，返回应写入的表名
+func (m *ShardManager) EnsureStatusReportShard(report *models.StatusReport) (string, error) {
+	day := report.CreatedAt
+	name := report.GetSliceDateDayTableByTime(day)
+	if !m.isReady(name) {
+		var err error
+		if m.mode == ShardModePartition {
+			err = m.createPartition(name, day)
+		} else {
+			err = m.syncTable(name)
+		}
+		if err != nil {
+			return "", err
+		}
+		m.markReady(name)
+	}
+	if m.mode == ShardModePartition {
+		// 写入父表，由数据库路由到对应分区
+		return m.parent, nil
+	}
+	return name, nil
+}
+
+// StatusReportTables 返回时间范围内需要查询的表，按日期从新到旧排列
+func (m *ShardManager) StatusReportTables(start, end time.Time) ([]string, error) {
+	if m.mode == ShardModePartition {
+		return []string{m.parent}, nil
+	}
+	days, err := m.listShards()
+	if err != nil {
+		return nil, err
+	}
+	startDay := truncateDay(start)
+	tables := make([]string, 0, len(days))
+	for name, day := range days {
+		if !start.IsZero() && day.Before(startDay) {
+			continue
+		}
+		if !end.IsZero() && day.After(end) {
+			continue
+		}
+		tables = append(tables, name)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(tables)))
+
+	// 旧分表可能缺少新增列，首次访问时同步结构以保证 UNION 列一致
+	for _, name := range tables {
+		if m.isReady(name) {
+			continue
+		}
+		if err = m.syncTable(name); err != nil {
+			return nil, err
+		}
+		m.markReady(name)
+	}
+	return tables, nil
+}
+
+// StatusReportTable 返回某天记录所在的表，分表模式下当天分表不存在时返回空
+func (m *ShardManager) StatusReportTable(day time.Time) (string, error) {
+	if m.mode == ShardModePartition {
+		return m.parent, nil
+	}
+	name := (&models.StatusReport{}).GetSliceDateDayTableByTime(day)
+	exist, err := m.engine.IsTableExist(name)
+	if err != nil || !exist {
+		return "", err
+	}
+	return name, nil
+}
+
+// DropStatusReportShardsBefore 删除整天早于 before 的分表或分区，返回被删除的表名
+func (m *ShardManager) DropStatusReportShardsBefore(before time.Time) ([]string, error) {
+	days, err := m.listShards()
+	if err != nil {
+		return nil, err
+	}
+	dropped := make([]string, 0)
+	for name, day := range days {
+		if day.AddDate(0, 0, 1).After(before) {
+			continue
+		}
+		if _, err = m.engine.Exec("DROP TABLE " + m.engine.Quote(name)); err != nil {
+			return dropped, err
+		}
+		m.mu.Lock()
+		delete(m.ready, name)
+		m.mu.Unlock()
+		dropped = append(dropped, name)
+		m.logger.Info("删除过期日志表", zap.String("table", name))
+	}
+	sort.Strings(dropped)
+	return dropped, nil
+}
+
+// Partitioned 是否为 PostgreSQL 原生分区模式
+func (m *ShardManager) Partitioned() bool {
+	return m.mode == ShardModePartition
+}
+
+func (m *ShardManager) syncTable(name string) error {
+	exist, err := m.engine.IsTableExist(name)
+	if err != nil {
+		return err
+	}
+	if err = m.engine.Table(name).Sync2(new(models.StatusReport)); err != nil {
+		return err
+	}
+	if !exist {
+		m.logger.Info("创建日志表成功", zap.String("table", name))
+	}
+	return nil
+}
+
+// preparePartitionedParent 按模型结构创建 PARTITION BY RANGE (created_at) 父表，
+// 父表已存在时补充模型新增的列，分区子表随父表一并增加
+func (m *ShardManager) preparePartitionedParent(table *schemas.Table) error {
+	exist, err := m.engine.IsTableExist(table.Name)
+	if err != nil {
+		return err
+	}
+	dialect := m.engine.Dialect()
+	quoter := dialect.Quoter()
+	if exist {
+		for _, col := range table.Columns() {
+			ddl := fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s",
+				quoter.Quote(table.Name), columnDef(dialect, col))
+			if _, err = m.engine.Exec(ddl); err != nil {
+				return err
+			}
+			// 模型由 VARCHAR 改为 TEXT 的列（如加密后变长的 status_message），分区随父表一并修改
+			if dialect.SQLType(col) == schemas.Text {
+				ddl = fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE TEXT", quoter.Quote(table.Name), quoter.Quote(col.Name))
+				if _, err = m.engine.Exec(ddl); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	defs := make([]string, 0, len(table.Columns())+1)
+	for _, col := range table.Columns() {
+		defs = append(defs, columnDef(dialect, col))
+	}
+	// 分区表的主键必须包含分区键
+	defs = append(defs, "PRIMARY KEY (id, created_at)")
+	ddl := fmt.Sprintf("CREATE TABLE %s (%s) PARTITION BY RANGE (created_at)",
+		quoter.Quote(table.Name), strings.Join(defs, ", "))
+	if _, err = m.engine.Exec(ddl); err != nil {
+		return err
+	}
+	for _, index := range table.Indexes {
+		ddl = fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)",
+			quoter.Quote(index.XName(table.Name)), quoter.Quote(table.Name), quoter.Join(index.Cols, ", "))
+		if _, err = m.engine.Exec(ddl); err != nil {
+			return err
+		}
+	}
+	m.logger.Info("创建分区父表成功", zap.String("table", table.Name))
+	return nil
+}
+
+func columnDef(dialect dialects.Dialect, col *schemas.Column) string {
+	def := dialect.Quoter().Quote(col.Name) + " " + dialect.SQLType(col)
+	if !col.Nullable {
+		def += " NOT NULL"
+	}
+	if col.Default != "" && !col.IsAutoIncrement {
+		def += " DEFAULT " + col.Default
+	}
+	return def
+}
+
+func (m *ShardManager) createPartition(name string, day time.Time) error {
+	from := truncateDay(day)
+	ddl := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+		m.engine.Quote(name), m.engine.Quote(m.parent),
+		from.Format(time.DateTime), from.AddDate(0, 0, 1).Format(time.DateTime))
+	_, err := m.engine.Exec(ddl)
+	return err
+}
+
+// syncedShards 列出已存在的日分片，分表模式下补齐模型新增的列，历史分片只在写入时才同步表结构
+func (m *ShardManager) syncedShards() (map[string]time.Time, error) {
+	shards, err := m.listShards()
+	if err != nil || m.mode == ShardModePartition {
+		return shards, err
+	}
+	for name := range shards {
+		if m.isReady(name) {
+			continue
+		}
+		if err = m.syncTable(name); err != nil {
+			return nil, err
+		}
+		m.markReady(name)
+	}
+	return shards, nil
+}
+
+// listShards 列出已存在的日分片（分表模式为分表，分区模式为分区子表）及其日期
+func (m *ShardManager) listShards() (map[string]time.Time, error) {
+	rows, err := m.engine.QueryString(m.dialect.ListTablesSQL(), m.parent+"_%")
+	if err != nil {
+		return nil, err
+	}
+	days := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		name := row["table_name"]
+		if day, ok := m.parseShardDay(name); ok {
+			days[name] = day
+		}
+	}
+	return days, nil
+}
+
+func (m *ShardManager) parseShardDay(name string) (time.Time, bool) {
+	suffix, ok := strings.CutPrefix(name, m.parent+"_")
+	if !ok || len(suffix) != len(shardDayLayout) {
+		return time.Time{}, false
+	}
+	day, err := time.ParseInLocation(shardDayLayout, suffix, time.Local)
+	return day, err == nil
+}
+
+func (m *ShardManager) isReady(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ready[name]
+}
+
+func (m *ShardManager) markReady(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ready[name] = true
+}
+
+func truncateDay(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
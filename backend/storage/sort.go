@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/stardustagi/TopModelsLogs/models"
+)
+
+// 排序方向
+const (
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+// MaxSortFields 单次查询最多的排序列数
+const MaxSortFields = 3
+
+// ErrInvalidSort 排序列或方向不合法，具体原因见 ValidationError
+var ErrInvalidSort = errors.New("invalid sort")
+
+// SortField 排序列与方向，Order 为空时按升序
+type SortField struct {
+	Field string
+	Order string
+}
+
+// sortable 各日志类型允许排序的列，只开放带索引的列
+// 模型调用日志的 id 只在单个日分片内唯一，不开放排序，跨分片由 (shard, id) 兜底保证顺序稳定
+var sortable = map[reflect.Type][]string{
+	reflect.TypeOf(models.ApiLog{}):           {"id", "user_id", "api_path", "created_at"},
+	reflect.TypeOf(models.ModelTrainingLog{}): {"id", "user_id", "model_id", "status", "created_at"},
+	reflect.TypeOf(models.StatusReport{}):     {"created_at", "trace_id", "model", "caller_key", "step"},
+}
+
+// FieldError 单个参数的校验错误
+type FieldError struct {
+	Field  string `json:"field"`  // 参数路径，如 sort[0].field
+	Value  string `json:"value"`  // 传入的值
+	Reason string `json:"reason"` // 错误原因
+}
+
+// ValidationError 参数校验错误，包含每个不合法参数的位置与原因
+type ValidationError struct {
+	Err    error // ErrInvalidSort / ErrInvalidFilter
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		parts = append(parts, fmt.Sprintf("%s=%q: %s", fe.Field, fe.Value, fe.Reason))
+	}
+	return e.Err.Error() + ": " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+type sortKey struct {
+	column string
+	desc   bool
+}
+
+// orderKeys 按白名单校验排序列，末尾补充 tiebreak 列保证排序唯一
+// 补充列的方向与最后一个排序列一致，未指定排序时为降序
+func orderKeys(model reflect.Type, spec []SortField, tiebreak ...string) ([]sortKey, error) {
+	allowed := sortable[model]
+	var errs []FieldError
+	if len(spec) > MaxSortFields {
+		errs = append(errs, FieldError{
+			Field:  "sort",
+			Value:  fmt.Sprint(len(spec)),
+			Reason: fmt.Sprintf("at most %d sort fields", MaxSortFields),
+		})
+	}
+	keys := make([]sortKey, 0, len(spec)+len(tiebreak))
+	seen := make(map[string]bool, len(spec))
+	for i, field := range spec {
+		column := strings.ToLower(strings.TrimSpace(field.Field))
+		switch {
+		case !slices.Contains(allowed, column):
+			errs = append(errs, FieldError{
+				Field:  fmt.Sprintf("sort[%d].field", i),
+				Value:  field.Field,
+				Reason: "not sortable, allowed: " + strings.Join(allowed, ", "),
+			})
+			continue
+		case seen[column]:
+			errs = append(errs, FieldError{
+				Field:  fmt.Sprintf("sort[%d].field", i),
+				Value:  field.Field,
+				Reason: "duplicate sort field",
+			})
+			continue
+		}
+		key := sortKey{column: column}
+		switch strings.ToLower(field.Order) {
+		case "", OrderAsc:
+		case OrderDesc:
+			key.desc = true
+		default:
+			errs = append(errs, FieldError{
+				Field:  fmt.Sprintf("sort[%d].order", i),
+				Value:  field.Order,
+				Reason: "must be asc or desc",
+			})
+		}
+		seen[column] = true
+		keys = append(keys, key)
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Err: ErrInvalidSort, Errors: errs}
+	}
+	desc := len(keys) == 0 || keys[len(keys)-1].desc
+	for _, column := range tiebreak {
+		if !seen[column] {
+			keys = append(keys, sortKey{column: column, desc: desc})
+		}
+	}
+	return keys, nil
+}
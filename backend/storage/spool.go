@@ -0,0 +1,442 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stardustagi/TopLib/libs/logs"
+	"github.com/stardustagi/TopModelsLogs/backend/metrics"
+	"go.uber.org/zap"
+)
+
+const (
+	spoolSegmentPrefix = "spool-"
+	spoolSegmentSuffix = ".log"
+	spoolAckSuffix     = ".ack"
+	spoolDeadFile      = "dead.log"
+)
+
+// ErrSpoolFull 本地缓冲已达容量上限
+var ErrSpoolFull = errors.New("spool is full")
+
+// SpoolRecord 缓冲中的一条待写入记录
+type SpoolRecord struct {
+	Kind      string          `json:"kind"`
+	SpooledAt int64           `json:"spooled_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// SpoolSegment 缓冲分段文件
+type SpoolSegment struct {
+	Name   string `json:"name"`
+	Bytes  int64  `json:"bytes"`  // 文件大小
+	Offset int64  `json:"offset"` // 已回放到的位置
+	Active bool   `json:"active"` // 正在写入的分段
+}
+
+// SpoolStats 缓冲状态
+type SpoolStats struct {
+	Dir            string         `json:"dir"`
+	MaxBytes       int64          `json:"max_bytes"`
+	PendingBytes   int64          `json:"pending_bytes"`
+	PendingRecords int64          `json:"pending_records"`
+	DeadRecords    int64          `json:"dead_records"`
+	Segments       []SpoolSegment `json:"segments"`
+}
+
+// Spool 数据库不可用时的本地预写缓冲
+// 记录以 JSON 行追加到分段文件，每次追加 fsync；回放从最旧分段开始，
+// 通过 .ack 文件记录回放位置，分段回放完成后删除
+type Spool struct {
+	dir          string
+	segmentBytes int64
+	maxBytes     int64
+	logger       *zap.Logger
+
+	mu             sync.Mutex
+	segments       []uint64 // 按序号升序
+	offsets        map[uint64]int64
+	active         *os.File
+	activeSize     int64
+	pendingBytes   int64
+	pendingRecords int64
+	deadRecords    int64
+
+	replayMu sync.Mutex
+}
+
+// OpenSpool 打开缓冲目录，并从已有分段恢复缓冲深度
+func OpenSpool(dir string, segmentBytes, maxBytes int64) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Spool{
+		dir:          dir,
+		segmentBytes: segmentBytes,
+		maxBytes:     maxBytes,
+		logger:       logs.GetLogger("Spool"),
+		offsets:      make(map[uint64]int64),
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		seq, ok := parseSegmentName(entry.Name())
+		if !ok {
+			continue
+		}
+		offset := s.readAck(seq)
+		records, size, err := countRecords(s.segmentPath(seq), offset)
+		if err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, seq)
+		s.offsets[seq] = offset
+		s.pendingBytes += size - offset
+		s.pendingRecords += records
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+	if dead, _, err := countRecords(filepath.Join(dir, spoolDeadFile), 0); err == nil {
+		s.deadRecords = dead
+	}
+	s.publish()
+	if s.pendingRecords > 0 {
+		s.logger.Info("发现未回放的缓冲日志",
+			zap.Int64("records", s.pendingRecords), zap.Int64("bytes", s.pendingBytes))
+	}
+	return s, nil
+}
+
+// Append 追加一条记录并落盘，超过容量上限时返回 ErrSpoolFull
+func (s *Spool) Append(kind string, row interface{}) error {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(SpoolRecord{Kind: kind, SpooledAt: time.Now().Unix(), Data: data})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxBytes > 0 && s.pendingBytes+int64(len(line)) > s.maxBytes {
+		return ErrSpoolFull
+	}
+	if s.active == nil || s.activeSize+int64(len(line)) > s.segmentBytes {
+		if err = s.rotate(); err != nil {
+			return err
+		}
+	}
+	if _, err = s.active.Write(line); err != nil {
+		return err
+	}
+	if err = s.active.Sync(); err != nil {
+		return err
+	}
+	s.activeSize += int64(len(line))
+	s.pendingBytes += int64(len(line))
+	s.pendingRecords++
+	s.publish()
+	return nil
+}
+
+// Pending 待回放的记录数
+func (s *Spool) Pending() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pendingRecords
+}
+
+// Replay 从最旧的记录开始逐条交给 fn，fn 返回错误时停止并保留该记录
+func (s *Spool) Replay(fn func(SpoolRecord) error) (int, error) {
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	s.mu.Lock()
+	// 封存正在写入的分段，回放期间的新记录写入新分段
+	s.seal()
+	segments := append([]uint64(nil), s.segments...)
+	s.mu.Unlock()
+
+	replayed := 0
+	for _, seq := range segments {
+		n, err := s.replaySegment(seq, fn)
+		replayed += n
+		if err != nil {
+			return replayed, err
+		}
+	}
+	return replayed, nil
+}
+
+// Bury 将无法写入的记录移入死信文件，不再回放
+func (s *Spool) Bury(record SpoolRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, spoolDeadFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.deadRecords++
+	s.publish()
+	s.mu.Unlock()
+	return nil
+}
+
+// Peek 读取最旧的 limit 条待回放记录，不改变回放位置
+func (s *Spool) Peek(limit int) ([]SpoolRecord, error) {
+	s.mu.Lock()
+	segments := append([]uint64(nil), s.segments...)
+	offsets := make(map[uint64]int64, len(segments))
+	for _, seq := range segments {
+		offsets[seq] = s.offsets[seq]
+	}
+	s.mu.Unlock()
+
+	records := make([]SpoolRecord, 0, limit)
+	for _, seq := range segments {
+		if len(records) >= limit {
+			break
+		}
+		err := scanSegment(s.segmentPath(seq), offsets[seq], func(line []byte) bool {
+			var record SpoolRecord
+			if json.Unmarshal(line, &record) == nil {
+				records = append(records, record)
+			}
+			return len(records) < limit
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// Stats 缓冲状态
+func (s *Spool) Stats() SpoolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := SpoolStats{
+		Dir:            s.dir,
+		MaxBytes:       s.maxBytes,
+		PendingBytes:   s.pendingBytes,
+		PendingRecords: s.pendingRecords,
+		DeadRecords:    s.deadRecords,
+		Segments:       make([]SpoolSegment, 0, len(s.segments)),
+	}
+	for i, seq := range s.segments {
+		segment := SpoolSegment{
+			Name:   filepath.Base(s.segmentPath(seq)),
+			Offset: s.offsets[seq],
+			Active: s.active != nil && i == len(s.segments)-1,
+		}
+		if info, err := os.Stat(s.segmentPath(seq)); err == nil {
+			segment.Bytes = info.Size()
+		}
+		stats.Segments = append(stats.Segments, segment)
+	}
+	return stats
+}
+
+// Close 关闭正在写入的分段
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		return nil
+	}
+	err := s.active.Close()
+	s.active = nil
+	return err
+}
+
+func (s *Spool) replaySegment(seq uint64, fn func(SpoolRecord) error) (int, error) {
+	s.mu.Lock()
+	offset := s.offsets[seq]
+	s.mu.Unlock()
+
+	replayed := 0
+	var fnErr error
+	err := scanSegment(s.segmentPath(seq), offset, func(line []byte) bool {
+		var record SpoolRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			s.logger.Error("缓冲记录损坏，已跳过", zap.Uint64("segment", seq), zap.Int64("offset", offset), zap.Error(err))
+		} else if fnErr = fn(record); fnErr != nil {
+			return false
+		} else {
+			replayed++
+		}
+		offset += int64(len(line)) + 1
+		s.advance(seq, offset, int64(len(line))+1)
+		return true
+	})
+	if fnErr != nil {
+		return replayed, fnErr
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return replayed, err
+	}
+	return replayed, s.remove(seq)
+}
+
+// advance 记录回放位置并更新缓冲深度
+func (s *Spool) advance(seq uint64, offset, size int64) {
+	if err := os.WriteFile(s.ackPath(seq), []byte(strconv.FormatInt(offset, 10)), 0o644); err != nil {
+		s.logger.Error("写入回放位置失败", zap.Uint64("segment", seq), zap.Error(err))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offsets[seq] = offset
+	s.pendingBytes -= size
+	s.pendingRecords--
+	s.publish()
+}
+
+// remove 删除回放完成的分段，末尾不完整的记录（写入时崩溃）一并丢弃
+func (s *Spool) remove(seq uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, err := os.Stat(s.segmentPath(seq)); err == nil {
+		if torn := info.Size() - s.offsets[seq]; torn > 0 {
+			s.logger.Warn("丢弃不完整的缓冲记录", zap.Uint64("segment", seq), zap.Int64("bytes", torn))
+			s.pendingBytes -= torn
+		}
+	}
+	if err := os.Remove(s.segmentPath(seq)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	_ = os.Remove(s.ackPath(seq))
+	delete(s.offsets, seq)
+	for i, v := range s.segments {
+		if v == seq {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+	s.publish()
+	return nil
+}
+
+// rotate 封存当前分段并创建新分段，调用方持有 mu
+func (s *Spool) rotate() error {
+	s.seal()
+	var seq uint64 = 1
+	if n := len(s.segments); n > 0 {
+		seq = s.segments[n-1] + 1
+	}
+	f, err := os.OpenFile(s.segmentPath(seq), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	s.segments = append(s.segments, seq)
+	s.offsets[seq] = 0
+	s.active, s.activeSize = f, 0
+	return nil
+}
+
+// seal 关闭正在写入的分段，调用方持有 mu
+func (s *Spool) seal() {
+	if s.active == nil {
+		return
+	}
+	if err := s.active.Close(); err != nil {
+		s.logger.Error("关闭缓冲分段失败", zap.Error(err))
+	}
+	s.active, s.activeSize = nil, 0
+}
+
+// publish 更新缓冲深度指标，调用方持有 mu
+func (s *Spool) publish() {
+	metrics.Gauge("spool_pending_records").Set(s.pendingRecords)
+	metrics.Gauge("spool_pending_bytes").Set(s.pendingBytes)
+	metrics.Gauge("spool_dead_records").Set(s.deadRecords)
+}
+
+func (s *Spool) readAck(seq uint64) int64 {
+	data, err := os.ReadFile(s.ackPath(seq))
+	if err != nil {
+		return 0
+	}
+	offset, _ := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	return offset
+}
+
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", spoolSegmentPrefix, seq, spoolSegmentSuffix))
+}
+
+func (s *Spool) ackPath(seq uint64) string {
+	return strings.TrimSuffix(s.segmentPath(seq), spoolSegmentSuffix) + spoolAckSuffix
+}
+
+func parseSegmentName(name string) (uint64, bool) {
+	if !strings.HasPrefix(name, spoolSegmentPrefix) || !strings.HasSuffix(name, spoolSegmentSuffix) {
+		return 0, false
+	}
+	seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, spoolSegmentPrefix), spoolSegmentSuffix), 10, 64)
+	return seq, err == nil
+}
+
+// scanSegment 从 offset 开始逐行读取完整记录，fn 返回 false 时停止
+func scanSegment(path string, offset int64, fn func(line []byte) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// 没有换行符的尾部是未写完的记录
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fn(bytes.TrimSuffix(line, []byte{'\n'})) {
+			return nil
+		}
+	}
+}
+
+// countRecords 统计 offset 之后的完整记录数，同时返回文件大小
+func countRecords(path string, offset int64) (int64, int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	var records int64
+	err = scanSegment(path, offset, func([]byte) bool {
+		records++
+		return true
+	})
+	return records, info.Size(), err
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/stardustagi/TopLib/libs/logs"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"go.uber.org/zap"
+)
+
+const (
+	spoolKindApiLog       = "api_log"
+	spoolKindTrainingLog  = "training_log"
+	spoolKindStatusReport = "status_report"
+)
+
+// SpoolStore 在 LogStore 之上增加本地缓冲：数据库不可用时日志写入 Spool，
+// 数据库恢复后由 Replay 按原始 CreatedAt 回写（模型调用日志据此路由到对应日分片）
+// 缓冲中仍有记录时新日志直接进入缓冲，保证回放顺序；缓冲写入的日志返回的 Id 为 0
+type SpoolStore struct {
+	LogStore
+	spool  *Spool
+	ping   func(ctx context.Context) error
+	logger *zap.Logger
+}
+
+var _ LogStore = (*SpoolStore)(nil)
+
+// NewSpoolStore 创建带本地缓冲的日志存储，ping 用于区分数据库不可用与单条记录无法写入
+func NewSpoolStore(store LogStore, spool *Spool, ping func(ctx context.Context) error) *SpoolStore {
+	return &SpoolStore{
+		LogStore: store,
+		spool:    spool,
+		ping:     ping,
+		logger:   logs.GetLogger("SpoolStore"),
+	}
+}
+
+func (s *SpoolStore) InsertApiLog(ctx context.Context, log *models.ApiLog) error {
+	if written, err := s.direct(ctx, spoolKindApiLog, func() error { return s.LogStore.InsertApiLog(ctx, log) }); written {
+		return err
+	}
+	if log.CreatedAt == 0 {
+		log.CreatedAt = time.Now().Unix()
+	}
+	log.Id = 0
+	return s.spool.Append(spoolKindApiLog, log)
+}
+
+func (s *SpoolStore) InsertModelTrainingLog(ctx context.Context, log *models.ModelTrainingLog) error {
+	if written, err := s.direct(ctx, spoolKindTrainingLog, func() error { return s.LogStore.InsertModelTrainingLog(ctx, log) }); written {
+		return err
+	}
+	if log.CreatedAt == 0 {
+		log.CreatedAt = time.Now().Unix()
+	}
+	log.Id = 0
+	return s.spool.Append(spoolKindTrainingLog, log)
+}
+
+func (s *SpoolStore) InsertStatusReport(ctx context.Context, report *models.StatusReport) error {
+	if written, err := s.direct(ctx, spoolKindStatusReport, func() error { return s.LogStore.InsertStatusReport(ctx, report) }); written {
+		return err
+	}
+	if report.CreatedAt.IsZero() {
+		report.CreatedAt = time.Now()
+	}
+	report.Id = 0
+	return s.spool.Append(spoolKindStatusReport, report)
+}
+
+// direct 缓冲为空时直接写库，返回 false 表示记录需要进入缓冲。
+// 写入失败但数据库仍可连通时是记录本身的问题（超长、约束冲突等），直接返回错误而不缓冲
+func (s *SpoolStore) direct(ctx context.Context, kind string, write func() error) (bool, error) {
+	if s.spool.Pending() > 0 {
+		return false, nil
+	}
+	err := write()
+	if err == nil {
+		return true, nil
+	}
+	if pingErr := s.ping(ctx); pingErr == nil {
+		return true, err
+	}
+	s.logger.Warn("数据库不可用，日志转入本地缓冲", zap.String("kind", kind), zap.Error(err))
+	return false, nil
+}
+
+// Replay 将缓冲中的日志回写数据库，数据库仍不可用时停止，
+// 数据库可用但记录写入失败时将其移入死信，避免阻塞后续记录
+func (s *SpoolStore) Replay(ctx context.Context) (int, error) {
+	if s.spool.Pending() == 0 {
+		return 0, nil
+	}
+	if err := s.ping(ctx); err != nil {
+		return 0, err
+	}
+	return s.spool.Replay(func(record SpoolRecord) error {
+		err := s.replayRecord(ctx, record)
+		if err == nil {
+			return nil
+		}
+		if pingErr := s.ping(ctx); pingErr != nil {
+			return pingErr
+		}
+		s.logger.Error("缓冲日志回放失败，移入死信", zap.String("kind", record.Kind), zap.Error(err))
+		return s.spool.Bury(record)
+	})
+}
+
+// Spool 底层缓冲
+func (s *SpoolStore) Spool() *Spool {
+	return s.spool
+}
+
+func (s *SpoolStore) replayRecord(ctx context.Context, record SpoolRecord) error {
+	switch record.Kind {
+	case spoolKindApiLog:
+		var log models.ApiLog
+		if err := json.Unmarshal(record.Data, &log); err != nil {
+			return err
+		}
+		log.Id = 0
+		return s.LogStore.InsertApiLog(ctx, &log)
+	case spoolKindTrainingLog:
+		var log models.ModelTrainingLog
+		if err := json.Unmarshal(record.Data, &log); err != nil {
+			return err
+		}
+		log.Id = 0
+		return s.LogStore.InsertModelTrainingLog(ctx, &log)
+	case spoolKindStatusReport:
+		var report models.StatusReport
+		if err := json.Unmarshal(record.Data, &report); err != nil {
+			return err
+		}
+		report.Id = 0
+		return s.LogStore.InsertStatusReport(ctx, &report)
+	}
+	return fmt.Errorf("unknown spool record kind: %s", record.Kind)
+}
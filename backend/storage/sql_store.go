@@ -0,0 +1,702 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stardustagi/TopLib/libs/databases"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"xorm.io/builder"
+)
+
+// sqlStore 基于 xorm 的日志存储，模型调用日志按日分片
+// 写入走主库，列表、详情与统计查询在配置了从库时走 replicas
+type sqlStore struct {
+	engine   databases.DBInterface
+	dialect  Dialect
+	shards   *ShardManager
+	replicas *ReplicaSet
+	index    *searchIndex
+}
+
+var _ LogStore = (*sqlStore)(nil)
+
+// NewSQLStore 创建关系数据库日志存储，replicas 为 nil 时全部查询走主库
+// search 开启时写入日志同步维护全文索引
+func NewSQLStore(engine databases.DBInterface, dialect Dialect, shards *ShardManager, replicas *ReplicaSet, search SearchConfig) (LogStore, error) {
+	s := &sqlStore{
+		engine:   engine,
+		dialect:  dialect,
+		shards:   shards,
+		replicas: replicas,
+	}
+	addExplainHook(engine)
+	for _, rep := range replicas.all() {
+		addExplainHook(rep.engine)
+	}
+	if search.Enabled {
+		var err error
+		if s.index, err = newSearchIndex(engine, search); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *sqlStore) InsertApiLog(ctx context.Context, log *models.ApiLog) error {
+	if _, err := s.engine.Context(ctx).InsertOne(log); err != nil {
+		return err
+	}
+	if s.index != nil {
+		s.index.add(ctx, searchKindApiLog, log.Id, log.UserId, log.CreatedAt, log.RequestBody, log.ResponseBody)
+	}
+	return nil
+}
+
+func (s *sqlStore) ListApiLogs(ctx context.Context, filter ApiLogFilter, page Page) (result *PageResult[models.ApiLog], err error) {
+	err = s.read(ctx, func(ctx context.Context) (err error) {
+		result, err = listTable[models.ApiLog](ctx, s, models.ApiLog{}.TableName(), s.apiLogCond(filter), page)
+		return err
+	})
+	return result, err
+}
+
+func (s *sqlStore) GetApiLog(ctx context.Context, id int64) (*models.ApiLog, error) {
+	log := &models.ApiLog{}
+	var ok bool
+	err := s.read(ctx, func(ctx context.Context) (err error) {
+		ok, err = s.reader(ctx).Context(ctx).ID(id).Get(log)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return log, nil
+}
+
+func (s *sqlStore) ApiLogStats(ctx context.Context, filter ApiLogFilter) (stats *ApiLogStats, err error) {
+	err = s.read(ctx, func(ctx context.Context) (err error) {
+		stats, err = s.apiLogStats(ctx, filter)
+		return err
+	})
+	return stats, err
+}
+
+func (s *sqlStore) apiLogStats(ctx context.Context, filter ApiLogFilter) (*ApiLogStats, error) {
+	from, args, err := s.source([]string{models.ApiLog{}.TableName()}, "duration, status_code", s.apiLogCond(filter))
+	if err != nil {
+		return nil, err
+	}
+	row, err := s.aggregate(ctx, from, args,
+		"COUNT(*) AS total",
+		"COALESCE(SUM(CASE WHEN status_code >= 400 THEN 1 ELSE 0 END), 0) AS failed",
+		"COALESCE(AVG(duration), 0) AS avg_duration")
+	if err != nil {
+		return nil, err
+	}
+	stats := &ApiLogStats{
+		Total:       parseInt(row["total"]),
+		Failed:      parseInt(row["failed"]),
+		AvgDuration: parseFloat(row["avg_duration"]),
+	}
+	if stats.Total == 0 {
+		return stats, nil
+	}
+	values, err := s.percentiles(ctx, "duration", from, args)
+	if err != nil {
+		return nil, err
+	}
+	stats.P50Duration, stats.P95Duration, stats.P99Duration = values[0], values[1], values[2]
+	return stats, nil
+}
+
+func (s *sqlStore) InsertModelTrainingLog(ctx context.Context, log *models.ModelTrainingLog) error {
+	_, err := s.engine.Context(ctx).InsertOne(log)
+	return err
+}
+
+func (s *sqlStore) ListModelTrainingLogs(ctx context.Context, filter ModelTrainingLogFilter, page Page) (result *PageResult[models.ModelTrainingLog], err error) {
+	err = s.read(ctx, func(ctx context.Context) (err error) {
+		result, err = listTable[models.ModelTrainingLog](ctx, s, models.ModelTrainingLog{}.TableName(), s.trainingLogCond(filter), page)
+		return err
+	})
+	return result, err
+}
+
+func (s *sqlStore) GetModelTrainingLog(ctx context.Context, id int64) (*models.ModelTrainingLog, error) {
+	log := &models.ModelTrainingLog{}
+	var ok bool
+	err := s.read(ctx, func(ctx context.Context) (err error) {
+		ok, err = s.reader(ctx).Context(ctx).ID(id).Get(log)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return log, nil
+}
+
+func (s *sqlStore) ModelTrainingLogStats(ctx context.Context, filter ModelTrainingLogFilter) (stats *ModelTrainingLogStats, err error) {
+	err = s.read(ctx, func(ctx context.Context) (err error) {
+		stats, err = s.trainingLogStats(ctx, filter)
+		return err
+	})
+	return stats, err
+}
+
+func (s *sqlStore) trainingLogStats(ctx context.Context, filter ModelTrainingLogFilter) (*ModelTrainingLogStats, error) {
+	from, args, err := s.source([]string{models.ModelTrainingLog{}.TableName()},
+		"log_level, loss, accuracy, epoch", s.trainingLogCond(filter))
+	if err != nil {
+		return nil, err
+	}
+	row, err := s.aggregate(ctx, from, args,
+		"COUNT(*) AS total",
+		"COALESCE(SUM(CASE WHEN log_level = 'error' THEN 1 ELSE 0 END), 0) AS errors",
+		"COALESCE(AVG(loss), 0) AS avg_loss",
+		"COALESCE(MIN(loss), 0) AS min_loss",
+		"COALESCE(MAX(accuracy), 0) AS max_accuracy",
+		"COALESCE(MAX(epoch), 0) AS max_epoch")
+	if err != nil {
+		return nil, err
+	}
+	return &ModelTrainingLogStats{
+		Total:       parseInt(row["total"]),
+		Errors:      parseInt(row["errors"]),
+		AvgLoss:     parseFloat(row["avg_loss"]),
+		MinLoss:     parseFloat(row["min_loss"]),
+		MaxAccuracy: parseFloat(row["max_accuracy"]),
+		MaxEpoch:    parseInt(row["max_epoch"]),
+	}, nil
+}
+
+func (s *sqlStore) InsertStatusReport(ctx context.Context, report *models.StatusReport) error {
+	table, err := s.shards.EnsureStatusReportShard(report)
+	if err != nil {
+		return err
+	}
+	if _, err = s.engine.Context(ctx).Table(table).InsertOne(report); err != nil {
+		return err
+	}
+	if s.index != nil && report.StatusMessage != "" {
+		s.index.add(ctx, searchKindStatusReport, int64(report.Id), report.UserId, report.CreatedAt.Unix(), report.StatusMessage)
+	}
+	return nil
+}
+
+func (s *sqlStore) ListStatusReports(ctx context.Context, filter StatusReportFilter, page Page) (result *PageResult[models.StatusReport], err error) {
+	err = s.read(ctx, func(ctx context.Context) (err error) {
+		result, err = s.listStatusReports(ctx, filter, page)
+		return err
+	})
+	return result, err
+}
+
+// listStatusReports 跨日分片列表查询，分表模式下以 (排序列, shard, id) 作为游标保证跨分片顺序稳定
+func (s *sqlStore) listStatusReports(ctx context.Context, filter StatusReportFilter, page Page) (*PageResult[models.StatusReport], error) {
+	model := reflect.TypeOf(models.StatusReport{})
+	tiebreak := []string{shardKey, "id"}
+	if s.shards.Partitioned() {
+		// 分区共用父表的自增序列，id 已唯一
+		tiebreak = []string{"id"}
+	}
+	keys, err := orderKeys(model, page.Sort, tiebreak...)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := projectFields(model, page.Fields)
+	if err != nil {
+		return nil, err
+	}
+	var values []interface{}
+	skip := page.Skip
+	if page.Cursor != "" {
+		if values, err = decodeCursor(page.Cursor, keys, model); err != nil {
+			return nil, err
+		}
+		skip = 0
+	}
+
+	cond := s.statusReportCond(filter)
+	tables, err := s.statusReportTables(ctx, filter.StartTime, filter.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	// 按 created_at 翻页时，游标之前的日分片不再参与查询
+	rowTables := tables
+	if values != nil && keys[0].column == "created_at" {
+		start, end := filter.StartTime, filter.EndTime
+		if at := values[0].(time.Time); keys[0].desc {
+			end = at
+		} else {
+			start = at
+		}
+		if rowTables, err = s.statusReportTables(ctx, start, end); err != nil {
+			return nil, err
+		}
+	}
+
+	var reports []models.StatusReport
+	if len(rowTables) > 0 {
+		branchLimit := 0
+		if page.Limit > 0 {
+			branchLimit = page.Limit + 1 + skip
+		}
+		from, args, err := s.shardPageSource(rowTables, strings.Join(selectColumns(fields, keys), ", "), cond, keys, values, branchLimit)
+		if err != nil {
+			return nil, err
+		}
+		if from != "" {
+			query := "SELECT * FROM (" + from + ") t ORDER BY " + orderBy(keys)
+			if page.Limit > 0 {
+				query += fmt.Sprintf(" LIMIT %d OFFSET %d", page.Limit+1, skip)
+			}
+			if err = s.reader(ctx).Context(ctx).SQL(query, args...).Find(&reports); err != nil {
+				return nil, err
+			}
+		}
+	}
+	result, err := pageResult(reports, page.Limit, keys)
+	if err != nil {
+		return nil, err
+	}
+	result.Fields = fields
+	if len(tables) == 0 {
+		result.Total, result.TotalExact = emptyCount(page.CountMode)
+		return result, nil
+	}
+	from, args, err := s.source(tables, "1 AS one", cond)
+	if err != nil {
+		return nil, err
+	}
+	result.Total, result.TotalExact, err = s.count(ctx, page.CountMode, from, args)
+	return result, err
+}
+
+func (s *sqlStore) GetStatusReport(ctx context.Context, id uint64, day time.Time) (report *models.StatusReport, err error) {
+	err = s.read(ctx, func(ctx context.Context) (err error) {
+		report, err = s.getStatusReport(ctx, id, day)
+		return err
+	})
+	return report, err
+}
+
+func (s *sqlStore) getStatusReport(ctx context.Context, id uint64, day time.Time) (*models.StatusReport, error) {
+	var tables []string
+	if day.IsZero() {
+		var err error
+		if tables, err = s.shards.StatusReportTables(time.Time{}, time.Time{}); err != nil {
+			return nil, err
+		}
+	} else {
+		table, err := s.shards.StatusReportTable(day)
+		if err != nil {
+			return nil, err
+		}
+		if table != "" {
+			tables = append(tables, table)
+		}
+	}
+	var found *models.StatusReport
+	for _, table := range tables {
+		report := &models.StatusReport{}
+		ok, err := s.reader(ctx).Context(ctx).Table(table).ID(id).Get(report)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if found != nil {
+			return nil, ErrAmbiguousId
+		}
+		found = report
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	return found, nil
+}
+
+func (s *sqlStore) StatusReportStats(ctx context.Context, filter StatusReportFilter) (stats *CallLogStats, err error) {
+	err = s.read(ctx, func(ctx context.Context) (err error) {
+		stats, err = s.statusReportStats(ctx, filter)
+		return err
+	})
+	return stats, err
+}
+
+func (s *sqlStore) statusReportStats(ctx context.Context, filter StatusReportFilter) (*CallLogStats, error) {
+	stats := &CallLogStats{}
+	tables, err := s.statusReportTables(ctx, filter.StartTime, filter.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	if len(tables) == 0 {
+		return stats, nil
+	}
+	from, args, err := s.source(tables, "status_code, latency, tokens_per_sec", s.statusReportCond(filter))
+	if err != nil {
+		return nil, err
+	}
+	row, err := s.aggregate(ctx, from, args,
+		"COUNT(*) AS total",
+		"COALESCE(SUM(CASE WHEN status_code <> '' THEN 1 ELSE 0 END), 0) AS failed",
+		"COALESCE(AVG(latency), 0) AS avg_latency",
+		"COALESCE(AVG(tokens_per_sec), 0) AS avg_tokens_per_sec")
+	if err != nil {
+		return nil, err
+	}
+	stats.Total = parseInt(row["total"])
+	stats.Failed = parseInt(row["failed"])
+	stats.AvgLatency = parseFloat(row["avg_latency"])
+	stats.AvgTokensPerSec = parseFloat(row["avg_tokens_per_sec"])
+	if stats.Total == 0 {
+		return stats, nil
+	}
+	values, err := s.percentiles(ctx, "latency", from, args)
+	if err != nil {
+		return nil, err
+	}
+	stats.P50Latency, stats.P95Latency, stats.P99Latency = values[0], values[1], values[2]
+	return stats, nil
+}
+
+func (s *sqlStore) PurgeBefore(ctx context.Context, before time.Time) (*PurgeResult, error) {
+	result := &PurgeResult{}
+	// 早期未填写创建时间的记录（0 或 NULL）无法判断时间，按已过期处理
+	cond := builder.Or(builder.Lt{"created_at": before.Unix()}, builder.IsNull{"created_at"})
+	var err error
+	if result.ApiLogs, err = s.engine.Context(ctx).Where(cond).Delete(new(models.ApiLog)); err != nil {
+		return nil, err
+	}
+	if result.TrainingLogs, err = s.engine.Context(ctx).Where(cond).Delete(new(models.ModelTrainingLog)); err != nil {
+		return nil, err
+	}
+	if result.DroppedShards, err = s.shards.DropStatusReportShardsBefore(before); err != nil {
+		return nil, err
+	}
+	if s.index != nil {
+		if _, err = s.index.purge(ctx, before); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (s *sqlStore) apiLogCond(filter ApiLogFilter) builder.Cond {
+	cond := builder.NewCond()
+	if filter.UserId > 0 {
+		cond = cond.And(builder.Eq{"user_id": filter.UserId})
+	}
+	if filter.ApiPath != "" {
+		cond = cond.And(builder.Expr("api_path "+s.dialect.LikeOp()+" ?", "%"+filter.ApiPath+"%"))
+	}
+	if filter.StartTime > 0 {
+		cond = cond.And(builder.Gte{"created_at": filter.StartTime})
+	}
+	if filter.EndTime > 0 {
+		cond = cond.And(builder.Lte{"created_at": filter.EndTime})
+	}
+	if filter.Expr != nil {
+		cond = cond.And(filter.Expr.cond(s.dialect))
+	}
+	return cond
+}
+
+func (s *sqlStore) trainingLogCond(filter ModelTrainingLogFilter) builder.Cond {
+	cond := builder.NewCond()
+	if filter.UserId > 0 {
+		cond = cond.And(builder.Eq{"user_id": filter.UserId})
+	}
+	if filter.ModelId > 0 {
+		cond = cond.And(builder.Eq{"model_id": filter.ModelId})
+	}
+	if filter.Status != "" {
+		cond = cond.And(builder.Eq{"status": filter.Status})
+	}
+	if filter.LogLevel != "" {
+		cond = cond.And(builder.Eq{"log_level": filter.LogLevel})
+	}
+	if filter.StartTime > 0 {
+		cond = cond.And(builder.Gte{"created_at": filter.StartTime})
+	}
+	if filter.EndTime > 0 {
+		cond = cond.And(builder.Lte{"created_at": filter.EndTime})
+	}
+	if filter.Expr != nil {
+		cond = cond.And(filter.Expr.cond(s.dialect))
+	}
+	return cond
+}
+
+func (s *sqlStore) statusReportCond(filter StatusReportFilter) builder.Cond {
+	cond := builder.NewCond()
+	if filter.UserId > 0 {
+		cond = cond.And(builder.Eq{"user_id": filter.UserId})
+	}
+	if filter.TraceId != "" {
+		cond = cond.And(builder.Eq{"trace_id": filter.TraceId})
+	}
+	if filter.Model != "" {
+		cond = cond.And(builder.Eq{"model": filter.Model})
+	}
+	if filter.CallerKey != "" {
+		cond = cond.And(builder.Eq{"caller_key": filter.CallerKey})
+	}
+	if filter.Step != "" {
+		cond = cond.And(builder.Eq{"step": filter.Step})
+	}
+	if filter.ActualProviderId != "" {
+		cond = cond.And(builder.Eq{"actual_provider_id": filter.ActualProviderId})
+	}
+	if !filter.StartTime.IsZero() {
+		cond = cond.And(builder.Gte{"created_at": filter.StartTime})
+	}
+	if !filter.EndTime.IsZero() {
+		cond = cond.And(builder.Lte{"created_at": filter.EndTime})
+	}
+	if filter.Expr != nil {
+		cond = cond.And(filter.Expr.cond(s.dialect))
+	}
+	return cond
+}
+
+// reader 返回只读查询使用的连接
+func (s *sqlStore) reader(ctx context.Context) databases.DBInterface {
+	if s.replicas == nil {
+		return s.engine
+	}
+	return s.replicas.Reader(ctx)
+}
+
+// statusReportTables 时间范围内需要查询的模型调用日志分片，试运行时一并记录
+func (s *sqlStore) statusReportTables(ctx context.Context, start, end time.Time) ([]string, error) {
+	tables, err := s.shards.StatusReportTables(start, end)
+	if err == nil {
+		noteTables(ctx, tables)
+	}
+	return tables, err
+}
+
+// read 执行只读查询，从库出错（如尚未同步新建的日分表）时回退主库重试一次，试运行拦截的查询不重试
+func (s *sqlStore) read(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := fn(ctx)
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrAmbiguousId) && !errors.Is(err, errExplained) && ctx.Err() == nil && s.replicas.Serving(ctx) {
+		err = fn(WithPrimary(ctx))
+	}
+	return err
+}
+
+// listTable 单表列表查询：按 Page 的游标或偏移翻页，并按 CountMode 计算总数
+func listTable[T any](ctx context.Context, s *sqlStore, table string, cond builder.Cond, page Page) (*PageResult[T], error) {
+	model := reflect.TypeOf((*T)(nil)).Elem()
+	keys, err := orderKeys(model, page.Sort, "id")
+	if err != nil {
+		return nil, err
+	}
+	fields, err := projectFields(model, page.Fields)
+	if err != nil {
+		return nil, err
+	}
+	query := cond
+	skip := page.Skip
+	if page.Cursor != "" {
+		values, err := decodeCursor(page.Cursor, keys, model)
+		if err != nil {
+			return nil, err
+		}
+		query = builder.And(cond, keysetCond(keys, values))
+		skip = 0
+	}
+	session := s.reader(ctx).Context(ctx).Table(table).Cols(selectColumns(fields, keys)...).
+		Where(query).OrderBy(orderBy(keys))
+	if page.Limit > 0 {
+		// 多取一条判断是否还有下一页
+		session = session.Limit(page.Limit+1, skip)
+	}
+	var rows []T
+	if err = session.Find(&rows); err != nil {
+		return nil, err
+	}
+	result, err := pageResult(rows, page.Limit, keys)
+	if err != nil {
+		return nil, err
+	}
+	result.Fields = fields
+	from, args, err := s.source([]string{table}, "1 AS one", cond)
+	if err != nil {
+		return nil, err
+	}
+	result.Total, result.TotalExact, err = s.count(ctx, page.CountMode, from, args)
+	return result, err
+}
+
+// count 按 CountMode 计算子查询 from 的行数，返回总数与是否精确
+func (s *sqlStore) count(ctx context.Context, mode string, from string, args []interface{}) (int64, bool, error) {
+	switch mode {
+	case CountNone:
+		return -1, false, nil
+	case CountApprox:
+		plan, err := s.reader(ctx).Context(ctx).QueryString(append([]interface{}{s.dialect.ExplainSQL(from)}, args...)...)
+		if err != nil {
+			return 0, false, err
+		}
+		if n, ok := s.dialect.EstimatedRows(plan); ok {
+			return n, false, nil
+		}
+		return s.count(ctx, CountCapped, from, args)
+	case CountCapped:
+		row, err := s.aggregate(ctx, fmt.Sprintf("SELECT 1 AS one FROM (%s) c LIMIT %d", from, CountCap+1), args, "COUNT(*) AS total")
+		if err != nil {
+			return 0, false, err
+		}
+		if n := parseInt(row["total"]); n <= CountCap {
+			return n, true, nil
+		}
+		return CountCap, false, nil
+	}
+	row, err := s.aggregate(ctx, from, args, "COUNT(*) AS total")
+	if err != nil {
+		return 0, false, err
+	}
+	return parseInt(row["total"]), true, nil
+}
+
+// emptyCount 没有可查询分片时的总数
+func emptyCount(mode string) (int64, bool) {
+	if mode == CountNone {
+		return -1, false
+	}
+	return 0, true
+}
+
+// source 把一张或多张表按相同条件拼接为 UNION ALL 子查询
+func (s *sqlStore) source(tables []string, columns string, cond builder.Cond) (string, []interface{}, error) {
+	return s.union(tables, func(string) string { return columns }, cond)
+}
+
+// shardPageSource 模型调用日志分页的数据源。分表模式下额外输出记录所在分表名 shard 列用于排序与游标，
+// 游标条件与排序、limit 下推到每个分表，每个分表最多取 limit 条（0 表示不限），避免先合并全部分表再排序；
+// 所有分表都在游标之前时返回空字符串
+func (s *sqlStore) shardPageSource(tables []string, columns string, cond builder.Cond,
+	keys []sortKey, values []interface{}, limit int) (string, []interface{}, error) {
+	if s.shards.Partitioned() {
+		if values != nil {
+			cond = cond.And(keysetCond(keys, values))
+		}
+		return s.source(tables, columns, cond)
+	}
+	parts := make([]string, 0, len(tables))
+	var args []interface{}
+	for _, table := range tables {
+		tableCond := cond
+		if values != nil {
+			after, ok := shardKeysetCond(keys, values, table)
+			if !ok {
+				continue
+			}
+			tableCond = tableCond.And(after)
+		}
+		where, condArgs, err := builder.ToSQL(tableCond)
+		if err != nil {
+			return "", nil, err
+		}
+		part := fmt.Sprintf("SELECT %s, '%s' AS %s FROM %s", columns, table, shardKey, s.engine.Quote(table))
+		if where != "" {
+			part += " WHERE " + where
+		}
+		if limit > 0 {
+			// SQLite 不支持给 UNION ALL 的分支加括号，以子查询承载分支内的排序与 limit
+			part = fmt.Sprintf("SELECT * FROM (%s ORDER BY %s LIMIT %d) b%d", part, orderBy(keys), limit, len(parts))
+		}
+		parts = append(parts, part)
+		args = append(args, s.bindTimes(condArgs)...)
+	}
+	return strings.Join(parts, " UNION ALL "), args, nil
+}
+
+func (s *sqlStore) union(tables []string, columns func(table string) string, cond builder.Cond) (string, []interface{}, error) {
+	where, condArgs, err := builder.ToSQL(cond)
+	if err != nil {
+		return "", nil, err
+	}
+	condArgs = s.bindTimes(condArgs)
+	parts := make([]string, 0, len(tables))
+	args := make([]interface{}, 0, len(condArgs)*len(tables))
+	for _, table := range tables {
+		part := fmt.Sprintf("SELECT %s FROM %s", columns(table), s.engine.Quote(table))
+		if where != "" {
+			part += " WHERE " + where
+		}
+		parts = append(parts, part)
+		args = append(args, condArgs...)
+	}
+	return strings.Join(parts, " UNION ALL "), args, nil
+}
+
+// bindTimes SQLite 以文本保存日期时间，原生 SQL 的 time.Time 参数需转换为相同格式，否则按字符串比较结果不正确
+func (s *sqlStore) bindTimes(args []interface{}) []interface{} {
+	if s.dialect.Name() != DialectSQLite {
+		return args
+	}
+	for i, arg := range args {
+		if t, ok := arg.(time.Time); ok {
+			args[i] = t.In(s.engine.GetTZDatabase()).Format(time.DateTime)
+		}
+	}
+	return args
+}
+
+// aggregate 在子查询 from 上执行聚合表达式，返回单行结果
+func (s *sqlStore) aggregate(ctx context.Context, from string, args []interface{}, exprs ...string) (map[string]string, error) {
+	query := "SELECT " + strings.Join(exprs, ", ") + " FROM (" + from + ") t"
+	rows, err := s.reader(ctx).Context(ctx).QueryString(append([]interface{}{query}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return map[string]string{}, nil
+	}
+	return rows[0], nil
+}
+
+// percentiles 计算 percentileFractions 对应的分位值
+func (s *sqlStore) percentiles(ctx context.Context, column, from string, args []interface{}) ([]float64, error) {
+	values := make([]float64, len(percentileFractions))
+	for i, p := range percentileFractions {
+		rows, err := s.reader(ctx).Context(ctx).QueryString(append([]interface{}{s.dialect.Percentile(column, from, p)}, args...)...)
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) > 0 {
+			values[i] = parseFloat(rows[0]["value"])
+		}
+	}
+	return values, nil
+}
+
+func parseInt(v string) int64 {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		// 部分驱动把整数聚合结果返回为小数形式
+		return int64(parseFloat(v))
+	}
+	return n
+}
+
+func parseFloat(v string) float64 {
+	f, _ := strconv.ParseFloat(v, 64)
+	return f
+}
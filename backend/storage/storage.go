@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/stardustagi/TopLib/libs/databases"
+	"github.com/stardustagi/TopLib/utils"
+	"github.com/stardustagi/TopModelsLogs/models"
+	"xorm.io/xorm"
+	"xorm.io/xorm/names"
+
+	_ "modernc.org/sqlite"
+)
+
+var (
+	config   *Config
+	engine   databases.DBInterface
+	dialect  Dialect
+	shards   *ShardManager
+	store    LogStore
+	spooler  *SpoolStore
+	replicas *ReplicaSet
+	keys     *KeyStore
+	callers  *CallerKeyStore
+	roles    *RoleStore
+	audits   *AuditStore
+	chain    *HashChain
+	// encryptor 开启字段加密时的加密存储，用于后台重新加密
+	encryptor *EncryptStore
+)
+
+// Init 准备数据库连接、方言、分片管理器与日志存储
+// database 模式复用 databases.Init 创建的连接，并按 databaseConfig（[mysql]）的 slaves 配置读写分离；
+// sqlite 模式自行打开嵌入式数据库
+func Init(c *Config, databaseConfig []byte) error {
+	// 倒排索引保存明文词项，与字段加密同时开启会在索引表中留下密文列的内容
+	if c.Encryption.Enabled && c.Search.Enabled {
+		return errors.New("storage.search cannot be enabled together with storage.encryption")
+	}
+	var e databases.DBInterface
+	switch c.Mode {
+	case ModeDatabase:
+		e = databases.GetMySqlDB()
+		if e == nil {
+			return errors.New("database is not initialized")
+		}
+	case ModeSQLite:
+		var err error
+		if e, err = openSQLite(c.SQLitePath); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported storage mode: %s", c.Mode)
+	}
+
+	d, err := NewDialect(string(e.Dialect().URI().DBType))
+	if err != nil {
+		return err
+	}
+	m, err := NewShardManager(e, d, c.ShardMode)
+	if err != nil {
+		return err
+	}
+	var rs *ReplicaSet
+	if c.Mode == ModeDatabase && len(databaseConfig) > 0 {
+		if rs, err = initReplicas(e, databaseConfig, c.Replica); err != nil {
+			return err
+		}
+	}
+	config, engine, dialect, shards, replicas = c, e, d, m, rs
+	if store, err = NewSQLStore(e, d, m, rs, c.Search); err != nil {
+		return err
+	}
+	if keys, err = NewKeyStore(e); err != nil {
+		return err
+	}
+	if callers, err = NewCallerKeyStore(e); err != nil {
+		return err
+	}
+	if roles, err = NewRoleStore(e); err != nil {
+		return err
+	}
+	if c.Audit.Enabled {
+		if audits, err = NewAuditStore(e); err != nil {
+			return err
+		}
+	}
+	if c.HashChain.Enabled {
+		if chain, err = NewHashChain(e, m, c.HashChain); err != nil {
+			return err
+		}
+	}
+
+	if c.Spool.Enabled {
+		spool, err := OpenSpool(c.Spool.Dir, c.Spool.SegmentMB<<20, c.Spool.MaxMB<<20)
+		if err != nil {
+			return err
+		}
+		spooler = NewSpoolStore(store, spool, func(ctx context.Context) error {
+			return e.Context(ctx).Ping()
+		})
+		store = spooler
+	}
+	// 在本地缓冲之前加密，缓冲文件中只有密文
+	if c.Encryption.Enabled {
+		keyring, err := OpenKeyring(c.Encryption.Keyring)
+		if err != nil {
+			return err
+		}
+		if encryptor, err = NewEncryptStore(store, keyring, c.Encryption, e, m); err != nil {
+			return err
+		}
+		store = encryptor
+	}
+	if c.Guard.Enabled {
+		store = NewGuardStore(store, c.Guard)
+	}
+	// 在加密与本地缓冲之前脱敏，缓冲文件中同样不含敏感内容
+	if c.Redact.Enabled {
+		redactor, err := NewRedactor(c.Redact)
+		if err != nil {
+			return err
+		}
+		store = NewRedactStore(store, redactor)
+	}
+	store = NewMaskStore(store)
+	return nil
+}
+
+func initReplicas(primary databases.DBInterface, databaseConfig []byte, c ReplicaConfig) (*ReplicaSet, error) {
+	dbConfig, err := utils.Bytes2Struct[*databases.Config](databaseConfig)
+	if err != nil {
+		return nil, err
+	}
+	if !dbConfig.UseMasterSlave || len(dbConfig.Slaves) == 0 {
+		return nil, nil
+	}
+	engines, err := openReplicas(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplicaSet(primary, engines,
+		time.Duration(c.MaxLagMs)*time.Millisecond, time.Duration(c.CheckIntervalMs)*time.Millisecond)
+}
+
+// openSQLite 打开嵌入式数据库，SQLite 只允许单写，连接数限制为 1
+func openSQLite(path string) (databases.DBInterface, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	e, err := xorm.NewEngine("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	e.SetMapper(names.GonicMapper{})
+	e.SetMaxOpenConns(1)
+	return e, nil
+}
+
+// Close 关闭本地缓冲、嵌入式数据库与进程内 Redis，database 模式的连接由 databases 管理
+func Close() {
+	if spooler != nil {
+		_ = spooler.Spool().Close()
+	}
+	if config != nil && config.Embedded() && engine != nil {
+		if e, ok := engine.(*xorm.Engine); ok {
+			_ = e.Close()
+		}
+	}
+	stopEmbeddedRedis()
+}
+
+// GetConfig 获取存储配置
+func GetConfig() *Config {
+	return config
+}
+
+// WidenColumns 加宽旧版本建表时的列，保证加密后变长的密文能够写入：MySQL 的 TEXT 最大 64KB，
+// api_log 的请求体与响应体改为 MEDIUMTEXT。xorm 同步表结构时只会把 VARCHAR 改为 TEXT（status_message 因此自动加宽），
+// 不会把 TEXT 改为 MEDIUMTEXT；PostgreSQL 与 SQLite 的 TEXT 没有长度限制
+func WidenColumns() error {
+	if dialect == nil || dialect.Name() != DialectMySQL {
+		return nil
+	}
+	table := models.ApiLog{}.TableName()
+	rows, err := engine.QueryString("SELECT column_name AS name, data_type AS type FROM information_schema.columns "+
+		"WHERE table_schema = DATABASE() AND table_name = ? AND column_name IN ('request_body', 'response_body')", table)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if !strings.EqualFold(row["type"], "text") {
+			continue
+		}
+		ddl := fmt.Sprintf("ALTER TABLE %s MODIFY %s MEDIUMTEXT", engine.Quote(table), engine.Quote(row["name"]))
+		if _, err = engine.Exec(ddl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetEngine 获取当前数据库连接
+func GetEngine() databases.DBInterface {
+	return engine
+}
+
+// GetDialect 获取当前数据库方言
+func GetDialect() Dialect {
+	return dialect
+}
+
+// GetShardManager 获取模型调用日志分片管理器
+func GetShardManager() *ShardManager {
+	return shards
+}
+
+// GetStore 获取日志存储
+func GetStore() LogStore {
+	return store
+}
+
+// GetReplicaSet 获取读写分离，未配置从库时返回 nil
+func GetReplicaSet() *ReplicaSet {
+	return replicas
+}
+
+// GetKeyStore 获取服务密钥存储
+func GetKeyStore() *KeyStore {
+	return keys
+}
+
+// GetCallerKeyStore 获取客户端 key 归属关系存储
+func GetCallerKeyStore() *CallerKeyStore {
+	return callers
+}
+
+// GetEncryptStore 获取字段加密存储，未开启时返回 nil
+func GetEncryptStore() *EncryptStore {
+	return encryptor
+}
+
+// GetRoleStore 获取角色存储
+func GetRoleStore() *RoleStore {
+	return roles
+}
+
+// GetAuditStore 获取审计记录存储，未启用时返回 nil
+func GetAuditStore() *AuditStore {
+	return audits
+}
+
+// GetHashChain 获取哈希链，未启用时返回 nil
+func GetHashChain() *HashChain {
+	return chain
+}
+
+// GetSpoolStore 获取本地缓冲，未启用时返回 nil
+func GetSpoolStore() *SpoolStore {
+	return spooler
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/stardustagi/TopModelsLogs/models"
+)
+
+var (
+	// ErrNotFound 日志不存在
+	ErrNotFound = errors.New("log not found")
+	// ErrAmbiguousId 分表模式下各日分表的自增ID独立，未指定日期时多个日分表存在同一ID
+	ErrAmbiguousId = errors.New("call log id exists in several daily shards, specify created_at")
+)
+
+// LogStore 日志存储接口，屏蔽具体数据库与分片细节
+type LogStore interface {
+	InsertApiLog(ctx context.Context, log *models.ApiLog) error
+	ListApiLogs(ctx context.Context, filter ApiLogFilter, page Page) (*PageResult[models.ApiLog], error)
+	GetApiLog(ctx context.Context, id int64) (*models.ApiLog, error)
+	ApiLogStats(ctx context.Context, filter ApiLogFilter) (*ApiLogStats, error)
+
+	InsertModelTrainingLog(ctx context.Context, log *models.ModelTrainingLog) error
+	ListModelTrainingLogs(ctx context.Context, filter ModelTrainingLogFilter, page Page) (*PageResult[models.ModelTrainingLog], error)
+	GetModelTrainingLog(ctx context.Context, id int64) (*models.ModelTrainingLog, error)
+	ModelTrainingLogStats(ctx context.Context, filter ModelTrainingLogFilter) (*ModelTrainingLogStats, error)
+
+	InsertStatusReport(ctx context.Context, report *models.StatusReport) error
+	ListStatusReports(ctx context.Context, filter StatusReportFilter, page Page) (*PageResult[models.StatusReport], error)
+	// GetStatusReport 日分表的自增ID按天重复，day 非零时只在当天分片中查找，
+	// 否则查找全部分片，多个分片存在该ID时返回 ErrAmbiguousId
+	GetStatusReport(ctx context.Context, id uint64, day time.Time) (*models.StatusReport, error)
+	StatusReportStats(ctx context.Context, filter StatusReportFilter) (*CallLogStats, error)
+
+	// SearchApiLogs 全文检索 API 日志的请求体与响应体
+	SearchApiLogs(ctx context.Context, q SearchQuery) (*SearchResult[models.ApiLog], error)
+	// SearchStatusReports 全文检索模型调用日志的 StatusMessage
+	SearchStatusReports(ctx context.Context, q SearchQuery) (*SearchResult[models.StatusReport], error)
+
+	// ApiLogFacets 等统计各字段的取值分布，fields 只允许各日志类型白名单内的维度列
+	ApiLogFacets(ctx context.Context, filter ApiLogFilter, fields []string) (map[string]*Facet, error)
+	ModelTrainingLogFacets(ctx context.Context, filter ModelTrainingLogFilter, fields []string) (map[string]*Facet, error)
+	StatusReportFacets(ctx context.Context, filter StatusReportFilter, fields []string) (map[string]*Facet, error)
+
+	// ApiLogHistogram 等按时间分桶统计条数，过滤条件中的时间范围必须指定
+	ApiLogHistogram(ctx context.Context, filter ApiLogFilter, q HistogramQuery) (*Histogram, error)
+	ModelTrainingLogHistogram(ctx context.Context, filter ModelTrainingLogFilter, q HistogramQuery) (*Histogram, error)
+	StatusReportHistogram(ctx context.Context, filter StatusReportFilter, q HistogramQuery) (*Histogram, error)
+
+	// PurgeBefore 清理 before 之前的日志，模型调用日志按整天分片删除
+	PurgeBefore(ctx context.Context, before time.Time) (*PurgeResult, error)
+}
+
+// Page 分页与排序
+// Sort 只允许各日志类型白名单内的列；排序末尾会自动补充 id 保证顺序稳定
+// Cursor 非空时按游标（keyset）翻页并忽略 Skip
+type Page struct {
+	Skip      int
+	Limit     int
+	Sort      []SortField
+	Cursor    string
+	CountMode string   // exact / approx / capped / none，空为 exact
+	Fields    []string // 返回的列，空时不含请求体、响应体等大字段，id 总是返回
+}
+
+// ApiLogFilter API日志过滤条件，时间为 created_at 原值，0 表示不限
+type ApiLogFilter struct {
+	UserId    int64
+	ApiPath   string
+	StartTime int64
+	EndTime   int64
+	Expr      *Expr // 过滤表达式，与其它条件取 and
+}
+
+// ModelTrainingLogFilter 模型训练日志过滤条件
+type ModelTrainingLogFilter struct {
+	UserId    int64
+	ModelId   int64
+	Status    string
+	LogLevel  string
+	StartTime int64
+	EndTime   int64
+	Expr      *Expr
+}
+
+// StatusReportFilter 模型调用日志过滤条件，零值时间表示不限
+type StatusReportFilter struct {
+	UserId           int64
+	TraceId          string
+	Model            string
+	CallerKey        string
+	Step             string
+	ActualProviderId string
+	StartTime        time.Time
+	EndTime          time.Time
+	Expr             *Expr
+}
+
+// ApiLogStats API日志统计
+type ApiLogStats struct {
+	Total       int64
+	Failed      int64 // status_code >= 400
+	AvgDuration float64
+	P50Duration float64
+	P95Duration float64
+	P99Duration float64
+}
+
+// ModelTrainingLogStats 模型训练日志统计
+type ModelTrainingLogStats struct {
+	Total       int64
+	Errors      int64 // log_level = error
+	AvgLoss     float64
+	MinLoss     float64
+	MaxAccuracy float64
+	MaxEpoch    int64
+}
+
+// CallLogStats 模型调用日志统计
+type CallLogStats struct {
+	Total           int64
+	Failed          int64 // status_code 非空
+	AvgLatency      float64
+	AvgTokensPerSec float64
+	P50Latency      float64
+	P95Latency      float64
+	P99Latency      float64
+}
+
+// PurgeResult 日志清理结果
+type PurgeResult struct {
+	ApiLogs       int64
+	TrainingLogs  int64
+	DroppedShards []string
+}
+
+// percentileFractions 统计接口输出的分位点
+var percentileFractions = []float64{0.5, 0.95, 0.99}
@@ -5,8 +5,13 @@ import (
 )
 
 var (
-	ErrInternalServer = topError.New("Internal server error", 500)
-	ErrInvalidParams  = topError.New("无效的请求参数", 501)
-	ErrNotDataSet     = topError.New("数据不存在", 1001)
-	ErrAuthFailed     = topError.New("认证失败", 1002)
+	ErrInternalServer   = topError.New("Internal server error", 500)
+	ErrInvalidParams    = topError.New("无效的请求参数", 501)
+	ErrNotDataSet       = topError.New("数据不存在", 1001)
+	ErrAuthFailed       = topError.New("认证失败", 1002)
+	ErrNotEnabled       = topError.New("功能未开启", 1003)
+	ErrQueryLimited     = topError.New("查询超出限制", 1004)
+	ErrPermissionDenied = topError.New("权限不足", 1005)
+	ErrRateLimited      = topError.New("请求过于频繁", 1006)
+	ErrQuotaExceeded    = topError.New("超出每日写入配额", 1007)
 )
@@ -1,16 +1,20 @@
 package main
 
 import (
+	"os"
+
 	"github.com/stardustagi/TopLib/libs/conf"
 	"github.com/stardustagi/TopLib/libs/databases"
 	"github.com/stardustagi/TopLib/libs/logs"
 	"github.com/stardustagi/TopLib/libs/redis"
 	"github.com/stardustagi/TopModelsLogs/backend"
 	"github.com/stardustagi/TopModelsLogs/backend/service"
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
 	"github.com/stardustagi/TopModelsLogs/constants"
 
 	_ "github.com/stardustagi/TopModelsLogs/docs"
 	echoSwagger "github.com/swaggo/echo-swagger"
+	"go.uber.org/zap"
 )
 
 // @title TopModelsLogs API
@@ -25,11 +29,38 @@ func main() {
 	logs.Init(loggerConfig)
 	logger := logs.GetLogger("main")
 	logger.Info("Init logs")
-	_, _ = databases.Init(conf.Get("mysql"))
-	logger.Info("Init mysql")
-	_, _ = redis.Init(conf.Get("redis"))
+	storageConfig, err := storage.LoadConfig(conf.Get("storage"))
+	if err != nil {
+		panic(err)
+	}
+	if !storageConfig.Embedded() {
+		_, _ = databases.Init(conf.Get("mysql"))
+		logger.Info("Init mysql")
+	}
+	if err = storage.Init(storageConfig, conf.Get("mysql")); err != nil {
+		panic(err)
+	}
+	defer storage.Close()
+	logger.Info("Init storage", zap.String("mode", storageConfig.Mode))
+	if len(os.Args) > 1 && os.Args[1] == "verify-chain" {
+		code := verifyChain(os.Args[2:])
+		storage.Close()
+		os.Exit(code)
+	}
+	redisConfig := conf.Get("redis")
+	if redisConfig == nil && storageConfig.Embedded() {
+		// 单机模式未配置 Redis 时使用进程内替身
+		if redisConfig, err = storage.StartEmbeddedRedis(); err != nil {
+			panic(err)
+		}
+		logger.Info("Start embedded redis")
+	}
+	_, _ = redis.Init(redisConfig)
 	logger.Info("Init redis")
 
+	if err = backend.InitAuth(conf.Get("auth")); err != nil {
+		panic(err)
+	}
 	app := backend.NewApplication(conf.Get("websrv"))
 	// 添加swagger
 	app.AddNativeHandler("GET", "/swagger/*", echoSwagger.WrapHandler)
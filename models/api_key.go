@@ -0,0 +1,46 @@
+package models
+
+import "strings"
+
+// ApiKey 服务密钥，网关与训练节点以密钥代替用户 JWT 上报日志
+// 明文密钥为 tml_<key_id>_<secret>，只保存 secret 的哈希
+type ApiKey struct {
+	Id             int64  `json:"id" xorm:"'id' pk autoincr BIGINT(20)"`
+	KeyId          string `json:"key_id" xorm:"'key_id' not null unique VARCHAR(32) comment('密钥标识，明文密钥中的前缀部分')"`
+	Name           string `json:"name" xorm:"'name' not null default '' VARCHAR(64)"`
+	UserId         int64  `json:"user_id" xorm:"'user_id' not null default 0 BIGINT(20) index comment('密钥所属用户')"`
+	Scopes         string `json:"scopes" xorm:"'scopes' not null default '' VARCHAR(255) comment('权限，逗号分隔，如 ingest:call,read:*')"`
+	AllowedIps     string `json:"allowed_ips" xorm:"'allowed_ips' not null default '' VARCHAR(1024) comment('允许的来源IP或CIDR，逗号分隔，空为不限')"`
+	SecretHash     string `json:"secret_hash" xorm:"'secret_hash' not null VARCHAR(64)"`
+	PrevSecretHash string `json:"prev_secret_hash" xorm:"'prev_secret_hash' not null default '' VARCHAR(64) comment('轮换前的密钥哈希')"`
+	PrevExpiresAt  int64  `json:"prev_expires_at" xorm:"'prev_expires_at' not null default 0 BIGINT(20) comment('轮换前的密钥失效时间，秒')"`
+	ExpiresAt      int64  `json:"expires_at" xorm:"'expires_at' not null default 0 BIGINT(20) comment('过期时间，秒，0 为不过期')"`
+	RevokedAt      int64  `json:"revoked_at" xorm:"'revoked_at' not null default 0 BIGINT(20) comment('吊销时间，秒，0 为有效')"`
+	CreatedBy      int64  `json:"created_by" xorm:"'created_by' not null default 0 BIGINT(20)"`
+	CreatedAt      int64  `json:"created_at" xorm:"'created_at' not null default 0 BIGINT(20)"`
+	UpdatedAt      int64  `json:"updated_at" xorm:"'updated_at' not null default 0 BIGINT(20)"`
+}
+
+func (ApiKey) TableName() string {
+	return "api_key"
+}
+
+// ScopeList 权限列表
+func (k *ApiKey) ScopeList() []string {
+	return splitList(k.Scopes)
+}
+
+// IpList 允许的来源IP或CIDR，空为不限
+func (k *ApiKey) IpList() []string {
+	return splitList(k.AllowedIps)
+}
+
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,22 @@
+package models
+
+// AuditEvent 日志数据访问审计记录，只追加，按 [storage.audit] 的保留天数单独清理
+type AuditEvent struct {
+	Id          int64  `json:"id" xorm:"'id' pk autoincr BIGINT(20)"`
+	UserId      int64  `json:"user_id" xorm:"'user_id' not null default 0 index BIGINT(20) comment('调用方用户，未绑定用户的服务密钥为 0')"`
+	KeyId       string `json:"key_id" xorm:"'key_id' not null default '' VARCHAR(64) comment('服务密钥标识，JWT 用户为空')"`
+	Action      string `json:"action" xorm:"'action' not null default '' index VARCHAR(64) comment('接口名，如 getApiLogList')"`
+	Scope       string `json:"scope" xorm:"'scope' not null default '' VARCHAR(64) comment('接口所需权限')"`
+	Filters     string `json:"filters" xorm:"'filters' TEXT comment('请求参数，超过上限时截断')"`
+	ResultCount int64  `json:"result_count" xorm:"'result_count' not null default 0 BIGINT(20) comment('返回或删除的记录数')"`
+	ErrCode     int    `json:"errcode" xorm:"'errcode' not null default 0 INT(11)"`
+	HttpStatus  int    `json:"http_status" xorm:"'http_status' not null default 0 INT(11)"`
+	ClientIp    string `json:"client_ip" xorm:"'client_ip' not null default '' VARCHAR(64)"`
+	UserAgent   string `json:"user_agent" xorm:"'user_agent' not null default '' VARCHAR(255)"`
+	DurationMs  int64  `json:"duration_ms" xorm:"'duration_ms' not null default 0 BIGINT(20)"`
+	CreatedAt   int64  `json:"created_at" xorm:"'created_at' not null default 0 index BIGINT(20)"`
+}
+
+func (AuditEvent) TableName() string {
+	return "audit_event"
+}
@@ -0,0 +1,14 @@
+package models
+
+// CallerKeyOwner 客户端 key 的归属用户，模型调用日志未上报 user_id 时据此补全
+type CallerKeyOwner struct {
+	Id        int64  `json:"id" xorm:"'id' pk autoincr BIGINT(20)"`
+	CallerKey string `json:"caller_key" xorm:"'caller_key' not null unique VARCHAR(128) comment('客户端key')"`
+	UserId    int64  `json:"user_id" xorm:"'user_id' not null index BIGINT(20) comment('归属用户')"`
+	CreatedAt int64  `json:"created_at" xorm:"'created_at' not null default 0 BIGINT(20)"`
+	UpdatedAt int64  `json:"updated_at" xorm:"'updated_at' not null default 0 BIGINT(20)"`
+}
+
+func (CallerKeyOwner) TableName() string {
+	return "caller_key_owner"
+}
@@ -0,0 +1,30 @@
+package models
+
+// ChainHead 哈希链的链头，每条链（API 日志表或模型调用日志日分片）一行，入链时按 seq 比较更新
+type ChainHead struct {
+	Chain     string `json:"chain" xorm:"'chain' pk VARCHAR(64) comment('表名')"`
+	Seq       int64  `json:"seq" xorm:"'seq' not null default 0 BIGINT(20)"`
+	RowId     int64  `json:"row_id" xorm:"'row_id' not null default 0 BIGINT(20)"`
+	Hash      string `json:"hash" xorm:"'hash' not null default '' VARCHAR(64)"`
+	UpdatedAt int64  `json:"updated_at" xorm:"'updated_at' not null default 0 BIGINT(20)"`
+}
+
+func (ChainHead) TableName() string {
+	return "chain_head"
+}
+
+// ChainCheckpoint 签名的哈希链检查点
+type ChainCheckpoint struct {
+	Id        int64  `json:"id" xorm:"'id' pk autoincr BIGINT(20)"`
+	Chain     string `json:"chain" xorm:"'chain' not null unique(chain_seq) VARCHAR(64)"`
+	Seq       int64  `json:"seq" xorm:"'seq' not null unique(chain_seq) BIGINT(20)"`
+	RowId     int64  `json:"row_id" xorm:"'row_id' not null default 0 BIGINT(20)"`
+	Hash      string `json:"hash" xorm:"'hash' not null default '' VARCHAR(64)"`
+	KeyId     string `json:"key_id" xorm:"'key_id' not null default '' VARCHAR(64) comment('签名密钥ID')"`
+	Signature string `json:"signature" xorm:"'signature' not null default '' VARCHAR(128) comment('Ed25519 签名，base64')"`
+	CreatedAt int64  `json:"created_at" xorm:"'created_at' not null default 0 BIGINT(20)"`
+}
+
+func (ChainCheckpoint) TableName() string {
+	return "chain_checkpoint"
+}
@@ -6,13 +6,18 @@ type ApiLog struct {
 	UserId       int64  `json:"user_id" xorm:"'user_id' BIGINT(20) index"`
 	ApiPath      string `json:"api_path" xorm:"'api_path' VARCHAR(255) index"`
 	Method       string `json:"method" xorm:"'method' VARCHAR(10)"`
-	RequestBody  string `json:"request_body" xorm:"'request_body' TEXT"`
-	ResponseBody string `json:"response_body" xorm:"'response_body' TEXT"`
+	RequestBody  string `json:"request_body" xorm:"'request_body' MEDIUMTEXT"`
+	ResponseBody string `json:"response_body" xorm:"'response_body' MEDIUMTEXT"`
 	StatusCode   int    `json:"status_code" xorm:"'status_code' INT(10)"`
 	Duration     int64  `json:"duration" xorm:"'duration' BIGINT(20) comment('请求耗时，毫秒')"`
 	ClientIP     string `json:"client_ip" xorm:"'client_ip' VARCHAR(50)"`
 	UserAgent    string `json:"user_agent" xorm:"'user_agent' VARCHAR(500)"`
 	CreatedAt    int64  `json:"created_at" xorm:"'created_at' BIGINT(20) index"`
+	EncKeyId     string `json:"enc_key_id" xorm:"'enc_key_id' not null default '' VARCHAR(32) index comment('加密数据密钥的主密钥ID，未加密为空')"`
+	EncDataKey   string `json:"enc_data_key" xorm:"'enc_data_key' not null default '' VARCHAR(128) comment('主密钥加密后的数据密钥')"`
+	ChainSeq     int64  `json:"chain_seq" xorm:"'chain_seq' not null default 0 index BIGINT(20) comment('哈希链序号，0 为尚未入链')"`
+	ChainPrev    string `json:"chain_prev" xorm:"'chain_prev' not null default '' VARCHAR(64) comment('链上前一行的哈希')"`
+	ChainHash    string `json:"chain_hash" xorm:"'chain_hash' not null default '' VARCHAR(64) comment('SHA-256(chain_prev + 规范化的行内容)')"`
 }
 
 func (ApiLog) TableName() string {
@@ -0,0 +1,39 @@
+package models
+
+// Role 角色：一组接口权限与需要隐藏的字段
+type Role struct {
+	Id          int64  `json:"id" xorm:"'id' pk autoincr BIGINT(20)"`
+	Name        string `json:"name" xorm:"'name' not null unique VARCHAR(64)"`
+	Description string `json:"description" xorm:"'description' not null default '' VARCHAR(255)"`
+	Scopes      string `json:"scopes" xorm:"'scopes' not null default '' VARCHAR(1024) comment('权限，逗号分隔，如 read:api,stats:*')"`
+	MaskFields  string `json:"mask_fields" xorm:"'mask_fields' not null default '' VARCHAR(512) comment('隐藏的字段，逗号分隔，如 request_body,response_body')"`
+	CreatedAt   int64  `json:"created_at" xorm:"'created_at' not null default 0 BIGINT(20)"`
+	UpdatedAt   int64  `json:"updated_at" xorm:"'updated_at' not null default 0 BIGINT(20)"`
+}
+
+func (Role) TableName() string {
+	return "role"
+}
+
+// ScopeList 权限列表
+func (r *Role) ScopeList() []string {
+	return splitList(r.Scopes)
+}
+
+// MaskList 隐藏的字段列表
+func (r *Role) MaskList() []string {
+	return splitList(r.MaskFields)
+}
+
+// UserRole 用户与角色的绑定
+type UserRole struct {
+	Id        int64 `json:"id" xorm:"'id' pk autoincr BIGINT(20)"`
+	UserId    int64 `json:"user_id" xorm:"'user_id' not null unique(user_role) BIGINT(20)"`
+	RoleId    int64 `json:"role_id" xorm:"'role_id' not null unique(user_role) index BIGINT(20)"`
+	CreatedBy int64 `json:"created_by" xorm:"'created_by' not null default 0 BIGINT(20)"`
+	CreatedAt int64 `json:"created_at" xorm:"'created_at' not null default 0 BIGINT(20)"`
+}
+
+func (UserRole) TableName() string {
+	return "user_role"
+}
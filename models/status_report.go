@@ -10,13 +10,14 @@ type StatusReport struct {
 	Id               uint64    `json:"id" xorm:"'id' not null pk autoincr comment('主键ID') UNSIGNED BIGINT(20)"`
 	TraceId          string    `json:"trace_id" xorm:"'trace_id' not null default '' comment('跟踪ID') index VARCHAR(64)"`
 	NodeAddr         string    `json:"node_addr" xorm:"'node_addr' not null default '' comment('LLM代理地址') VARCHAR(128)"`
+	NodeId           string    `json:"node_id" xorm:"'node_id' not null default '' comment('签名校验通过的LLM代理节点，未签名上报时为空') VARCHAR(64)"`
 	Model            string    `json:"model" xorm:"'model' not null default '' comment('模型名字') index VARCHAR(64)"`
 	ModelId          int       `json:"model_id" xorm:"'model_id' not null default 0 comment('模型ID（计费使用）') INT(11)"`
 	ActualModel      string    `json:"actual_model" xorm:"'actual_model' not null default '' comment('实际使用的模型') VARCHAR(64)"`
 	Provider         string    `json:"provider" xorm:"'provider' not null default '' comment('虚拟provider') VARCHAR(64)"`
 	ActualProvider   string    `json:"actual_provider" xorm:"'actual_provider' not null default '' comment('实际服务商') VARCHAR(64)"`
 	ActualProviderId string    `json:"actual_provider_id" xorm:"'actual_provider_id' not null default '' comment('实际服务商ID') VARCHAR(64)"`
-	UserId           int64     `json:"user_id"` //用户id
+	UserId           int64     `json:"user_id" xorm:"'user_id' not null default 0 comment('用户ID，未上报时按 caller_key 归属补全') index BIGINT(20)"`
 	CallerKey        string    `json:"caller_key" xorm:"'caller_key' not null default '' comment('客户端key') index VARCHAR(128)"`
 	Stream           int       `json:"stream" xorm:"'stream' not null default 0 comment('是否流式访问：0-否，1-是') TINYINT(1)"`
 	ReportType       string    `json:"report_type" xorm:"'report_type' not null default '' comment('报告类型：text/image/video') VARCHAR(16)"`
@@ -24,8 +25,13 @@ type StatusReport struct {
 	Latency          string    `json:"latency" xorm:"'latency' not null default 0.0000 comment('请求延迟（秒）') DECIMAL(10,4)"`
 	Step             string    `json:"step" xorm:"'step' not null default '' comment('调用环节：call_llm_agent/check_user_balance/select_provider/send_llm_request/send_llm_completed/llm_agent_done/user_agent_done') index VARCHAR(32)"`
 	StatusCode       string    `json:"status_code" xorm:"'status_code' not null default '' comment('状态码（非空为失败）') VARCHAR(16)"`
-	StatusMessage    string    `json:"status_message" xorm:"'status_message' not null default '' comment('状态消息（状态码非空时有值）') VARCHAR(512)"`
-	CreatedAt        time.Time `json:"created_at" xorm:"'created_at' not null default current_timestamp() comment('请求时间') index DATETIME"`
+	StatusMessage    string    `json:"status_message" xorm:"'status_message' not null comment('状态消息（状态码非空时有值）') TEXT"`
+	CreatedAt        time.Time `json:"created_at" xorm:"'created_at' not null default CURRENT_TIMESTAMP comment('请求时间') index DATETIME"`
+	EncKeyId         string    `json:"enc_key_id" xorm:"'enc_key_id' not null default '' comment('加密数据密钥的主密钥ID，未加密为空') VARCHAR(32)"`
+	EncDataKey       string    `json:"enc_data_key" xorm:"'enc_data_key' not null default '' comment('主密钥加密后的数据密钥') VARCHAR(128)"`
+	ChainSeq         int64     `json:"chain_seq" xorm:"'chain_seq' not null default 0 comment('哈希链序号，0 为尚未入链') index BIGINT(20)"`
+	ChainPrev        string    `json:"chain_prev" xorm:"'chain_prev' not null default '' comment('链上前一行的哈希') VARCHAR(64)"`
+	ChainHash        string    `json:"chain_hash" xorm:"'chain_hash' not null default '' comment('SHA-256(chain_prev + 规范化的行内容)') VARCHAR(64)"`
 }
 
 func (o *StatusReport) TableName() string {
@@ -47,7 +53,11 @@ func (o *StatusReport) GetSliceDateMonthTable() string {
 }
 
 func (o *StatusReport) GetSliceDateDayTable() string {
-	t := time.Now()
+	return o.GetSliceDateDayTableByTime(time.Now())
+}
+
+// GetSliceDateDayTableByTime 获取指定时间所在日的分表表名
+func (o *StatusReport) GetSliceDateDayTableByTime(t time.Time) string {
 	return fmt.Sprintf("status_report_%d%02d%02d", t.Year(), t.Month(), t.Day())
 }
 
@@ -1,10 +1,18 @@
 package requests
 
+// SortReq 排序列与方向
+type SortReq struct {
+	Field string `json:"field"` // 只允许各日志类型带索引的列
+	Order string `json:"order"` // asc / desc，默认 asc
+}
+
 // PageReq 分页请求
 type PageReq struct {
-	Skip  int    `json:"skip"`
-	Limit int    `json:"limit"`
-	Sort  string `json:"sort"`
+	Skip      int       `json:"skip"`
+	Limit     int       `json:"limit"`
+	Sort      []SortReq `json:"sort"`                                                           // 按顺序排序，最多 3 列
+	Cursor    string    `json:"cursor"`                                                         // 上一页返回的 next_cursor，非空时忽略 skip
+	CountMode string    `json:"count_mode" validate:"omitempty,oneof=exact approx capped none"` // 总数计算方式，默认 exact
 }
 
 // CreateApiLogReq 创建API日志请求
@@ -23,11 +31,15 @@ type CreateApiLogReq struct {
 
 // GetApiLogListReq 获取API日志列表请求
 type GetApiLogListReq struct {
-	PageInfo  PageReq `json:"page_info"`
-	UserId    int64   `json:"user_id"`
-	ApiPath   string  `json:"api_path"`
-	StartTime int64   `json:"start_time"`
-	EndTime   int64   `json:"end_time"`
+	PageInfo  PageReq  `json:"page_info"`
+	UserId    int64    `json:"user_id"`
+	ApiPath   string   `json:"api_path"`
+	StartTime int64    `json:"start_time"`
+	EndTime   int64    `json:"end_time"`
+	Filter    string   `json:"filter"`   // 过滤表达式，如 status_code >= 500 and api_path like "/v1/%"
+	Fields    []string `json:"fields"`   // 返回的列，默认不含 request_body、response_body，需要时显式选择或查看详情
+	Explain   bool     `json:"explain"`  // 试运行，只返回生成的查询语句与执行计划
+	NoCache   bool     `json:"no_cache"` // 不读取也不写入查询结果缓存
 }
 
 // GetApiLogDetailReq 获取API日志详情请求
@@ -52,13 +64,17 @@ type CreateModelTrainingLogReq struct {
 
 // GetModelTrainingLogListReq 获取模型训练日志列表请求
 type GetModelTrainingLogListReq struct {
-	PageInfo  PageReq `json:"page_info"`
-	UserId    int64   `json:"user_id"`
-	ModelId   int64   `json:"model_id"`
-	Status    string  `json:"status"`
-	LogLevel  string  `json:"log_level"`
-	StartTime int64   `json:"start_time"`
-	EndTime   int64   `json:"end_time"`
+	PageInfo  PageReq  `json:"page_info"`
+	UserId    int64    `json:"user_id"`
+	ModelId   int64    `json:"model_id"`
+	Status    string   `json:"status"`
+	LogLevel  string   `json:"log_level"`
+	StartTime int64    `json:"start_time"`
+	EndTime   int64    `json:"end_time"`
+	Filter    string   `json:"filter"`   // 过滤表达式，如 status = "failed" or loss > 0.5
+	Fields    []string `json:"fields"`   // 返回的列，默认全部，id 总是返回
+	Explain   bool     `json:"explain"`  // 试运行，只返回生成的查询语句与执行计划
+	NoCache   bool     `json:"no_cache"` // 不读取也不写入查询结果缓存
 }
 
 // GetModelTrainingLogDetailReq 获取模型训练日志详情请求
@@ -68,6 +84,7 @@ type GetModelTrainingLogDetailReq struct {
 
 // CreateModelsCallLogReq 创建模型调用日志请求
 type CreateModelsCallLogReq struct {
+	UserId           int64   `json:"user_id"` // 为 0 时按 caller_key 的归属用户补全
 	TraceId          string  `json:"trace_id"`
 	NodeAddr         string  `json:"node_addr"`
 	Model            string  `json:"model"`
@@ -89,17 +106,272 @@ type CreateModelsCallLogReq struct {
 
 // GetModelsCallLogListReq 获取模型调用日志列表请求
 type GetModelsCallLogListReq struct {
-	PageInfo         PageReq `json:"page_info"`
-	TraceId          string  `json:"trace_id"`
-	Model            string  `json:"model"`
-	CallerKey        string  `json:"caller_key"`
-	Step             string  `json:"step"`
-	ActualProviderId string  `json:"actual_provider_id"`
-	StartTime        int64   `json:"start_time"`
-	EndTime          int64   `json:"end_time"`
+	PageInfo         PageReq  `json:"page_info"`
+	UserId           int64    `json:"user_id"`
+	TraceId          string   `json:"trace_id"`
+	Model            string   `json:"model"`
+	CallerKey        string   `json:"caller_key"`
+	Step             string   `json:"step"`
+	ActualProviderId string   `json:"actual_provider_id"`
+	StartTime        int64    `json:"start_time"`
+	EndTime          int64    `json:"end_time"`
+	Filter           string   `json:"filter"`   // 过滤表达式，如 model = "gpt-4o" and latency > 2.5 and status_code != ""
+	Fields           []string `json:"fields"`   // 返回的列，默认全部，id 总是返回
+	Explain          bool     `json:"explain"`  // 试运行，只返回生成的查询语句与执行计划
+	NoCache          bool     `json:"no_cache"` // 不读取也不写入查询结果缓存
 }
 
 // GetModelsCallLogDetailReq 获取模型调用日志详情请求
 type GetModelsCallLogDetailReq struct {
-	Id uint64 `json:"id" validate:"required"`
+	Id        uint64 `json:"id" validate:"required"`
+	CreatedAt int64  `json:"created_at"` // 可选，记录创建时间（秒），用于定位日分表
+}
+
+// GetModelsCallLogStatsReq 获取模型调用日志统计请求
+type GetModelsCallLogStatsReq struct {
+	UserId           int64  `json:"user_id"`
+	Model            string `json:"model"`
+	CallerKey        string `json:"caller_key"`
+	Step             string `json:"step"`
+	ActualProviderId string `json:"actual_provider_id"`
+	StartTime        int64  `json:"start_time"`
+	EndTime          int64  `json:"end_time"`
+	Filter           string `json:"filter"`   // 过滤表达式，语法同列表查询
+	Explain          bool   `json:"explain"`  // 试运行，只返回生成的查询语句与执行计划
+	NoCache          bool   `json:"no_cache"` // 不读取也不写入查询结果缓存
+}
+
+// GetApiLogStatsReq 获取API日志统计请求
+type GetApiLogStatsReq struct {
+	UserId    int64  `json:"user_id"`
+	ApiPath   string `json:"api_path"`
+	StartTime int64  `json:"start_time"`
+	EndTime   int64  `json:"end_time"`
+	Filter    string `json:"filter"`   // 过滤表达式，语法同列表查询
+	Explain   bool   `json:"explain"`  // 试运行，只返回生成的查询语句与执行计划
+	NoCache   bool   `json:"no_cache"` // 不读取也不写入查询结果缓存
+}
+
+// GetModelTrainingLogStatsReq 获取模型训练日志统计请求
+type GetModelTrainingLogStatsReq struct {
+	UserId    int64  `json:"user_id"`
+	ModelId   int64  `json:"model_id"`
+	Status    string `json:"status"`
+	LogLevel  string `json:"log_level"`
+	StartTime int64  `json:"start_time"`
+	EndTime   int64  `json:"end_time"`
+	Filter    string `json:"filter"`   // 过滤表达式，语法同列表查询
+	Explain   bool   `json:"explain"`  // 试运行，只返回生成的查询语句与执行计划
+	NoCache   bool   `json:"no_cache"` // 不读取也不写入查询结果缓存
+}
+
+// PurgeLogsReq 清理过期日志请求
+type PurgeLogsReq struct {
+	RetentionDays int `json:"retention_days"` // 保留天数，0 时使用 [storage] retention_days
+}
+
+// GetMetricsReq 查看服务指标请求
+type GetMetricsReq struct{}
+
+// GetSpoolStatusReq 查看本地缓冲请求
+type GetSpoolStatusReq struct {
+	Limit int `json:"limit"` // 返回最旧的待回放记录条数，0 表示不返回
+}
+
+// SearchLogsReq 全文检索请求
+type SearchLogsReq struct {
+	Query     string `json:"query" validate:"required"` // 检索词，双引号内为短语
+	UserId    int64  `json:"user_id"`
+	StartTime int64  `json:"start_time"` // 秒级时间戳，默认最近 7 天
+	EndTime   int64  `json:"end_time"`
+	Order     string `json:"order"` // relevance（默认）/ time
+	Skip      int    `json:"skip"`
+	Limit     int    `json:"limit"`
+}
+
+// GetApiLogFacetsReq 获取API日志取值分布请求
+type GetApiLogFacetsReq struct {
+	Fields    []string `json:"fields" validate:"required,min=1,max=8"` // api_path / method / status_code
+	UserId    int64    `json:"user_id"`
+	ApiPath   string   `json:"api_path"`
+	StartTime int64    `json:"start_time"` // 秒级时间戳，默认最近 7 个自然日，跨度不超过 31 天
+	EndTime   int64    `json:"end_time"`
+	Filter    string   `json:"filter"`  // 过滤表达式，语法同列表查询
+	Limit     int      `json:"limit"`   // 每个字段返回的取值数，默认 20
+	Explain   bool     `json:"explain"` // 试运行，只返回生成的查询语句与执行计划
+}
+
+// GetModelTrainingLogFacetsReq 获取模型训练日志取值分布请求
+type GetModelTrainingLogFacetsReq struct {
+	Fields    []string `json:"fields" validate:"required,min=1,max=8"` // status / log_level
+	UserId    int64    `json:"user_id"`
+	ModelId   int64    `json:"model_id"`
+	StartTime int64    `json:"start_time"`
+	EndTime   int64    `json:"end_time"`
+	Filter    string   `json:"filter"`
+	Limit     int      `json:"limit"`
+	Explain   bool     `json:"explain"` // 试运行，只返回生成的查询语句与执行计划
+}
+
+// GetModelsCallLogFacetsReq 获取模型调用日志取值分布请求
+type GetModelsCallLogFacetsReq struct {
+	// model / actual_model / provider / actual_provider / step / report_type / node_addr / status_code
+	Fields           []string `json:"fields" validate:"required,min=1,max=8"`
+	UserId           int64    `json:"user_id"`
+	Model            string   `json:"model"`
+	CallerKey        string   `json:"caller_key"`
+	Step             string   `json:"step"`
+	ActualProviderId string   `json:"actual_provider_id"`
+	StartTime        int64    `json:"start_time"`
+	EndTime          int64    `json:"end_time"`
+	Filter           string   `json:"filter"`
+	Limit            int      `json:"limit"`
+	Explain          bool     `json:"explain"` // 试运行，只返回生成的查询语句与执行计划
+}
+
+// GetApiLogHistogramReq 获取API日志时间分布请求，过滤条件同列表查询
+type GetApiLogHistogramReq struct {
+	UserId    int64  `json:"user_id"`
+	ApiPath   string `json:"api_path"`
+	StartTime int64  `json:"start_time"` // 秒级时间戳，默认最近 24 小时
+	EndTime   int64  `json:"end_time"`
+	Filter    string `json:"filter"`
+	Interval  string `json:"interval"` // 分桶间隔，如 30s / 5m / 1h / 1d，为空时按时间范围自动选择
+	SplitBy   string `json:"split_by"` // 拆分维度，如 status_code
+	Explain   bool   `json:"explain"`  // 试运行，只返回生成的查询语句与执行计划
+	NoCache   bool   `json:"no_cache"` // 不读取也不写入查询结果缓存
+}
+
+// GetModelTrainingLogHistogramReq 获取模型训练日志时间分布请求
+type GetModelTrainingLogHistogramReq struct {
+	UserId    int64  `json:"user_id"`
+	ModelId   int64  `json:"model_id"`
+	Status    string `json:"status"`
+	LogLevel  string `json:"log_level"`
+	StartTime int64  `json:"start_time"`
+	EndTime   int64  `json:"end_time"`
+	Filter    string `json:"filter"`
+	Interval  string `json:"interval"`
+	SplitBy   string `json:"split_by"` // 如 log_level
+	Explain   bool   `json:"explain"`  // 试运行，只返回生成的查询语句与执行计划
+	NoCache   bool   `json:"no_cache"` // 不读取也不写入查询结果缓存
+}
+
+// GetModelsCallLogHistogramReq 获取模型调用日志时间分布请求
+type GetModelsCallLogHistogramReq struct {
+	UserId           int64  `json:"user_id"`
+	TraceId          string `json:"trace_id"`
+	Model            string `json:"model"`
+	CallerKey        string `json:"caller_key"`
+	Step             string `json:"step"`
+	ActualProviderId string `json:"actual_provider_id"`
+	StartTime        int64  `json:"start_time"`
+	EndTime          int64  `json:"end_time"`
+	Filter           string `json:"filter"`
+	Interval         string `json:"interval"`
+	SplitBy          string `json:"split_by"` // 如 step / status_code
+	Explain          bool   `json:"explain"`  // 试运行，只返回生成的查询语句与执行计划
+	NoCache          bool   `json:"no_cache"` // 不读取也不写入查询结果缓存
+}
+
+// CreateApiKeyReq 创建服务密钥请求
+type CreateApiKeyReq struct {
+	Name       string   `json:"name" validate:"required,max=64"`
+	UserId     int64    `json:"user_id"`                          // 密钥所属用户
+	Scopes     []string `json:"scopes" validate:"required,min=1"` // ingest:call / ingest:api / ingest:training / read:* 等
+	AllowedIps []string `json:"allowed_ips"`                      // 允许的来源IP或CIDR，空为不限
+	ExpiresAt  int64    `json:"expires_at"`                       // 过期时间（秒），0 为不过期
+}
+
+// GetApiKeyListReq 获取服务密钥列表请求
+type GetApiKeyListReq struct {
+	UserId         int64 `json:"user_id"` // 0 为全部用户
+	IncludeRevoked bool  `json:"include_revoked"`
+}
+
+// RotateApiKeyReq 轮换服务密钥请求
+type RotateApiKeyReq struct {
+	KeyId        string `json:"key_id" validate:"required"`
+	GraceSeconds int64  `json:"grace_seconds" validate:"min=0,max=604800"` // 旧密钥继续有效的秒数，最长 7 天
+}
+
+// RevokeApiKeyReq 吊销服务密钥请求
+type RevokeApiKeyReq struct {
+	KeyId string `json:"key_id" validate:"required"`
+}
+
+// BindCallerKeyReq 登记客户端 key 归属用户请求，只影响之后写入的模型调用日志
+type BindCallerKeyReq struct {
+	CallerKey string `json:"caller_key" validate:"required,max=128"`
+	UserId    int64  `json:"user_id" validate:"required,min=1"`
+}
+
+// UnbindCallerKeyReq 取消客户端 key 归属请求
+type UnbindCallerKeyReq struct {
+	CallerKey string `json:"caller_key" validate:"required"`
+}
+
+// GetCallerKeyListReq 获取客户端 key 归属列表请求
+type GetCallerKeyListReq struct {
+	UserId int64 `json:"user_id"` // 0 为全部用户
+}
+
+// SaveRoleReq 创建或更新角色请求，按名称更新已有角色
+type SaveRoleReq struct {
+	Name        string   `json:"name" validate:"required,max=64"`
+	Description string   `json:"description" validate:"max=255"`
+	Scopes      []string `json:"scopes" validate:"required,min=1"` // read:api / stats:* / admin:retention 等
+	MaskFields  []string `json:"mask_fields"`                      // 返回结果中隐藏的列，如 request_body、response_body、caller_key
+}
+
+// DeleteRoleReq 删除角色请求，同时解除该角色的全部绑定
+type DeleteRoleReq struct {
+	Name string `json:"name" validate:"required"`
+}
+
+// GetRoleListReq 获取角色列表请求
+type GetRoleListReq struct{}
+
+// BindUserRoleReq 为用户绑定角色请求
+type BindUserRoleReq struct {
+	UserId int64  `json:"user_id" validate:"required,min=1"`
+	Role   string `json:"role" validate:"required"`
+}
+
+// UnbindUserRoleReq 解除用户角色请求
+type UnbindUserRoleReq struct {
+	UserId int64  `json:"user_id" validate:"required,min=1"`
+	Role   string `json:"role" validate:"required"`
+}
+
+// GetUserRoleListReq 获取用户角色绑定列表请求
+type GetUserRoleListReq struct {
+	UserId int64 `json:"user_id"` // 0 为全部用户
+}
+
+// GetAuditEventListReq 查询审计记录请求，按时间从新到旧
+type GetAuditEventListReq struct {
+	UserId    int64  `json:"user_id"` // 0 为全部调用方
+	KeyId     string `json:"key_id"`
+	Action    string `json:"action"`     // 接口名，如 getApiLogDetail
+	StartTime int64  `json:"start_time"` // 秒级时间戳
+	EndTime   int64  `json:"end_time"`
+	Skip      int    `json:"skip" validate:"min=0"`
+	Limit     int    `json:"limit" validate:"min=0,max=1000"` // 默认 50
+}
+
+// GetRateLimitUsageReq 查询限流与写入配额用量请求，user_id、key_id 与 caller_key 需要 admin:quota，否则按调用方自己查询
+type GetRateLimitUsageReq struct {
+	UserId    int64  `json:"user_id"`                                // 租户，查询每日写入用量与该用户的令牌桶
+	KeyId     string `json:"key_id"`                                 // 非空时查询该服务密钥的令牌桶，user_id 为 0 时同时查询其写入用量
+	CallerKey string `json:"caller_key"`                             // 非空时同时查询该 caller_key 的令牌桶
+	Day       string `json:"day" validate:"omitempty,len=8,numeric"` // YYYYMMDD，默认今天
+}
+
+// VerifyHashChainReq 校验哈希链请求
+type VerifyHashChainReq struct {
+	LogType string `json:"log_type" validate:"required,oneof=api call"`
+	Day     string `json:"day" validate:"omitempty,len=8,numeric"` // YYYYMMDD，log_type 为 call 时必填
+	FromSeq int64  `json:"from_seq" validate:"min=0"`              // 0 为现存的第一行
+	ToSeq   int64  `json:"to_seq" validate:"min=0"`                // 0 为链头
 }
@@ -1,26 +1,222 @@
 package responses
 
-import "github.com/stardustagi/TopModelsLogs/models"
+import (
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+	"github.com/stardustagi/TopModelsLogs/models"
+)
 
 // DefaultResponse 默认响应
 type DefaultResponse struct {
 	Message string `json:"message"`
 }
 
+// ValidationErrorResp 参数校验失败时随错误码返回，逐项列出不合法的参数
+type ValidationErrorResp struct {
+	Errors []storage.FieldError `json:"errors"`
+}
+
+// QueryLimitResp 查询超出护栏上限时随错误码返回，说明触发的上限
+type QueryLimitResp struct {
+	Limit *storage.LimitError `json:"limit"`
+}
+
+// ExplainResp 请求带 explain 时返回查询的执行计划
+type ExplainResp struct {
+	Explain *storage.ExplainPlan `json:"explain"`
+}
+
 // GetApiLogListResp 获取API日志列表响应
 type GetApiLogListResp struct {
-	Logs  []models.ApiLog `json:"logs"`
-	Total int             `json:"total"`
+	Logs       []storage.Projected[models.ApiLog] `json:"logs"`        // 只包含 fields 选择的列
+	Total      int                                `json:"total"`       // count_mode 为 none 时为 -1
+	TotalExact bool                               `json:"total_exact"` // approx / capped 模式下为估算值或下限
+	NextCursor string                             `json:"next_cursor"` // 下一页游标，为空表示没有更多数据
 }
 
 // GetModelTrainingLogListResp 获取模型训练日志列表响应
 type GetModelTrainingLogListResp struct {
-	Logs  []models.ModelTrainingLog `json:"logs"`
-	Total int                       `json:"total"`
+	Logs       []storage.Projected[models.ModelTrainingLog] `json:"logs"`        // 只包含 fields 选择的列
+	Total      int                                          `json:"total"`       // count_mode 为 none 时为 -1
+	TotalExact bool                                         `json:"total_exact"` // approx / capped 模式下为估算值或下限
+	NextCursor string                                       `json:"next_cursor"` // 下一页游标，为空表示没有更多数据
 }
 
 // GetModelsCallLogListResp 获取模型调用日志列表响应
 type GetModelsCallLogListResp struct {
-	Logs  []models.StatusReport `json:"logs"`
-	Total int                   `json:"total"`
+	Logs       []storage.Projected[models.StatusReport] `json:"logs"`        // 只包含 fields 选择的列
+	Total      int                                      `json:"total"`       // count_mode 为 none 时为 -1
+	TotalExact bool                                     `json:"total_exact"` // approx / capped 模式下为估算值或下限
+	NextCursor string                                   `json:"next_cursor"` // 下一页游标，为空表示没有更多数据
+}
+
+// GetModelsCallLogStatsResp 获取模型调用日志统计响应
+type GetModelsCallLogStatsResp struct {
+	Total           int64   `json:"total"`
+	Failed          int64   `json:"failed"`
+	AvgLatency      float64 `json:"avg_latency"`
+	AvgTokensPerSec float64 `json:"avg_tokens_per_sec"`
+	P50Latency      float64 `json:"p50_latency"`
+	P95Latency      float64 `json:"p95_latency"`
+	P99Latency      float64 `json:"p99_latency"`
+}
+
+// GetApiLogStatsResp 获取API日志统计响应
+type GetApiLogStatsResp struct {
+	Total       int64   `json:"total"`
+	Failed      int64   `json:"failed"`
+	AvgDuration float64 `json:"avg_duration"`
+	P50Duration float64 `json:"p50_duration"`
+	P95Duration float64 `json:"p95_duration"`
+	P99Duration float64 `json:"p99_duration"`
+}
+
+// GetModelTrainingLogStatsResp 获取模型训练日志统计响应
+type GetModelTrainingLogStatsResp struct {
+	Total       int64   `json:"total"`
+	Errors      int64   `json:"errors"`
+	AvgLoss     float64 `json:"avg_loss"`
+	MinLoss     float64 `json:"min_loss"`
+	MaxAccuracy float64 `json:"max_accuracy"`
+	MaxEpoch    int64   `json:"max_epoch"`
+}
+
+// PurgeLogsResp 清理过期日志响应
+type PurgeLogsResp struct {
+	Before        int64    `json:"before"` // 清理截止时间（秒）
+	ApiLogs       int64    `json:"api_logs"`
+	TrainingLogs  int64    `json:"training_logs"`
+	DroppedShards []string `json:"dropped_shards"`
+}
+
+// GetSpoolStatusResp 查看本地缓冲响应
+type GetSpoolStatusResp struct {
+	Enabled bool                  `json:"enabled"`
+	Stats   storage.SpoolStats    `json:"stats"`
+	Records []storage.SpoolRecord `json:"records"`
+}
+
+// ApiLogSearchHit API日志检索结果
+type ApiLogSearchHit struct {
+	Log      storage.Projected[models.ApiLog] `json:"log"`
+	Score    float64                          `json:"score"`
+	Snippets map[string][]string              `json:"snippets"` // 字段名 -> 摘要，命中词以 <em></em> 标出
+}
+
+// SearchApiLogsResp 检索API日志响应
+type SearchApiLogsResp struct {
+	Hits       []ApiLogSearchHit `json:"hits"`
+	Total      int               `json:"total"`
+	TotalExact bool              `json:"total_exact"`
+}
+
+// CallLogSearchHit 模型调用日志检索结果
+type CallLogSearchHit struct {
+	Log      storage.Projected[models.StatusReport] `json:"log"`
+	Score    float64                                `json:"score"`
+	Snippets map[string][]string                    `json:"snippets"`
+}
+
+// SearchModelsCallLogsResp 检索模型调用日志响应
+type SearchModelsCallLogsResp struct {
+	Hits       []CallLogSearchHit `json:"hits"`
+	Total      int                `json:"total"`
+	TotalExact bool               `json:"total_exact"`
+}
+
+// GetLogFacetsResp 获取日志取值分布响应，时间范围为补全默认值后实际统计的范围
+type GetLogFacetsResp struct {
+	Facets    map[string]*storage.Facet `json:"facets"`
+	StartTime int64                     `json:"start_time"`
+	EndTime   int64                     `json:"end_time"`
+}
+
+// GetLogHistogramResp 获取日志时间分布响应
+type GetLogHistogramResp struct {
+	storage.Histogram
+	StartTime int64 `json:"start_time"`
+	EndTime   int64 `json:"end_time"`
+}
+
+// ApiKeyInfo 服务密钥信息，不含密钥哈希
+type ApiKeyInfo struct {
+	KeyId         string   `json:"key_id"`
+	Name          string   `json:"name"`
+	UserId        int64    `json:"user_id"`
+	Scopes        []string `json:"scopes"`
+	AllowedIps    []string `json:"allowed_ips"`
+	ExpiresAt     int64    `json:"expires_at"`
+	RevokedAt     int64    `json:"revoked_at"`
+	PrevExpiresAt int64    `json:"prev_expires_at"` // 轮换前的密钥失效时间，0 为已失效
+	CreatedBy     int64    `json:"created_by"`
+	CreatedAt     int64    `json:"created_at"`
+	UpdatedAt     int64    `json:"updated_at"`
+}
+
+// ApiKeySecretResp 创建、轮换服务密钥响应，明文密钥只返回这一次
+type ApiKeySecretResp struct {
+	Key    string     `json:"key"`
+	ApiKey ApiKeyInfo `json:"api_key"`
+}
+
+// GetApiKeyListResp 获取服务密钥列表响应
+type GetApiKeyListResp struct {
+	Keys []ApiKeyInfo `json:"keys"`
+}
+
+// GetCallerKeyListResp 获取客户端 key 归属列表响应
+type GetCallerKeyListResp struct {
+	Owners []models.CallerKeyOwner `json:"owners"`
+}
+
+// GetRoleListResp 获取角色列表响应
+type GetRoleListResp struct {
+	Roles []models.Role `json:"roles"`
+}
+
+// UserRoleInfo 用户角色绑定
+type UserRoleInfo struct {
+	UserId    int64  `json:"user_id"`
+	Role      string `json:"role"`
+	CreatedBy int64  `json:"created_by"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// GetUserRoleListResp 获取用户角色绑定列表响应
+type GetUserRoleListResp struct {
+	Bindings []UserRoleInfo `json:"bindings"`
+}
+
+// GetAuditEventListResp 查询审计记录响应
+type GetAuditEventListResp struct {
+	Events []models.AuditEvent `json:"events"`
+	Total  int64               `json:"total"`
+}
+
+// RateBucketInfo 令牌桶状态
+type RateBucketInfo struct {
+	Group   string  `json:"group"` // ingest / read / stats / admin / caller_key
+	Subject string  `json:"subject"`
+	Tokens  float64 `json:"tokens"` // 当前可用的令牌数
+	Rate    float64 `json:"rate"`
+	Burst   int64   `json:"burst"`
+}
+
+// GetRateLimitUsageResp 查询限流与写入配额用量响应
+type GetRateLimitUsageResp struct {
+	Enabled    bool             `json:"enabled"`
+	Day        string           `json:"day"`
+	UserId     int64            `json:"user_id"`
+	KeyId      string           `json:"key_id"` // user_id 为 0 时按该服务密钥统计写入用量
+	Rows       int64            `json:"rows"`
+	Bytes      int64            `json:"bytes"`
+	DailyRows  int64            `json:"daily_rows"`  // 上限，0 表示不限
+	DailyBytes int64            `json:"daily_bytes"` // 上限，0 表示不限
+	Buckets    []RateBucketInfo `json:"buckets"`
+}
+
+// VerifyHashChainResp 校验哈希链响应
+type VerifyHashChainResp struct {
+	PublicKey  string               `json:"public_key"`  // 当前检查点签名公钥，base64
+	PublicKeys map[string]string    `json:"public_keys"` // 按密钥标识的全部公钥，含已轮换的旧公钥
+	Report     *storage.ChainReport `json:"report"`
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/stardustagi/TopModelsLogs/backend/storage"
+)
+
+// verifyChain verify-chain 命令：校验哈希链并输出 JSON 报告，校验不通过时以状态码 1 退出
+//
+//	runConfig=config/prod.toml topLogs verify-chain -type api -from 1 -to 0
+func verifyChain(args []string) int {
+	fs := flag.NewFlagSet("verify-chain", flag.ExitOnError)
+	logType := fs.String("type", "api", "日志类型：api 或 call")
+	day := fs.String("day", "", "模型调用日志的日分片 YYYYMMDD")
+	from := fs.Int64("from", 0, "起始序号，0 为现存的第一行")
+	to := fs.Int64("to", 0, "结束序号，0 为链头")
+	_ = fs.Parse(args)
+
+	chain := storage.GetHashChain()
+	if chain == nil {
+		fmt.Fprintln(os.Stderr, "hash chain is not enabled: set [storage.hash_chain] enabled = true")
+		return 2
+	}
+	table, err := chain.ChainTable(*logType, *day)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	report, err := chain.Verify(context.Background(), table, *from, *to)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(struct {
+		PublicKey  string               `json:"public_key"`
+		PublicKeys map[string]string    `json:"public_keys"`
+		Report     *storage.ChainReport `json:"report"`
+	}{chain.PublicKey(), chain.PublicKeys(), report})
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}